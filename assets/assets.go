@@ -0,0 +1,112 @@
+// Package assets combines a file store and imgproxy to store uploads and build URLs for thumbnails and downloads.
+package assets
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"time"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/imgproxy"
+	"github.com/networkteam/filestore/upload"
+)
+
+// ErrDownloadURLUnsupported is returned by DownloadURL if the store does not implement filestore.DownloadURLer
+// and no download URL func is set.
+var ErrDownloadURLUnsupported = errors.New("store does not support download URLs")
+
+// ErrPublicURLUnsupported is returned by PublicURL if the store does not implement filestore.PublicURLer.
+var ErrPublicURLUnsupported = errors.New("store does not support public URLs")
+
+// DownloadURLFunc builds a download URL for stores that cannot build download URLs themselves
+// (e.g. a local store served by an application handler).
+type DownloadURLFunc func(ctx context.Context, hash, filename string, expiry time.Duration) (string, error)
+
+// Service stores uploads in a file store and builds thumbnail and download URLs.
+type Service struct {
+	store           filestore.FileStore
+	imgproxy        *imgproxy.Service
+	downloadURLFunc DownloadURLFunc
+}
+
+type options struct {
+	downloadURLFunc DownloadURLFunc
+}
+
+// Option is a functional option for creating an assets service.
+type Option func(*options)
+
+// WithDownloadURLFunc sets a func to build download URLs.
+// It is used instead of filestore.DownloadURLer of the store.
+func WithDownloadURLFunc(fn DownloadURLFunc) Option {
+	return func(opts *options) {
+		opts.downloadURLFunc = fn
+	}
+}
+
+// NewService creates a new assets service for the store and imgproxy service.
+func NewService(store filestore.FileStore, imgproxyService *imgproxy.Service, opts ...Option) *Service {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return &Service{
+		store:           store,
+		imgproxy:        imgproxyService,
+		downloadURLFunc: o.downloadURLFunc,
+	}
+}
+
+// ThumbnailURL returns an imgproxy URL for the stored image with the given hash.
+func (s *Service) ThumbnailURL(ctx context.Context, hash string, params imgproxy.Parameters) (string, error) {
+	sourceURL, err := s.store.ImgproxyURLSource(hash)
+	if err != nil {
+		return "", fmt.Errorf("getting imgproxy source URL: %w", err)
+	}
+
+	thumbnailURL, err := s.imgproxy.ImageURL(sourceURL, params)
+	if err != nil {
+		return "", fmt.Errorf("building image URL: %w", err)
+	}
+	return thumbnailURL, nil
+}
+
+// DownloadURL returns a URL to download the file with the given hash as an attachment with the given filename.
+// The URL is valid for the given expiry.
+func (s *Service) DownloadURL(ctx context.Context, hash, filename string, expiry time.Duration) (string, error) {
+	if s.downloadURLFunc != nil {
+		return s.downloadURLFunc(ctx, hash, filename, expiry)
+	}
+
+	downloadURLer, ok := s.store.(filestore.DownloadURLer)
+	if !ok {
+		return "", ErrDownloadURLUnsupported
+	}
+	return downloadURLer.DownloadURL(ctx, hash, filename, expiry)
+}
+
+// PublicURL returns the stable public URL of the file with the given hash (e.g. to render asset links in templates).
+func (s *Service) PublicURL(hash string) (string, error) {
+	publicURLer, ok := s.store.(filestore.PublicURLer)
+	if !ok {
+		return "", ErrPublicURLUnsupported
+	}
+	return publicURLer.PublicURL(hash)
+}
+
+// StoreUpload stores an uploaded file of a multipart form and returns its hash.
+// The size, content type and filename of the header are passed to the store (e.g. as S3 object metadata).
+func (s *Service) StoreUpload(ctx context.Context, file multipart.File, header *multipart.FileHeader) (hash string, err error) {
+	result, err := upload.Store(ctx, s.store, file, upload.Metadata{
+		ContentType: header.Header.Get("Content-Type"),
+		Filename:    header.Filename,
+		Size:        header.Size,
+	}, 0)
+	if err != nil {
+		return "", err
+	}
+	return result.Hash, nil
+}
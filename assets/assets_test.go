@@ -0,0 +1,87 @@
+package assets_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/assets"
+	"github.com/networkteam/filestore/imgproxy"
+	"github.com/networkteam/filestore/memory"
+)
+
+func TestService(t *testing.T) {
+	ctx := context.Background()
+
+	store := memory.NewFilestore()
+	imgproxyService, err := imgproxy.NewService("http://imgproxy.example.com")
+	require.NoError(t, err)
+
+	svc := assets.NewService(store, imgproxyService)
+
+	file, header := uploadFile(t, "image.png", "image/png", "PNG content")
+	hash, err := svc.StoreUpload(ctx, file, header)
+	require.NoError(t, err)
+
+	info, err := store.Stat(ctx, hash)
+	require.NoError(t, err)
+	assert.Equal(t, filestore.ObjectInfo{
+		Hash:               hash,
+		Size:               11,
+		ContentType:        "image/png",
+		ContentDisposition: `attachment; filename="image.png"`,
+	}, info)
+
+	thumbnailURL, err := svc.ThumbnailURL(ctx, hash, imgproxy.Parameters{Width: 100})
+	require.NoError(t, err)
+	assert.Equal(t, "http://imgproxy.example.com/insecure/resize:auto:100:0:0/"+base64.RawURLEncoding.EncodeToString([]byte("memory://"+hash)), thumbnailURL)
+
+	_, err = svc.DownloadURL(ctx, hash, "image.png", time.Hour)
+	assert.ErrorIs(t, err, assets.ErrDownloadURLUnsupported)
+
+	svc = assets.NewService(store, imgproxyService, assets.WithDownloadURLFunc(func(ctx context.Context, hash, filename string, expiry time.Duration) (string, error) {
+		return "https://example.com/assets/" + hash + "?filename=" + filename, nil
+	}))
+	downloadURL, err := svc.DownloadURL(ctx, hash, "image.png", time.Hour)
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/assets/"+hash+"?filename=image.png", downloadURL)
+
+	_, err = svc.PublicURL(hash)
+	assert.ErrorIs(t, err, assets.ErrPublicURLUnsupported)
+}
+
+// uploadFile parses a multipart form with a single file and returns the file and header.
+func uploadFile(t *testing.T, filename, contentType, content string) (multipart.File, *multipart.FileHeader) {
+	t.Helper()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	partHeader := make(map[string][]string)
+	partHeader["Content-Disposition"] = []string{`form-data; name="file"; filename="` + filename + `"`}
+	partHeader["Content-Type"] = []string{contentType}
+	part, err := mw.CreatePart(partHeader)
+	require.NoError(t, err)
+	_, err = part.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, mw.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+
+	file, header, err := req.FormFile("file")
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = file.Close()
+	})
+
+	return file, header
+}
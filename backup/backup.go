@@ -0,0 +1,448 @@
+// Package backup creates incremental backups of a file store in a directory and restores them.
+//
+// A backup directory contains the content of all backed up files in "objects" (named by the key of the file) and a
+// manifest per backup in "manifests". Since files are content addressed, a file is only copied once and later
+// backups only copy files that are not in the directory yet.
+package backup
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/hashing"
+	"github.com/networkteam/filestore/internal/parallel"
+)
+
+const (
+	objectsDirName   = "objects"
+	manifestsDirName = "manifests"
+	manifestExt      = ".json"
+	// manifestTimeFormat sorts manifest names by creation time.
+	manifestTimeFormat = "20060102T150405.000000000Z"
+)
+
+var (
+	// ErrNoManifest is returned if a backup directory has no manifest.
+	ErrNoManifest = errors.New("no backup manifest")
+	// ErrInvalidKey is returned for keys of files that cannot be used as a file name.
+	ErrInvalidKey = errors.New("invalid key")
+)
+
+// A Store is a file store that can be backed up.
+type Store interface {
+	filestore.Fetcher
+	filestore.Iterator
+}
+
+// Manifest lists the files of a backup.
+type Manifest struct {
+	// Created is the time the backup was started.
+	Created time.Time `json:"created"`
+	Objects []Object  `json:"objects"`
+}
+
+// Object is a file in a backup.
+type Object struct {
+	// Key is the key (hash) of the file in the backed up store.
+	Key  string `json:"key"`
+	Size int64  `json:"size"`
+	// SHA256 is the hex encoded SHA256 hash of the content, used for verification.
+	SHA256             string `json:"sha256"`
+	ContentType        string `json:"contentType,omitempty"`
+	ContentDisposition string `json:"contentDisposition,omitempty"`
+}
+
+// Result describes a backup or restore.
+type Result struct {
+	// Manifest is the name of the manifest of the backup.
+	Manifest string
+	// Objects is the number of files in the backup.
+	Objects int
+	// Copied is the number of copied files, the other files were already in the backup directory or store.
+	Copied int
+	// CopiedBytes is the total size of the copied files.
+	CopiedBytes int64
+}
+
+type options struct {
+	workers int
+}
+
+// Option is a functional option for Backup, Restore and Verify.
+type Option func(*options)
+
+// WithWorkers sets the number of files copied or verified concurrently (defaults to 1).
+func WithWorkers(workers int) Option {
+	return func(opts *options) {
+		opts.workers = workers
+	}
+}
+
+// Backup copies all files of store that are not in the backup directory yet to dir and writes a manifest of all files.
+// Content type and disposition are kept in the manifest if store implements filestore.Stater or
+// filestore.InfoFetcher. Files removed while the backup runs are skipped.
+func Backup(ctx context.Context, store Store, dir string, opts ...Option) (Result, error) {
+	o := options{workers: 1}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	created := time.Now().UTC()
+	for _, d := range []string{objectsDirName, manifestsDirName} {
+		if err := os.MkdirAll(filepath.Join(dir, d), 0755); err != nil {
+			return Result{}, fmt.Errorf("creating backup directory: %w", err)
+		}
+	}
+
+	// The latest manifest is used to skip hashing files that were already backed up
+	previous := make(map[string]Object)
+	if manifest, _, err := ReadManifest(dir, ""); err == nil {
+		for _, object := range manifest.Objects {
+			previous[object.Key] = object
+		}
+	} else if !errors.Is(err, ErrNoManifest) {
+		return Result{}, err
+	}
+
+	var keys []string
+	err := store.Iterate(ctx, 1000, func(hashes []string) error {
+		keys = append(keys, hashes...)
+		return nil
+	})
+	if err != nil {
+		return Result{}, fmt.Errorf("iterating files: %w", err)
+	}
+
+	var (
+		mx      sync.Mutex
+		result  Result
+		objects = make([]Object, 0, len(keys))
+	)
+	err = parallel.ForEach(ctx, keys, o.workers, func(ctx context.Context, key string) error {
+		object, copied, err := backupObject(ctx, store, dir, key, previous)
+		if errors.Is(err, filestore.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("backing up %s: %w", key, err)
+		}
+
+		mx.Lock()
+		defer mx.Unlock()
+		objects = append(objects, object)
+		if copied {
+			result.Copied++
+			result.CopiedBytes += object.Size
+		}
+		return nil
+	})
+	if err != nil {
+		return Result{}, err
+	}
+
+	sort.Slice(objects, func(i, j int) bool {
+		return objects[i].Key < objects[j].Key
+	})
+	manifest := Manifest{
+		Created: created,
+		Objects: objects,
+	}
+	result.Manifest = created.Format(manifestTimeFormat)
+	result.Objects = len(objects)
+	if err = writeManifest(dir, result.Manifest, manifest); err != nil {
+		return Result{}, err
+	}
+
+	return result, nil
+}
+
+func backupObject(ctx context.Context, store Store, dir, key string, previous map[string]Object) (object Object, copied bool, err error) {
+	objectPath, err := objectPath(dir, key)
+	if err != nil {
+		return Object{}, false, err
+	}
+
+	existing, statErr := os.Stat(objectPath)
+	if statErr == nil {
+		if object, ok := previous[key]; ok {
+			return object, false, nil
+		}
+	}
+
+	r, info, err := filestore.FetchInfo(ctx, store, key)
+	if err != nil {
+		return Object{}, false, err
+	}
+	defer r.Close()
+
+	object = Object{
+		Key:                key,
+		ContentType:        info.ContentType,
+		ContentDisposition: info.ContentDisposition,
+	}
+
+	if statErr == nil {
+		// The file was copied by an interrupted backup, so only the hash is needed
+		object.SHA256, err = hashing.HashFile(objectPath)
+		if err != nil {
+			return Object{}, false, fmt.Errorf("hashing backup file: %w", err)
+		}
+		object.Size = existing.Size()
+		return object, false, nil
+	}
+
+	hashingReader := hashing.NewHashingReader(r)
+	if err = writeFile(objectPath, hashingReader); err != nil {
+		return Object{}, false, err
+	}
+	object.Size = hashingReader.BytesRead()
+	object.SHA256 = hashingReader.SumHex()
+
+	return object, true, nil
+}
+
+// Restore stores all files of a backup in store with their key. Files that already exist in store are skipped if
+// store implements filestore.Exister. If manifest is empty, the latest backup is restored.
+func Restore(ctx context.Context, dir, manifest string, store filestore.HashedStorer, opts ...Option) (Result, error) {
+	o := options{workers: 1}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	m, name, err := ReadManifest(dir, manifest)
+	if err != nil {
+		return Result{}, err
+	}
+
+	var (
+		mx     sync.Mutex
+		result = Result{Manifest: name, Objects: len(m.Objects)}
+	)
+	err = parallel.ForEach(ctx, m.Objects, o.workers, func(ctx context.Context, object Object) error {
+		if exister, ok := store.(filestore.Exister); ok {
+			exists, err := exister.Exists(ctx, object.Key)
+			if err != nil {
+				return fmt.Errorf("checking %s: %w", object.Key, err)
+			}
+			if exists {
+				return nil
+			}
+		}
+
+		if err := restoreObject(ctx, dir, object, store); err != nil {
+			return fmt.Errorf("restoring %s: %w", object.Key, err)
+		}
+
+		mx.Lock()
+		defer mx.Unlock()
+		result.Copied++
+		result.CopiedBytes += object.Size
+		return nil
+	})
+	if err != nil {
+		return Result{}, err
+	}
+
+	return result, nil
+}
+
+func restoreObject(ctx context.Context, dir string, object Object, store filestore.HashedStorer) error {
+	objectPath, err := objectPath(dir, object.Key)
+	if err != nil {
+		return err
+	}
+	f, err := os.Open(objectPath)
+	if err != nil {
+		return fmt.Errorf("opening backup file: %w", err)
+	}
+	defer f.Close()
+
+	return store.StoreHashed(ctx, filestore.NewReader(
+		f,
+		filestore.WithSize(object.Size),
+		filestore.WithContentType(object.ContentType),
+		filestore.WithContentDisposition(object.ContentDisposition),
+	), object.Key)
+}
+
+// VerifyResult describes the files of a backup that failed verification.
+type VerifyResult struct {
+	// Missing are the keys of files that are not in the backup directory.
+	Missing []string
+	// Corrupt are the keys of files with a different size or hash than in the manifest.
+	Corrupt []string
+}
+
+// OK returns true if no files failed verification.
+func (r VerifyResult) OK() bool {
+	return len(r.Missing) == 0 && len(r.Corrupt) == 0
+}
+
+// Verify checks the size and hash of all files of a backup. If manifest is empty, the latest backup is verified.
+func Verify(ctx context.Context, dir, manifest string, opts ...Option) (VerifyResult, error) {
+	o := options{workers: 1}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	m, _, err := ReadManifest(dir, manifest)
+	if err != nil {
+		return VerifyResult{}, err
+	}
+
+	var (
+		mx     sync.Mutex
+		result VerifyResult
+	)
+	err = parallel.ForEach(ctx, m.Objects, o.workers, func(ctx context.Context, object Object) error {
+		objectPath, err := objectPath(dir, object.Key)
+		if err != nil {
+			return err
+		}
+
+		var missing, corrupt bool
+		fi, err := os.Stat(objectPath)
+		switch {
+		case errors.Is(err, fs.ErrNotExist):
+			missing = true
+		case err != nil:
+			return fmt.Errorf("stat backup file: %w", err)
+		case fi.Size() != object.Size:
+			corrupt = true
+		default:
+			sha256, err := hashing.HashFile(objectPath)
+			if err != nil {
+				return fmt.Errorf("hashing backup file: %w", err)
+			}
+			corrupt = sha256 != object.SHA256
+		}
+
+		mx.Lock()
+		defer mx.Unlock()
+		if missing {
+			result.Missing = append(result.Missing, object.Key)
+		}
+		if corrupt {
+			result.Corrupt = append(result.Corrupt, object.Key)
+		}
+		return nil
+	})
+	if err != nil {
+		return VerifyResult{}, err
+	}
+
+	sort.Strings(result.Missing)
+	sort.Strings(result.Corrupt)
+	return result, nil
+}
+
+// Manifests returns the names of all manifests in a backup directory, oldest first.
+func Manifests(dir string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(dir, manifestsDirName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading manifests: %w", err)
+	}
+
+	var names []string
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || strings.HasPrefix(name, ".") || !strings.HasSuffix(name, manifestExt) {
+			continue
+		}
+		names = append(names, strings.TrimSuffix(name, manifestExt))
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+// ReadManifest reads a manifest by name and returns it with its name. If name is empty, the latest manifest is read.
+// ErrNoManifest is returned if there is no manifest.
+func ReadManifest(dir, name string) (Manifest, string, error) {
+	if name == "" {
+		names, err := Manifests(dir)
+		if err != nil {
+			return Manifest{}, "", err
+		}
+		if len(names) == 0 {
+			return Manifest{}, "", ErrNoManifest
+		}
+		name = names[len(names)-1]
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, manifestsDirName, name+manifestExt))
+	if errors.Is(err, fs.ErrNotExist) {
+		return Manifest{}, "", fmt.Errorf("%w: %s", ErrNoManifest, name)
+	}
+	if err != nil {
+		return Manifest{}, "", fmt.Errorf("reading manifest: %w", err)
+	}
+
+	var manifest Manifest
+	if err = json.Unmarshal(data, &manifest); err != nil {
+		return Manifest{}, "", fmt.Errorf("decoding manifest: %w", err)
+	}
+	return manifest, name, nil
+}
+
+func writeManifest(dir, name string, manifest Manifest) error {
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding manifest: %w", err)
+	}
+	if err = writeFile(filepath.Join(dir, manifestsDirName, name+manifestExt), bytes.NewReader(data)); err != nil {
+		return fmt.Errorf("writing manifest: %w", err)
+	}
+	return nil
+}
+
+// objectPath returns the path of a file in the backup directory, sharded by the first two characters of the key.
+func objectPath(dir, key string) (string, error) {
+	if len(key) < 2 || strings.HasPrefix(key, ".") || strings.ContainsAny(key, `/\`) {
+		return "", fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	return filepath.Join(dir, objectsDirName, key[:2], key), nil
+}
+
+// writeFile writes the content of r to a temporary file and renames it to path after it was synced, so incomplete
+// files are never visible.
+func writeFile(path string, r io.Reader) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return fmt.Errorf("creating directory: %w", err)
+	}
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return fmt.Errorf("creating temp file: %w", err)
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err = filestore.Copy(tmpFile, r); err != nil {
+		_ = tmpFile.Close()
+		return fmt.Errorf("writing temp file: %w", err)
+	}
+	if err = tmpFile.Sync(); err != nil {
+		_ = tmpFile.Close()
+		return fmt.Errorf("syncing temp file: %w", err)
+	}
+	if err = tmpFile.Close(); err != nil {
+		return fmt.Errorf("closing temp file: %w", err)
+	}
+	if err = os.Rename(tmpFile.Name(), path); err != nil {
+		return fmt.Errorf("renaming temp file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,105 @@
+package backup_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/backup"
+	"github.com/networkteam/filestore/memory"
+)
+
+func TestBackup(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+
+	store := memory.NewFilestore()
+	hash, err := store.Store(ctx, filestore.NewReader(strings.NewReader("Hello World"), filestore.WithContentType("text/plain")))
+	require.NoError(t, err)
+	_, err = store.Store(ctx, strings.NewReader("Other content"))
+	require.NoError(t, err)
+
+	result, err := backup.Backup(ctx, store, dir, backup.WithWorkers(2))
+	require.NoError(t, err)
+	assert.Equal(t, 2, result.Objects)
+	assert.Equal(t, 2, result.Copied)
+	assert.Equal(t, int64(24), result.CopiedBytes)
+
+	t.Run("incremental", func(t *testing.T) {
+		newHash, err := store.Store(ctx, strings.NewReader("New content"))
+		require.NoError(t, err)
+		require.NoError(t, store.Remove(ctx, hash))
+
+		incremental, err := backup.Backup(ctx, store, dir)
+		require.NoError(t, err)
+		assert.Equal(t, 2, incremental.Objects)
+		assert.Equal(t, 1, incremental.Copied)
+		assert.Equal(t, int64(11), incremental.CopiedBytes)
+
+		manifests, err := backup.Manifests(dir)
+		require.NoError(t, err)
+		assert.Equal(t, []string{result.Manifest, incremental.Manifest}, manifests)
+
+		manifest, _, err := backup.ReadManifest(dir, "")
+		require.NoError(t, err)
+		var keys []string
+		for _, object := range manifest.Objects {
+			keys = append(keys, object.Key)
+		}
+		assert.Contains(t, keys, newHash)
+		assert.NotContains(t, keys, hash)
+	})
+
+	t.Run("Restore", func(t *testing.T) {
+		restored := memory.NewFilestore()
+
+		// Restore the first backup with the removed file
+		restoreResult, err := backup.Restore(ctx, dir, result.Manifest, restored)
+		require.NoError(t, err)
+		assert.Equal(t, 2, restoreResult.Copied)
+
+		info, err := restored.Stat(ctx, hash)
+		require.NoError(t, err)
+		assert.Equal(t, filestore.ObjectInfo{Hash: hash, Size: 11, ContentType: "text/plain"}, info)
+
+		// Existing files are skipped
+		restoreResult, err = backup.Restore(ctx, dir, result.Manifest, restored)
+		require.NoError(t, err)
+		assert.Equal(t, 0, restoreResult.Copied)
+	})
+
+	t.Run("Verify", func(t *testing.T) {
+		verifyResult, err := backup.Verify(ctx, dir, result.Manifest)
+		require.NoError(t, err)
+		assert.True(t, verifyResult.OK())
+
+		objectPath := filepath.Join(dir, "objects", hash[:2], hash)
+		require.NoError(t, os.WriteFile(objectPath, []byte("Hello Wordl"), 0644))
+
+		verifyResult, err = backup.Verify(ctx, dir, result.Manifest)
+		require.NoError(t, err)
+		assert.False(t, verifyResult.OK())
+		assert.Equal(t, []string{hash}, verifyResult.Corrupt)
+		assert.Empty(t, verifyResult.Missing)
+
+		require.NoError(t, os.Remove(objectPath))
+
+		verifyResult, err = backup.Verify(ctx, dir, result.Manifest)
+		require.NoError(t, err)
+		assert.Equal(t, []string{hash}, verifyResult.Missing)
+	})
+}
+
+func TestReadManifest_NoManifest(t *testing.T) {
+	_, _, err := backup.ReadManifest(t.TempDir(), "")
+	assert.ErrorIs(t, err, backup.ErrNoManifest)
+
+	_, err = backup.Restore(context.Background(), t.TempDir(), "", memory.NewFilestore())
+	assert.ErrorIs(t, err, backup.ErrNoManifest)
+}
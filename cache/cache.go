@@ -0,0 +1,136 @@
+// Package cache provides a read-through cache wrapper that keeps fetched files of an origin store (e.g. S3) in a
+// hot store (e.g. a local or bounded in-memory store on an edge node).
+package cache
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/hashicorp/go-multierror"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/internal/parallel"
+)
+
+// DefaultPrefetchConcurrency is the default number of files copied concurrently by Prefetch.
+const DefaultPrefetchConcurrency = 4
+
+// Filestore wraps an origin store and caches fetched files in a hot store. Files are stored in and removed from the
+// origin store, other operations (e.g. Exists and Iterate) use the origin store.
+// Only the methods of filestore.FileStore and filestore.Prefetcher are available on the wrapper.
+type Filestore struct {
+	filestore.FileStore
+
+	hot                 filestore.FileStore
+	prefetchConcurrency int
+}
+
+type options struct {
+	prefetchConcurrency int
+}
+
+// Option is a functional option for creating a caching file store.
+type Option func(*options)
+
+// WithPrefetchConcurrency sets the number of files copied concurrently by Prefetch
+// (defaults to DefaultPrefetchConcurrency).
+func WithPrefetchConcurrency(concurrency int) Option {
+	return func(opts *options) {
+		opts.prefetchConcurrency = concurrency
+	}
+}
+
+var (
+	_ filestore.FileStore  = &Filestore{}
+	_ filestore.Prefetcher = &Filestore{}
+)
+
+// NewFilestore creates a file store that caches files of origin in hot.
+func NewFilestore(origin, hot filestore.FileStore, opts ...Option) *Filestore {
+	o := options{
+		prefetchConcurrency: DefaultPrefetchConcurrency,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return &Filestore{
+		FileStore:           origin,
+		hot:                 hot,
+		prefetchConcurrency: o.prefetchConcurrency,
+	}
+}
+
+// Fetch fetches a file from the hot store. A file that is not cached yet is copied from the origin store to the hot
+// store first.
+func (f *Filestore) Fetch(ctx context.Context, hash string) (io.ReadCloser, error) {
+	r, err := f.hot.Fetch(ctx, hash)
+	if !errors.Is(err, filestore.ErrNotExist) {
+		return r, err
+	}
+
+	if err = f.fill(ctx, hash); err != nil {
+		return nil, err
+	}
+	return f.hot.Fetch(ctx, hash)
+}
+
+// Remove removes a file from the origin store and the hot store.
+func (f *Filestore) Remove(ctx context.Context, hash string) error {
+	if err := f.FileStore.Remove(ctx, hash); err != nil {
+		return err
+	}
+	if err := f.hot.Remove(ctx, hash); err != nil && !errors.Is(err, filestore.ErrNotExist) {
+		return fmt.Errorf("removing cached file: %w", err)
+	}
+	return nil
+}
+
+// Prefetch implements filestore.Prefetcher and copies the files with the given hashes that are not cached yet from
+// the origin store to the hot store (e.g. to warm an edge node before a launch). All hashes are prefetched even if
+// some fail, the errors are returned combined.
+func (f *Filestore) Prefetch(ctx context.Context, hashes []string) error {
+	var (
+		mx     sync.Mutex
+		result error
+	)
+	err := parallel.ForEach(ctx, hashes, f.prefetchConcurrency, func(ctx context.Context, hash string) error {
+		cached, err := f.hot.Exists(ctx, hash)
+		if err == nil && !cached {
+			err = f.fill(ctx, hash)
+		}
+		if err != nil {
+			mx.Lock()
+			result = multierror.Append(result, fmt.Errorf("prefetching %s: %w", hash, err))
+			mx.Unlock()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return result
+}
+
+// fill copies a file with its metadata from the origin store to the hot store.
+func (f *Filestore) fill(ctx context.Context, hash string) error {
+	rc, info, err := filestore.FetchInfo(ctx, f.FileStore, hash)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	err = f.hot.StoreHashed(ctx, filestore.NewReader(
+		rc,
+		filestore.WithSize(info.Size),
+		filestore.WithContentType(info.ContentType),
+		filestore.WithContentDisposition(info.ContentDisposition),
+	), hash)
+	if err != nil {
+		return fmt.Errorf("caching %s: %w", hash, err)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package cache_test
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/cache"
+	"github.com/networkteam/filestore/hashing"
+	"github.com/networkteam/filestore/memory"
+)
+
+func TestFilestore(t *testing.T) {
+	ctx := context.Background()
+	origin := memory.NewFilestore()
+	hot := memory.NewFilestore()
+	store := cache.NewFilestore(origin, hot)
+
+	hash, err := store.Store(ctx, filestore.ContentTypedReader(strings.NewReader("Hello World"), "text/plain"))
+	require.NoError(t, err)
+	assertCached(t, hot, hash, false)
+
+	r, err := store.Fetch(ctx, hash)
+	require.NoError(t, err)
+	content, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	assert.Equal(t, "Hello World", string(content))
+
+	info, err := hot.Stat(ctx, hash)
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain", info.ContentType)
+
+	require.NoError(t, store.Remove(ctx, hash))
+	assertCached(t, hot, hash, false)
+	_, err = store.Fetch(ctx, hash)
+	assert.ErrorIs(t, err, filestore.ErrNotExist)
+}
+
+func TestFilestore_Prefetch(t *testing.T) {
+	ctx := context.Background()
+	origin := memory.NewFilestore()
+	hot := memory.NewFilestore()
+	store := cache.NewFilestore(origin, hot, cache.WithPrefetchConcurrency(2))
+
+	var hashes []string
+	for _, content := range []string{"First", "Second", "Third"} {
+		hash, err := store.Store(ctx, strings.NewReader(content))
+		require.NoError(t, err)
+		hashes = append(hashes, hash)
+	}
+
+	missingHash := hashing.HashBytes([]byte("Missing"))
+	err := store.Prefetch(ctx, append([]string{missingHash}, hashes...))
+	assert.ErrorIs(t, err, filestore.ErrNotExist)
+
+	for _, hash := range hashes {
+		assertCached(t, hot, hash, true)
+	}
+	require.NoError(t, store.Prefetch(ctx, hashes), "prefetching cached files does nothing")
+}
+
+func assertCached(t *testing.T, hot filestore.Exister, hash string, expected bool) {
+	t.Helper()
+
+	cached, err := hot.Exists(context.Background(), hash)
+	require.NoError(t, err)
+	assert.Equal(t, expected, cached)
+}
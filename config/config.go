@@ -0,0 +1,342 @@
+// Package config describes file store backends with a configuration struct, so stores can be constructed from
+// configuration loaded with e.g. viper (mapstructure tags) or env/envconfig (env tags).
+//
+// The struct covers the options that can be expressed as plain values. Options that take Go values (e.g. key
+// derivations, transports, TLS configurations, request observers or eviction callbacks) are not supported, stores
+// needing them have to be constructed in code.
+package config
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/hashing"
+	"github.com/networkteam/filestore/local"
+	"github.com/networkteam/filestore/memory"
+	"github.com/networkteam/filestore/s3"
+)
+
+var (
+	// ErrUnknownBackend is returned by NewFromConfig for an unknown backend.
+	ErrUnknownBackend = errors.New("unknown backend")
+	// ErrInvalidValue is returned by NewFromConfig for an invalid option value (e.g. an unknown bucket lookup).
+	ErrInvalidValue = errors.New("invalid value")
+)
+
+// Backend names.
+const (
+	BackendLocal  = "local"
+	BackendS3     = "s3"
+	BackendMemory = "memory"
+)
+
+// Config selects and configures a file store backend.
+type Config struct {
+	// Backend is one of "local", "s3" or "memory".
+	Backend string       `mapstructure:"backend" env:"BACKEND" envconfig:"BACKEND"`
+	Local   LocalConfig  `mapstructure:"local" envPrefix:"LOCAL_" envconfig:"LOCAL"`
+	S3      S3Config     `mapstructure:"s3" envPrefix:"S3_" envconfig:"S3"`
+	Memory  MemoryConfig `mapstructure:"memory" envPrefix:"MEMORY_" envconfig:"MEMORY"`
+}
+
+// LocalConfig configures a local file store (see local.NewFilestore).
+type LocalConfig struct {
+	AssetsPath  string `mapstructure:"assetsPath" env:"ASSETS_PATH" envconfig:"ASSETS_PATH"`
+	TmpPath     string `mapstructure:"tmpPath" env:"TMP_PATH" envconfig:"TMP_PATH"`
+	PrefixSize  int    `mapstructure:"prefixSize" env:"PREFIX_SIZE" envconfig:"PREFIX_SIZE"`
+	PrefixDepth int    `mapstructure:"prefixDepth" env:"PREFIX_DEPTH" envconfig:"PREFIX_DEPTH"`
+	// FlatLayout stores files without prefix directories (see local.WithFlatLayout).
+	FlatLayout bool `mapstructure:"flatLayout" env:"FLAT_LAYOUT" envconfig:"FLAT_LAYOUT"`
+	// FileMode and DirMode are octal modes like "0640" (see local.WithFileMode and local.WithDirMode).
+	FileMode        string `mapstructure:"fileMode" env:"FILE_MODE" envconfig:"FILE_MODE"`
+	DirMode         string `mapstructure:"dirMode" env:"DIR_MODE" envconfig:"DIR_MODE"`
+	ReadOnly        bool   `mapstructure:"readOnly" env:"READ_ONLY" envconfig:"READ_ONLY"`
+	DurableWrites   bool   `mapstructure:"durableWrites" env:"DURABLE_WRITES" envconfig:"DURABLE_WRITES"`
+	FileLocking     bool   `mapstructure:"fileLocking" env:"FILE_LOCKING" envconfig:"FILE_LOCKING"`
+	MinFreeSpace    uint64 `mapstructure:"minFreeSpace" env:"MIN_FREE_SPACE" envconfig:"MIN_FREE_SPACE"`
+	MaxObjectSize   int64  `mapstructure:"maxObjectSize" env:"MAX_OBJECT_SIZE" envconfig:"MAX_OBJECT_SIZE"`
+	WriteOnce       bool   `mapstructure:"writeOnce" env:"WRITE_ONCE" envconfig:"WRITE_ONCE"`
+	KeepEmptyDirs   bool   `mapstructure:"keepEmptyDirs" env:"KEEP_EMPTY_DIRS" envconfig:"KEEP_EMPTY_DIRS"`
+	IterateSnapshot bool   `mapstructure:"iterateSnapshot" env:"ITERATE_SNAPSHOT" envconfig:"ITERATE_SNAPSHOT"`
+	// KeyEncoding is "hex", "prefixed" or "multihash" (see hashing.ParseKeyEncoding).
+	KeyEncoding string `mapstructure:"keyEncoding" env:"KEY_ENCODING" envconfig:"KEY_ENCODING"`
+	// BloomFilter is the expected number of files of the index (see local.WithBloomFilter).
+	BloomFilter    int    `mapstructure:"bloomFilter" env:"BLOOM_FILTER" envconfig:"BLOOM_FILTER"`
+	PublicURL      string `mapstructure:"publicURL" env:"PUBLIC_URL" envconfig:"PUBLIC_URL"`
+	ImgproxySource string `mapstructure:"imgproxySource" env:"IMGPROXY_SOURCE" envconfig:"IMGPROXY_SOURCE"`
+}
+
+// S3Config configures an S3 file store (see s3.NewFilestore).
+type S3Config struct {
+	Endpoint  string `mapstructure:"endpoint" env:"ENDPOINT" envconfig:"ENDPOINT"`
+	Bucket    string `mapstructure:"bucket" env:"BUCKET" envconfig:"BUCKET"`
+	AccessKey string `mapstructure:"accessKey" env:"ACCESS_KEY" envconfig:"ACCESS_KEY"`
+	SecretKey string `mapstructure:"secretKey" env:"SECRET_KEY" envconfig:"SECRET_KEY"`
+	Region    string `mapstructure:"region" env:"REGION" envconfig:"REGION"`
+	Secure    bool   `mapstructure:"secure" env:"SECURE" envconfig:"SECURE"`
+	// BucketLookup is "dns", "path" or empty for automatic lookup.
+	BucketLookup     string        `mapstructure:"bucketLookup" env:"BUCKET_LOOKUP" envconfig:"BUCKET_LOOKUP"`
+	BucketAutoCreate bool          `mapstructure:"bucketAutoCreate" env:"BUCKET_AUTO_CREATE" envconfig:"BUCKET_AUTO_CREATE"`
+	VerifyChecksum   bool          `mapstructure:"verifyChecksum" env:"VERIFY_CHECKSUM" envconfig:"VERIFY_CHECKSUM"`
+	SkipExisting     bool          `mapstructure:"skipExisting" env:"SKIP_EXISTING" envconfig:"SKIP_EXISTING"`
+	RequesterPays    bool          `mapstructure:"requesterPays" env:"REQUESTER_PAYS" envconfig:"REQUESTER_PAYS"`
+	OperationTimeout time.Duration `mapstructure:"operationTimeout" env:"OPERATION_TIMEOUT" envconfig:"OPERATION_TIMEOUT"`
+	RequestTimeout   time.Duration `mapstructure:"requestTimeout" env:"REQUEST_TIMEOUT" envconfig:"REQUEST_TIMEOUT"`
+	MaxRetries       int           `mapstructure:"maxRetries" env:"MAX_RETRIES" envconfig:"MAX_RETRIES"`
+	RetryBackoff     time.Duration `mapstructure:"retryBackoff" env:"RETRY_BACKOFF" envconfig:"RETRY_BACKOFF"`
+	RetryMaxBackoff  time.Duration `mapstructure:"retryMaxBackoff" env:"RETRY_MAX_BACKOFF" envconfig:"RETRY_MAX_BACKOFF"`
+	LazyBucketCheck  bool          `mapstructure:"lazyBucketCheck" env:"LAZY_BUCKET_CHECK" envconfig:"LAZY_BUCKET_CHECK"`
+	// TransferAcceleration uses the S3 Transfer Acceleration endpoint (see s3.WithTransferAcceleration).
+	TransferAcceleration bool  `mapstructure:"transferAcceleration" env:"TRANSFER_ACCELERATION" envconfig:"TRANSFER_ACCELERATION"`
+	TrailingHeaders      bool  `mapstructure:"trailingHeaders" env:"TRAILING_HEADERS" envconfig:"TRAILING_HEADERS"`
+	MaxObjectSize        int64 `mapstructure:"maxObjectSize" env:"MAX_OBJECT_SIZE" envconfig:"MAX_OBJECT_SIZE"`
+	WriteOnce            bool  `mapstructure:"writeOnce" env:"WRITE_ONCE" envconfig:"WRITE_ONCE"`
+	// KeyEncoding is "hex", "prefixed" or "multihash" (see hashing.ParseKeyEncoding).
+	KeyEncoding string `mapstructure:"keyEncoding" env:"KEY_ENCODING" envconfig:"KEY_ENCODING"`
+	// RetentionMode is "governance" or "compliance" and requires RetentionPeriod (see s3.WithRetention).
+	RetentionMode   string        `mapstructure:"retentionMode" env:"RETENTION_MODE" envconfig:"RETENTION_MODE"`
+	RetentionPeriod time.Duration `mapstructure:"retentionPeriod" env:"RETENTION_PERIOD" envconfig:"RETENTION_PERIOD"`
+	LegalHold       bool          `mapstructure:"legalHold" env:"LEGAL_HOLD" envconfig:"LEGAL_HOLD"`
+	TempPrefix      string        `mapstructure:"tempPrefix" env:"TEMP_PREFIX" envconfig:"TEMP_PREFIX"`
+	PublicURL       string        `mapstructure:"publicURL" env:"PUBLIC_URL" envconfig:"PUBLIC_URL"`
+	ImgproxySource  string        `mapstructure:"imgproxySource" env:"IMGPROXY_SOURCE" envconfig:"IMGPROXY_SOURCE"`
+	// ArchiveStorageClass is the storage class of archived objects (see s3.WithArchiveStorageClass).
+	ArchiveStorageClass string `mapstructure:"archiveStorageClass" env:"ARCHIVE_STORAGE_CLASS" envconfig:"ARCHIVE_STORAGE_CLASS"`
+	// CompatibilityMode enables the compatibility mode for S3 compatible services (see s3.WithCompatibilityMode),
+	// SpoolDir is the directory for spooled uploads.
+	CompatibilityMode bool   `mapstructure:"compatibilityMode" env:"COMPATIBILITY_MODE" envconfig:"COMPATIBILITY_MODE"`
+	SpoolDir          string `mapstructure:"spoolDir" env:"SPOOL_DIR" envconfig:"SPOOL_DIR"`
+}
+
+// MemoryConfig configures an in-memory file store (see memory.NewFilestore).
+type MemoryConfig struct {
+	MaxBytes      int64 `mapstructure:"maxBytes" env:"MAX_BYTES" envconfig:"MAX_BYTES"`
+	MaxObjects    int   `mapstructure:"maxObjects" env:"MAX_OBJECTS" envconfig:"MAX_OBJECTS"`
+	MaxObjectSize int64 `mapstructure:"maxObjectSize" env:"MAX_OBJECT_SIZE" envconfig:"MAX_OBJECT_SIZE"`
+	WriteOnce     bool  `mapstructure:"writeOnce" env:"WRITE_ONCE" envconfig:"WRITE_ONCE"`
+	// KeyEncoding is "hex", "prefixed" or "multihash" (see hashing.ParseKeyEncoding).
+	KeyEncoding string `mapstructure:"keyEncoding" env:"KEY_ENCODING" envconfig:"KEY_ENCODING"`
+}
+
+// NewFromConfig creates the file store of the configured backend.
+func NewFromConfig(ctx context.Context, cfg Config) (filestore.FileStore, error) {
+	switch cfg.Backend {
+	case BackendLocal:
+		return newLocal(cfg.Local)
+	case BackendS3:
+		return newS3(ctx, cfg.S3)
+	case BackendMemory:
+		return newMemory(cfg.Memory)
+	default:
+		return nil, fmt.Errorf("%w: %q", ErrUnknownBackend, cfg.Backend)
+	}
+}
+
+func newLocal(cfg LocalConfig) (*local.Filestore, error) {
+	var opts []local.Option
+	if cfg.ReadOnly {
+		opts = append(opts, local.WithReadOnly())
+	}
+	if cfg.DurableWrites {
+		opts = append(opts, local.WithDurableWrites())
+	}
+	if cfg.FileLocking {
+		opts = append(opts, local.WithFileLocking())
+	}
+	if cfg.MinFreeSpace > 0 {
+		opts = append(opts, local.WithMinFreeSpace(cfg.MinFreeSpace))
+	}
+	if cfg.MaxObjectSize > 0 {
+		opts = append(opts, local.WithMaxObjectSize(cfg.MaxObjectSize))
+	}
+	if cfg.FlatLayout {
+		opts = append(opts, local.WithFlatLayout())
+	}
+	if cfg.WriteOnce {
+		opts = append(opts, local.WithWriteOnce())
+	}
+	if cfg.KeepEmptyDirs {
+		opts = append(opts, local.WithKeepEmptyDirs())
+	}
+	if cfg.IterateSnapshot {
+		opts = append(opts, local.WithIterateSnapshot())
+	}
+	if cfg.BloomFilter > 0 {
+		opts = append(opts, local.WithBloomFilter(cfg.BloomFilter, 0))
+	}
+	if cfg.PublicURL != "" {
+		opts = append(opts, local.WithPublicURL(cfg.PublicURL))
+	}
+	if cfg.ImgproxySource != "" {
+		opts = append(opts, local.WithImgproxySource(cfg.ImgproxySource))
+	}
+	for _, mode := range []struct {
+		name  string
+		value string
+		opt   func(os.FileMode) local.Option
+	}{
+		{"fileMode", cfg.FileMode, local.WithFileMode},
+		{"dirMode", cfg.DirMode, local.WithDirMode},
+	} {
+		if mode.value == "" {
+			continue
+		}
+		parsed, err := strconv.ParseUint(mode.value, 8, 32)
+		if err != nil {
+			return nil, fmt.Errorf("%w: %s %q", ErrInvalidValue, mode.name, mode.value)
+		}
+		opts = append(opts, mode.opt(os.FileMode(parsed)))
+	}
+	if cfg.KeyEncoding != "" {
+		encoding, err := parseKeyEncoding(cfg.KeyEncoding)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, local.WithKeyEncoding(encoding))
+	}
+
+	store, err := local.NewFilestore(cfg.TmpPath, cfg.AssetsPath, opts...)
+	if err != nil {
+		return nil, err
+	}
+	if cfg.PrefixSize > 0 {
+		store.PrefixSize = cfg.PrefixSize
+	}
+	if cfg.PrefixDepth > 0 {
+		store.PrefixDepth = cfg.PrefixDepth
+	}
+	return store, nil
+}
+
+func newS3(ctx context.Context, cfg S3Config) (*s3.Filestore, error) {
+	var opts []s3.Option
+	if cfg.AccessKey != "" {
+		opts = append(opts, s3.WithCredentialsV4(cfg.AccessKey, cfg.SecretKey, ""))
+	}
+	if cfg.Region != "" {
+		opts = append(opts, s3.WithRegion(cfg.Region))
+	}
+	if cfg.Secure {
+		opts = append(opts, s3.WithSecure())
+	}
+	switch cfg.BucketLookup {
+	case "":
+	case "dns":
+		opts = append(opts, s3.WithBucketLookupDNS())
+	case "path":
+		opts = append(opts, s3.WithBucketLookupPath())
+	default:
+		return nil, fmt.Errorf("%w: bucketLookup %q", ErrInvalidValue, cfg.BucketLookup)
+	}
+	if cfg.BucketAutoCreate {
+		opts = append(opts, s3.WithBucketAutoCreate())
+	}
+	if cfg.VerifyChecksum {
+		opts = append(opts, s3.WithChecksumVerification())
+	}
+	if cfg.SkipExisting {
+		opts = append(opts, s3.WithSkipExistingUploads())
+	}
+	if cfg.RequesterPays {
+		opts = append(opts, s3.WithRequesterPays())
+	}
+	if cfg.OperationTimeout > 0 {
+		opts = append(opts, s3.WithOperationTimeout(cfg.OperationTimeout))
+	}
+	if cfg.RequestTimeout > 0 {
+		opts = append(opts, s3.WithRequestTimeout(cfg.RequestTimeout))
+	}
+	if cfg.MaxRetries > 0 {
+		opts = append(opts, s3.WithRetry(cfg.MaxRetries, cfg.RetryBackoff, cfg.RetryMaxBackoff))
+	}
+	if cfg.LazyBucketCheck {
+		opts = append(opts, s3.WithLazyBucketCheck())
+	}
+	if cfg.TransferAcceleration {
+		opts = append(opts, s3.WithTransferAcceleration())
+	}
+	if cfg.TrailingHeaders {
+		opts = append(opts, s3.WithTrailingHeaders())
+	}
+	if cfg.MaxObjectSize > 0 {
+		opts = append(opts, s3.WithMaxObjectSize(cfg.MaxObjectSize))
+	}
+	if cfg.WriteOnce {
+		opts = append(opts, s3.WithWriteOnce())
+	}
+	if cfg.KeyEncoding != "" {
+		encoding, err := parseKeyEncoding(cfg.KeyEncoding)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, s3.WithKeyEncoding(encoding))
+	}
+	if cfg.RetentionMode != "" {
+		mode := minio.RetentionMode(strings.ToUpper(cfg.RetentionMode))
+		if !mode.IsValid() || cfg.RetentionPeriod <= 0 {
+			return nil, fmt.Errorf("%w: retentionMode %q with retentionPeriod %s",
+				ErrInvalidValue, cfg.RetentionMode, cfg.RetentionPeriod)
+		}
+		opts = append(opts, s3.WithRetention(mode, cfg.RetentionPeriod))
+	}
+	if cfg.LegalHold {
+		opts = append(opts, s3.WithLegalHold())
+	}
+	if cfg.TempPrefix != "" {
+		opts = append(opts, s3.WithTempPrefix(cfg.TempPrefix))
+	}
+	if cfg.PublicURL != "" {
+		opts = append(opts, s3.WithPublicURL(cfg.PublicURL))
+	}
+	if cfg.ImgproxySource != "" {
+		opts = append(opts, s3.WithImgproxySource(cfg.ImgproxySource))
+	}
+	if cfg.ArchiveStorageClass != "" {
+		opts = append(opts, s3.WithArchiveStorageClass(cfg.ArchiveStorageClass))
+	}
+	if cfg.CompatibilityMode {
+		opts = append(opts, s3.WithCompatibilityMode(cfg.SpoolDir))
+	}
+
+	return s3.NewFilestore(ctx, cfg.Endpoint, cfg.Bucket, opts...)
+}
+
+func newMemory(cfg MemoryConfig) (*memory.Filestore, error) {
+	var opts []memory.Option
+	if cfg.MaxBytes > 0 {
+		opts = append(opts, memory.WithMaxBytes(cfg.MaxBytes))
+	}
+	if cfg.MaxObjects > 0 {
+		opts = append(opts, memory.WithMaxObjects(cfg.MaxObjects))
+	}
+	if cfg.MaxObjectSize > 0 {
+		opts = append(opts, memory.WithMaxObjectSize(cfg.MaxObjectSize))
+	}
+	if cfg.WriteOnce {
+		opts = append(opts, memory.WithWriteOnce())
+	}
+	if cfg.KeyEncoding != "" {
+		encoding, err := parseKeyEncoding(cfg.KeyEncoding)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, memory.WithKeyEncoding(encoding))
+	}
+	return memory.NewFilestore(opts...), nil
+}
+
+func parseKeyEncoding(name string) (hashing.KeyEncoding, error) {
+	encoding, err := hashing.ParseKeyEncoding(name)
+	if err != nil {
+		return nil, fmt.Errorf("parsing key encoding: %w", err)
+	}
+	return encoding, nil
+}
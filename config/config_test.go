@@ -0,0 +1,111 @@
+package config_test
+
+import (
+	"context"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/networkteam/filestore/config"
+	"github.com/networkteam/filestore/hashing"
+	"github.com/networkteam/filestore/local"
+	"github.com/networkteam/filestore/memory"
+)
+
+func TestNewFromConfig(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("local", func(t *testing.T) {
+		testDir := t.TempDir()
+
+		store, err := config.NewFromConfig(ctx, config.Config{
+			Backend: config.BackendLocal,
+			Local: config.LocalConfig{
+				AssetsPath: path.Join(testDir, "assets"),
+				TmpPath:    path.Join(testDir, "tmp"),
+				PrefixSize: 3,
+			},
+		})
+		require.NoError(t, err)
+		require.IsType(t, &local.Filestore{}, store)
+		assert.Equal(t, 3, store.(*local.Filestore).PrefixSize)
+	})
+
+	t.Run("local with layout and modes", func(t *testing.T) {
+		testDir := t.TempDir()
+
+		store, err := config.NewFromConfig(ctx, config.Config{
+			Backend: config.BackendLocal,
+			Local: config.LocalConfig{
+				AssetsPath:  path.Join(testDir, "assets"),
+				TmpPath:     path.Join(testDir, "tmp"),
+				FlatLayout:  true,
+				FileMode:    "0640",
+				DirMode:     "0750",
+				KeyEncoding: "prefixed",
+			},
+		})
+		require.NoError(t, err)
+		require.IsType(t, &local.Filestore{}, store)
+		localStore := store.(*local.Filestore)
+		assert.Equal(t, 0, localStore.PrefixSize)
+		assert.Equal(t, os.FileMode(0640), localStore.TargetFileMode)
+		assert.Equal(t, os.FileMode(0750), localStore.DirMode)
+
+		hash, err := store.Store(ctx, strings.NewReader("Test"))
+		require.NoError(t, err)
+		assert.True(t, strings.HasPrefix(hash, "sha256-"), "hash %q should use the prefixed key encoding", hash)
+	})
+
+	t.Run("local with invalid file mode", func(t *testing.T) {
+		testDir := t.TempDir()
+
+		_, err := config.NewFromConfig(ctx, config.Config{
+			Backend: config.BackendLocal,
+			Local: config.LocalConfig{
+				AssetsPath: path.Join(testDir, "assets"),
+				TmpPath:    path.Join(testDir, "tmp"),
+				FileMode:   "rw-r-----",
+			},
+		})
+		assert.ErrorIs(t, err, config.ErrInvalidValue)
+	})
+
+	t.Run("memory", func(t *testing.T) {
+		store, err := config.NewFromConfig(ctx, config.Config{
+			Backend: config.BackendMemory,
+			Memory:  config.MemoryConfig{MaxObjects: 10},
+		})
+		require.NoError(t, err)
+		assert.IsType(t, &memory.Filestore{}, store)
+	})
+
+	t.Run("memory with invalid key encoding", func(t *testing.T) {
+		_, err := config.NewFromConfig(ctx, config.Config{
+			Backend: config.BackendMemory,
+			Memory:  config.MemoryConfig{KeyEncoding: "base64"},
+		})
+		assert.ErrorIs(t, err, hashing.ErrUnknownKeyEncoding)
+	})
+
+	t.Run("s3 with invalid bucket lookup", func(t *testing.T) {
+		_, err := config.NewFromConfig(ctx, config.Config{
+			Backend: config.BackendS3,
+			S3: config.S3Config{
+				Endpoint:     "localhost:9000",
+				Bucket:       "test",
+				BucketLookup: "DNS",
+			},
+		})
+		assert.ErrorIs(t, err, config.ErrInvalidValue)
+	})
+
+	t.Run("unknown backend", func(t *testing.T) {
+		_, err := config.NewFromConfig(ctx, config.Config{Backend: "ftp"})
+		assert.ErrorIs(t, err, config.ErrUnknownBackend)
+	})
+}
@@ -0,0 +1,131 @@
+// Package contenttype provides a file store wrapper that only stores content with allowed content types.
+package contenttype
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+
+	"github.com/networkteam/filestore"
+)
+
+// ErrNotAllowed is returned if the content type of the content is not allowed. It wraps filestore.ErrContentRejected.
+var ErrNotAllowed = fmt.Errorf("content type not allowed: %w", filestore.ErrContentRejected)
+
+// Filestore wraps a file store and rejects content with a content type that is not allowed before it is stored.
+// Only the methods of filestore.FileStore are available on the wrapper.
+type Filestore struct {
+	filestore.FileStore
+
+	allowed []string
+	sniff   bool
+}
+
+type options struct {
+	sniff bool
+}
+
+// Option is a functional option for creating a content type restricting file store.
+type Option func(*options)
+
+// WithSniffing always detects the content type from the content (see filestore.DetectContentType) instead of using the
+// content type declared by the reader (see filestore.ContentTyped), which is usually set by a client.
+// The detected content type is stored instead of the declared content type.
+func WithSniffing() Option {
+	return func(opts *options) {
+		opts.sniff = true
+	}
+}
+
+var _ filestore.FileStore = &Filestore{}
+
+// NewFilestore creates a file store that only stores content in store with a content type matching one of
+// the allowed content types (e.g. "image/png" or "image/*").
+// The content type declared by the reader is checked, content without a declared content type is sniffed and the
+// detected content type is stored.
+func NewFilestore(store filestore.FileStore, allowed []string, opts ...Option) *Filestore {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return &Filestore{
+		FileStore: store,
+		allowed:   allowed,
+		sniff:     o.sniff,
+	}
+}
+
+// Store checks the content type and stores the content in the wrapped store if it is allowed.
+func (f *Filestore) Store(ctx context.Context, r io.Reader) (string, error) {
+	checkedReader, err := f.check(r)
+	if err != nil {
+		return "", err
+	}
+	return f.FileStore.Store(ctx, checkedReader)
+}
+
+// StoreHashed checks the content type and stores the content in the wrapped store if it is allowed.
+func (f *Filestore) StoreHashed(ctx context.Context, r io.Reader, hash string) error {
+	checkedReader, err := f.check(r)
+	if err != nil {
+		return err
+	}
+	return f.FileStore.StoreHashed(ctx, checkedReader, hash)
+}
+
+// check returns a reader for the content of r if the content type is allowed.
+func (f *Filestore) check(r io.Reader) (io.Reader, error) {
+	var declared string
+	if typedReader, ok := r.(filestore.ContentTyped); ok {
+		declared = typedReader.ContentType()
+	}
+	if declared != "" && !f.sniff {
+		if !Matches(declared, f.allowed) {
+			return nil, fmt.Errorf("%w: %s", ErrNotAllowed, declared)
+		}
+		return r, nil
+	}
+
+	detected, content, err := filestore.DetectContentType(r)
+	if err != nil {
+		return nil, err
+	}
+	if !Matches(detected, f.allowed) {
+		return nil, fmt.Errorf("%w: %s", ErrNotAllowed, detected)
+	}
+
+	readerOpts := []filestore.ReaderOption{filestore.WithContentType(detected)}
+	if dispoReader, ok := r.(filestore.ContentDispositioned); ok {
+		readerOpts = append(readerOpts, filestore.WithContentDisposition(dispoReader.ContentDisposition()))
+	}
+	if sizedReader, ok := r.(filestore.Sized); ok {
+		readerOpts = append(readerOpts, filestore.WithSize(sizedReader.Size()))
+	}
+	return filestore.NewReader(content, readerOpts...), nil
+}
+
+// Matches returns true if the media type of contentType matches one of the allowed content types.
+// Allowed content types can use a wildcard subtype (e.g. "image/*"), all content types match if allowed is empty.
+func Matches(contentType string, allowed []string) bool {
+	if len(allowed) == 0 {
+		return true
+	}
+
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+	for _, a := range allowed {
+		a = strings.ToLower(a)
+		if a == mediaType {
+			return true
+		}
+		if strings.HasSuffix(a, "/*") && strings.HasPrefix(mediaType, strings.TrimSuffix(a, "*")) {
+			return true
+		}
+	}
+	return false
+}
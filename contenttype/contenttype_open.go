@@ -0,0 +1,43 @@
+package contenttype
+
+import (
+	"context"
+	"errors"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/networkteam/filestore"
+)
+
+func init() {
+	filestore.RegisterWrapper("contenttype", wrapContentType)
+}
+
+// ErrMissingAllowedContentTypes is returned by filestore.Open if the contenttype wrapper is used without allowed
+// content types.
+var ErrMissingAllowedContentTypes = errors.New("missing allowed content types")
+
+// wrapContentType wraps a store opened by filestore.Open with "wrap=contenttype" to only store allowed content types.
+// Allowed content types are set with the allowedContentTypes parameter (comma separated or repeated, e.g.
+// "allowedContentTypes=image/*,application/pdf"), sniffing is enabled with sniffContentType=true.
+func wrapContentType(ctx context.Context, store filestore.FileStore, params url.Values) (filestore.FileStore, error) {
+	var allowed []string
+	for _, value := range params["allowedContentTypes"] {
+		for _, contentType := range strings.Split(value, ",") {
+			if contentType = strings.TrimSpace(contentType); contentType != "" {
+				allowed = append(allowed, contentType)
+			}
+		}
+	}
+	if len(allowed) == 0 {
+		return nil, ErrMissingAllowedContentTypes
+	}
+
+	var opts []Option
+	if sniff, _ := strconv.ParseBool(params.Get("sniffContentType")); sniff {
+		opts = append(opts, WithSniffing())
+	}
+
+	return NewFilestore(store, allowed, opts...), nil
+}
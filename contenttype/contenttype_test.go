@@ -0,0 +1,92 @@
+package contenttype_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/contenttype"
+	"github.com/networkteam/filestore/memory"
+)
+
+const pngHeader = "\x89PNG\r\n\x1a\n"
+
+func TestFilestore(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("declared content type", func(t *testing.T) {
+		store := contenttype.NewFilestore(memory.NewFilestore(), []string{"image/*", "application/pdf"})
+
+		hash, err := store.Store(ctx, filestore.NewReader(strings.NewReader("%PDF-1.4"), filestore.WithContentType("application/pdf")))
+		require.NoError(t, err)
+		info, err := store.FileStore.(filestore.Stater).Stat(ctx, hash)
+		require.NoError(t, err)
+		assert.Equal(t, "application/pdf", info.ContentType)
+
+		_, err = store.Store(ctx, filestore.NewReader(strings.NewReader("Hello"), filestore.WithContentType("text/plain; charset=utf-8")))
+		require.ErrorIs(t, err, contenttype.ErrNotAllowed)
+		require.ErrorIs(t, err, filestore.ErrContentRejected)
+
+		err = store.StoreHashed(ctx, filestore.NewReader(strings.NewReader("Hello"), filestore.WithContentType("text/plain")), "a0b1c2d3e4f5")
+		require.ErrorIs(t, err, contenttype.ErrNotAllowed)
+	})
+
+	t.Run("sniffed content type", func(t *testing.T) {
+		store := contenttype.NewFilestore(memory.NewFilestore(), []string{"image/png"})
+
+		hash, err := store.Store(ctx, filestore.NewReader(strings.NewReader(pngHeader+"data"), filestore.WithSize(12), filestore.WithFilename("image.png")))
+		require.NoError(t, err)
+		info, err := store.FileStore.(filestore.Stater).Stat(ctx, hash)
+		require.NoError(t, err)
+		assert.Equal(t, filestore.ObjectInfo{
+			Hash:               hash,
+			Size:               12,
+			ContentType:        "image/png",
+			ContentDisposition: `attachment; filename="image.png"`,
+		}, info)
+
+		_, err = store.Store(ctx, strings.NewReader("Hello"))
+		require.ErrorIs(t, err, contenttype.ErrNotAllowed)
+	})
+
+	t.Run("with sniffing", func(t *testing.T) {
+		store := contenttype.NewFilestore(memory.NewFilestore(), []string{"image/png"}, contenttype.WithSniffing())
+
+		_, err := store.Store(ctx, filestore.ContentTypedReader(strings.NewReader("<html></html>"), "image/png"))
+		require.ErrorIs(t, err, contenttype.ErrNotAllowed)
+
+		hash, err := store.Store(ctx, filestore.ContentTypedReader(strings.NewReader(pngHeader), "application/octet-stream"))
+		require.NoError(t, err)
+		info, err := store.FileStore.(filestore.Stater).Stat(ctx, hash)
+		require.NoError(t, err)
+		assert.Equal(t, "image/png", info.ContentType)
+	})
+}
+
+func TestMatches(t *testing.T) {
+	allowed := []string{"image/*", "application/pdf"}
+
+	assert.True(t, contenttype.Matches("image/png", allowed))
+	assert.True(t, contenttype.Matches("Application/PDF", allowed))
+	assert.True(t, contenttype.Matches("text/plain", nil))
+	assert.False(t, contenttype.Matches("text/plain; charset=utf-8", allowed))
+	assert.False(t, contenttype.Matches("imagefoo/png", allowed))
+	assert.False(t, contenttype.Matches("", allowed))
+}
+
+func TestOpen(t *testing.T) {
+	ctx := context.Background()
+
+	store, err := filestore.Open(ctx, "memory://?wrap=contenttype&allowedContentTypes=image/*,application/pdf")
+	require.NoError(t, err)
+
+	_, err = store.Store(ctx, strings.NewReader("Hello"))
+	require.ErrorIs(t, err, contenttype.ErrNotAllowed)
+
+	_, err = filestore.Open(ctx, "memory://?wrap=contenttype")
+	require.ErrorIs(t, err, contenttype.ErrMissingAllowedContentTypes)
+}
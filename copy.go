@@ -0,0 +1,23 @@
+package filestore
+
+import (
+	"io"
+
+	"github.com/networkteam/filestore/internal/bufpool"
+)
+
+// DefaultCopyBufferSize is the default size of the pooled buffers used by stores and wrappers to copy content.
+const DefaultCopyBufferSize = bufpool.DefaultSize
+
+// SetCopyBufferSize sets the size of the pooled buffers used by stores and wrappers to copy content
+// (defaults to DefaultCopyBufferSize). Larger buffers reduce the number of reads and writes for large files.
+// It should be called before any content is copied, e.g. during initialization.
+func SetCopyBufferSize(size int) {
+	bufpool.SetSize(size)
+}
+
+// Copy copies from src to dst like io.Copy, but uses a pooled buffer instead of allocating a new one for every call.
+// Wrappers of file stores can use it to share the buffers of the stores.
+func Copy(dst io.Writer, src io.Reader) (written int64, err error) {
+	return bufpool.Copy(dst, src)
+}
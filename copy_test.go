@@ -0,0 +1,56 @@
+package filestore_test
+
+import (
+	"bytes"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/networkteam/filestore"
+)
+
+func TestCopy(t *testing.T) {
+	content := strings.Repeat("0123456789", 1000)
+
+	t.Run("to buffer", func(t *testing.T) {
+		var buf bytes.Buffer
+		n, err := filestore.Copy(&buf, strings.NewReader(content))
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(content)), n)
+		assert.Equal(t, content, buf.String())
+	})
+
+	t.Run("to file with small buffer size", func(t *testing.T) {
+		filestore.SetCopyBufferSize(16)
+		defer filestore.SetCopyBufferSize(0)
+
+		f, err := os.Create(filepath.Join(t.TempDir(), "copy"))
+		require.NoError(t, err)
+		defer f.Close()
+
+		// Hide WriterTo of strings.Reader, so the pooled buffer is used
+		n, err := filestore.Copy(f, struct{ io.Reader }{strings.NewReader(content)})
+		require.NoError(t, err)
+		assert.Equal(t, int64(len(content)), n)
+
+		data, err := os.ReadFile(f.Name())
+		require.NoError(t, err)
+		assert.Equal(t, content, string(data))
+	})
+}
+
+func BenchmarkCopy(b *testing.B) {
+	content := []byte(strings.Repeat("0123456789", 10000))
+	var buf bytes.Buffer
+
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		buf.Reset()
+		_, _ = filestore.Copy(&buf, struct{ io.Reader }{bytes.NewReader(content)})
+	}
+}
@@ -0,0 +1,161 @@
+package filestore
+
+import (
+	"context"
+	"errors"
+	"sort"
+)
+
+// diffBatchSize is the batch size for iterating stores in Diff.
+const diffBatchSize = 1000
+
+// errNotSorted is returned by mergeDiff if a store does not return hashes in lexicographic order.
+var errNotSorted = errors.New("hashes not sorted")
+
+// Diff compares the files of two stores and returns the sorted hashes that only exist in a or only in b
+// (e.g. to check that a mirror is in sync with the primary store).
+//
+// If both stores implement SortedIterator, their iterations are merged while streaming, so memory usage only depends
+// on the number of differences. Otherwise, all hashes of b are buffered.
+func Diff(ctx context.Context, a, b Iterator) (onlyA, onlyB []string, err error) {
+	if iteratesSorted(a) && iteratesSorted(b) {
+		onlyA, onlyB, err = mergeDiff(ctx, a, b)
+		if !errors.Is(err, errNotSorted) {
+			return onlyA, onlyB, err
+		}
+		// The order is not guaranteed for all files (e.g. for a local store with files in a legacy layout)
+	}
+	return bufferedDiff(ctx, a, b)
+}
+
+func iteratesSorted(it Iterator) bool {
+	sortedIterator, ok := it.(SortedIterator)
+	return ok && sortedIterator.IteratesSorted()
+}
+
+func mergeDiff(ctx context.Context, a, b Iterator) (onlyA, onlyB []string, err error) {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	cursorA := newIterateCursor(ctx, a)
+	cursorB := newIterateCursor(ctx, b)
+
+	hashA, okA := cursorA.next()
+	hashB, okB := cursorB.next()
+	for (okA || okB) && cursorA.err() == nil && cursorB.err() == nil {
+		switch {
+		case !okB || (okA && hashA < hashB):
+			onlyA = append(onlyA, hashA)
+			hashA, okA = cursorA.next()
+		case !okA || hashB < hashA:
+			onlyB = append(onlyB, hashB)
+			hashB, okB = cursorB.next()
+		default:
+			hashA, okA = cursorA.next()
+			hashB, okB = cursorB.next()
+		}
+	}
+
+	if err := cursorA.err(); err != nil {
+		return nil, nil, err
+	}
+	if err := cursorB.err(); err != nil {
+		return nil, nil, err
+	}
+	return onlyA, onlyB, nil
+}
+
+// iterateCursor streams the hashes of a store from a goroutine running Iterate.
+type iterateCursor struct {
+	batches <-chan []string
+	errCh   <-chan error
+	batch   []string
+	last    string
+	started bool
+	done    bool
+	iterErr error
+}
+
+func newIterateCursor(ctx context.Context, it Iterator) *iterateCursor {
+	batches := make(chan []string, 1)
+	errCh := make(chan error, 1)
+	go func() {
+		defer close(batches)
+		errCh <- it.Iterate(ctx, diffBatchSize, func(hashes []string) error {
+			batch := make([]string, len(hashes))
+			copy(batch, hashes)
+			select {
+			case batches <- batch:
+				return nil
+			case <-ctx.Done():
+				return ctx.Err()
+			}
+		})
+	}()
+	return &iterateCursor{batches: batches, errCh: errCh}
+}
+
+// next returns the next hash or false if the iteration ended or failed (see err).
+func (c *iterateCursor) next() (string, bool) {
+	if c.done {
+		return "", false
+	}
+	for len(c.batch) == 0 {
+		batch, ok := <-c.batches
+		if !ok {
+			c.done = true
+			c.iterErr = <-c.errCh
+			return "", false
+		}
+		c.batch = batch
+	}
+
+	hash := c.batch[0]
+	c.batch = c.batch[1:]
+	if c.started && hash <= c.last {
+		c.done = true
+		c.iterErr = errNotSorted
+		return "", false
+	}
+	c.started = true
+	c.last = hash
+	return hash, true
+}
+
+func (c *iterateCursor) err() error {
+	return c.iterErr
+}
+
+func bufferedDiff(ctx context.Context, a, b Iterator) (onlyA, onlyB []string, err error) {
+	hashesB := make(map[string]struct{})
+	err = b.Iterate(ctx, diffBatchSize, func(hashes []string) error {
+		for _, hash := range hashes {
+			hashesB[hash] = struct{}{}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = a.Iterate(ctx, diffBatchSize, func(hashes []string) error {
+		for _, hash := range hashes {
+			if _, ok := hashesB[hash]; ok {
+				delete(hashesB, hash)
+			} else {
+				onlyA = append(onlyA, hash)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for hash := range hashesB {
+		onlyB = append(onlyB, hash)
+	}
+	sort.Strings(onlyA)
+	sort.Strings(onlyB)
+	return onlyA, onlyB, nil
+}
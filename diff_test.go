@@ -0,0 +1,93 @@
+package filestore_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/memory"
+)
+
+func TestDiff(t *testing.T) {
+	ctx := context.Background()
+
+	a := memory.NewFilestore()
+	b := memory.NewFilestore()
+	var onlyA, onlyB []string
+	for i := 0; i < 2500; i++ {
+		content := fmt.Sprintf("Content %d", i)
+		switch i % 5 {
+		case 0:
+			hash, err := a.Store(ctx, strings.NewReader(content))
+			require.NoError(t, err)
+			onlyA = append(onlyA, hash)
+		case 1:
+			hash, err := b.Store(ctx, strings.NewReader(content))
+			require.NoError(t, err)
+			onlyB = append(onlyB, hash)
+		default:
+			_, err := a.Store(ctx, strings.NewReader(content))
+			require.NoError(t, err)
+			_, err = b.Store(ctx, strings.NewReader(content))
+			require.NoError(t, err)
+		}
+	}
+
+	for name, stores := range map[string][2]filestore.Iterator{
+		"sorted":   {a, b},
+		"unsorted": {unsortedIterator{a}, b},
+	} {
+		t.Run(name, func(t *testing.T) {
+			actualA, actualB, err := filestore.Diff(ctx, stores[0], stores[1])
+			require.NoError(t, err)
+			assert.ElementsMatch(t, onlyA, actualA)
+			assert.ElementsMatch(t, onlyB, actualB)
+			assert.IsIncreasing(t, actualA)
+			assert.IsIncreasing(t, actualB)
+		})
+	}
+
+	t.Run("same store", func(t *testing.T) {
+		actualA, actualB, err := filestore.Diff(ctx, a, a)
+		require.NoError(t, err)
+		assert.Empty(t, actualA)
+		assert.Empty(t, actualB)
+	})
+
+	t.Run("not sorted as declared", func(t *testing.T) {
+		actualA, actualB, err := filestore.Diff(ctx, reversedIterator{a}, b)
+		require.NoError(t, err)
+		assert.ElementsMatch(t, onlyA, actualA)
+		assert.ElementsMatch(t, onlyB, actualB)
+	})
+}
+
+// unsortedIterator hides the SortedIterator implementation of a store.
+type unsortedIterator struct {
+	filestore.Iterator
+}
+
+// reversedIterator declares a sorted iteration but returns hashes in reverse order.
+type reversedIterator struct {
+	*memory.Filestore
+}
+
+func (r reversedIterator) Iterate(ctx context.Context, maxBatch int, callback func(hashes []string) error) error {
+	var all []string
+	err := r.Filestore.Iterate(ctx, maxBatch, func(hashes []string) error {
+		all = append(all, hashes...)
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	for i, j := 0, len(all)-1; i < j; i, j = i+1, j-1 {
+		all[i], all[j] = all[j], all[i]
+	}
+	return callback(all)
+}
@@ -0,0 +1,79 @@
+package filestore
+
+import (
+	"io"
+	"strings"
+	"unicode/utf8"
+)
+
+// ContentDisposition returns a Content-Disposition value (RFC 6266) with the given type (e.g. "attachment" or
+// "inline") for a raw filename. Directories of the filename are removed. Filenames with non-ASCII characters are
+// encoded as filename* (RFC 5987) with an ASCII fallback as filename for clients not supporting it.
+func ContentDisposition(dispositionType, filename string) string {
+	if i := strings.LastIndexAny(filename, `/\`); i >= 0 {
+		filename = filename[i+1:]
+	}
+	if filename == "" {
+		return dispositionType
+	}
+
+	fallback, isASCII := asciiFilename(filename)
+	value := dispositionType + `; filename="` + fallback + `"`
+	if !isASCII {
+		value += "; filename*=UTF-8''" + encodeExtValue(filename)
+	}
+	return value
+}
+
+// FilenameReader wraps a reader to implement ContentDispositioned with an attachment content disposition for
+// the given raw filename (see ContentDisposition).
+func FilenameReader(r io.Reader, filename string) io.Reader {
+	return ContentDispositionedReader(r, ContentDisposition("attachment", filename))
+}
+
+// asciiFilename returns the filename escaped for a quoted string with non-ASCII and control characters replaced
+// by "_" and if the filename was printable ASCII only.
+func asciiFilename(filename string) (string, bool) {
+	var (
+		sb      strings.Builder
+		isASCII = true
+	)
+	for _, r := range filename {
+		switch {
+		case r == utf8.RuneError || r < 0x20 || r > 0x7e:
+			isASCII = false
+			sb.WriteByte('_')
+		case r == '"' || r == '\\':
+			sb.WriteByte('\\')
+			sb.WriteRune(r)
+		default:
+			sb.WriteRune(r)
+		}
+	}
+	return sb.String(), isASCII
+}
+
+// encodeExtValue percent-encodes all bytes of s except attr-char (RFC 5987).
+func encodeExtValue(s string) string {
+	const hex = "0123456789ABCDEF"
+
+	var sb strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if isAttrChar(c) {
+			sb.WriteByte(c)
+			continue
+		}
+		sb.WriteByte('%')
+		sb.WriteByte(hex[c>>4])
+		sb.WriteByte(hex[c&0x0f])
+	}
+	return sb.String()
+}
+
+func isAttrChar(c byte) bool {
+	if 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' {
+		return true
+	}
+	return strings.IndexByte("!#$&+-.^_`|~", c) >= 0
+}
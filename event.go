@@ -0,0 +1,17 @@
+package filestore
+
+// EventType is the type of a change in a file store.
+type EventType string
+
+const (
+	// EventStored is emitted when a file was stored.
+	EventStored EventType = "stored"
+	// EventRemoved is emitted when a file was removed.
+	EventRemoved EventType = "removed"
+)
+
+// An Event describes a change of a file in a file store.
+type Event struct {
+	Type EventType
+	Hash string
+}
@@ -0,0 +1,252 @@
+// Package events publishes the stored and removed files of a file store to a message broker (e.g. NATS JetStream
+// or Kafka) with at-least-once delivery, so event-driven pipelines can react to new files.
+//
+// The package does not depend on a broker client and ships no adapters for NATS or Kafka: callers must supply a
+// Publisher for the client of their broker (see PublisherFunc for NATS JetStream and Kafka examples).
+// Events are recorded in a durable replicator.Journal before the operation returns and are published by Run with a
+// replicator.Consumer, so events are published after a restart or an outage of the broker.
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/replicator"
+)
+
+const (
+	// DefaultSubject is the default subject template of published messages.
+	DefaultSubject = "filestore.{type}"
+	// DefaultBatchSize is the default number of journal entries published before they are acknowledged.
+	DefaultBatchSize = 100
+	// DefaultPollInterval is the default interval for checking the journal for new entries.
+	DefaultPollInterval = 5 * time.Second
+	// DefaultMinRetryDelay is the default delay before retrying a failed publish, doubled for every failure.
+	DefaultMinRetryDelay = time.Second
+	// DefaultMaxRetryDelay is the default maximum delay before retrying a failed publish.
+	DefaultMaxRetryDelay = time.Minute
+)
+
+// journalTarget is the name of the acknowledged entries in the journal.
+const journalTarget = "events"
+
+// A Message is an event to publish.
+type Message struct {
+	// Subject is the NATS subject or Kafka topic expanded from the subject template (see WithSubject).
+	Subject string
+	// ID uniquely identifies the event, it is the same if an event is published again after a failure
+	// (e.g. for the Nats-Msg-Id header to deduplicate messages in JetStream).
+	ID string
+	// Key is the hash of the file (e.g. as Kafka message key, so events of a file are kept in order).
+	Key string
+	// Data is the JSON encoded Payload.
+	Data []byte
+}
+
+// Payload is the JSON encoded data of a message.
+type Payload struct {
+	Type filestore.EventType `json:"type"`
+	Hash string              `json:"hash"`
+	Time time.Time           `json:"time"`
+}
+
+// A Publisher publishes messages to a broker. Publish must only return after the broker acknowledged the message
+// (e.g. with a JetStream publish or a Kafka writer with required acks), otherwise messages can be lost.
+type Publisher interface {
+	Publish(ctx context.Context, msg Message) error
+}
+
+// PublisherFunc adapts a function to a Publisher, e.g. for NATS JetStream:
+//
+//	events.PublisherFunc(func(ctx context.Context, msg events.Message) error {
+//		_, err := js.Publish(msg.Subject, msg.Data, nats.Context(ctx), nats.MsgId(msg.ID))
+//		return err
+//	})
+//
+// or for a Kafka writer of github.com/segmentio/kafka-go (with RequiredAcks set):
+//
+//	events.PublisherFunc(func(ctx context.Context, msg events.Message) error {
+//		return writer.WriteMessages(ctx, kafka.Message{Topic: msg.Subject, Key: []byte(msg.Key), Value: msg.Data})
+//	})
+type PublisherFunc func(ctx context.Context, msg Message) error
+
+// Publish calls f(ctx, msg).
+func (f PublisherFunc) Publish(ctx context.Context, msg Message) error {
+	return f(ctx, msg)
+}
+
+// Filestore wraps a file store and records stored and removed files in a journal, which are published by Run.
+// Only the methods of filestore.FileStore are available on the wrapper.
+//
+// An event is recorded after the operation succeeded on the store. If recording fails, the error is returned
+// although the operation succeeded. The journal must not be shared with a replicator.Replicator, since both
+// truncate the journal after their own acknowledgements.
+type Filestore struct {
+	filestore.FileStore
+
+	publisher Publisher
+	opts      options
+	journal   replicator.Journal
+	consumer  *replicator.Consumer
+}
+
+type options struct {
+	subject       string
+	batchSize     int
+	pollInterval  time.Duration
+	minRetryDelay time.Duration
+	maxRetryDelay time.Duration
+}
+
+// Option is a functional option for creating an event publishing file store.
+type Option func(*options)
+
+// WithSubject sets the template for the subject (or topic) of messages (defaults to DefaultSubject).
+// The placeholders "{type}" and "{hash}" are replaced with the event type ("stored" or "removed") and the hash.
+func WithSubject(template string) Option {
+	return func(opts *options) {
+		opts.subject = template
+	}
+}
+
+// WithBatchSize sets the number of journal entries published before they are acknowledged
+// (defaults to DefaultBatchSize).
+func WithBatchSize(batchSize int) Option {
+	return func(opts *options) {
+		opts.batchSize = batchSize
+	}
+}
+
+// WithPollInterval sets the interval for checking the journal for new entries (defaults to DefaultPollInterval).
+// Entries recorded by the wrapper itself are published immediately.
+func WithPollInterval(pollInterval time.Duration) Option {
+	return func(opts *options) {
+		opts.pollInterval = pollInterval
+	}
+}
+
+// WithRetryDelay sets the delay before retrying a failed publish, which is doubled for every failure up to maxDelay
+// (defaults to DefaultMinRetryDelay and DefaultMaxRetryDelay).
+func WithRetryDelay(minDelay, maxDelay time.Duration) Option {
+	return func(opts *options) {
+		opts.minRetryDelay = minDelay
+		opts.maxRetryDelay = maxDelay
+	}
+}
+
+var _ filestore.FileStore = &Filestore{}
+
+// NewFilestore creates a file store that records the operations on store in journal and publishes them with
+// publisher.
+func NewFilestore(store filestore.FileStore, journal replicator.Journal, publisher Publisher, opts ...Option) *Filestore {
+	o := options{
+		subject:       DefaultSubject,
+		batchSize:     DefaultBatchSize,
+		pollInterval:  DefaultPollInterval,
+		minRetryDelay: DefaultMinRetryDelay,
+		maxRetryDelay: DefaultMaxRetryDelay,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	f := &Filestore{
+		FileStore: store,
+		publisher: publisher,
+		opts:      o,
+		journal:   journal,
+	}
+	f.consumer = replicator.NewConsumer(journal, journalTarget, f.publish, replicator.ConsumerOptions{
+		BatchSize:     o.batchSize,
+		PollInterval:  o.pollInterval,
+		MinRetryDelay: o.minRetryDelay,
+		MaxRetryDelay: o.maxRetryDelay,
+		OnAck: func(seq uint64) {
+			// Truncating is an optimization, entries are truncated again with the next acknowledgement
+			_ = journal.Truncate(seq)
+		},
+	})
+	return f
+}
+
+// Store stores the content in the store and records a stored event.
+func (f *Filestore) Store(ctx context.Context, r io.Reader) (string, error) {
+	hash, err := f.FileStore.Store(ctx, r)
+	if err != nil {
+		return "", err
+	}
+	return hash, f.record(filestore.Event{Type: filestore.EventStored, Hash: hash})
+}
+
+// StoreHashed stores the content in the store and records a stored event.
+func (f *Filestore) StoreHashed(ctx context.Context, r io.Reader, hash string) error {
+	if err := f.FileStore.StoreHashed(ctx, r, hash); err != nil {
+		return err
+	}
+	return f.record(filestore.Event{Type: filestore.EventStored, Hash: hash})
+}
+
+// Remove removes the file from the store and records a removed event.
+func (f *Filestore) Remove(ctx context.Context, hash string) error {
+	if err := f.FileStore.Remove(ctx, hash); err != nil {
+		return err
+	}
+	return f.record(filestore.Event{Type: filestore.EventRemoved, Hash: hash})
+}
+
+func (f *Filestore) record(event filestore.Event) error {
+	if _, err := f.journal.Append(event); err != nil {
+		return fmt.Errorf("recording %s %s for publishing: %w", event.Type, event.Hash, err)
+	}
+	f.consumer.Notify()
+	return nil
+}
+
+// Run publishes the journal entries until ctx is cancelled and returns the error of the context.
+// A failed publish is retried with an increasing delay, later entries are not published until the failed entry
+// succeeds, so the order of events is kept. An entry can be published more than once (e.g. if the process stops
+// before the entry was acknowledged), consumers should deduplicate messages by Message.ID or be idempotent.
+func (f *Filestore) Run(ctx context.Context) error {
+	return f.consumer.Run(ctx)
+}
+
+// publish publishes the message of a journal entry.
+func (f *Filestore) publish(ctx context.Context, entry replicator.Entry) error {
+	msg, err := f.message(entry)
+	if err != nil {
+		return err
+	}
+	if err = f.publisher.Publish(ctx, msg); err != nil {
+		return fmt.Errorf("publishing message: %w", err)
+	}
+	return nil
+}
+
+// message builds the message of a journal entry.
+func (f *Filestore) message(entry replicator.Entry) (Message, error) {
+	data, err := json.Marshal(Payload{
+		Type: entry.Type,
+		Hash: entry.Hash,
+		Time: entry.Time,
+	})
+	if err != nil {
+		return Message{}, fmt.Errorf("encoding payload: %w", err)
+	}
+
+	return Message{
+		Subject: strings.NewReplacer("{type}", string(entry.Type), "{hash}", entry.Hash).Replace(f.opts.subject),
+		ID:      fmt.Sprintf("%s-%s-%d", entry.Type, entry.Hash, entry.Time.UnixNano()),
+		Key:     entry.Hash,
+		Data:    data,
+	}, nil
+}
+
+// LastError returns the error of the last failed publish or nil if the last entry was published.
+func (f *Filestore) LastError() error {
+	return f.consumer.LastError()
+}
@@ -0,0 +1,131 @@
+package events_test
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/events"
+	"github.com/networkteam/filestore/memory"
+	"github.com/networkteam/filestore/replicator"
+)
+
+type recordingPublisher struct {
+	mx       sync.Mutex
+	failures int
+	messages []events.Message
+}
+
+func (p *recordingPublisher) Publish(ctx context.Context, msg events.Message) error {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	if p.failures > 0 {
+		p.failures--
+		return errors.New("broker unavailable")
+	}
+	p.messages = append(p.messages, msg)
+	return nil
+}
+
+func (p *recordingPublisher) published() []events.Message {
+	p.mx.Lock()
+	defer p.mx.Unlock()
+
+	return append([]events.Message(nil), p.messages...)
+}
+
+func TestFilestore(t *testing.T) {
+	ctx := context.Background()
+
+	journal, err := replicator.OpenFileJournal(t.TempDir())
+	require.NoError(t, err)
+	defer journal.Close()
+
+	publisher := &recordingPublisher{failures: 2}
+	store := events.NewFilestore(memory.NewFilestore(), journal, publisher,
+		events.WithSubject("assets.{type}.{hash}"),
+		events.WithRetryDelay(time.Millisecond, 10*time.Millisecond),
+	)
+
+	hash, err := store.Store(ctx, strings.NewReader("Hello World"))
+	require.NoError(t, err)
+	require.NoError(t, store.Remove(ctx, hash))
+
+	runFilestore(t, store)
+
+	require.Eventually(t, func() bool {
+		return len(publisher.published()) == 2
+	}, 5*time.Second, time.Millisecond)
+	assert.NoError(t, store.LastError())
+
+	messages := publisher.published()
+	assert.Equal(t, "assets.stored."+hash, messages[0].Subject)
+	assert.Equal(t, "assets.removed."+hash, messages[1].Subject)
+	assert.Equal(t, hash, messages[0].Key)
+	assert.NotEqual(t, messages[0].ID, messages[1].ID)
+
+	var payload events.Payload
+	require.NoError(t, json.Unmarshal(messages[0].Data, &payload))
+	assert.Equal(t, filestore.EventStored, payload.Type)
+	assert.Equal(t, hash, payload.Hash)
+	assert.WithinDuration(t, time.Now(), payload.Time, time.Minute)
+
+	t.Run("publishes new entries immediately", func(t *testing.T) {
+		newHash, err := store.Store(ctx, strings.NewReader("New content"))
+		require.NoError(t, err)
+
+		require.Eventually(t, func() bool {
+			messages := publisher.published()
+			return len(messages) == 3 && messages[2].Key == newHash
+		}, 5*time.Second, time.Millisecond)
+	})
+}
+
+func TestFilestore_Restart(t *testing.T) {
+	ctx := context.Background()
+	journalDir := t.TempDir()
+
+	journal, err := replicator.OpenFileJournal(journalDir)
+	require.NoError(t, err)
+	hash, err := events.NewFilestore(memory.NewFilestore(), journal, &recordingPublisher{}).Store(ctx, strings.NewReader("Hello World"))
+	require.NoError(t, err)
+	require.NoError(t, journal.Close())
+
+	// The entry is published after reopening the journal
+	journal, err = replicator.OpenFileJournal(journalDir)
+	require.NoError(t, err)
+	defer journal.Close()
+
+	publisher := &recordingPublisher{}
+	runFilestore(t, events.NewFilestore(memory.NewFilestore(), journal, publisher))
+
+	require.Eventually(t, func() bool {
+		return len(publisher.published()) == 1
+	}, 5*time.Second, time.Millisecond)
+	messages := publisher.published()
+	assert.Equal(t, "filestore.stored", messages[0].Subject)
+	assert.Equal(t, hash, messages[0].Key)
+}
+
+func runFilestore(t *testing.T, store *events.Filestore) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- store.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		assert.ErrorIs(t, <-done, context.Canceled)
+	})
+}
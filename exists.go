@@ -0,0 +1,41 @@
+package filestore
+
+import (
+	"context"
+	"sync"
+
+	"github.com/networkteam/filestore/internal/parallel"
+)
+
+// DefaultExistsWorkers is the default number of concurrent Exists calls of ExistsMany for stores that do not
+// implement BatchExister.
+const DefaultExistsWorkers = 8
+
+// ExistsMany returns whether each of the given hashes exists in store, keyed by hash (e.g. to plan which files
+// need to be copied by a sync). It uses ExistsMany if store implements BatchExister and calls Exists with up to
+// DefaultExistsWorkers concurrent calls otherwise.
+func ExistsMany(ctx context.Context, store Exister, hashes []string) (map[string]bool, error) {
+	if batchExister, ok := store.(BatchExister); ok {
+		return batchExister.ExistsMany(ctx, hashes)
+	}
+
+	var (
+		mx     sync.Mutex
+		exists = make(map[string]bool, len(hashes))
+	)
+	err := parallel.ForEach(ctx, hashes, DefaultExistsWorkers, func(ctx context.Context, hash string) error {
+		ok, err := store.Exists(ctx, hash)
+		if err != nil {
+			return err
+		}
+
+		mx.Lock()
+		exists[hash] = ok
+		mx.Unlock()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return exists, nil
+}
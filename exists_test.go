@@ -0,0 +1,39 @@
+package filestore_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/memory"
+)
+
+func TestExistsMany(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewFilestore(memory.WithRecording())
+
+	hash, err := store.Store(ctx, strings.NewReader("Test content"))
+	require.NoError(t, err)
+	missingHash := filestore.HashBytes([]byte("Missing content"))
+
+	t.Run("batch exister", func(t *testing.T) {
+		exists, err := filestore.ExistsMany(ctx, store, []string{hash, missingHash})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]bool{hash: true, missingHash: false}, exists)
+	})
+
+	t.Run("exister", func(t *testing.T) {
+		store.ResetCalls()
+
+		// Hide ExistsMany of the store
+		exister := struct{ filestore.Exister }{store}
+		exists, err := filestore.ExistsMany(ctx, exister, []string{hash, missingHash})
+		require.NoError(t, err)
+		assert.Equal(t, map[string]bool{hash: true, missingHash: false}, exists)
+		assert.Len(t, store.CallsOf(memory.OpExists), 2)
+	})
+}
@@ -0,0 +1,117 @@
+package filestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/networkteam/filestore/internal/parallel"
+)
+
+// DefaultExportWorkers is the default number of files written concurrently by ExportTree.
+const DefaultExportWorkers = 4
+
+type exportOptions struct {
+	workers int
+	copy    bool
+}
+
+// ExportOption is a functional option for ExportTree.
+type ExportOption func(*exportOptions)
+
+// WithExportWorkers sets the number of files written concurrently (defaults to DefaultExportWorkers).
+func WithExportWorkers(workers int) ExportOption {
+	return func(opts *exportOptions) {
+		opts.workers = workers
+	}
+}
+
+// WithExportCopy always copies the content, even if the files of the store could be hard linked.
+func WithExportCopy() ExportOption {
+	return func(opts *exportOptions) {
+		opts.copy = true
+	}
+}
+
+// ExportTree writes the files of a manifest (a mapping of slash separated paths to hashes as returned by ImportTree)
+// to the directory dest, e.g. to hand files to tools that need real paths. Existing files are replaced.
+//
+// If store implements LocalPather, files are hard linked if possible (unless WithExportCopy is given), so the
+// exported files share their content with the store and must not be modified. Otherwise, the content is copied.
+func ExportTree(ctx context.Context, store Fetcher, manifest map[string]string, dest string, opts ...ExportOption) error {
+	o := exportOptions{workers: DefaultExportWorkers}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	paths := make([]string, 0, len(manifest))
+	for p := range manifest {
+		// Paths must not escape dest
+		if !fs.ValidPath(p) || p == "." {
+			return fmt.Errorf("invalid path %q", p)
+		}
+		paths = append(paths, p)
+	}
+
+	return parallel.ForEach(ctx, paths, o.workers, func(ctx context.Context, p string) error {
+		hash := manifest[p]
+		if err := exportFile(ctx, store, hash, filepath.Join(dest, filepath.FromSlash(p)), o.copy); err != nil {
+			return fmt.Errorf("exporting %s to %s: %w", hash, p, err)
+		}
+		return nil
+	})
+}
+
+func exportFile(ctx context.Context, store Fetcher, hash, filename string, forceCopy bool) error {
+	if err := os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return fmt.Errorf("creating directory: %w", err)
+	}
+
+	if pather, ok := store.(LocalPather); ok && !forceCopy {
+		localPath, err := pather.LocalPath(ctx, hash)
+		if errors.Is(err, ErrNotExist) {
+			return err
+		}
+		if err == nil {
+			if err := os.Remove(filename); err != nil && !errors.Is(err, fs.ErrNotExist) {
+				return fmt.Errorf("removing existing file: %w", err)
+			}
+			if os.Link(localPath, filename) == nil {
+				return nil
+			}
+			// Fall back to copying the content (e.g. if dest is on another device)
+		}
+	}
+
+	r, err := store.Fetch(ctx, hash)
+	if err != nil {
+		return err
+	}
+	defer r.Close()
+
+	// Write to a temporary file first, so no incomplete file is left behind
+	tmp, err := os.CreateTemp(filepath.Dir(filename), ".export-*")
+	if err != nil {
+		return fmt.Errorf("creating temporary file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err = Copy(tmp, r); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("copying content: %w", err)
+	}
+	if err = tmp.Chmod(0644); err != nil {
+		_ = tmp.Close()
+		return fmt.Errorf("setting file mode: %w", err)
+	}
+	if err = tmp.Close(); err != nil {
+		return fmt.Errorf("closing temporary file: %w", err)
+	}
+	if err = os.Rename(tmp.Name(), filename); err != nil {
+		return fmt.Errorf("renaming temporary file: %w", err)
+	}
+	return nil
+}
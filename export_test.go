@@ -0,0 +1,103 @@
+package filestore_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/local"
+	"github.com/networkteam/filestore/memory"
+)
+
+func TestExportTree(t *testing.T) {
+	ctx := context.Background()
+
+	storeFiles := func(t *testing.T, store filestore.Storer) map[string]string {
+		manifest := make(map[string]string)
+		for name, content := range map[string]string{
+			"logo.png":                "PNG",
+			"uploads/2019/report.pdf": "PDF",
+			"uploads/copy.pdf":        "PDF",
+		} {
+			hash, err := store.Store(ctx, strings.NewReader(content))
+			require.NoError(t, err)
+			manifest[name] = hash
+		}
+		return manifest
+	}
+	assertExported := func(t *testing.T, dest string) {
+		for name, content := range map[string]string{
+			"logo.png":                "PNG",
+			"uploads/2019/report.pdf": "PDF",
+			"uploads/copy.pdf":        "PDF",
+		} {
+			data, err := os.ReadFile(filepath.Join(dest, filepath.FromSlash(name)))
+			require.NoError(t, err)
+			assert.Equal(t, content, string(data), name)
+		}
+	}
+
+	t.Run("copies content", func(t *testing.T) {
+		store := memory.NewFilestore()
+		manifest := storeFiles(t, store)
+		dest := t.TempDir()
+		require.NoError(t, os.WriteFile(filepath.Join(dest, "logo.png"), []byte("old"), 0644))
+
+		require.NoError(t, filestore.ExportTree(ctx, store, manifest, dest))
+		assertExported(t, dest)
+
+		entries, err := os.ReadDir(filepath.Join(dest, "uploads"))
+		require.NoError(t, err)
+		assert.Len(t, entries, 2, "no temporary files left")
+	})
+
+	t.Run("hard links local files", func(t *testing.T) {
+		testDir := t.TempDir()
+		store, err := local.NewFilestore(filepath.Join(testDir, "tmp"), filepath.Join(testDir, "assets"))
+		require.NoError(t, err)
+		manifest := storeFiles(t, store)
+		dest := filepath.Join(testDir, "export")
+
+		require.NoError(t, filestore.ExportTree(ctx, store, manifest, dest))
+		assertExported(t, dest)
+
+		localPath, err := store.LocalPath(ctx, manifest["logo.png"])
+		require.NoError(t, err)
+		assertSameFile(t, localPath, filepath.Join(dest, "logo.png"), true)
+
+		copyDest := filepath.Join(testDir, "copy")
+		require.NoError(t, filestore.ExportTree(ctx, store, manifest, copyDest, filestore.WithExportCopy()))
+		assertExported(t, copyDest)
+		assertSameFile(t, localPath, filepath.Join(copyDest, "logo.png"), false)
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		err := filestore.ExportTree(ctx, memory.NewFilestore(), map[string]string{"a.txt": "a0b1c2d3e4f5"}, t.TempDir())
+		assert.ErrorIs(t, err, filestore.ErrNotExist)
+	})
+
+	t.Run("invalid path", func(t *testing.T) {
+		store := memory.NewFilestore()
+		hash, err := store.Store(ctx, strings.NewReader("content"))
+		require.NoError(t, err)
+
+		err = filestore.ExportTree(ctx, store, map[string]string{"../escape.txt": hash}, t.TempDir())
+		assert.Error(t, err)
+	})
+}
+
+func assertSameFile(t *testing.T, a, b string, same bool) {
+	t.Helper()
+
+	infoA, err := os.Stat(a)
+	require.NoError(t, err)
+	infoB, err := os.Stat(b)
+	require.NoError(t, err)
+	assert.Equal(t, same, os.SameFile(infoA, infoB))
+}
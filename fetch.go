@@ -0,0 +1,74 @@
+package filestore
+
+import (
+	"context"
+	"fmt"
+	"io"
+
+	"github.com/networkteam/filestore/internal/parallel"
+)
+
+// FetchAll fetches the objects with the given hashes from store with up to concurrency parallel fetches and calls fn
+// with the content of each object. The reader is closed after fn returns.
+// fn is called concurrently and must be safe for concurrent use, the order of calls is undefined.
+// The first error of a fetch or fn cancels the remaining fetches and is returned.
+func FetchAll(ctx context.Context, store Fetcher, hashes []string, concurrency int, fn func(hash string, r io.Reader) error) error {
+	return parallel.ForEach(ctx, hashes, concurrency, func(ctx context.Context, hash string) error {
+		r, err := store.Fetch(ctx, hash)
+		if err != nil {
+			return fmt.Errorf("fetching %s: %w", hash, err)
+		}
+		defer r.Close()
+
+		return fn(hash, r)
+	})
+}
+
+// FetchInfo fetches the content of the given hash from store together with information about the file.
+// If store does not implement InfoFetcher, the information is requested separately with Stat (if store implements
+// Stater) or Size (if store implements Sizer), otherwise only the hash is set.
+func FetchInfo(ctx context.Context, store Fetcher, hash string) (io.ReadCloser, ObjectInfo, error) {
+	if infoFetcher, ok := store.(InfoFetcher); ok {
+		return infoFetcher.FetchInfo(ctx, hash)
+	}
+
+	r, err := store.Fetch(ctx, hash)
+	if err != nil {
+		return nil, ObjectInfo{}, err
+	}
+
+	info := ObjectInfo{Hash: hash}
+	switch s := store.(type) {
+	case Stater:
+		info, err = s.Stat(ctx, hash)
+	case Sizer:
+		info.Size, err = s.Size(ctx, hash)
+	}
+	if err != nil {
+		_ = r.Close()
+		return nil, ObjectInfo{}, err
+	}
+
+	return r, info, nil
+}
+
+// FetchIfNoneMatch fetches the content of the given hash from store unless the ETag (e.g. the value of an
+// If-None-Match header) matches the hash. Since the content of a hash never changes, a matching ETag means the client
+// has the current content and ErrNotModified is returned without fetching it. If store implements Exister, the
+// existence of the file is still checked, so removed files are reported with ErrNotExist.
+func FetchIfNoneMatch(ctx context.Context, store Fetcher, hash, etag string) (io.ReadCloser, error) {
+	if !ETagMatches(etag, hash) {
+		return store.Fetch(ctx, hash)
+	}
+
+	if exister, ok := store.(Exister); ok {
+		exists, err := exister.Exists(ctx, hash)
+		if err != nil {
+			return nil, fmt.Errorf("checking existence: %w", err)
+		}
+		if !exists {
+			return nil, &NotExistError{Op: "fetch", Hash: hash}
+		}
+	}
+	return nil, ErrNotModified
+}
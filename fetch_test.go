@@ -0,0 +1,128 @@
+package filestore_test
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/memory"
+)
+
+func TestFetchAll(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewFilestore()
+
+	expected := make(map[string]string)
+	var hashes []string
+	for i := 0; i < 20; i++ {
+		content := fmt.Sprintf("Content %d", i)
+		hash, err := store.Store(ctx, strings.NewReader(content))
+		require.NoError(t, err)
+		expected[hash] = content
+		hashes = append(hashes, hash)
+	}
+
+	t.Run("fetches all objects", func(t *testing.T) {
+		var (
+			mx            sync.Mutex
+			fetched       = make(map[string]string)
+			running, peak int32
+		)
+		err := filestore.FetchAll(ctx, store, hashes, 4, func(hash string, r io.Reader) error {
+			n := atomic.AddInt32(&running, 1)
+			defer atomic.AddInt32(&running, -1)
+
+			content, err := io.ReadAll(r)
+			if err != nil {
+				return err
+			}
+
+			mx.Lock()
+			defer mx.Unlock()
+			fetched[hash] = string(content)
+			if n > peak {
+				peak = n
+			}
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, expected, fetched)
+		assert.LessOrEqual(t, peak, int32(4))
+	})
+
+	t.Run("missing object", func(t *testing.T) {
+		err := filestore.FetchAll(ctx, store, append([]string{"a0b1c2d3e4f5"}, hashes...), 2, func(hash string, r io.Reader) error {
+			return nil
+		})
+		require.ErrorIs(t, err, filestore.ErrNotExist)
+	})
+
+	t.Run("error of callback stops fetching", func(t *testing.T) {
+		errTest := errors.New("test error")
+		var calls int32
+		err := filestore.FetchAll(ctx, store, hashes, 1, func(hash string, r io.Reader) error {
+			atomic.AddInt32(&calls, 1)
+			return errTest
+		})
+		require.ErrorIs(t, err, errTest)
+		assert.Equal(t, int32(1), calls)
+	})
+}
+
+func TestFetchInfo(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewFilestore()
+
+	hash, err := store.Store(ctx, filestore.NewReader(strings.NewReader("Hello World"), filestore.WithContentType("text/plain")))
+	require.NoError(t, err)
+
+	for _, test := range []struct {
+		name     string
+		store    filestore.Fetcher
+		expected filestore.ObjectInfo
+	}{
+		{
+			name:     "InfoFetcher",
+			store:    store,
+			expected: filestore.ObjectInfo{Hash: hash, Size: 11, ContentType: "text/plain"},
+		},
+		{
+			name: "Stater",
+			store: struct {
+				filestore.Fetcher
+				filestore.Stater
+			}{store, store},
+			expected: filestore.ObjectInfo{Hash: hash, Size: 11, ContentType: "text/plain"},
+		},
+		{
+			name:     "Sizer",
+			store:    struct{ filestore.FileStore }{store},
+			expected: filestore.ObjectInfo{Hash: hash, Size: 11},
+		},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			r, info, err := filestore.FetchInfo(ctx, test.store, hash)
+			require.NoError(t, err)
+			defer r.Close()
+
+			content, err := io.ReadAll(r)
+			require.NoError(t, err)
+			assert.Equal(t, "Hello World", string(content))
+			assert.Equal(t, test.expected, info)
+		})
+	}
+
+	t.Run("missing object", func(t *testing.T) {
+		_, _, err := filestore.FetchInfo(ctx, struct{ filestore.FileStore }{store}, "a0b1c2d3e4f5")
+		require.ErrorIs(t, err, filestore.ErrNotExist)
+	})
+}
@@ -0,0 +1,261 @@
+package filestore
+
+import (
+	"bytes"
+	"context"
+	"encoding"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"time"
+
+	"github.com/networkteam/filestore/hashing"
+)
+
+const (
+	// DefaultFetchRetries is the default number of consecutive retries of FetchVerified after a failed read.
+	DefaultFetchRetries = 3
+	// DefaultFetchRetryDelay is the default delay of FetchVerified before retrying a failed read.
+	DefaultFetchRetryDelay = time.Second
+)
+
+// ErrInvalidResumeState is returned by FetchVerified if the state given by WithResumeState cannot be decoded.
+var ErrInvalidResumeState = errors.New("invalid resume state")
+
+type fetchVerifiedOptions struct {
+	retries     int
+	retryDelay  time.Duration
+	resumeState []byte
+}
+
+// FetchVerifiedOption is a functional option for FetchVerified.
+type FetchVerifiedOption func(*fetchVerifiedOptions)
+
+// WithFetchRetries sets the number of consecutive retries after a failed read (defaults to DefaultFetchRetries).
+// The counter is reset after content was read successfully.
+func WithFetchRetries(retries int) FetchVerifiedOption {
+	return func(opts *fetchVerifiedOptions) {
+		opts.retries = retries
+	}
+}
+
+// WithFetchRetryDelay sets the delay before retrying a failed read (defaults to DefaultFetchRetryDelay).
+func WithFetchRetryDelay(delay time.Duration) FetchVerifiedOption {
+	return func(opts *fetchVerifiedOptions) {
+		opts.retryDelay = delay
+	}
+}
+
+// WithResumeState resumes a fetch from the state of a previous VerifiedReader (see VerifiedReader.State),
+// e.g. after a restart of the process. Reading continues at the offset of the state and the hash of the content
+// read before is restored, so the full content is still verified.
+func WithResumeState(state []byte) FetchVerifiedOption {
+	return func(opts *fetchVerifiedOptions) {
+		opts.resumeState = state
+	}
+}
+
+// VerifiedReader reads the content of a hash and verifies the hash of the full content, see FetchVerified.
+type VerifiedReader struct {
+	ctx      context.Context
+	store    Fetcher
+	hash     string
+	expected []byte
+	digest   hash.Hash
+	opts     fetchVerifiedOptions
+
+	r        io.ReadCloser
+	offset   int64
+	failures int
+	err      error
+}
+
+var _ io.ReadCloser = &VerifiedReader{}
+
+// FetchVerified fetches the content of the given hash and verifies it against the hash while it is read.
+// If reading fails (e.g. the connection was reset), the content is fetched again from the offset that was read
+// so far (with FetchRange if store implements RangeFetcher, otherwise the content before the offset is skipped),
+// so large downloads do not start over after transient errors.
+//
+// The hash is verified when the end of the content is reached: Read returns ErrHashMismatch instead of io.EOF
+// if the content does not match, so the content must not be used before io.EOF was returned.
+// The hash must be a hex encoded SHA256 hash in one of the key encodings of the hashing package.
+func FetchVerified(ctx context.Context, store Fetcher, hash string, opts ...FetchVerifiedOption) (*VerifiedReader, error) {
+	o := fetchVerifiedOptions{
+		retries:    DefaultFetchRetries,
+		retryDelay: DefaultFetchRetryDelay,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	expected, err := decodeHash(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	v := &VerifiedReader{
+		ctx:      ctx,
+		store:    store,
+		hash:     hash,
+		expected: expected,
+		digest:   hashing.New(),
+		opts:     o,
+	}
+	if o.resumeState != nil {
+		if err = v.restore(o.resumeState); err != nil {
+			return nil, err
+		}
+	}
+
+	// Open the content to fail early if the hash does not exist
+	if err = v.open(); err != nil {
+		return nil, err
+	}
+
+	return v, nil
+}
+
+// decodeHash returns the SHA256 hash of a key in one of the key encodings.
+func decodeHash(key string) ([]byte, error) {
+	hexHash, _ := hashing.PrefixedKeys.Decode(key)
+	hexHash, _ = hashing.MultihashKeys.Decode(hexHash)
+	sum, err := hex.DecodeString(hexHash)
+	if err != nil || len(sum) != hashing.New().Size() {
+		return nil, fmt.Errorf("verifying %s: not a SHA256 hash", key)
+	}
+	return sum, nil
+}
+
+// Read implements io.Reader. Failed reads are retried transparently, see FetchVerified.
+func (v *VerifiedReader) Read(p []byte) (int, error) {
+	if v.err != nil {
+		return 0, v.err
+	}
+
+	for {
+		if v.r == nil {
+			if err := v.open(); err != nil {
+				if !v.retry(err) {
+					v.err = err
+					return 0, err
+				}
+				continue
+			}
+		}
+
+		n, err := v.r.Read(p)
+		v.digest.Write(p[:n])
+		v.offset += int64(n)
+		if n > 0 {
+			v.failures = 0
+		}
+
+		if err == io.EOF {
+			v.err = v.verify()
+			return n, v.err
+		}
+		if err != nil {
+			_ = v.r.Close()
+			v.r = nil
+			if !v.retry(err) {
+				v.err = err
+				return n, err
+			}
+			if n == 0 {
+				continue
+			}
+		}
+		return n, nil
+	}
+}
+
+// open fetches the content from the current offset.
+func (v *VerifiedReader) open() error {
+	if rangeFetcher, ok := v.store.(RangeFetcher); ok {
+		r, err := rangeFetcher.FetchRange(v.ctx, v.hash, v.offset, -1)
+		if err != nil {
+			return err
+		}
+		v.r = r
+		return nil
+	}
+
+	r, err := v.store.Fetch(v.ctx, v.hash)
+	if err != nil {
+		return err
+	}
+	if _, err = io.CopyN(io.Discard, r, v.offset); err != nil {
+		_ = r.Close()
+		return fmt.Errorf("skipping to offset %d: %w", v.offset, err)
+	}
+	v.r = r
+	return nil
+}
+
+// retry waits for the retry delay and returns true if the failed operation should be retried.
+func (v *VerifiedReader) retry(err error) bool {
+	if errors.Is(err, ErrNotExist) || errors.Is(err, ErrInvalidRange) || v.ctx.Err() != nil {
+		return false
+	}
+	v.failures++
+	if v.failures > v.opts.retries {
+		return false
+	}
+
+	timer := time.NewTimer(v.opts.retryDelay)
+	defer timer.Stop()
+	select {
+	case <-v.ctx.Done():
+		return false
+	case <-timer.C:
+		return true
+	}
+}
+
+func (v *VerifiedReader) verify() error {
+	if sum := v.digest.Sum(nil); !bytes.Equal(sum, v.expected) {
+		return fmt.Errorf("verifying %s: got hash %x: %w", v.hash, sum, ErrHashMismatch)
+	}
+	return io.EOF
+}
+
+// Offset returns the number of bytes read (including the offset of a resumed fetch).
+func (v *VerifiedReader) Offset() int64 {
+	return v.offset
+}
+
+// State returns the offset and the state of the running hash, so the fetch can be resumed with WithResumeState
+// (e.g. after the process was restarted). The state must be taken after the content up to the offset was
+// persisted by the caller.
+func (v *VerifiedReader) State() ([]byte, error) {
+	digestState, err := v.digest.(encoding.BinaryMarshaler).MarshalBinary()
+	if err != nil {
+		return nil, fmt.Errorf("encoding hash state: %w", err)
+	}
+	return append(binary.BigEndian.AppendUint64(nil, uint64(v.offset)), digestState...), nil
+}
+
+func (v *VerifiedReader) restore(state []byte) error {
+	if len(state) < 8 {
+		return ErrInvalidResumeState
+	}
+	if err := v.digest.(encoding.BinaryUnmarshaler).UnmarshalBinary(state[8:]); err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidResumeState, err)
+	}
+	v.offset = int64(binary.BigEndian.Uint64(state[:8]))
+	return nil
+}
+
+// Close implements io.Closer.
+func (v *VerifiedReader) Close() error {
+	if v.r == nil {
+		return nil
+	}
+	err := v.r.Close()
+	v.r = nil
+	return err
+}
@@ -0,0 +1,162 @@
+package filestore_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/hashing"
+	"github.com/networkteam/filestore/memory"
+)
+
+func TestFetchVerified(t *testing.T) {
+	ctx := context.Background()
+	content := strings.Repeat("Large content ", 1000)
+
+	store := memory.NewFilestore(memory.WithRecording())
+	hash, err := store.Store(ctx, strings.NewReader(content))
+	require.NoError(t, err)
+
+	t.Run("verifies content", func(t *testing.T) {
+		r, err := filestore.FetchVerified(ctx, store, hash)
+		require.NoError(t, err)
+		defer r.Close()
+
+		data, err := io.ReadAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, content, string(data))
+		assert.Equal(t, int64(len(content)), r.Offset())
+	})
+
+	t.Run("resumes with range after failed reads", func(t *testing.T) {
+		store.ResetCalls()
+		flaky := &flakyStore{Filestore: store, failAfter: 1000, failures: 3}
+
+		r, err := filestore.FetchVerified(ctx, flaky, hash, filestore.WithFetchRetryDelay(0))
+		require.NoError(t, err)
+		defer r.Close()
+
+		data, err := io.ReadAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, content, string(data))
+
+		var offsets []int64
+		for _, call := range store.Calls() {
+			require.Equal(t, memory.OpFetchRange, call.Op)
+			offsets = append(offsets, int64(len(content))-call.Bytes)
+		}
+		assert.Equal(t, []int64{0, 1000, 2000, 3000}, offsets)
+	})
+
+	t.Run("fails after retries without progress", func(t *testing.T) {
+		flaky := &flakyStore{Filestore: store, failAfter: 0, failures: 10}
+
+		r, err := filestore.FetchVerified(ctx, flaky, hash, filestore.WithFetchRetries(2), filestore.WithFetchRetryDelay(0))
+		require.NoError(t, err)
+		defer r.Close()
+
+		_, err = io.ReadAll(r)
+		assert.ErrorIs(t, err, errFlaky)
+	})
+
+	t.Run("skips content without range fetcher", func(t *testing.T) {
+		flaky := &flakyStore{Filestore: store, failAfter: 1000, failures: 2}
+
+		r, err := filestore.FetchVerified(ctx, struct{ filestore.Fetcher }{flaky}, hash, filestore.WithFetchRetryDelay(0))
+		require.NoError(t, err)
+		defer r.Close()
+
+		data, err := io.ReadAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, content, string(data))
+	})
+
+	t.Run("resumes from state", func(t *testing.T) {
+		r, err := filestore.FetchVerified(ctx, store, hash)
+		require.NoError(t, err)
+		start := make([]byte, 5000)
+		_, err = io.ReadFull(r, start)
+		require.NoError(t, err)
+		state, err := r.State()
+		require.NoError(t, err)
+		require.NoError(t, r.Close())
+
+		r, err = filestore.FetchVerified(ctx, store, hash, filestore.WithResumeState(state))
+		require.NoError(t, err)
+		defer r.Close()
+		assert.Equal(t, int64(5000), r.Offset())
+
+		rest, err := io.ReadAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, content, string(start)+string(rest))
+
+		_, err = filestore.FetchVerified(ctx, store, hash, filestore.WithResumeState([]byte("invalid")))
+		assert.ErrorIs(t, err, filestore.ErrInvalidResumeState)
+	})
+
+	t.Run("detects mismatch", func(t *testing.T) {
+		wrongHash := hashing.HashBytes([]byte("Other content"))
+		require.NoError(t, store.StoreHashed(ctx, strings.NewReader("Tampered content"), wrongHash))
+
+		r, err := filestore.FetchVerified(ctx, store, wrongHash)
+		require.NoError(t, err)
+		defer r.Close()
+
+		_, err = io.ReadAll(r)
+		assert.ErrorIs(t, err, filestore.ErrHashMismatch)
+	})
+
+	t.Run("missing hash", func(t *testing.T) {
+		_, err := filestore.FetchVerified(ctx, store, hashing.HashBytes([]byte("Missing content")))
+		assert.ErrorIs(t, err, filestore.ErrNotExist)
+	})
+
+	t.Run("invalid hash", func(t *testing.T) {
+		_, err := filestore.FetchVerified(ctx, store, "invalid")
+		assert.Error(t, err)
+	})
+}
+
+var errFlaky = errors.New("connection reset")
+
+// flakyStore returns readers that fail after failAfter bytes for the first failures fetches.
+type flakyStore struct {
+	*memory.Filestore
+	failAfter int64
+	failures  int
+}
+
+func (s *flakyStore) Fetch(ctx context.Context, hash string) (io.ReadCloser, error) {
+	r, err := s.Filestore.Fetch(ctx, hash)
+	return s.wrap(r), err
+}
+
+func (s *flakyStore) FetchRange(ctx context.Context, hash string, offset, length int64) (io.ReadCloser, error) {
+	r, err := s.Filestore.FetchRange(ctx, hash, offset, length)
+	return s.wrap(r), err
+}
+
+func (s *flakyStore) wrap(r io.ReadCloser) io.ReadCloser {
+	if r == nil || s.failures == 0 {
+		return r
+	}
+	s.failures--
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.MultiReader(io.LimitReader(r, s.failAfter), &errReader{err: errFlaky}), r}
+}
+
+type errReader struct {
+	err error
+}
+
+func (r *errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
@@ -4,6 +4,7 @@ import (
 	"context"
 	"errors"
 	"io"
+	"time"
 )
 
 // A Storer stores the content of the given reader (e.g. a file) and returns a consistent hash for later retrieval.
@@ -17,16 +18,44 @@ type HashedStorer interface {
 	StoreHashed(ctx context.Context, r io.Reader, hash string) error
 }
 
+// An IfAbsentStorer stores a file with the given hash only if it does not exist yet.
+type IfAbsentStorer interface {
+	// StoreIfAbsent stores the content of r with the given hash if no file with the hash exists and returns true
+	// if the content was stored or false if the file already existed.
+	StoreIfAbsent(ctx context.Context, r io.Reader, hash string) (created bool, err error)
+}
+
 // A Fetcher fetches the content of the given hash in the form of an io.Reader.
 type Fetcher interface {
 	Fetch(ctx context.Context, hash string) (io.ReadCloser, error)
 }
 
+// An InfoFetcher fetches the content of the given hash together with information about the file, so no separate
+// request is needed (e.g. to set the Content-Length and Content-Type headers of a response).
+// If the file does not exist, ErrNotExist is returned.
+type InfoFetcher interface {
+	FetchInfo(ctx context.Context, hash string) (io.ReadCloser, ObjectInfo, error)
+}
+
+// A RangeFetcher fetches a part of the content of the given hash, starting at offset with up to length bytes
+// (or up to the end if length is negative). An offset at the end of the file returns an empty reader, an offset
+// beyond the end returns ErrInvalidRange. If the file does not exist, ErrNotExist is returned.
+type RangeFetcher interface {
+	FetchRange(ctx context.Context, hash string, offset, length int64) (io.ReadCloser, error)
+}
+
 // An Exister checks if the given hash exists in the store.
 type Exister interface {
 	Exists(ctx context.Context, hash string) (bool, error)
 }
 
+// A BatchExister checks which of multiple hashes exist with fewer round trips than calling Exists for each hash
+// (see ExistsMany).
+type BatchExister interface {
+	// ExistsMany returns whether each of the given hashes exists, keyed by hash.
+	ExistsMany(ctx context.Context, hashes []string) (map[string]bool, error)
+}
+
 // An Iterator iterates over all stored files and returns their hashes in batches.
 type Iterator interface {
 	// Iterate calls callback with a maxBatch number of asset hashes.
@@ -34,22 +63,114 @@ type Iterator interface {
 	Iterate(ctx context.Context, maxBatch int, callback func(hashes []string) error) error
 }
 
+// A SortedIterator is an Iterator that returns hashes in lexicographic order, so the files of two stores can be
+// compared without buffering them (see Diff).
+type SortedIterator interface {
+	Iterator
+	// IteratesSorted returns true if Iterate returns hashes in lexicographic order.
+	IteratesSorted() bool
+}
+
+// A ParallelIterator iterates over all stored files with multiple concurrent workers (e.g. by hash prefix).
+type ParallelIterator interface {
+	// IterateParallel calls callback with batches of asset hashes from up to workers concurrent goroutines,
+	// so callback must be safe for concurrent use. The order of hashes is undefined.
+	// If callback returns an error, iteration stops and the error is returned.
+	IterateParallel(ctx context.Context, workers int, callback func(hashes []string) error) error
+}
+
 // A Remover can remove a file with the given hash.
 type Remover interface {
 	Remove(ctx context.Context, hash string) error
 }
 
+// A BatchRemover can remove multiple files with one request (e.g. the S3 DeleteObjects API).
+type BatchRemover interface {
+	// RemoveBatch removes the files with the given hashes. Missing files are ignored.
+	RemoveBatch(ctx context.Context, hashes []string) error
+}
+
 // A Sizer can return the size of a file with the given hash.
 type Sizer interface {
 	Size(ctx context.Context, hash string) (int64, error)
 }
 
+// A Stater returns information about the file with the given hash.
+// If the file does not exist, ErrNotExist is returned.
+type Stater interface {
+	Stat(ctx context.Context, hash string) (ObjectInfo, error)
+}
+
+// ObjectInfo describes a stored file.
+type ObjectInfo struct {
+	Hash string
+	Size int64
+	// ContentType is the content type given when storing the file (empty if unknown).
+	ContentType string
+	// ContentDisposition is the content disposition given when storing the file (empty if unknown).
+	ContentDisposition string
+}
+
 // An ImgproxyURLSourcer can return the source URL to original file for imgproxy.
 type ImgproxyURLSourcer interface {
 	// ImgproxyURLSource gets the source URL to original file (e.g. for use with imgproxy).
 	ImgproxyURLSource(hash string) (string, error)
 }
 
+// A DownloadURLer returns a URL to download the file with the given hash directly from the backend
+// (e.g. a pre-signed URL) that is valid for the given expiry. The filename is used for the content disposition.
+type DownloadURLer interface {
+	DownloadURL(ctx context.Context, hash, filename string, expiry time.Duration) (string, error)
+}
+
+// A PublicURLer returns a stable public URL for the file with the given hash (e.g. on a CDN), so links to assets
+// can be rendered without knowing the backend. The URL does not expire, unlike the URL of a DownloadURLer.
+type PublicURLer interface {
+	PublicURL(hash string) (string, error)
+}
+
+// An Archiver moves files to cheaper cold storage (e.g. S3 Glacier) and restores them on demand. Archived files
+// still exist, but fetching them fails with ErrArchived until they are restored.
+type Archiver interface {
+	// Archive moves the file with the given hash to cold storage. Archiving an archived file does nothing.
+	Archive(ctx context.Context, hash string) error
+	// Restore requests the restore of an archived file. Restores can take hours (see RestoreStatus).
+	// Requesting the restore of a file that is being restored does nothing.
+	Restore(ctx context.Context, hash string) error
+	// RestoreStatus returns the archive and restore status of the file with the given hash.
+	RestoreStatus(ctx context.Context, hash string) (RestoreStatus, error)
+}
+
+// RestoreStatus describes whether a file is archived and the progress of its restore.
+type RestoreStatus struct {
+	// Archived is true if the file is in cold storage.
+	Archived bool
+	// Restoring is true while a restore of the archived file is in progress.
+	Restoring bool
+	// Restored is true if the archived file can be fetched.
+	Restored bool
+	// RestoredUntil is the time when a temporary restored copy is removed again (zero if not restored or if the
+	// file was restored permanently).
+	RestoredUntil time.Time
+}
+
+// A Pinger checks that the backend of a store is reachable (e.g. the bucket of an S3 store exists), see HealthHandler.
+type Pinger interface {
+	Ping(ctx context.Context) error
+}
+
+// A Prefetcher copies files into a faster tier of a store before they are fetched (e.g. a cache on an edge node).
+type Prefetcher interface {
+	// Prefetch copies the files with the given hashes into the faster tier with bounded concurrency.
+	Prefetch(ctx context.Context, hashes []string) error
+}
+
+// A LocalPather returns the path of a stored file on the local filesystem (e.g. to hard link it, see ExportTree).
+// The file must not be modified.
+type LocalPather interface {
+	LocalPath(ctx context.Context, hash string) (string, error)
+}
+
 // A FileStore bundles all the interfaces above.
 type FileStore interface {
 	Storer
@@ -62,5 +183,55 @@ type FileStore interface {
 	ImgproxyURLSourcer
 }
 
+// Usage describes the total number of stored files and their size.
+type Usage struct {
+	Objects int64
+	Bytes   int64
+}
+
 // ErrNotExist is returned when a stored file does not exist.
 var ErrNotExist = errors.New("file does not exist")
+
+// ErrReadOnly is returned by mutating operations of a file store that was opened read-only.
+var ErrReadOnly = errors.New("file store is read-only")
+
+// ErrNoSpace is returned when a file cannot be stored because there is not enough free space.
+var ErrNoSpace = errors.New("not enough free space")
+
+// ErrContentRejected is returned when content is rejected before it is stored (e.g. by a virus scanner).
+var ErrContentRejected = errors.New("content rejected")
+
+// ErrTooLarge is returned when a file cannot be stored because it exceeds the maximum object size.
+var ErrTooLarge = errors.New("file exceeds max size")
+
+// ErrInvalidRange is returned by FetchRange if the offset is negative or beyond the end of the file.
+var ErrInvalidRange = errors.New("invalid range")
+
+// ErrHashMismatch is returned when fetched content does not match its hash.
+var ErrHashMismatch = errors.New("content does not match hash")
+
+// ErrNotModified is returned by FetchIfNoneMatch if the ETag matches the hash, so the content does not need to be sent.
+var ErrNotModified = errors.New("not modified")
+
+// ErrArchived is returned when fetching a file that was moved to cold storage and was not restored (see Archiver).
+var ErrArchived = errors.New("file is archived")
+
+// ErrAlreadyExists is returned when a file with the hash already exists with different content and the store
+// is write-once (e.g. local.WithWriteOnce), so the existing file is not overwritten.
+var ErrAlreadyExists = errors.New("file already exists with different content")
+
+// NotExistError is returned when a stored file with the hash does not exist for an operation.
+// It wraps ErrNotExist, so errors.Is(err, ErrNotExist) can be used to check for missing files.
+type NotExistError struct {
+	// Op is the operation (e.g. "fetch", "size", "remove" or "stat").
+	Op   string
+	Hash string
+}
+
+func (e *NotExistError) Error() string {
+	return e.Op + " " + e.Hash + ": " + ErrNotExist.Error()
+}
+
+func (e *NotExistError) Unwrap() error {
+	return ErrNotExist
+}
@@ -0,0 +1,504 @@
+// Package filestoretest implements conformance tests for file store implementations.
+package filestoretest
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/hashing"
+	"github.com/networkteam/filestore/resumable"
+)
+
+// missingHash is a valid hash of content that is never stored by the tests.
+const missingHash = "0000000000000000000000000000000000000000000000000000000000000000"
+
+// TestNotExist checks that Fetch, Size, Remove, Stat, FetchInfo and FetchRange (if implemented) of store return a
+// filestore.NotExistError with the operation and hash for a missing file.
+func TestNotExist(t *testing.T, store filestore.FileStore) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	t.Run("Fetch", func(t *testing.T) {
+		r, err := store.Fetch(ctx, missingHash)
+		if err == nil {
+			_ = r.Close()
+		}
+		checkNotExist(t, err, "fetch")
+	})
+
+	t.Run("Size", func(t *testing.T) {
+		_, err := store.Size(ctx, missingHash)
+		checkNotExist(t, err, "size")
+	})
+
+	t.Run("Remove", func(t *testing.T) {
+		err := store.Remove(ctx, missingHash)
+		checkNotExist(t, err, "remove")
+	})
+
+	t.Run("Stat", func(t *testing.T) {
+		stater, ok := store.(filestore.Stater)
+		if !ok {
+			t.Skip("store does not implement filestore.Stater")
+		}
+		_, err := stater.Stat(ctx, missingHash)
+		checkNotExist(t, err, "stat")
+	})
+
+	t.Run("FetchInfo", func(t *testing.T) {
+		infoFetcher, ok := store.(filestore.InfoFetcher)
+		if !ok {
+			t.Skip("store does not implement filestore.InfoFetcher")
+		}
+		r, _, err := infoFetcher.FetchInfo(ctx, missingHash)
+		if err == nil {
+			_ = r.Close()
+		}
+		checkNotExist(t, err, "fetch info")
+	})
+
+	t.Run("FetchRange", func(t *testing.T) {
+		rangeFetcher, ok := store.(filestore.RangeFetcher)
+		if !ok {
+			t.Skip("store does not implement filestore.RangeFetcher")
+		}
+		r, err := rangeFetcher.FetchRange(ctx, missingHash, 0, -1)
+		if err == nil {
+			_ = r.Close()
+		}
+		checkNotExist(t, err, "fetch range")
+	})
+
+	t.Run("Exists", func(t *testing.T) {
+		exists, err := store.Exists(ctx, missingHash)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if exists {
+			t.Error("expected missing file to not exist")
+		}
+	})
+}
+
+// TestStoreIfAbsent checks that StoreIfAbsent of store (if implemented) only stores missing files and reports
+// whether the content was stored.
+func TestStoreIfAbsent(t *testing.T, store filestore.FileStore) {
+	t.Helper()
+
+	ifAbsentStorer, ok := store.(filestore.IfAbsentStorer)
+	if !ok {
+		t.Skip("store does not implement filestore.IfAbsentStorer")
+	}
+
+	ctx := context.Background()
+	const hash = "1111111111111111111111111111111111111111111111111111111111111111"
+
+	created, err := ifAbsentStorer.StoreIfAbsent(ctx, strings.NewReader("First content"), hash)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !created {
+		t.Error("expected missing file to be created")
+	}
+
+	created, err = ifAbsentStorer.StoreIfAbsent(ctx, strings.NewReader("Second content"), hash)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if created {
+		t.Error("expected existing file to not be created")
+	}
+
+	checkContent(t, store, hash, "First content")
+}
+
+// TestExistsMany checks that ExistsMany of store (if implemented) reports existing and missing files.
+func TestExistsMany(t *testing.T, store filestore.FileStore) {
+	t.Helper()
+
+	batchExister, ok := store.(filestore.BatchExister)
+	if !ok {
+		t.Skip("store does not implement filestore.BatchExister")
+	}
+
+	ctx := context.Background()
+
+	hash, err := store.Store(ctx, strings.NewReader("Existing content"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	exists, err := batchExister.ExistsMany(ctx, []string{hash, missingHash})
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(exists) != 2 || !exists[hash] || exists[missingHash] {
+		t.Errorf("expected only %s to exist, got %v", hash, exists)
+	}
+
+	exists, err = batchExister.ExistsMany(ctx, nil)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if len(exists) != 0 {
+		t.Errorf("expected no results, got %v", exists)
+	}
+}
+
+// TestKeyEncoding checks that store (configured with the key encoding) returns encoded keys and reads files
+// stored with bare hex keys by their encoded keys.
+func TestKeyEncoding(t *testing.T, store filestore.FileStore, encoding hashing.KeyEncoding) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	hexHash, err := hashing.HashReader(strings.NewReader("Encoded content"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	key, err := store.Store(ctx, strings.NewReader("Encoded content"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if key != encoding.Encode(hexHash) {
+		t.Errorf("expected key %q, got %q", encoding.Encode(hexHash), key)
+	}
+	checkContent(t, store, key, "Encoded content")
+
+	// Store a file with a bare hex key like before the encoding was set
+	legacyHash, err := hashing.HashReader(strings.NewReader("Legacy content"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err = store.StoreHashed(ctx, strings.NewReader("Legacy content"), legacyHash); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	legacyKey := encoding.Encode(legacyHash)
+
+	exists, err := store.Exists(ctx, legacyKey)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if !exists {
+		t.Error("expected legacy file to exist by encoded key")
+	}
+	checkContent(t, store, legacyKey, "Legacy content")
+	size, err := store.Size(ctx, legacyKey)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if size != int64(len("Legacy content")) {
+		t.Errorf("expected size %d, got %d", len("Legacy content"), size)
+	}
+
+	if err = store.Remove(ctx, legacyKey); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	exists, err = store.Exists(ctx, legacyHash)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if exists {
+		t.Error("expected legacy file to be removed by encoded key")
+	}
+}
+
+// TestKeyDerivation checks that store (configured with the key derivation) returns derived keys instead of the
+// content hash and fetches files by their derived keys.
+func TestKeyDerivation(t *testing.T, store filestore.FileStore, derivation hashing.KeyDerivation) {
+	t.Helper()
+
+	ctx := context.Background()
+
+	hexHash, err := hashing.HashReader(strings.NewReader("Derived content"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	key, err := store.Store(ctx, strings.NewReader("Derived content"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if key != derivation(hexHash) {
+		t.Errorf("expected key %q, got %q", derivation(hexHash), key)
+	}
+	if key == hexHash {
+		t.Error("expected key to differ from content hash")
+	}
+	checkContent(t, store, key, "Derived content")
+
+	exists, err := store.Exists(ctx, hexHash)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if exists {
+		t.Error("expected file to not exist by content hash")
+	}
+
+	// Storing the same content again returns the same key
+	key2, err := store.Store(ctx, strings.NewReader("Derived content"))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if key2 != key {
+		t.Errorf("expected key %q, got %q", key, key2)
+	}
+}
+
+// TestWriteOnce checks that StoreHashed of store (configured to be write-once) accepts the same content for an
+// existing hash and refuses different content with filestore.ErrAlreadyExists.
+func TestWriteOnce(t *testing.T, store filestore.FileStore) {
+	t.Helper()
+
+	ctx := context.Background()
+	const hash = "2222222222222222222222222222222222222222222222222222222222222222"
+
+	if err := store.StoreHashed(ctx, strings.NewReader("First content"), hash); err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if err := store.StoreHashed(ctx, strings.NewReader("First content"), hash); err != nil {
+		t.Errorf("expected no error for same content, got %v", err)
+	}
+
+	for _, r := range []io.Reader{
+		strings.NewReader("Other content"),
+		filestore.NewReader(strings.NewReader("Other"), filestore.WithSize(5)),
+	} {
+		if err := store.StoreHashed(ctx, r, hash); !errors.Is(err, filestore.ErrAlreadyExists) {
+			t.Errorf("expected error wrapping filestore.ErrAlreadyExists for different content, got %v", err)
+		}
+	}
+
+	checkContent(t, store, hash, "First content")
+}
+
+// TestFetchInfo checks that FetchInfo of store (if implemented) returns the content of a file together with its size,
+// content type and content disposition.
+func TestFetchInfo(t *testing.T, store filestore.FileStore) {
+	t.Helper()
+
+	infoFetcher, ok := store.(filestore.InfoFetcher)
+	if !ok {
+		t.Skip("store does not implement filestore.InfoFetcher")
+	}
+
+	ctx := context.Background()
+	hash, err := store.Store(ctx, filestore.NewReader(
+		strings.NewReader("Info content"),
+		filestore.WithSize(12),
+		filestore.WithContentType("text/plain"),
+		filestore.WithContentDisposition(`attachment; filename="info.txt"`),
+	))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	r, info, err := infoFetcher.FetchInfo(ctx, hash)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer r.Close()
+
+	content, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if string(content) != "Info content" {
+		t.Errorf("expected content %q, got %q", "Info content", content)
+	}
+
+	expected := filestore.ObjectInfo{
+		Hash:               hash,
+		Size:               12,
+		ContentType:        "text/plain",
+		ContentDisposition: `attachment; filename="info.txt"`,
+	}
+	if info != expected {
+		t.Errorf("expected info %+v, got %+v", expected, info)
+	}
+}
+
+// TestFetchRange checks that FetchRange of store (if implemented) returns the requested part of the content.
+func TestFetchRange(t *testing.T, store filestore.FileStore) {
+	t.Helper()
+
+	rangeFetcher, ok := store.(filestore.RangeFetcher)
+	if !ok {
+		t.Skip("store does not implement filestore.RangeFetcher")
+	}
+
+	ctx := context.Background()
+	hash, err := store.Store(ctx, filestore.NewReader(strings.NewReader("Range content"), filestore.WithSize(13)))
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+
+	for _, test := range []struct {
+		name           string
+		offset, length int64
+		expected       string
+	}{
+		{name: "whole content", offset: 0, length: -1, expected: "Range content"},
+		{name: "to end", offset: 6, length: -1, expected: "content"},
+		{name: "with length", offset: 2, length: 3, expected: "nge"},
+		{name: "length beyond end", offset: 6, length: 100, expected: "content"},
+		{name: "offset at end", offset: 13, length: -1, expected: ""},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			r, err := rangeFetcher.FetchRange(ctx, hash, test.offset, test.length)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			defer r.Close()
+
+			content, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatalf("expected no error, got %v", err)
+			}
+			if string(content) != test.expected {
+				t.Errorf("expected content %q, got %q", test.expected, content)
+			}
+		})
+	}
+
+	t.Run("offset beyond end", func(t *testing.T) {
+		r, err := rangeFetcher.FetchRange(ctx, hash, 14, -1)
+		if err == nil {
+			_ = r.Close()
+		}
+		if !errors.Is(err, filestore.ErrInvalidRange) {
+			t.Errorf("expected error wrapping filestore.ErrInvalidRange, got %v", err)
+		}
+	})
+}
+
+// TestResumableUpload checks that the store implements resumable.Uploader: chunks are appended at the current offset,
+// the finalized upload is stored by its hash and unknown uploads return resumable.ErrUploadNotFound.
+func TestResumableUpload(t *testing.T, store filestore.FileStore) {
+	t.Helper()
+
+	uploader, ok := store.(resumable.Uploader)
+	if !ok {
+		t.Skip("store does not implement resumable.Uploader")
+	}
+
+	ctx := context.Background()
+
+	t.Run("append and finalize", func(t *testing.T) {
+		id, err := uploader.CreateUpload(ctx)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+
+		offset, err := uploader.AppendUpload(ctx, id, 0, strings.NewReader("Resumable "))
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if offset != 10 {
+			t.Errorf("expected offset 10, got %d", offset)
+		}
+
+		if _, err = uploader.AppendUpload(ctx, id, 0, strings.NewReader("Resumable ")); !errors.Is(err, resumable.ErrOffsetMismatch) {
+			t.Errorf("expected resumable.ErrOffsetMismatch for chunk at wrong offset, got %v", err)
+		}
+
+		if _, err = uploader.AppendUpload(ctx, id, offset, filestore.NewReader(strings.NewReader("content"), filestore.WithSize(7))); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		offset, err = uploader.UploadOffset(ctx, id)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if offset != 17 {
+			t.Errorf("expected offset 17, got %d", offset)
+		}
+
+		hash, err := uploader.FinalizeUpload(ctx, id)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if expected := hashing.HashBytes([]byte("Resumable content")); hash != expected {
+			t.Errorf("expected hash %s, got %s", expected, hash)
+		}
+		checkContent(t, store, hash, "Resumable content")
+
+		if _, err = uploader.UploadOffset(ctx, id); !errors.Is(err, resumable.ErrUploadNotFound) {
+			t.Errorf("expected resumable.ErrUploadNotFound after finalize, got %v", err)
+		}
+	})
+
+	t.Run("empty upload", func(t *testing.T) {
+		id, err := uploader.CreateUpload(ctx)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		hash, err := uploader.FinalizeUpload(ctx, id)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		checkContent(t, store, hash, "")
+	})
+
+	t.Run("abort", func(t *testing.T) {
+		id, err := uploader.CreateUpload(ctx)
+		if err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if _, err = uploader.AppendUpload(ctx, id, 0, strings.NewReader("Aborted content")); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if err = uploader.AbortUpload(ctx, id); err != nil {
+			t.Fatalf("expected no error, got %v", err)
+		}
+		if _, err = uploader.AppendUpload(ctx, id, 15, strings.NewReader("More")); !errors.Is(err, resumable.ErrUploadNotFound) {
+			t.Errorf("expected resumable.ErrUploadNotFound after abort, got %v", err)
+		}
+	})
+
+	t.Run("unknown upload", func(t *testing.T) {
+		for _, id := range []string{"unknown", "../../etc/passwd"} {
+			if _, err := uploader.UploadOffset(ctx, id); !errors.Is(err, resumable.ErrUploadNotFound) {
+				t.Errorf("expected resumable.ErrUploadNotFound for %q, got %v", id, err)
+			}
+			if _, err := uploader.FinalizeUpload(ctx, id); !errors.Is(err, resumable.ErrUploadNotFound) {
+				t.Errorf("expected resumable.ErrUploadNotFound for %q, got %v", id, err)
+			}
+		}
+	})
+}
+
+func checkContent(t *testing.T, store filestore.Fetcher, key, expected string) {
+	t.Helper()
+
+	r, err := store.Fetch(context.Background(), key)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	defer r.Close()
+	content, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatalf("expected no error, got %v", err)
+	}
+	if string(content) != expected {
+		t.Errorf("expected content %q, got %q", expected, content)
+	}
+}
+
+func checkNotExist(t *testing.T, err error, op string) {
+	t.Helper()
+
+	if !errors.Is(err, filestore.ErrNotExist) {
+		t.Fatalf("expected error wrapping filestore.ErrNotExist, got %v", err)
+	}
+	var notExistErr *filestore.NotExistError
+	if !errors.As(err, &notExistErr) {
+		t.Fatalf("expected *filestore.NotExistError, got %T", err)
+	}
+	if notExistErr.Op != op || notExistErr.Hash != missingHash {
+		t.Errorf("expected op %q and hash %q, got op %q and hash %q", op, missingHash, notExistErr.Op, notExistErr.Hash)
+	}
+}
@@ -0,0 +1,175 @@
+package filestore
+
+import (
+	"context"
+	"errors"
+	"io"
+	"io/fs"
+	"time"
+)
+
+// A FetchSizer can fetch files and return their size.
+type FetchSizer interface {
+	Fetcher
+	Sizer
+}
+
+// NewFS returns an fs.FS that opens files by hash from the given store (e.g. for use with http.FileServer via http.FS).
+// Opened files implement io.Seeker if the reader returned by Fetch does.
+// The root directory can be listed if the store also implements Iterator.
+//
+// Since fs.FS does not accept a context, all operations use context.Background().
+func NewFS(store FetchSizer) fs.FS {
+	return &hashFS{store: store}
+}
+
+type hashFS struct {
+	store FetchSizer
+}
+
+var _ fs.FS = &hashFS{}
+
+// Open implements fs.FS.
+func (h *hashFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	if name == "." {
+		return &hashDir{store: h.store}, nil
+	}
+
+	ctx := context.Background()
+
+	size, err := h.store.Size(ctx, name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: toFSError(err)}
+	}
+	r, err := h.store.Fetch(ctx, name)
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: toFSError(err)}
+	}
+
+	file := &hashFile{
+		ReadCloser: r,
+		info:       fileInfo{name: name, size: size},
+	}
+	if seeker, ok := r.(io.Seeker); ok {
+		return &seekableHashFile{hashFile: file, Seeker: seeker}, nil
+	}
+	return file, nil
+}
+
+func toFSError(err error) error {
+	if errors.Is(err, ErrNotExist) {
+		return fs.ErrNotExist
+	}
+	return err
+}
+
+type hashFile struct {
+	io.ReadCloser
+	info fileInfo
+}
+
+var _ fs.File = &hashFile{}
+
+// Stat implements fs.File.
+func (f *hashFile) Stat() (fs.FileInfo, error) {
+	return f.info, nil
+}
+
+type seekableHashFile struct {
+	*hashFile
+	io.Seeker
+}
+
+var _ io.ReadSeeker = &seekableHashFile{}
+
+type hashDir struct {
+	store   FetchSizer
+	entries []fs.DirEntry
+	read    bool
+}
+
+var _ fs.ReadDirFile = &hashDir{}
+
+// Stat implements fs.File.
+func (d *hashDir) Stat() (fs.FileInfo, error) {
+	return fileInfo{name: ".", dir: true}, nil
+}
+
+// Read implements fs.File.
+func (d *hashDir) Read([]byte) (int, error) {
+	return 0, &fs.PathError{Op: "read", Path: ".", Err: errors.New("is a directory")}
+}
+
+// Close implements fs.File.
+func (d *hashDir) Close() error {
+	return nil
+}
+
+// ReadDir implements fs.ReadDirFile. It lists all hashes if the store implements Iterator.
+func (d *hashDir) ReadDir(n int) ([]fs.DirEntry, error) {
+	if !d.read {
+		if err := d.readEntries(); err != nil {
+			return nil, &fs.PathError{Op: "readdir", Path: ".", Err: err}
+		}
+		d.read = true
+	}
+
+	if n <= 0 {
+		entries := d.entries
+		d.entries = nil
+		return entries, nil
+	}
+	if len(d.entries) == 0 {
+		return nil, io.EOF
+	}
+	if n > len(d.entries) {
+		n = len(d.entries)
+	}
+	entries := d.entries[:n]
+	d.entries = d.entries[n:]
+	return entries, nil
+}
+
+func (d *hashDir) readEntries() error {
+	iterator, ok := d.store.(Iterator)
+	if !ok {
+		return errors.New("store does not implement Iterator")
+	}
+
+	ctx := context.Background()
+
+	return iterator.Iterate(ctx, 100, func(hashes []string) error {
+		for _, hash := range hashes {
+			size, err := d.store.Size(ctx, hash)
+			if err != nil {
+				return err
+			}
+			d.entries = append(d.entries, fs.FileInfoToDirEntry(fileInfo{name: hash, size: size}))
+		}
+		return nil
+	})
+}
+
+type fileInfo struct {
+	name string
+	size int64
+	dir  bool
+}
+
+var _ fs.FileInfo = fileInfo{}
+
+func (i fileInfo) Name() string       { return i.name }
+func (i fileInfo) Size() int64        { return i.size }
+func (i fileInfo) ModTime() time.Time { return time.Time{} }
+func (i fileInfo) IsDir() bool        { return i.dir }
+func (i fileInfo) Sys() any           { return nil }
+
+func (i fileInfo) Mode() fs.FileMode {
+	if i.dir {
+		return fs.ModeDir | 0555
+	}
+	return 0444
+}
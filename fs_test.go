@@ -0,0 +1,50 @@
+package filestore_test
+
+import (
+	"context"
+	"io/fs"
+	"path"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/networkteam/filestore/local"
+	"github.com/networkteam/filestore/memory"
+)
+
+func TestNewFS(t *testing.T) {
+	testDir := t.TempDir()
+	ctx := context.Background()
+
+	store, err := local.NewFilestore(path.Join(testDir, "tmp"), path.Join(testDir, "assets"))
+	require.NoError(t, err)
+
+	hash, err := store.Store(ctx, strings.NewReader("Test content"))
+	require.NoError(t, err)
+	otherHash, err := store.Store(ctx, strings.NewReader("Other content"))
+	require.NoError(t, err)
+
+	err = fstest.TestFS(store.FS(), hash, otherHash)
+	require.NoError(t, err)
+
+	content, err := fs.ReadFile(store.FS(), hash)
+	require.NoError(t, err)
+	assert.Equal(t, "Test content", string(content))
+
+	_, err = fs.ReadFile(store.FS(), "a0b1c2d3e4f5")
+	require.ErrorIs(t, err, fs.ErrNotExist)
+}
+
+func TestNewFS_Memory(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewFilestore()
+
+	hash, err := store.Store(ctx, strings.NewReader("Test content"))
+	require.NoError(t, err)
+
+	err = fstest.TestFS(store.FS(), hash)
+	require.NoError(t, err)
+}
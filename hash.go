@@ -0,0 +1,19 @@
+package filestore
+
+import (
+	"io"
+
+	"github.com/networkteam/filestore/hashing"
+)
+
+// Hash reads r until EOF and returns the hash of the content exactly like Store would (hex encoded SHA256) without
+// storing anything, e.g. to check with Exists if the content is already stored before uploading it.
+// Stores with a key encoding or derivation (e.g. local.WithKeyEncoding) return keys that differ from the hash.
+func Hash(r io.Reader) (string, error) {
+	return hashing.HashReader(r)
+}
+
+// HashBytes returns the hash of data like Hash.
+func HashBytes(data []byte) string {
+	return hashing.HashBytes(data)
+}
@@ -0,0 +1,34 @@
+package filestore_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/memory"
+)
+
+func TestHash(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewFilestore()
+
+	hash, err := filestore.Hash(strings.NewReader("Test content"))
+	require.NoError(t, err)
+	assert.Equal(t, hash, filestore.HashBytes([]byte("Test content")))
+
+	exists, err := store.Exists(ctx, hash)
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	storedHash, err := store.Store(ctx, strings.NewReader("Test content"))
+	require.NoError(t, err)
+	assert.Equal(t, storedHash, hash)
+
+	exists, err = store.Exists(ctx, hash)
+	require.NoError(t, err)
+	assert.True(t, exists)
+}
@@ -0,0 +1,105 @@
+// Package hashing computes hashes of content exactly like the file stores do (hex encoded SHA256),
+// so custom backends and callers can compute hashes consistently.
+package hashing
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"hash"
+	"io"
+	"os"
+
+	"github.com/networkteam/filestore/internal/bufpool"
+)
+
+// New returns a new digest for the hash of stored content (SHA256).
+func New() hash.Hash {
+	return sha256.New()
+}
+
+// HashingReader writes all content read from a reader into a digest.
+// Sum and SumHex return the hash of the content read so far, which is the hash of the whole content after EOF.
+type HashingReader struct {
+	r      io.Reader
+	digest hash.Hash
+	n      int64
+}
+
+// NewHashingReader returns a reader that hashes the content of r with the digest of the file stores (SHA256).
+func NewHashingReader(r io.Reader) *HashingReader {
+	return NewHashingReaderWithDigest(r, New())
+}
+
+// NewHashingReaderWithDigest returns a reader that hashes the content of r with the given digest.
+func NewHashingReaderWithDigest(r io.Reader, digest hash.Hash) *HashingReader {
+	return &HashingReader{
+		r:      r,
+		digest: digest,
+	}
+}
+
+// Read implements io.Reader.
+func (h *HashingReader) Read(p []byte) (int, error) {
+	n, err := h.r.Read(p)
+	if n > 0 {
+		// Writing to a hash.Hash never returns an error
+		_, _ = h.digest.Write(p[:n])
+		h.n += int64(n)
+	}
+	return n, err
+}
+
+// Sum returns the digest of the content read so far.
+func (h *HashingReader) Sum() []byte {
+	return h.digest.Sum(nil)
+}
+
+// SumHex returns the hex encoded digest of the content read so far.
+func (h *HashingReader) SumHex() string {
+	return hex.EncodeToString(h.Sum())
+}
+
+// BytesRead returns the number of bytes read so far.
+func (h *HashingReader) BytesRead() int64 {
+	return h.n
+}
+
+// HashReader reads r until EOF and returns the hex encoded hash of the content.
+func HashReader(r io.Reader) (string, error) {
+	hr := NewHashingReader(r)
+	if _, err := bufpool.Copy(io.Discard, hr); err != nil {
+		return "", fmt.Errorf("hashing content: %w", err)
+	}
+	return hr.SumHex(), nil
+}
+
+// HashFile returns the hex encoded hash of the file content.
+func HashFile(path string) (string, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return "", fmt.Errorf("opening file: %w", err)
+	}
+	defer file.Close()
+
+	return HashReader(file)
+}
+
+// HashBytes returns the hex encoded hash of data.
+func HashBytes(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Equal reads a and b until EOF and reports whether their content is equal by comparing their hashes.
+func Equal(a, b io.Reader) (bool, error) {
+	hashA, err := HashReader(a)
+	if err != nil {
+		return false, err
+	}
+	hashB, err := HashReader(b)
+	if err != nil {
+		return false, err
+	}
+	return hashA == hashB, nil
+}
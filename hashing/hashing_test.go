@@ -0,0 +1,145 @@
+package hashing_test
+
+import (
+	"context"
+	"hash/fnv"
+	"io"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/networkteam/filestore/hashing"
+	"github.com/networkteam/filestore/memory"
+)
+
+const testContentHash = "9d9595c5d94fb65b824f56e9999527dba9542481580d69feb89056aabaa0aa87"
+
+func TestHashingReader(t *testing.T) {
+	hr := hashing.NewHashingReader(strings.NewReader("Test content"))
+
+	content, err := io.ReadAll(hr)
+	require.NoError(t, err)
+
+	assert.Equal(t, "Test content", string(content))
+	assert.Equal(t, testContentHash, hr.SumHex())
+	assert.Equal(t, int64(12), hr.BytesRead())
+
+	hr = hashing.NewHashingReaderWithDigest(strings.NewReader("Test content"), fnv.New64a())
+	_, err = io.Copy(io.Discard, hr)
+	require.NoError(t, err)
+	assert.Len(t, hr.Sum(), 8)
+}
+
+func TestHashReaderMatchesStore(t *testing.T) {
+	hash, err := hashing.HashReader(strings.NewReader("Test content"))
+	require.NoError(t, err)
+	assert.Equal(t, testContentHash, hash)
+	assert.Equal(t, testContentHash, hashing.HashBytes([]byte("Test content")))
+
+	storedHash, err := memory.NewFilestore().Store(context.Background(), strings.NewReader("Test content"))
+	require.NoError(t, err)
+	assert.Equal(t, storedHash, hash)
+}
+
+func TestHashFile(t *testing.T) {
+	filePath := path.Join(t.TempDir(), "test.txt")
+	require.NoError(t, os.WriteFile(filePath, []byte("Test content"), 0644))
+
+	hash, err := hashing.HashFile(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, testContentHash, hash)
+}
+
+func TestKeyEncodings(t *testing.T) {
+	tests := []struct {
+		name     string
+		encoding hashing.KeyEncoding
+		key      string
+	}{
+		{name: "hex", encoding: hashing.HexKeys, key: testContentHash},
+		{name: "prefixed", encoding: hashing.PrefixedKeys, key: "sha256-" + testContentHash},
+		{name: "multihash", encoding: hashing.MultihashKeys, key: "1220" + testContentHash},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			encoding, err := hashing.ParseKeyEncoding(tt.name)
+			require.NoError(t, err)
+			assert.Equal(t, tt.encoding, encoding)
+
+			assert.Equal(t, tt.key, tt.encoding.Encode(testContentHash))
+
+			hexHash, ok := tt.encoding.Decode(tt.key)
+			assert.True(t, ok)
+			assert.Equal(t, testContentHash, hexHash)
+
+			// Bare hex keys are decoded by all encodings
+			hexHash, ok = tt.encoding.Decode(testContentHash)
+			assert.True(t, ok)
+			assert.Equal(t, testContentHash, hexHash)
+
+			_, ok = tt.encoding.Decode("../" + testContentHash)
+			assert.False(t, ok)
+
+			legacyKey, ok := hashing.LegacyKey(tt.encoding, tt.key)
+			assert.Equal(t, tt.encoding != hashing.HexKeys, ok)
+			if ok {
+				assert.Equal(t, testContentHash, legacyKey)
+			}
+		})
+	}
+
+	_, err := hashing.ParseKeyEncoding("base64")
+	assert.ErrorIs(t, err, hashing.ErrUnknownKeyEncoding)
+}
+
+func TestValidateKey(t *testing.T) {
+	sha256Length, err := hashing.ParseHexLength("sha256")
+	require.NoError(t, err)
+	assert.Equal(t, 64, sha256Length)
+
+	_, err = hashing.ParseHexLength("crc32")
+	assert.ErrorIs(t, err, hashing.ErrUnknownAlgorithm)
+
+	for _, test := range []struct {
+		name     string
+		key      string
+		encoding hashing.KeyEncoding
+		valid    bool
+	}{
+		{name: "hex", key: testContentHash, encoding: hashing.HexKeys, valid: true},
+		{name: "prefixed", key: "sha256-" + testContentHash, encoding: hashing.PrefixedKeys, valid: true},
+		{name: "bare hex with prefixed encoding", key: testContentHash, encoding: hashing.PrefixedKeys, valid: true},
+		{name: "uppercase", key: strings.ToUpper(testContentHash), encoding: hashing.HexKeys},
+		{name: "too short", key: testContentHash[:40], encoding: hashing.HexKeys},
+		{name: "too long", key: testContentHash + "00", encoding: hashing.HexKeys},
+		{name: "path traversal", key: "../" + testContentHash[3:], encoding: hashing.HexKeys},
+		{name: "empty", key: "", encoding: hashing.HexKeys},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			err := hashing.ValidateKey(test.key, test.encoding, sha256Length)
+			if test.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.ErrorIs(t, err, hashing.ErrInvalidKey)
+			}
+		})
+	}
+
+	// Any length is valid without an expected length
+	assert.NoError(t, hashing.ValidateKey(testContentHash[:40], hashing.HexKeys, 0))
+}
+
+func TestHMACKeys(t *testing.T) {
+	derive := hashing.HMACKeys([]byte("secret"))
+
+	key := derive(testContentHash)
+	assert.Len(t, key, 64)
+	assert.NotEqual(t, testContentHash, key)
+	assert.Equal(t, key, derive(testContentHash), "derivation is deterministic")
+	assert.NotEqual(t, key, hashing.HMACKeys([]byte("other secret"))(testContentHash))
+	assert.NoError(t, hashing.ValidateKey(key, hashing.HexKeys, 64))
+}
@@ -0,0 +1,167 @@
+package hashing
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// Algorithm is the name of the hash algorithm of stored content, used by PrefixedKeys.
+const Algorithm = "sha256"
+
+// multihashPrefix is the hex encoded multihash code (0x12) and digest length (0x20) of SHA256.
+const multihashPrefix = "1220"
+
+// ErrUnknownKeyEncoding is returned by ParseKeyEncoding for unknown names.
+var ErrUnknownKeyEncoding = errors.New("unknown key encoding")
+
+// A KeyEncoding encodes the hex encoded hash of stored content to the key returned by a file store.
+// Key encodings can be set on the file stores (e.g. local.WithKeyEncoding), so the hash algorithm can be identified
+// from the key alone and changed later.
+// Encode must preserve prefixes (encoded keys of hashes with a common prefix start with the encoded prefix),
+// so stores can list keys by hash prefix.
+type KeyEncoding interface {
+	// Encode returns the key for a hex encoded hash.
+	Encode(hexHash string) string
+	// Decode returns the hex encoded hash of a key and false if the key is invalid.
+	// Bare hex keys (see HexKeys) are decoded by all encodings, so files stored before changing the encoding
+	// can still be read.
+	Decode(key string) (hexHash string, ok bool)
+}
+
+var (
+	// HexKeys encodes keys as bare hex encoded hashes (e.g. "2cf24d…"). This is the default of the file stores.
+	HexKeys KeyEncoding = hexKeys{}
+	// PrefixedKeys encodes keys as hex encoded hashes prefixed with the algorithm (e.g. "sha256-2cf24d…").
+	PrefixedKeys KeyEncoding = prefixedKeys{}
+	// MultihashKeys encodes keys as hex encoded multihashes (e.g. "12202cf24d…").
+	MultihashKeys KeyEncoding = multihashKeys{}
+)
+
+// ParseKeyEncoding returns the key encoding with the given name ("hex", "prefixed" or "multihash"),
+// e.g. for the keyEncoding query parameter of a DSN. An empty name returns HexKeys.
+func ParseKeyEncoding(name string) (KeyEncoding, error) {
+	switch name {
+	case "", "hex":
+		return HexKeys, nil
+	case "prefixed":
+		return PrefixedKeys, nil
+	case "multihash":
+		return MultihashKeys, nil
+	}
+	return nil, fmt.Errorf("%w: %q", ErrUnknownKeyEncoding, name)
+}
+
+// LegacyKey returns the bare hex key of a key that is not bare hex in the given encoding, so it can be used as
+// a fallback for reading files stored before the encoding was changed. It returns false if there is no legacy key.
+func LegacyKey(encoding KeyEncoding, key string) (string, bool) {
+	hexHash, ok := encoding.Decode(key)
+	if !ok || hexHash == key {
+		return "", false
+	}
+	return hexHash, true
+}
+
+// A KeyDerivation derives the hash used for the key of stored content from the hex encoded content hash (see HMACKeys).
+// The derived hash must be lowercase hex, it is encoded with the key encoding of the store.
+type KeyDerivation func(hexHash string) string
+
+// HMACKeys derives keys as the hex encoded HMAC-SHA256 of the hex encoded content hash with the secret, so the key
+// of a file cannot be computed from its content alone (e.g. to fetch a known file from a shared bucket).
+// Keys are no longer the hash of the content, so the content cannot be verified against the key without the secret.
+func HMACKeys(secret []byte) KeyDerivation {
+	return func(hexHash string) string {
+		mac := hmac.New(sha256.New, secret)
+		mac.Write([]byte(hexHash))
+		return hex.EncodeToString(mac.Sum(nil))
+	}
+}
+
+type hexKeys struct{}
+
+func (hexKeys) Encode(hexHash string) string {
+	return hexHash
+}
+
+func (hexKeys) Decode(key string) (string, bool) {
+	return key, isHex(key)
+}
+
+type prefixedKeys struct{}
+
+func (prefixedKeys) Encode(hexHash string) string {
+	return Algorithm + "-" + hexHash
+}
+
+func (prefixedKeys) Decode(key string) (string, bool) {
+	key = strings.TrimPrefix(key, Algorithm+"-")
+	return key, isHex(key)
+}
+
+type multihashKeys struct{}
+
+func (multihashKeys) Encode(hexHash string) string {
+	return multihashPrefix + hexHash
+}
+
+func (multihashKeys) Decode(key string) (string, bool) {
+	if len(key) == len(multihashPrefix)+2*32 && strings.HasPrefix(key, multihashPrefix) {
+		key = key[len(multihashPrefix):]
+	}
+	return key, isHex(key)
+}
+
+// isHex checks if s is a non-empty lowercase hex string.
+func isHex(s string) bool {
+	if s == "" {
+		return false
+	}
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if (c < '0' || c > '9') && (c < 'a' || c > 'f') {
+			return false
+		}
+	}
+	return true
+}
+
+// ErrInvalidKey is returned by ValidateKey for keys that are not valid keys of the expected format.
+var ErrInvalidKey = errors.New("invalid key")
+
+// ErrUnknownAlgorithm is returned by ParseHexLength for unknown hash algorithms.
+var ErrUnknownAlgorithm = errors.New("unknown hash algorithm")
+
+// hexLengths are the lengths of hex encoded hashes of known hash algorithms.
+var hexLengths = map[string]int{
+	"md5":    32,
+	"sha1":   40,
+	"sha256": 64,
+	"sha384": 96,
+	"sha512": 128,
+}
+
+// ParseHexLength returns the length of hex encoded hashes of the named hash algorithm (e.g. 64 for "sha256"), so keys
+// can be validated for stores with content hashed by other systems. An empty name returns the length for Algorithm.
+func ParseHexLength(algorithm string) (int, error) {
+	if algorithm == "" {
+		algorithm = Algorithm
+	}
+	if n, ok := hexLengths[strings.ToLower(algorithm)]; ok {
+		return n, nil
+	}
+	return 0, fmt.Errorf("%w: %q", ErrUnknownAlgorithm, algorithm)
+}
+
+// ValidateKey checks that key is a key of the encoding with a lowercase hex encoded hash of hexLength characters
+// (any length if hexLength is 0) and returns an error wrapping ErrInvalidKey otherwise.
+// Valid keys never contain path separators or other characters that could be used for path traversal.
+func ValidateKey(key string, encoding KeyEncoding, hexLength int) error {
+	hexHash, ok := encoding.Decode(key)
+	if !ok || (hexLength > 0 && len(hexHash) != hexLength) {
+		return fmt.Errorf("%w: %q", ErrInvalidKey, key)
+	}
+	return nil
+}
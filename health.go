@@ -0,0 +1,109 @@
+package filestore
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// DefaultHealthTimeout is the default timeout of a health check by HealthHandler.
+const DefaultHealthTimeout = 5 * time.Second
+
+type healthOptions struct {
+	writeProbe bool
+	timeout    time.Duration
+}
+
+// A HealthOption configures CheckHealth and HealthHandler.
+type HealthOption func(*healthOptions)
+
+// WithWriteProbe additionally stores and removes a small probe file with random content, so a store that is reachable
+// but not writable (e.g. full or without permissions) is reported as unhealthy. Stores opened read-only always fail
+// the write probe.
+func WithWriteProbe() HealthOption {
+	return func(opts *healthOptions) {
+		opts.writeProbe = true
+	}
+}
+
+// WithHealthTimeout sets the timeout of a health check by HealthHandler (defaults to DefaultHealthTimeout).
+func WithHealthTimeout(timeout time.Duration) HealthOption {
+	return func(opts *healthOptions) {
+		opts.timeout = timeout
+	}
+}
+
+// CheckHealth pings store (if it implements Pinger) and runs the write probe if enabled with WithWriteProbe.
+func CheckHealth(ctx context.Context, store FileStore, opts ...HealthOption) error {
+	o := healthOptionsFrom(opts)
+
+	if pinger, ok := store.(Pinger); ok {
+		if err := pinger.Ping(ctx); err != nil {
+			return fmt.Errorf("pinging store: %w", err)
+		}
+	}
+
+	if o.writeProbe {
+		if err := writeProbe(ctx, store); err != nil {
+			return fmt.Errorf("write probe: %w", err)
+		}
+	}
+
+	return nil
+}
+
+// HealthHandler returns a handler for health checks of store (see CheckHealth), e.g. for liveness and readiness
+// probes:
+//
+//	http.Handle("/healthz", filestore.HealthHandler(store))
+//	http.Handle("/readyz", filestore.HealthHandler(store, filestore.WithWriteProbe()))
+//
+// It responds with 200 OK if the store is healthy and with 503 Service Unavailable and the error otherwise.
+func HealthHandler(store FileStore, opts ...HealthOption) http.Handler {
+	o := healthOptionsFrom(opts)
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx, cancel := context.WithTimeout(r.Context(), o.timeout)
+		defer cancel()
+
+		w.Header().Set("Cache-Control", "no-store")
+		if err := CheckHealth(ctx, store, opts...); err != nil {
+			http.Error(w, err.Error(), http.StatusServiceUnavailable)
+			return
+		}
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		_, _ = w.Write([]byte("ok\n"))
+	})
+}
+
+func healthOptionsFrom(opts []HealthOption) healthOptions {
+	o := healthOptions{
+		timeout: DefaultHealthTimeout,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// writeProbe stores and removes a probe file. The content is random, so the probe never removes a stored file
+// or the probe file of a concurrent check.
+func writeProbe(ctx context.Context, store FileStore) error {
+	nonce := make([]byte, 16)
+	if _, err := rand.Read(nonce); err != nil {
+		return fmt.Errorf("generating probe content: %w", err)
+	}
+
+	hash, err := store.Store(ctx, strings.NewReader("filestore health probe "+hex.EncodeToString(nonce)))
+	if err != nil {
+		return fmt.Errorf("storing: %w", err)
+	}
+	if err = store.Remove(ctx, hash); err != nil {
+		return fmt.Errorf("removing: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,69 @@
+package filestore_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/memory"
+)
+
+type unwritableStore struct {
+	filestore.FileStore
+}
+
+func (unwritableStore) Store(ctx context.Context, r io.Reader) (string, error) {
+	return "", filestore.ErrNoSpace
+}
+
+type unreachableStore struct {
+	filestore.FileStore
+}
+
+func (unreachableStore) Ping(ctx context.Context) error {
+	return errors.New("connection refused")
+}
+
+func TestHealthHandler(t *testing.T) {
+	store := memory.NewFilestore()
+
+	for _, test := range []struct {
+		name           string
+		store          filestore.FileStore
+		opts           []filestore.HealthOption
+		expectedStatus int
+	}{
+		{name: "healthy", store: store, expectedStatus: http.StatusOK},
+		{name: "healthy with write probe", store: store, opts: []filestore.HealthOption{filestore.WithWriteProbe()}, expectedStatus: http.StatusOK},
+		{name: "unreachable", store: unreachableStore{store}, expectedStatus: http.StatusServiceUnavailable},
+		{name: "unwritable", store: unwritableStore{store}, expectedStatus: http.StatusOK},
+		{name: "unwritable with write probe", store: unwritableStore{store}, opts: []filestore.HealthOption{filestore.WithWriteProbe()}, expectedStatus: http.StatusServiceUnavailable},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			filestore.HealthHandler(test.store, test.opts...).ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/healthz", nil))
+
+			assert.Equal(t, test.expectedStatus, rec.Code)
+			assert.Equal(t, "no-store", rec.Header().Get("Cache-Control"))
+		})
+	}
+
+	t.Run("removes probe file", func(t *testing.T) {
+		require.NoError(t, filestore.CheckHealth(context.Background(), store, filestore.WithWriteProbe()))
+
+		var hashes []string
+		err := store.Iterate(context.Background(), 10, func(batch []string) error {
+			hashes = append(hashes, batch...)
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Empty(t, hashes)
+	})
+}
@@ -0,0 +1,93 @@
+package filestore
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// RedirectDownload redirects (302 Found) to a download URL of the file with the given hash (e.g. a pre-signed
+// S3 URL), so the content is served by the backend instead of streaming it through the application.
+func RedirectDownload(w http.ResponseWriter, r *http.Request, store DownloadURLer, hash, filename string, expiry time.Duration) {
+	downloadURL, err := store.DownloadURL(r.Context(), hash, filename, expiry)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Cache-Control", "no-store")
+	http.Redirect(w, r, downloadURL, http.StatusFound)
+}
+
+// ETag returns the (strong) ETag of the content with the given hash, e.g. for the ETag header of a response.
+func ETag(hash string) string {
+	return `"` + hash + `"`
+}
+
+// ETagMatches returns true if the value of an If-None-Match header matches the ETag of the hash.
+// The value can be a list of (weak or strong) ETags or "*".
+func ETagMatches(ifNoneMatch, hash string) bool {
+	for _, etag := range strings.Split(ifNoneMatch, ",") {
+		etag = strings.TrimSpace(etag)
+		if etag == "*" || strings.TrimPrefix(etag, "W/") == ETag(hash) {
+			return true
+		}
+	}
+	return false
+}
+
+// ServeHash serves the content of the given hash from store and answers conditional requests with a matching
+// If-None-Match header with 304 Not Modified without fetching the content (see FetchIfNoneMatch).
+// The ETag is set to the hash, the Content-Type, Content-Disposition and Content-Length headers are set from the
+// information of FetchInfo. Headers already set in the response (e.g. Cache-Control) are not overwritten.
+// Archived files that were not restored are answered with 503 Service Unavailable (see Archiver).
+// Stores with their own handler (e.g. local.Filestore.ServeHash) should be preferred to support range requests.
+func ServeHash(w http.ResponseWriter, r *http.Request, store Fetcher, hash string) {
+	var (
+		rc   io.ReadCloser
+		info ObjectInfo
+		err  error
+	)
+	if ifNoneMatch := r.Header.Get("If-None-Match"); ETagMatches(ifNoneMatch, hash) {
+		_, err = FetchIfNoneMatch(r.Context(), store, hash, ifNoneMatch)
+	} else {
+		rc, info, err = FetchInfo(r.Context(), store, hash)
+	}
+
+	switch {
+	case errors.Is(err, ErrNotModified):
+		w.Header().Set("ETag", ETag(hash))
+		w.WriteHeader(http.StatusNotModified)
+		return
+	case errors.Is(err, ErrNotExist):
+		http.NotFound(w, r)
+		return
+	case errors.Is(err, ErrArchived):
+		http.Error(w, "File is archived", http.StatusServiceUnavailable)
+		return
+	case err != nil:
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	defer rc.Close()
+
+	header := w.Header()
+	header.Set("ETag", ETag(hash))
+	if info.ContentType != "" && header.Get("Content-Type") == "" {
+		header.Set("Content-Type", info.ContentType)
+	}
+	if info.ContentDisposition != "" && header.Get("Content-Disposition") == "" {
+		header.Set("Content-Disposition", info.ContentDisposition)
+	}
+	if info.Size > 0 {
+		header.Set("Content-Length", strconv.FormatInt(info.Size, 10))
+	}
+
+	if r.Method == http.MethodHead {
+		return
+	}
+	_, _ = Copy(w, rc)
+}
@@ -0,0 +1,119 @@
+package filestore_test
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/hashing"
+	"github.com/networkteam/filestore/memory"
+	"github.com/networkteam/filestore/tiering"
+)
+
+type staticDownloadURLer string
+
+func (u staticDownloadURLer) DownloadURL(ctx context.Context, hash, filename string, expiry time.Duration) (string, error) {
+	return string(u) + hash + "?filename=" + filename, nil
+}
+
+func TestRedirectDownload(t *testing.T) {
+	rec := httptest.NewRecorder()
+	req := httptest.NewRequest(http.MethodGet, "/download/abcdef", nil)
+	filestore.RedirectDownload(rec, req, staticDownloadURLer("https://s3.example.com/bucket/"), "abcdef", "file.txt", time.Minute)
+
+	assert.Equal(t, http.StatusFound, rec.Code)
+	assert.Equal(t, "https://s3.example.com/bucket/abcdef?filename=file.txt", rec.Header().Get("Location"))
+}
+
+func TestETagMatches(t *testing.T) {
+	assert.True(t, filestore.ETagMatches(`"abcdef"`, "abcdef"))
+	assert.True(t, filestore.ETagMatches(`W/"abcdef"`, "abcdef"))
+	assert.True(t, filestore.ETagMatches(`"123", "abcdef"`, "abcdef"))
+	assert.True(t, filestore.ETagMatches(`*`, "abcdef"))
+	assert.False(t, filestore.ETagMatches(`"123"`, "abcdef"))
+	assert.False(t, filestore.ETagMatches(``, "abcdef"))
+}
+
+func TestFetchIfNoneMatch(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewFilestore(memory.WithRecording())
+	hash, err := store.Store(ctx, strings.NewReader("Hello World"))
+	require.NoError(t, err)
+	store.ResetCalls()
+
+	_, err = filestore.FetchIfNoneMatch(ctx, store, hash, filestore.ETag(hash))
+	assert.ErrorIs(t, err, filestore.ErrNotModified)
+	for _, call := range store.Calls() {
+		assert.NotEqual(t, memory.OpFetch, call.Op)
+	}
+
+	rc, err := filestore.FetchIfNoneMatch(ctx, store, hash, `"other"`)
+	require.NoError(t, err)
+	defer rc.Close()
+	content, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	assert.Equal(t, "Hello World", string(content))
+
+	missingHash := hashing.HashBytes([]byte("Missing"))
+	_, err = filestore.FetchIfNoneMatch(ctx, store, missingHash, filestore.ETag(missingHash))
+	assert.ErrorIs(t, err, filestore.ErrNotExist)
+}
+
+func TestServeHash(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewFilestore()
+	hash, err := store.Store(ctx, filestore.NewReader(strings.NewReader("Hello World"), filestore.WithContentType("text/plain")))
+	require.NoError(t, err)
+
+	t.Run("serves content", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		filestore.ServeHash(rec, httptest.NewRequest(http.MethodGet, "/"+hash, nil), store, hash)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, `"`+hash+`"`, rec.Header().Get("ETag"))
+		assert.Equal(t, "text/plain", rec.Header().Get("Content-Type"))
+		assert.Equal(t, "11", rec.Header().Get("Content-Length"))
+		assert.Equal(t, "Hello World", rec.Body.String())
+	})
+
+	t.Run("not modified", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/"+hash, nil)
+		req.Header.Set("If-None-Match", `W/"`+hash+`"`)
+		filestore.ServeHash(rec, req, store, hash)
+
+		assert.Equal(t, http.StatusNotModified, rec.Code)
+		assert.Equal(t, `"`+hash+`"`, rec.Header().Get("ETag"))
+		assert.Empty(t, rec.Body.String())
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		missingHash := hashing.HashBytes([]byte("Missing"))
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/"+missingHash, nil)
+		req.Header.Set("If-None-Match", filestore.ETag(missingHash))
+		filestore.ServeHash(rec, req, store, missingHash)
+
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+
+	t.Run("archived", func(t *testing.T) {
+		tieredStore := tiering.NewFilestore(memory.NewFilestore(), memory.NewFilestore())
+		hash, err := tieredStore.Store(ctx, strings.NewReader("Old content"))
+		require.NoError(t, err)
+		require.NoError(t, tieredStore.Archive(ctx, hash))
+
+		rec := httptest.NewRecorder()
+		filestore.ServeHash(rec, httptest.NewRequest(http.MethodGet, "/"+hash, nil), tieredStore, hash)
+
+		assert.Equal(t, http.StatusServiceUnavailable, rec.Code)
+	})
+}
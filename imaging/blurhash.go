@@ -0,0 +1,122 @@
+package imaging
+
+import (
+	"errors"
+	"image"
+	"math"
+	"strings"
+)
+
+// ErrInvalidComponents is returned by Blurhash if the number of components is not between 1 and 9.
+var ErrInvalidComponents = errors.New("blurhash components must be between 1 and 9")
+
+const base83Chars = "0123456789ABCDEFGHIJKLMNOPQRSTUVWXYZabcdefghijklmnopqrstuvwxyz#$%*+,-.:;=?@[]^_{|}~"
+
+// Blurhash encodes the image as a BlurHash (see https://blurha.sh) with the given number of components.
+func Blurhash(img image.Image, xComponents, yComponents int) (string, error) {
+	if xComponents < 1 || xComponents > 9 || yComponents < 1 || yComponents > 9 {
+		return "", ErrInvalidComponents
+	}
+
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+
+	// Convert the image to linear RGB once
+	linear := make([][3]float64, width*height)
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			r, g, b, _ := img.At(bounds.Min.X+x, bounds.Min.Y+y).RGBA()
+			linear[y*width+x] = [3]float64{srgbToLinear(r >> 8), srgbToLinear(g >> 8), srgbToLinear(b >> 8)}
+		}
+	}
+
+	factors := make([][3]float64, 0, xComponents*yComponents)
+	for j := 0; j < yComponents; j++ {
+		for i := 0; i < xComponents; i++ {
+			factors = append(factors, multiplyBasisFunction(linear, width, height, i, j))
+		}
+	}
+
+	var sb strings.Builder
+	encodeBase83(&sb, (xComponents-1)+(yComponents-1)*9, 1)
+
+	dc, ac := factors[0], factors[1:]
+
+	maximumValue := 1.0
+	if len(ac) > 0 {
+		var actualMaximumValue float64
+		for _, factor := range ac {
+			for _, v := range factor {
+				actualMaximumValue = math.Max(actualMaximumValue, math.Abs(v))
+			}
+		}
+		quantisedMaximumValue := int(math.Max(0, math.Min(82, math.Floor(actualMaximumValue*166-0.5))))
+		maximumValue = float64(quantisedMaximumValue+1) / 166
+		encodeBase83(&sb, quantisedMaximumValue, 1)
+	} else {
+		encodeBase83(&sb, 0, 1)
+	}
+
+	encodeBase83(&sb, linearToSrgb(dc[0])<<16+linearToSrgb(dc[1])<<8+linearToSrgb(dc[2]), 4)
+
+	for _, factor := range ac {
+		quantR := quantiseAC(factor[0], maximumValue)
+		quantG := quantiseAC(factor[1], maximumValue)
+		quantB := quantiseAC(factor[2], maximumValue)
+		encodeBase83(&sb, quantR*19*19+quantG*19+quantB, 2)
+	}
+
+	return sb.String(), nil
+}
+
+func multiplyBasisFunction(linear [][3]float64, width, height, i, j int) [3]float64 {
+	var r, g, b float64
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			basis := math.Cos(math.Pi*float64(i)*float64(x)/float64(width)) *
+				math.Cos(math.Pi*float64(j)*float64(y)/float64(height))
+			pixel := linear[y*width+x]
+			r += basis * pixel[0]
+			g += basis * pixel[1]
+			b += basis * pixel[2]
+		}
+	}
+
+	normalisation := 2.0
+	if i == 0 && j == 0 {
+		normalisation = 1
+	}
+	scale := normalisation / float64(width*height)
+	return [3]float64{r * scale, g * scale, b * scale}
+}
+
+func quantiseAC(value, maximumValue float64) int {
+	return int(math.Max(0, math.Min(18, math.Floor(signPow(value/maximumValue, 0.5)*9+9.5))))
+}
+
+func signPow(value, exp float64) float64 {
+	return math.Copysign(math.Pow(math.Abs(value), exp), value)
+}
+
+func srgbToLinear(value uint32) float64 {
+	v := float64(value) / 255
+	if v <= 0.04045 {
+		return v / 12.92
+	}
+	return math.Pow((v+0.055)/1.055, 2.4)
+}
+
+func linearToSrgb(value float64) int {
+	v := math.Max(0, math.Min(1, value))
+	if v <= 0.0031308 {
+		return int(v*12.92*255 + 0.5)
+	}
+	return int((1.055*math.Pow(v, 1/2.4)-0.055)*255 + 0.5)
+}
+
+func encodeBase83(sb *strings.Builder, value, length int) {
+	for i := 1; i <= length; i++ {
+		digit := (value / int(math.Pow(83, float64(length-i)))) % 83
+		sb.WriteByte(base83Chars[digit])
+	}
+}
@@ -0,0 +1,159 @@
+package imaging
+
+import (
+	"bytes"
+	"encoding/binary"
+	"time"
+)
+
+// EXIF contains selected EXIF fields of an image.
+type EXIF struct {
+	Make  string
+	Model string
+	// DateTime is the date and time of the last change (without time zone).
+	DateTime time.Time
+	// DateTimeOriginal is the date and time the image was taken (without time zone).
+	DateTimeOriginal time.Time
+}
+
+const (
+	exifTagMake             = 0x010F
+	exifTagModel            = 0x0110
+	exifTagOrientation      = 0x0112
+	exifTagDateTime         = 0x0132
+	exifTagExifIFD          = 0x8769
+	exifTagDateTimeOriginal = 0x9003
+
+	exifTypeASCII = 2
+	exifTypeShort = 3
+	exifTypeLong  = 4
+
+	exifDateTimeLayout = "2006:01:02 15:04:05"
+)
+
+// parseJPEGExif finds the EXIF segment in the beginning of JPEG data and returns the orientation and selected fields.
+// Malformed or missing EXIF data is ignored.
+func parseJPEGExif(data []byte) (orientation int, exif EXIF) {
+	tiff := findExifSegment(data)
+	if len(tiff) < 8 {
+		return 0, EXIF{}
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 0, EXIF{}
+	}
+
+	p := exifParser{tiff: tiff, order: order}
+	var exifIFDOffset uint32
+	p.readIFD(order.Uint32(tiff[4:8]), func(tag uint16, typ uint16, count uint32, value []byte) {
+		switch tag {
+		case exifTagOrientation:
+			if typ == exifTypeShort {
+				orientation = int(order.Uint16(value))
+			}
+		case exifTagMake:
+			exif.Make = p.ascii(typ, count, value)
+		case exifTagModel:
+			exif.Model = p.ascii(typ, count, value)
+		case exifTagDateTime:
+			exif.DateTime = parseExifDateTime(p.ascii(typ, count, value))
+		case exifTagExifIFD:
+			if typ == exifTypeLong {
+				exifIFDOffset = order.Uint32(value)
+			}
+		}
+	})
+	if exifIFDOffset > 0 {
+		p.readIFD(exifIFDOffset, func(tag uint16, typ uint16, count uint32, value []byte) {
+			if tag == exifTagDateTimeOriginal {
+				exif.DateTimeOriginal = parseExifDateTime(p.ascii(typ, count, value))
+			}
+		})
+	}
+
+	return orientation, exif
+}
+
+// findExifSegment returns the TIFF data of the APP1 EXIF segment of JPEG data.
+func findExifSegment(data []byte) []byte {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return nil
+	}
+
+	pos := 2
+	for pos+4 <= len(data) {
+		if data[pos] != 0xFF {
+			return nil
+		}
+		marker := data[pos+1]
+		// Start of scan or end of image: no more metadata segments
+		if marker == 0xDA || marker == 0xD9 {
+			return nil
+		}
+		length := int(binary.BigEndian.Uint16(data[pos+2 : pos+4]))
+		end := pos + 2 + length
+		if length < 2 || end > len(data) {
+			return nil
+		}
+		segment := data[pos+4 : end]
+		if marker == 0xE1 && bytes.HasPrefix(segment, []byte("Exif\x00\x00")) {
+			return segment[6:]
+		}
+		pos = end
+	}
+	return nil
+}
+
+type exifParser struct {
+	tiff  []byte
+	order binary.ByteOrder
+}
+
+// readIFD calls fn for every entry of the IFD at offset with the 4 byte value field of the entry.
+func (p exifParser) readIFD(offset uint32, fn func(tag uint16, typ uint16, count uint32, value []byte)) {
+	if uint64(offset)+2 > uint64(len(p.tiff)) {
+		return
+	}
+	entries := int(p.order.Uint16(p.tiff[offset:]))
+	for i := 0; i < entries; i++ {
+		start := int(offset) + 2 + i*12
+		if start+12 > len(p.tiff) {
+			return
+		}
+		entry := p.tiff[start : start+12]
+		fn(p.order.Uint16(entry[0:2]), p.order.Uint16(entry[2:4]), p.order.Uint32(entry[4:8]), entry[8:12])
+	}
+}
+
+// ascii returns the string of an ASCII entry, which is stored in the value field or at the offset in it.
+func (p exifParser) ascii(typ uint16, count uint32, value []byte) string {
+	if typ != exifTypeASCII {
+		return ""
+	}
+
+	var data []byte
+	if count <= 4 {
+		data = value[:count]
+	} else {
+		offset := p.order.Uint32(value)
+		if uint64(offset)+uint64(count) > uint64(len(p.tiff)) {
+			return ""
+		}
+		data = p.tiff[offset : offset+count]
+	}
+	return string(bytes.TrimRight(data, "\x00 "))
+}
+
+func parseExifDateTime(s string) time.Time {
+	t, err := time.Parse(exifDateTimeLayout, s)
+	if err != nil {
+		return time.Time{}
+	}
+	return t
+}
@@ -0,0 +1,278 @@
+// Package imaging analyzes image content while it is stored (e.g. to extract dimensions and EXIF data or to compute
+// a BlurHash placeholder).
+// GIF, JPEG and PNG images are supported, other content is stored without analysis.
+package imaging
+
+import (
+	"bytes"
+	"context"
+	"image"
+	_ "image/gif"  // register GIF decoder
+	_ "image/jpeg" // register JPEG decoder
+	_ "image/png"  // register PNG decoder
+	"io"
+
+	"github.com/networkteam/filestore"
+)
+
+// Result is the result of storing and analyzing content.
+type Result struct {
+	Hash string
+	// Format of the image (e.g. "jpeg" or "png", empty if the content is not a supported image).
+	Format string
+	// Width and Height of the image in pixels (as stored, without applying the EXIF orientation).
+	Width  int
+	Height int
+	// Orientation is the EXIF orientation (1-8, 0 if unknown).
+	Orientation int
+	// EXIF contains selected EXIF fields of JPEG images.
+	EXIF EXIF
+	// Blurhash of the image (empty if the content is not a supported image or BlurHash is disabled).
+	Blurhash string
+}
+
+// DefaultMaxPixels is the default maximum number of pixels (width * height) of images that are decoded to compute
+// a BlurHash (see WithMaxPixels).
+const DefaultMaxPixels = 50_000_000
+
+type options struct {
+	blurhashX, blurhashY int
+	noBlurhash           bool
+	maxPixels            int64
+}
+
+// Option is a functional option for analyzing images.
+type Option func(*options)
+
+// WithBlurhashComponents sets the number of BlurHash components (defaults to 4x3).
+func WithBlurhashComponents(xComponents, yComponents int) Option {
+	return func(opts *options) {
+		opts.blurhashX = xComponents
+		opts.blurhashY = yComponents
+	}
+}
+
+// WithoutBlurhash disables computing a BlurHash. Images are not decoded completely then,
+// only the dimensions and EXIF data are extracted.
+func WithoutBlurhash() Option {
+	return func(opts *options) {
+		opts.noBlurhash = true
+	}
+}
+
+// WithMaxPixels sets the maximum number of pixels (width * height) of images that are decoded to compute a BlurHash
+// (defaults to DefaultMaxPixels). Decoding needs memory for every pixel, so for larger images (or images declaring
+// huge dimensions in their header) only the dimensions and EXIF data are extracted.
+func WithMaxPixels(maxPixels int64) Option {
+	return func(opts *options) {
+		opts.maxPixels = maxPixels
+	}
+}
+
+func newOptions(opts []Option) options {
+	o := options{
+		blurhashX: 4,
+		blurhashY: 3,
+		maxPixels: DefaultMaxPixels,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// exifMaxLength is the number of bytes at the beginning of the content that are searched for EXIF data.
+const exifMaxLength = 128 * 1024
+
+// blurhashSampleSize is the max width and height of the sampled image used for computing the BlurHash.
+const blurhashSampleSize = 64
+
+// Store stores the content of r in the store and analyzes it while it is read by the store.
+// The content is streamed and not buffered. If the content is not a supported image, the result only contains the hash.
+func Store(ctx context.Context, store filestore.Storer, r io.Reader, opts ...Option) (Result, error) {
+	var result Result
+	err := analyzed(r, newOptions(opts), &result, func(r io.Reader) (err error) {
+		result.Hash, err = store.Store(ctx, r)
+		return err
+	})
+	if err != nil {
+		return Result{}, err
+	}
+	return result, nil
+}
+
+// Filestore wraps a file store and analyzes images while they are stored.
+// Only the methods of filestore.FileStore are available on the wrapper.
+type Filestore struct {
+	filestore.FileStore
+
+	onAnalyzed func(ctx context.Context, result Result)
+	options    options
+}
+
+var _ filestore.FileStore = &Filestore{}
+
+// NewFilestore creates a file store that calls onAnalyzed with the result of every stored image
+// (e.g. to save the dimensions and BlurHash in a database). It is not called for content that is not a supported image.
+func NewFilestore(store filestore.FileStore, onAnalyzed func(ctx context.Context, result Result), opts ...Option) *Filestore {
+	return &Filestore{
+		FileStore:  store,
+		onAnalyzed: onAnalyzed,
+		options:    newOptions(opts),
+	}
+}
+
+// Store stores and analyzes the content.
+func (f *Filestore) Store(ctx context.Context, r io.Reader) (string, error) {
+	var result Result
+	err := analyzed(r, f.options, &result, func(r io.Reader) (err error) {
+		result.Hash, err = f.FileStore.Store(ctx, r)
+		return err
+	})
+	if err != nil {
+		return "", err
+	}
+
+	f.notify(ctx, result)
+	return result.Hash, nil
+}
+
+// StoreHashed stores and analyzes the content.
+func (f *Filestore) StoreHashed(ctx context.Context, r io.Reader, hash string) error {
+	result := Result{Hash: hash}
+	err := analyzed(r, f.options, &result, func(r io.Reader) error {
+		return f.FileStore.StoreHashed(ctx, r, hash)
+	})
+	if err != nil {
+		return err
+	}
+
+	f.notify(ctx, result)
+	return nil
+}
+
+func (f *Filestore) notify(ctx context.Context, result Result) {
+	if result.Format != "" {
+		f.onAnalyzed(ctx, result)
+	}
+}
+
+// analyzed calls store with a reader that tees the content to an image decoder and sets the analysis in result.
+func analyzed(r io.Reader, o options, result *Result, store func(r io.Reader) error) error {
+	pr, pw := io.Pipe()
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		analyze(pr, o, result)
+		// Drain the remaining content, so the store is not blocked
+		_, _ = io.Copy(io.Discard, pr)
+	}()
+
+	err := store(newTeeReader(r, pw))
+	_ = pw.CloseWithError(err)
+	<-done
+
+	return err
+}
+
+func analyze(r io.Reader, o options, result *Result) {
+	head := &headBuffer{max: exifMaxLength}
+	r = io.TeeReader(r, head)
+
+	// The header read for the config is decoded again if the image is decoded completely
+	var configHead bytes.Buffer
+	config, format, err := image.DecodeConfig(io.TeeReader(r, &configHead))
+	if err != nil {
+		return
+	}
+
+	if o.noBlurhash || int64(config.Width)*int64(config.Height) > o.maxPixels {
+		result.Format = format
+		result.Width, result.Height = config.Width, config.Height
+	} else {
+		img, format, err := image.Decode(io.MultiReader(&configHead, r))
+		if err != nil {
+			return
+		}
+		result.Format = format
+		result.Width, result.Height = img.Bounds().Dx(), img.Bounds().Dy()
+
+		if blurhash, err := Blurhash(sample(img, blurhashSampleSize), o.blurhashX, o.blurhashY); err == nil {
+			result.Blurhash = blurhash
+		}
+	}
+
+	if result.Format == "jpeg" {
+		// The EXIF segment precedes the image data, so it was already read by the decoder
+		result.Orientation, result.EXIF = parseJPEGExif(head.Bytes())
+	}
+}
+
+// headBuffer keeps the first max bytes written to it.
+type headBuffer struct {
+	bytes.Buffer
+	max int
+}
+
+func (b *headBuffer) Write(p []byte) (int, error) {
+	if remaining := b.max - b.Len(); remaining > 0 {
+		if len(p) > remaining {
+			b.Buffer.Write(p[:remaining])
+		} else {
+			b.Buffer.Write(p)
+		}
+	}
+	return len(p), nil
+}
+
+// teeReader is like io.TeeReader but keeps the content type and disposition of the original reader.
+type teeReader struct {
+	r                  io.Reader
+	w                  io.Writer
+	contentType        string
+	contentDisposition string
+}
+
+// sizedTeeReader is a teeReader that keeps the size of the original reader.
+type sizedTeeReader struct {
+	*teeReader
+	size int64
+}
+
+// newTeeReader returns a reader that writes the content of r to w and implements the typed reader interfaces
+// (size, content type and disposition) implemented by r.
+func newTeeReader(r io.Reader, w io.Writer) io.Reader {
+	t := &teeReader{r: r, w: w}
+	if typedReader, ok := r.(filestore.ContentTyped); ok {
+		t.contentType = typedReader.ContentType()
+	}
+	if dispoReader, ok := r.(filestore.ContentDispositioned); ok {
+		t.contentDisposition = dispoReader.ContentDisposition()
+	}
+	if sizedReader, ok := r.(filestore.Sized); ok {
+		return &sizedTeeReader{teeReader: t, size: sizedReader.Size()}
+	}
+	return t
+}
+
+func (t *teeReader) Read(p []byte) (int, error) {
+	n, err := t.r.Read(p)
+	if n > 0 {
+		if _, writeErr := t.w.Write(p[:n]); writeErr != nil {
+			return n, writeErr
+		}
+	}
+	return n, err
+}
+
+func (t *teeReader) ContentType() string {
+	return t.contentType
+}
+
+func (t *teeReader) ContentDisposition() string {
+	return t.contentDisposition
+}
+
+func (t *sizedTeeReader) Size() int64 {
+	return t.size
+}
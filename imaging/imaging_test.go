@@ -0,0 +1,230 @@
+package imaging_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/networkteam/filestore/imaging"
+	"github.com/networkteam/filestore/memory"
+)
+
+func TestBlurhash(t *testing.T) {
+	img := solidImage(32, 24, color.RGBA{R: 255, A: 255})
+
+	blurhash, err := imaging.Blurhash(img, 4, 3)
+	require.NoError(t, err)
+	assert.Equal(t, "LDTI:j]9fQ]9|co1fQo1fQfQfQfQ", blurhash)
+
+	gradient := image.NewRGBA(image.Rect(0, 0, 40, 30))
+	for y := 0; y < 30; y++ {
+		for x := 0; x < 40; x++ {
+			gradient.Set(x, y, color.RGBA{R: uint8(x * 6), G: uint8(y * 8), B: 128, A: 255})
+		}
+	}
+	blurhash, err = imaging.Blurhash(gradient, 4, 3)
+	require.NoError(t, err)
+	assert.Equal(t, "LqG91]2swxX8l}WWjtf7gJfjfQfj", blurhash)
+
+	_, err = imaging.Blurhash(img, 10, 3)
+	assert.ErrorIs(t, err, imaging.ErrInvalidComponents)
+}
+
+func TestStore(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewFilestore()
+
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, solidImage(200, 160, color.RGBA{R: 255, A: 255})))
+
+	result, err := imaging.Store(ctx, store, bytes.NewReader(buf.Bytes()))
+	require.NoError(t, err)
+	assert.Equal(t, "L6TI:j]9fQ]9|cjtfQjtfQfQfQfQ", result.Blurhash)
+
+	exists, err := store.Exists(ctx, result.Hash)
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	// Other content is stored without analysis
+	result, err = imaging.Store(ctx, store, strings.NewReader("Not an image"))
+	require.NoError(t, err)
+	assert.NotEmpty(t, result.Hash)
+	assert.Empty(t, result.Blurhash)
+}
+
+func TestStore_MaxPixels(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewFilestore()
+
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, solidImage(200, 160, color.RGBA{R: 255, A: 255})))
+
+	result, err := imaging.Store(ctx, store, bytes.NewReader(buf.Bytes()), imaging.WithMaxPixels(100*100))
+	require.NoError(t, err)
+	assert.Equal(t, "png", result.Format)
+	assert.Equal(t, 200, result.Width)
+	assert.Empty(t, result.Blurhash, "large image should not be decoded")
+
+	// A small PNG declaring huge dimensions is not decoded with the default limit
+	result, err = imaging.Store(ctx, store, bytes.NewReader(withPNGDimensions(buf.Bytes(), 100_000, 100_000)))
+	require.NoError(t, err)
+	assert.Equal(t, "png", result.Format)
+	assert.Equal(t, 100_000, result.Width)
+	assert.Equal(t, 100_000, result.Height)
+	assert.Empty(t, result.Blurhash)
+}
+
+// withPNGDimensions replaces the dimensions in the IHDR chunk of PNG data.
+func withPNGDimensions(pngData []byte, width, height uint32) []byte {
+	data := append([]byte(nil), pngData...)
+	// The IHDR chunk follows the 8 byte signature: length (4), type (4), width (4), height (4), ... and CRC
+	binary.BigEndian.PutUint32(data[16:20], width)
+	binary.BigEndian.PutUint32(data[20:24], height)
+	binary.BigEndian.PutUint32(data[29:33], crc32.ChecksumIEEE(data[12:29]))
+	return data
+}
+
+func TestFilestore(t *testing.T) {
+	ctx := context.Background()
+
+	var results []imaging.Result
+	store := imaging.NewFilestore(memory.NewFilestore(), func(ctx context.Context, result imaging.Result) {
+		results = append(results, result)
+	}, imaging.WithBlurhashComponents(1, 1))
+
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, solidImage(10, 10, color.RGBA{R: 255, A: 255})))
+
+	hash, err := store.Store(ctx, &buf)
+	require.NoError(t, err)
+
+	_, err = store.Store(ctx, strings.NewReader("Not an image"))
+	require.NoError(t, err)
+
+	assert.Equal(t, []imaging.Result{{Hash: hash, Format: "png", Width: 10, Height: 10, Blurhash: "00TI:j"}}, results)
+}
+
+func TestStore_EXIF(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewFilestore()
+
+	var buf bytes.Buffer
+	require.NoError(t, jpeg.Encode(&buf, solidImage(40, 30, color.RGBA{B: 255, A: 255}), nil))
+	jpegData := withExif(buf.Bytes(), exifData())
+
+	result, err := imaging.Store(ctx, store, bytes.NewReader(jpegData), imaging.WithoutBlurhash())
+	require.NoError(t, err)
+
+	assert.Equal(t, imaging.Result{
+		Hash:        result.Hash,
+		Format:      "jpeg",
+		Width:       40,
+		Height:      30,
+		Orientation: 6,
+		EXIF: imaging.EXIF{
+			Make:             "Canon",
+			Model:            "Canon EOS 5D Mark IV",
+			DateTime:         time.Date(2023, 1, 2, 3, 4, 5, 0, time.UTC),
+			DateTimeOriginal: time.Date(2023, 1, 1, 12, 0, 0, 0, time.UTC),
+		},
+	}, result)
+}
+
+// exifData builds little endian TIFF data with IFD0 (make, model, orientation, date time, EXIF IFD pointer)
+// and an EXIF IFD (date time original).
+func exifData() []byte {
+	le := binary.LittleEndian
+	var tiff []byte
+	tiff = append(tiff, 'I', 'I', 42, 0, 8, 0, 0, 0)
+
+	const ifd0Entries = 5
+	ifd0End := 8 + 2 + ifd0Entries*12 + 4
+	exifIFDOffset := ifd0End
+	exifIFDEnd := exifIFDOffset + 2 + 12 + 4
+	dataOffset := exifIFDEnd
+
+	var values []byte
+	entry := func(tag, typ uint16, count uint32, value []byte) []byte {
+		e := make([]byte, 12)
+		le.PutUint16(e[0:], tag)
+		le.PutUint16(e[2:], typ)
+		le.PutUint32(e[4:], count)
+		copy(e[8:], value)
+		return e
+	}
+	asciiEntry := func(tag uint16, s string) []byte {
+		offset := make([]byte, 4)
+		le.PutUint32(offset, uint32(dataOffset+len(values)))
+		values = append(values, append([]byte(s), 0)...)
+		return entry(tag, 2, uint32(len(s)+1), offset)
+	}
+	u16 := func(v uint16) []byte { b := make([]byte, 4); le.PutUint16(b, v); return b }
+	u32 := func(v uint32) []byte { b := make([]byte, 4); le.PutUint32(b, v); return b }
+
+	tiff = append(tiff, u16(ifd0Entries)[:2]...)
+	tiff = append(tiff, asciiEntry(0x010F, "Canon")...)
+	tiff = append(tiff, asciiEntry(0x0110, "Canon EOS 5D Mark IV")...)
+	tiff = append(tiff, entry(0x0112, 3, 1, u16(6))...)
+	tiff = append(tiff, asciiEntry(0x0132, "2023:01:02 03:04:05")...)
+	tiff = append(tiff, entry(0x8769, 4, 1, u32(uint32(exifIFDOffset)))...)
+	tiff = append(tiff, 0, 0, 0, 0)
+
+	tiff = append(tiff, u16(1)[:2]...)
+	tiff = append(tiff, asciiEntry(0x9003, "2023:01:01 12:00:00")...)
+	tiff = append(tiff, 0, 0, 0, 0)
+
+	return append(tiff, values...)
+}
+
+// withExif inserts an APP1 EXIF segment after the start of image marker of JPEG data.
+func withExif(jpegData, tiff []byte) []byte {
+	segment := append([]byte("Exif\x00\x00"), tiff...)
+	var out []byte
+	out = append(out, jpegData[:2]...)
+	out = append(out, 0xFF, 0xE1, byte((len(segment)+2)>>8), byte(len(segment)+2))
+	out = append(out, segment...)
+	return append(out, jpegData[2:]...)
+}
+
+func solidImage(width, height int, c color.Color) image.Image {
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, c)
+		}
+	}
+	return img
+}
+
+func TestResize(t *testing.T) {
+	img := image.NewRGBA(image.Rect(0, 0, 40, 20))
+	for y := 0; y < 20; y++ {
+		for x := 0; x < 40; x++ {
+			if x < 20 {
+				img.Set(x, y, color.RGBA{R: 255, A: 255})
+			} else {
+				img.Set(x, y, color.RGBA{B: 255, A: 255})
+			}
+		}
+	}
+
+	resized := imaging.Resize(img, 4, 2)
+	assert.Equal(t, image.Rect(0, 0, 4, 2), resized.Bounds())
+	assert.Equal(t, color.RGBA{R: 255, A: 255}, resized.At(0, 0))
+	assert.Equal(t, color.RGBA{B: 255, A: 255}, resized.At(3, 1))
+
+	// Pixels covering both halves are averaged
+	resized = imaging.Resize(img, 1, 1)
+	assert.Equal(t, color.RGBA{R: 127, B: 127, A: 255}, resized.At(0, 0))
+}
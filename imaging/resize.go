@@ -0,0 +1,56 @@
+package imaging
+
+import (
+	"image"
+	"image/draw"
+)
+
+// Resize scales img to width x height pixels with a box filter, so every pixel of the result is the average of the
+// pixels it covers in img. It is meant for downscaling (e.g. thumbnails), enlarging repeats pixels.
+func Resize(img image.Image, width, height int) *image.RGBA {
+	width, height = max1(width), max1(height)
+	bounds := img.Bounds()
+	srcWidth, srcHeight := bounds.Dx(), bounds.Dy()
+
+	src, ok := img.(*image.RGBA)
+	if !ok || bounds.Min != (image.Point{}) {
+		src = image.NewRGBA(image.Rect(0, 0, srcWidth, srcHeight))
+		draw.Draw(src, src.Bounds(), img, bounds.Min, draw.Src)
+	}
+
+	dst := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		y0 := y * srcHeight / height
+		y1 := (y + 1) * srcHeight / height
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < width; x++ {
+			x0 := x * srcWidth / width
+			x1 := (x + 1) * srcWidth / width
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			// Average the premultiplied channels of the covered pixels
+			var r, g, b, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				row := src.Pix[sy*src.Stride:]
+				for sx := x0; sx < x1; sx++ {
+					p := row[sx*4 : sx*4+4]
+					r += uint64(p[0])
+					g += uint64(p[1])
+					b += uint64(p[2])
+					a += uint64(p[3])
+					n++
+				}
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8(r / n)
+			dst.Pix[i+1] = uint8(g / n)
+			dst.Pix[i+2] = uint8(b / n)
+			dst.Pix[i+3] = uint8(a / n)
+		}
+	}
+	return dst
+}
@@ -0,0 +1,52 @@
+package imaging
+
+import (
+	"image"
+	"image/color"
+)
+
+// sample returns a nearest neighbor sampled view of img with a width and height of at most maxSize.
+func sample(img image.Image, maxSize int) image.Image {
+	bounds := img.Bounds()
+	width, height := bounds.Dx(), bounds.Dy()
+	if width <= maxSize && height <= maxSize {
+		return img
+	}
+
+	if width >= height {
+		height = max1(height * maxSize / width)
+		width = maxSize
+	} else {
+		width = max1(width * maxSize / height)
+		height = maxSize
+	}
+
+	return &sampledImage{src: img, width: width, height: height}
+}
+
+type sampledImage struct {
+	src           image.Image
+	width, height int
+}
+
+func (s *sampledImage) ColorModel() color.Model {
+	return s.src.ColorModel()
+}
+
+func (s *sampledImage) Bounds() image.Rectangle {
+	return image.Rect(0, 0, s.width, s.height)
+}
+
+func (s *sampledImage) At(x, y int) color.Color {
+	srcBounds := s.src.Bounds()
+	srcX := srcBounds.Min.X + x*srcBounds.Dx()/s.width
+	srcY := srcBounds.Min.Y + y*srcBounds.Dy()/s.height
+	return s.src.At(srcX, srcY)
+}
+
+func max1(v int) int {
+	if v < 1 {
+		return 1
+	}
+	return v
+}
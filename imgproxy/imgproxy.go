@@ -5,14 +5,20 @@ import (
 	"crypto/sha256"
 	"encoding/base64"
 	"encoding/hex"
+	"errors"
 	"fmt"
+	"net/url"
+	"strconv"
 	"strings"
 )
 
 type Service struct {
-	baseURL string
-	key     []byte
-	salt    []byte
+	baseURL         string
+	key             []byte
+	salt            []byte
+	signatureSize   int
+	plainSourceURLs bool
+	defaultParams   Parameters
 }
 
 type ResizingType string
@@ -30,12 +36,73 @@ type Parameters struct {
 	Gravity string
 	Enlarge bool
 	Format  string
+
+	// Quality of the resulting image in percent (1-100).
+	Quality int
+	// DPR is the device pixel ratio that multiplies the resulting dimensions.
+	DPR float64
+	// Crop crops the image before resizing.
+	Crop *Crop
+	// Trim removes the surrounding background.
+	Trim *Trim
+	// Padding adds padding to the resulting image.
+	Padding *Padding
+	// Background is the hex color (e.g. "ffffff") or "R:G:B" color used to fill transparent areas and padding.
+	Background string
+	// Blur applies a gaussian blur with the given sigma.
+	Blur float64
+	// Sharpen applies a sharpen filter with the given sigma.
+	Sharpen float64
+	// Pixelate pixelates the image with the given pixel size.
+	Pixelate int
+	// Rotate rotates the image by the given angle (a multiple of 90).
+	Rotate int
+	// AutoRotate rotates the image according to the EXIF orientation if set (overrides the server default).
+	AutoRotate *bool
+	// StripMetadata strips metadata (EXIF, IPTC, etc.) if set (overrides the server default).
+	StripMetadata *bool
+	// StripColorProfile strips the color profile if set (overrides the server default).
+	StripColorProfile *bool
+
+	// Options are raw processing options (e.g. "watermark:0.5:soea") appended to the generated options.
+	Options []string
+}
+
+// Crop defines a crop area. If Gravity is empty, the default gravity is used.
+type Crop struct {
+	Width   int
+	Height  int
+	Gravity string
+}
+
+// Trim defines how the surrounding background is trimmed. If Color is empty, it is detected automatically.
+type Trim struct {
+	Threshold float64
+	Color     string
+	EqualHor  bool
+	EqualVer  bool
+}
+
+// Padding defines the padding in pixels.
+type Padding struct {
+	Top    int
+	Right  int
+	Bottom int
+	Left   int
+}
+
+// Bool returns a pointer to b, e.g. for Parameters.AutoRotate.
+func Bool(b bool) *bool {
+	return &b
 }
 
 type Option func(*options) error
 
 type options struct {
-	key, salt []byte
+	key, salt       []byte
+	signatureSize   int
+	plainSourceURLs bool
+	defaultParams   Parameters
 }
 
 func WithKeyAndSalt(key, salt []byte) Option {
@@ -67,6 +134,47 @@ func WithHexKeyAndSalt(keyHex, saltHex string) Option {
 	}
 }
 
+// ErrInvalidSignatureSize is returned by WithSignatureSize for sizes outside of 1-32.
+var ErrInvalidSignatureSize = errors.New("signature size must be between 1 and 32")
+
+// WithSignatureSize truncates signatures to the given number of bytes (1-32).
+// It must match IMGPROXY_SIGNATURE_SIZE of the imgproxy server.
+func WithSignatureSize(size int) Option {
+	return func(opts *options) error {
+		if size < 1 || size > sha256.Size {
+			return ErrInvalidSignatureSize
+		}
+
+		opts.signatureSize = size
+
+		return nil
+	}
+}
+
+// WithPlainSourceURLs builds URLs with plain (percent-encoded) source URLs instead of base64 encoded source URLs.
+func WithPlainSourceURLs() Option {
+	return func(opts *options) error {
+		opts.plainSourceURLs = true
+
+		return nil
+	}
+}
+
+// WithDefaultParams sets parameters that are applied to every image URL.
+// Parameters passed to ImageURL override the defaults if they are set (non-zero), default options are prepended.
+func WithDefaultParams(params Parameters) Option {
+	return func(opts *options) error {
+		opts.defaultParams = params
+
+		return nil
+	}
+}
+
+// ErrIncompleteKeyAndSalt is returned by NewService if only one of key and salt is set.
+var ErrIncompleteKeyAndSalt = errors.New("key and salt must both be set for signed URLs or both be empty for unsigned URLs")
+
+// NewService creates a new imgproxy service for the given base URL.
+// URLs are signed if a key and salt are set, otherwise unsigned (insecure) URLs are built.
 func NewService(baseURL string, opts ...Option) (*Service, error) {
 	// Make sure base URL contains no trailing slash
 	baseURL = strings.TrimRight(baseURL, "/")
@@ -77,47 +185,187 @@ func NewService(baseURL string, opts ...Option) (*Service, error) {
 			return nil, err
 		}
 	}
+	if (len(options.key) == 0) != (len(options.salt) == 0) {
+		return nil, ErrIncompleteKeyAndSalt
+	}
 
 	return &Service{
-		baseURL: baseURL,
-		key:     options.key,
-		salt:    options.salt,
+		baseURL:         baseURL,
+		key:             options.key,
+		salt:            options.salt,
+		signatureSize:   options.signatureSize,
+		plainSourceURLs: options.plainSourceURLs,
+		defaultParams:   options.defaultParams,
 	}, nil
 }
 
 func (s *Service) ImageURL(imgproxySourceURL string, params Parameters) (string, error) {
+	return s.PipelineURL(imgproxySourceURL, params)
+}
+
+// PipelineURL returns an image URL with chained pipelines: every parameters are processed in a separate pipeline
+// (separated by "-"), e.g. to crop an image and then resize the cropped image.
+// Default parameters are applied to the last pipeline and the format of the last pipeline with a format is used.
+func (s *Service) PipelineURL(imgproxySourceURL string, pipelines ...Parameters) (string, error) {
+	if len(pipelines) == 0 {
+		pipelines = []Parameters{{}}
+	}
+
+	var (
+		groups []string
+		format string
+	)
+	for i, params := range pipelines {
+		if i == len(pipelines)-1 {
+			params = params.withDefaults(s.defaultParams)
+		}
+		if params.Format != "" {
+			format = params.Format
+		}
+		groups = append(groups, strings.Join(params.processingOptions(), "/"))
+	}
+
+	path := fmt.Sprintf("/%s/%s", strings.Join(groups, "/-/"), s.encodeSource(imgproxySourceURL, format))
+
+	return fmt.Sprintf("%s/%s%s", s.baseURL, s.signature(path), path), nil
+}
+
+// encodeSource encodes the source URL and format for the URL path.
+func (s *Service) encodeSource(imgproxySourceURL, format string) string {
+	if s.plainSourceURLs {
+		// The format is separated by "@", so it must be escaped in the source URL
+		source := "plain/" + strings.ReplaceAll(url.PathEscape(imgproxySourceURL), "@", "%40")
+		if format != "" {
+			source += "@" + format
+		}
+		return source
+	}
+
+	source := base64.RawURLEncoding.EncodeToString([]byte(imgproxySourceURL))
+	if format != "" {
+		source += "." + format
+	}
+	return source
+}
+
+// signature returns the signature of the path or "insecure" if no key and salt are set.
+func (s *Service) signature(path string) string {
+	if len(s.key) == 0 {
+		return "insecure"
+	}
+
+	mac := hmac.New(sha256.New, s.key)
+	mac.Write(s.salt)
+	mac.Write([]byte(path))
+	signature := mac.Sum(nil)
+	if s.signatureSize > 0 {
+		signature = signature[:s.signatureSize]
+	}
+	return base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// processingOptions returns the imgproxy processing options for the parameters.
+func (p Parameters) processingOptions() []string {
 	var parts []string
 
-	if params.Width > 0 || params.Height > 0 {
+	if p.Width > 0 || p.Height > 0 {
 		enlarge := 0
-		if params.Enlarge {
+		if p.Enlarge {
 			enlarge = 1
 		}
-		resize := params.Resize
+		resize := p.Resize
 		if resize == "" {
 			resize = ResizingTypeAuto
 		}
-		parts = append(parts, fmt.Sprintf("resize:%s:%d:%d:%d", resize, params.Width, params.Height, enlarge))
+		parts = append(parts, fmt.Sprintf("resize:%s:%d:%d:%d", resize, p.Width, p.Height, enlarge))
 	}
-	gravity := params.Gravity
-	if gravity != "" {
-		parts = append(parts, fmt.Sprintf("gravity:%s", gravity))
+	if p.Crop != nil {
+		crop := fmt.Sprintf("crop:%d:%d", p.Crop.Width, p.Crop.Height)
+		if p.Crop.Gravity != "" {
+			crop += ":" + p.Crop.Gravity
+		}
+		parts = append(parts, crop)
 	}
-
-	extension := params.Format
-	if extension != "" {
-		extension = "." + extension
+	if p.Gravity != "" {
+		parts = append(parts, fmt.Sprintf("gravity:%s", p.Gravity))
+	}
+	if p.Trim != nil {
+		parts = append(parts, fmt.Sprintf("trim:%s:%s:%t:%t", formatFloat(p.Trim.Threshold), p.Trim.Color, p.Trim.EqualHor, p.Trim.EqualVer))
+	}
+	if p.Padding != nil {
+		parts = append(parts, fmt.Sprintf("padding:%d:%d:%d:%d", p.Padding.Top, p.Padding.Right, p.Padding.Bottom, p.Padding.Left))
+	}
+	if p.DPR > 0 {
+		parts = append(parts, "dpr:"+formatFloat(p.DPR))
+	}
+	if p.Quality > 0 {
+		parts = append(parts, fmt.Sprintf("quality:%d", p.Quality))
+	}
+	if p.Background != "" {
+		parts = append(parts, "background:"+p.Background)
+	}
+	if p.Blur > 0 {
+		parts = append(parts, "blur:"+formatFloat(p.Blur))
+	}
+	if p.Sharpen > 0 {
+		parts = append(parts, "sharpen:"+formatFloat(p.Sharpen))
+	}
+	if p.Pixelate > 0 {
+		parts = append(parts, fmt.Sprintf("pixelate:%d", p.Pixelate))
+	}
+	if p.Rotate != 0 {
+		parts = append(parts, fmt.Sprintf("rotate:%d", p.Rotate))
+	}
+	if p.AutoRotate != nil {
+		parts = append(parts, fmt.Sprintf("auto_rotate:%t", *p.AutoRotate))
+	}
+	if p.StripMetadata != nil {
+		parts = append(parts, fmt.Sprintf("strip_metadata:%t", *p.StripMetadata))
+	}
+	if p.StripColorProfile != nil {
+		parts = append(parts, fmt.Sprintf("strip_color_profile:%t", *p.StripColorProfile))
 	}
 
-	encodedURL := base64.RawURLEncoding.EncodeToString([]byte(imgproxySourceURL))
+	return append(parts, p.Options...)
+}
 
-	path := fmt.Sprintf("/%s/%s%s", strings.Join(parts, "/"), encodedURL, extension)
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'f', -1, 64)
+}
 
-	// TODO Add support for unsigned URLs
-	mac := hmac.New(sha256.New, s.key)
-	mac.Write(s.salt)
-	mac.Write([]byte(path))
-	signature := base64.RawURLEncoding.EncodeToString(mac.Sum(nil))
+// withDefaults returns the parameters with all unset (zero) fields set from defaults.
+func (p Parameters) withDefaults(defaults Parameters) Parameters {
+	if p.Width == 0 && p.Height == 0 {
+		p.Width = defaults.Width
+		p.Height = defaults.Height
+	}
+	p.Resize = defaultValue(p.Resize, defaults.Resize)
+	p.Gravity = defaultValue(p.Gravity, defaults.Gravity)
+	p.Enlarge = p.Enlarge || defaults.Enlarge
+	p.Format = defaultValue(p.Format, defaults.Format)
+	p.Quality = defaultValue(p.Quality, defaults.Quality)
+	p.DPR = defaultValue(p.DPR, defaults.DPR)
+	p.Crop = defaultValue(p.Crop, defaults.Crop)
+	p.Trim = defaultValue(p.Trim, defaults.Trim)
+	p.Padding = defaultValue(p.Padding, defaults.Padding)
+	p.Background = defaultValue(p.Background, defaults.Background)
+	p.Blur = defaultValue(p.Blur, defaults.Blur)
+	p.Sharpen = defaultValue(p.Sharpen, defaults.Sharpen)
+	p.Pixelate = defaultValue(p.Pixelate, defaults.Pixelate)
+	p.Rotate = defaultValue(p.Rotate, defaults.Rotate)
+	p.AutoRotate = defaultValue(p.AutoRotate, defaults.AutoRotate)
+	p.StripMetadata = defaultValue(p.StripMetadata, defaults.StripMetadata)
+	p.StripColorProfile = defaultValue(p.StripColorProfile, defaults.StripColorProfile)
+	if len(defaults.Options) > 0 {
+		p.Options = append(append([]string{}, defaults.Options...), p.Options...)
+	}
+	return p
+}
 
-	return fmt.Sprintf("%s/%s%s", s.baseURL, signature, path), nil
+func defaultValue[T comparable](value, defaultValue T) T {
+	var zero T
+	if value == zero {
+		return defaultValue
+	}
+	return value
 }
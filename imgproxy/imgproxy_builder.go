@@ -0,0 +1,198 @@
+package imgproxy
+
+import (
+	"errors"
+	"fmt"
+)
+
+// ErrInvalidParameters is returned if parameters are invalid.
+var ErrInvalidParameters = errors.New("invalid parameters")
+
+// ErrSigningUnavailable is returned by Builder.URL if a signed URL is required but no key and salt are set.
+var ErrSigningUnavailable = errors.New("signing requires key and salt")
+
+// Builder builds an image URL with chainable methods. Create it with Service.Build.
+type Builder struct {
+	service   *Service
+	sourceURL string
+	pipelines []Parameters
+	params    Parameters
+	signed    bool
+}
+
+// Build starts building an image URL for the imgproxy source URL, e.g.:
+//
+//	svc.Build(srcURL).Resize(imgproxy.ResizingTypeFit, 800, 600).Quality(80).Format("webp").Signed().URL()
+func (s *Service) Build(imgproxySourceURL string) *Builder {
+	return &Builder{
+		service:   s,
+		sourceURL: imgproxySourceURL,
+	}
+}
+
+// Params sets all parameters at once. Parameters set by other methods afterwards take precedence.
+func (b *Builder) Params(params Parameters) *Builder {
+	b.params = params
+	return b
+}
+
+// Resize sets the resizing type and dimensions. A zero width or height is calculated from the aspect ratio.
+func (b *Builder) Resize(resize ResizingType, width, height int) *Builder {
+	b.params.Resize = resize
+	b.params.Width = width
+	b.params.Height = height
+	return b
+}
+
+// Enlarge allows enlarging images smaller than the resize dimensions.
+func (b *Builder) Enlarge() *Builder {
+	b.params.Enlarge = true
+	return b
+}
+
+// Gravity sets the gravity (e.g. "ce", "sm" or "fp:0.5:0.5").
+func (b *Builder) Gravity(gravity string) *Builder {
+	b.params.Gravity = gravity
+	return b
+}
+
+// Format sets the format (extension) of the resulting image.
+func (b *Builder) Format(format string) *Builder {
+	b.params.Format = format
+	return b
+}
+
+// Quality sets the quality of the resulting image in percent (1-100).
+func (b *Builder) Quality(quality int) *Builder {
+	b.params.Quality = quality
+	return b
+}
+
+// DPR sets the device pixel ratio.
+func (b *Builder) DPR(dpr float64) *Builder {
+	b.params.DPR = dpr
+	return b
+}
+
+// Crop crops the image before resizing. The gravity is optional.
+func (b *Builder) Crop(width, height int, gravity string) *Builder {
+	b.params.Crop = &Crop{Width: width, Height: height, Gravity: gravity}
+	return b
+}
+
+// Trim removes the surrounding background.
+func (b *Builder) Trim(trim Trim) *Builder {
+	b.params.Trim = &trim
+	return b
+}
+
+// Padding adds padding to the resulting image.
+func (b *Builder) Padding(top, right, bottom, left int) *Builder {
+	b.params.Padding = &Padding{Top: top, Right: right, Bottom: bottom, Left: left}
+	return b
+}
+
+// Background sets the background color.
+func (b *Builder) Background(color string) *Builder {
+	b.params.Background = color
+	return b
+}
+
+// Blur applies a gaussian blur.
+func (b *Builder) Blur(sigma float64) *Builder {
+	b.params.Blur = sigma
+	return b
+}
+
+// Sharpen applies a sharpen filter.
+func (b *Builder) Sharpen(sigma float64) *Builder {
+	b.params.Sharpen = sigma
+	return b
+}
+
+// Pixelate pixelates the image.
+func (b *Builder) Pixelate(size int) *Builder {
+	b.params.Pixelate = size
+	return b
+}
+
+// Rotate rotates the image by a multiple of 90 degrees.
+func (b *Builder) Rotate(angle int) *Builder {
+	b.params.Rotate = angle
+	return b
+}
+
+// AutoRotate enables or disables rotating the image according to the EXIF orientation.
+func (b *Builder) AutoRotate(autoRotate bool) *Builder {
+	b.params.AutoRotate = Bool(autoRotate)
+	return b
+}
+
+// StripMetadata enables or disables stripping metadata.
+func (b *Builder) StripMetadata(strip bool) *Builder {
+	b.params.StripMetadata = Bool(strip)
+	return b
+}
+
+// StripColorProfile enables or disables stripping the color profile.
+func (b *Builder) StripColorProfile(strip bool) *Builder {
+	b.params.StripColorProfile = Bool(strip)
+	return b
+}
+
+// Option adds a raw processing option (e.g. "watermark:0.5:soea").
+func (b *Builder) Option(option string) *Builder {
+	b.params.Options = append(b.params.Options, option)
+	return b
+}
+
+// Then starts a new chained pipeline that processes the result of the previous pipeline.
+func (b *Builder) Then() *Builder {
+	b.pipelines = append(b.pipelines, b.params)
+	b.params = Parameters{}
+	return b
+}
+
+// Signed requires a signed URL, so URL returns an error instead of an unsigned URL if no key and salt are set.
+func (b *Builder) Signed() *Builder {
+	b.signed = true
+	return b
+}
+
+// URL validates the parameters and returns the image URL.
+func (b *Builder) URL() (string, error) {
+	if b.signed && len(b.service.key) == 0 {
+		return "", ErrSigningUnavailable
+	}
+	pipelines := make([]Parameters, 0, len(b.pipelines)+1)
+	pipelines = append(pipelines, b.pipelines...)
+	pipelines = append(pipelines, b.params)
+	for _, params := range pipelines {
+		if err := params.Validate(); err != nil {
+			return "", err
+		}
+	}
+
+	return b.service.PipelineURL(b.sourceURL, pipelines...)
+}
+
+// Validate checks that the parameters are in the ranges accepted by imgproxy.
+func (p Parameters) Validate() error {
+	switch {
+	case p.Width < 0 || p.Height < 0:
+		return fmt.Errorf("%w: width and height must not be negative", ErrInvalidParameters)
+	case p.Resize != "" && p.Resize != ResizingTypeFill && p.Resize != ResizingTypeFit && p.Resize != ResizingTypeAuto:
+		return fmt.Errorf("%w: unknown resizing type %q", ErrInvalidParameters, p.Resize)
+	case p.Quality < 0 || p.Quality > 100:
+		return fmt.Errorf("%w: quality must be between 1 and 100", ErrInvalidParameters)
+	case p.DPR < 0:
+		return fmt.Errorf("%w: dpr must be positive", ErrInvalidParameters)
+	case p.Crop != nil && (p.Crop.Width < 0 || p.Crop.Height < 0):
+		return fmt.Errorf("%w: crop width and height must not be negative", ErrInvalidParameters)
+	case p.Blur < 0 || p.Sharpen < 0 || p.Pixelate < 0:
+		return fmt.Errorf("%w: blur, sharpen and pixelate must not be negative", ErrInvalidParameters)
+	case p.Rotate%90 != 0:
+		return fmt.Errorf("%w: rotation must be a multiple of 90", ErrInvalidParameters)
+	}
+	return nil
+}
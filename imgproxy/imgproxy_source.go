@@ -0,0 +1,22 @@
+package imgproxy
+
+import (
+	"fmt"
+	"net/url"
+)
+
+// HTTPSource is an ImgproxyURLSourcer for files that are exposed via HTTP (e.g. by a CDN) under a base URL.
+// The source URL of a file is the base URL joined with the hash:
+//
+//	source := imgproxy.HTTPSource("https://cdn.example.com/assets")
+//	sourceURL, _ := source.ImgproxyURLSource(hash) // https://cdn.example.com/assets/{hash}
+type HTTPSource string
+
+// ImgproxyURLSource gets the source URL of the file with the given hash.
+func (s HTTPSource) ImgproxyURLSource(hash string) (string, error) {
+	sourceURL, err := url.JoinPath(string(s), hash)
+	if err != nil {
+		return "", fmt.Errorf("joining base URL: %w", err)
+	}
+	return sourceURL, nil
+}
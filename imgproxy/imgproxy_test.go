@@ -0,0 +1,167 @@
+package imgproxy_test
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/imgproxy"
+)
+
+func TestService_ImageURL(t *testing.T) {
+	params := imgproxy.Parameters{
+		Resize: imgproxy.ResizingTypeFill,
+		Width:  300,
+		Height: 400,
+		Format: "png",
+	}
+
+	t.Run("signed", func(t *testing.T) {
+		// Example key and salt from the imgproxy documentation
+		svc, err := imgproxy.NewService("http://imgproxy.example.com/", imgproxy.WithHexKeyAndSalt("943b421c9eb07c830af81030552c86009268de4e532ba2ee2eab8247c6da0881", "520f986b998545b4785e0defbc4f3c1203f22de2374a3d53cb7a7fe9fea309c5"))
+		require.NoError(t, err)
+
+		imageURL, err := svc.ImageURL("http://example.com/images/curiosity.jpg", params)
+		require.NoError(t, err)
+		assert.Equal(t, "http://imgproxy.example.com/9D6ra1JN9iYK9U0EOiPTNu_7moLyst4QhFyrgCjquqY/resize:fill:300:400:0/aHR0cDovL2V4YW1wbGUuY29tL2ltYWdlcy9jdXJpb3NpdHkuanBn.png", imageURL)
+	})
+
+	t.Run("unsigned", func(t *testing.T) {
+		svc, err := imgproxy.NewService("http://imgproxy.example.com")
+		require.NoError(t, err)
+
+		imageURL, err := svc.ImageURL("http://example.com/images/curiosity.jpg", params)
+		require.NoError(t, err)
+		assert.Equal(t, "http://imgproxy.example.com/insecure/resize:fill:300:400:0/aHR0cDovL2V4YW1wbGUuY29tL2ltYWdlcy9jdXJpb3NpdHkuanBn.png", imageURL)
+	})
+
+	t.Run("incomplete key and salt", func(t *testing.T) {
+		_, err := imgproxy.NewService("http://imgproxy.example.com", imgproxy.WithKeyAndSalt([]byte("key"), nil))
+		assert.ErrorIs(t, err, imgproxy.ErrIncompleteKeyAndSalt)
+	})
+}
+
+func TestService_ImageURL_ProcessingOptions(t *testing.T) {
+	svc, err := imgproxy.NewService("http://imgproxy.example.com")
+	require.NoError(t, err)
+
+	imageURL, err := svc.ImageURL("local:///image.jpg", imgproxy.Parameters{
+		Resize:            imgproxy.ResizingTypeFit,
+		Width:             800,
+		Crop:              &imgproxy.Crop{Width: 1000, Height: 500, Gravity: "sm"},
+		Trim:              &imgproxy.Trim{Threshold: 10, Color: "ffffff", EqualHor: true},
+		Padding:           &imgproxy.Padding{Top: 10, Right: 20, Bottom: 10, Left: 20},
+		DPR:               1.5,
+		Quality:           80,
+		Background:        "255:0:0",
+		Blur:              0.5,
+		Sharpen:           0.7,
+		Pixelate:          4,
+		Rotate:            90,
+		AutoRotate:        imgproxy.Bool(false),
+		StripMetadata:     imgproxy.Bool(true),
+		StripColorProfile: imgproxy.Bool(true),
+		Options:           []string{"watermark:0.5:soea"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "http://imgproxy.example.com/insecure/resize:fit:800:0:0/crop:1000:500:sm/trim:10:ffffff:true:false/padding:10:20:10:20/dpr:1.5/quality:80/background:255:0:0/blur:0.5/sharpen:0.7/pixelate:4/rotate:90/auto_rotate:false/strip_metadata:true/strip_color_profile:true/watermark:0.5:soea/bG9jYWw6Ly8vaW1hZ2UuanBn", imageURL)
+}
+
+func TestBuilder(t *testing.T) {
+	svc, err := imgproxy.NewService("http://imgproxy.example.com")
+	require.NoError(t, err)
+
+	t.Run("URL", func(t *testing.T) {
+		imageURL, err := svc.Build("local:///image.jpg").Resize(imgproxy.ResizingTypeFit, 800, 600).Quality(80).Format("webp").URL()
+		require.NoError(t, err)
+		assert.Equal(t, "http://imgproxy.example.com/insecure/resize:fit:800:600:0/quality:80/bG9jYWw6Ly8vaW1hZ2UuanBn.webp", imageURL)
+	})
+
+	t.Run("invalid parameters", func(t *testing.T) {
+		_, err := svc.Build("local:///image.jpg").Quality(120).URL()
+		assert.ErrorIs(t, err, imgproxy.ErrInvalidParameters)
+
+		_, err = svc.Build("local:///image.jpg").Rotate(45).URL()
+		assert.ErrorIs(t, err, imgproxy.ErrInvalidParameters)
+	})
+
+	t.Run("signed without key", func(t *testing.T) {
+		_, err := svc.Build("local:///image.jpg").Signed().URL()
+		assert.ErrorIs(t, err, imgproxy.ErrSigningUnavailable)
+	})
+}
+
+func TestService_ImageURL_SignatureSizeAndPlainSourceURLs(t *testing.T) {
+	svc, err := imgproxy.NewService(
+		"http://imgproxy.example.com",
+		imgproxy.WithHexKeyAndSalt("943b421c9eb07c830af81030552c86009268de4e532ba2ee2eab8247c6da0881", "520f986b998545b4785e0defbc4f3c1203f22de2374a3d53cb7a7fe9fea309c5"),
+		imgproxy.WithSignatureSize(8),
+		imgproxy.WithPlainSourceURLs(),
+	)
+	require.NoError(t, err)
+
+	imageURL, err := svc.ImageURL("http://example.com/images/curiosity.jpg", imgproxy.Parameters{
+		Resize: imgproxy.ResizingTypeFill,
+		Width:  300,
+		Height: 400,
+		Format: "png",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "http://imgproxy.example.com/GDa9vmhn2M4/resize:fill:300:400:0/plain/http:%2F%2Fexample.com%2Fimages%2Fcuriosity.jpg@png", imageURL)
+
+	// The "@" separating the format is escaped in the source URL
+	imageURL, err = svc.ImageURL("s3://bucket/user@2x.png", imgproxy.Parameters{Format: "webp"})
+	require.NoError(t, err)
+	assert.True(t, strings.HasSuffix(imageURL, "/plain/s3:%2F%2Fbucket%2Fuser%402x.png@webp"), imageURL)
+
+	_, err = imgproxy.NewService("http://imgproxy.example.com", imgproxy.WithSignatureSize(33))
+	assert.ErrorIs(t, err, imgproxy.ErrInvalidSignatureSize)
+}
+
+func TestService_ImageURL_DefaultParams(t *testing.T) {
+	svc, err := imgproxy.NewService("http://imgproxy.example.com", imgproxy.WithDefaultParams(imgproxy.Parameters{
+		Format:        "webp",
+		Quality:       75,
+		StripMetadata: imgproxy.Bool(true),
+	}))
+	require.NoError(t, err)
+
+	imageURL, err := svc.ImageURL("local:///image.jpg", imgproxy.Parameters{
+		Width:   200,
+		Quality: 90,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "http://imgproxy.example.com/insecure/resize:auto:200:0:0/quality:90/strip_metadata:true/bG9jYWw6Ly8vaW1hZ2UuanBn.webp", imageURL)
+}
+
+func TestService_PipelineURL(t *testing.T) {
+	svc, err := imgproxy.NewService("http://imgproxy.example.com")
+	require.NoError(t, err)
+
+	imageURL, err := svc.PipelineURL("local:///image.jpg",
+		imgproxy.Parameters{Crop: &imgproxy.Crop{Width: 1000, Height: 1000, Gravity: "ce"}},
+		imgproxy.Parameters{Resize: imgproxy.ResizingTypeFill, Width: 200, Height: 200, Format: "webp"},
+	)
+	require.NoError(t, err)
+	assert.Equal(t, "http://imgproxy.example.com/insecure/crop:1000:1000:ce/-/resize:fill:200:200:0/bG9jYWw6Ly8vaW1hZ2UuanBn.webp", imageURL)
+
+	builderURL, err := svc.Build("local:///image.jpg").Crop(1000, 1000, "ce").Then().Resize(imgproxy.ResizingTypeFill, 200, 200).Format("webp").URL()
+	require.NoError(t, err)
+	assert.Equal(t, imageURL, builderURL)
+}
+
+func TestHTTPSource(t *testing.T) {
+	var _ filestore.ImgproxyURLSourcer = imgproxy.HTTPSource("")
+
+	for _, baseURL := range []string{"https://cdn.example.com/assets", "https://cdn.example.com/assets/"} {
+		sourceURL, err := imgproxy.HTTPSource(baseURL).ImgproxyURLSource("a0b1c2d3e4f5")
+		require.NoError(t, err)
+		assert.Equal(t, "https://cdn.example.com/assets/a0b1c2d3e4f5", sourceURL)
+	}
+
+	_, err := imgproxy.HTTPSource("://invalid").ImgproxyURLSource("a0b1c2d3e4f5")
+	assert.Error(t, err)
+}
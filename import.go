@@ -0,0 +1,184 @@
+package filestore
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"sync"
+
+	"github.com/networkteam/filestore/internal/parallel"
+)
+
+// DefaultImportWorkers is the default number of files stored concurrently by ImportTree.
+const DefaultImportWorkers = 4
+
+type importOptions struct {
+	workers  int
+	include  []string
+	exclude  []string
+	manifest string
+}
+
+// ImportOption is a functional option for ImportTree.
+type ImportOption func(*importOptions)
+
+// WithImportWorkers sets the number of files stored concurrently (defaults to DefaultImportWorkers).
+func WithImportWorkers(workers int) ImportOption {
+	return func(opts *importOptions) {
+		opts.workers = workers
+	}
+}
+
+// WithInclude only imports files matching one of the given glob patterns (see path.Match).
+// Patterns match the slash separated path relative to the root or the base name of a file, so "*.jpg" matches
+// JPEG files in all directories.
+func WithInclude(patterns ...string) ImportOption {
+	return func(opts *importOptions) {
+		opts.include = append(opts.include, patterns...)
+	}
+}
+
+// WithExclude skips files and directories matching one of the given glob patterns (see WithInclude), e.g. ".git".
+func WithExclude(patterns ...string) ImportOption {
+	return func(opts *importOptions) {
+		opts.exclude = append(opts.exclude, patterns...)
+	}
+}
+
+// WithImportManifest writes the mapping of imported paths to hashes as a JSON object to the given file.
+func WithImportManifest(filename string) ImportOption {
+	return func(opts *importOptions) {
+		opts.manifest = filename
+	}
+}
+
+// ImportTree walks the directory root, stores every regular file in store and returns a mapping of the slash
+// separated path relative to root to the hash of the file (e.g. to migrate a legacy uploads folder).
+// Symbolic links and other special files are skipped. The content type is set by the file extension.
+//
+// If storing a file fails, the remaining files are not imported and the error is returned together with the
+// files imported so far.
+func ImportTree(ctx context.Context, store Storer, root string, opts ...ImportOption) (map[string]string, error) {
+	o := importOptions{workers: DefaultImportWorkers}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	for _, patterns := range [][]string{o.include, o.exclude} {
+		for _, pattern := range patterns {
+			if _, err := path.Match(pattern, ""); err != nil {
+				return nil, fmt.Errorf("invalid pattern %q: %w", pattern, err)
+			}
+		}
+	}
+
+	var paths []string
+	err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if p == root {
+			return nil
+		}
+		rel, err := filepath.Rel(root, p)
+		if err != nil {
+			return err
+		}
+		rel = filepath.ToSlash(rel)
+
+		if matchesAny(o.exclude, rel) {
+			if d.IsDir() {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if !d.Type().IsRegular() {
+			return nil
+		}
+		if len(o.include) > 0 && !matchesAny(o.include, rel) {
+			return nil
+		}
+		paths = append(paths, rel)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("walking %s: %w", root, err)
+	}
+
+	var (
+		mx     sync.Mutex
+		hashes = make(map[string]string, len(paths))
+	)
+	err = parallel.ForEach(ctx, paths, o.workers, func(ctx context.Context, rel string) error {
+		hash, err := importFile(ctx, store, filepath.Join(root, filepath.FromSlash(rel)))
+		if err != nil {
+			return fmt.Errorf("importing %s: %w", rel, err)
+		}
+
+		mx.Lock()
+		hashes[rel] = hash
+		mx.Unlock()
+		return nil
+	})
+	if err != nil {
+		return hashes, err
+	}
+
+	if o.manifest != "" {
+		if err := writeImportManifest(o.manifest, hashes); err != nil {
+			return hashes, err
+		}
+	}
+
+	return hashes, nil
+}
+
+func importFile(ctx context.Context, store Storer, filename string) (string, error) {
+	f, err := os.Open(filename)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	fi, err := f.Stat()
+	if err != nil {
+		return "", err
+	}
+
+	return store.Store(ctx, NewReader(f, WithSize(fi.Size()), WithContentType(mime.TypeByExtension(filepath.Ext(filename)))))
+}
+
+func matchesAny(patterns []string, rel string) bool {
+	for _, pattern := range patterns {
+		// Errors were checked before walking
+		if ok, _ := path.Match(pattern, rel); ok {
+			return true
+		}
+		if ok, _ := path.Match(pattern, path.Base(rel)); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func writeImportManifest(filename string, hashes map[string]string) error {
+	data, err := json.MarshalIndent(hashes, "", "  ")
+	if err != nil {
+		return fmt.Errorf("encoding manifest: %w", err)
+	}
+
+	// Write to a temporary file first, so an existing manifest is never left incomplete
+	tmp := filename + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return fmt.Errorf("writing manifest: %w", err)
+	}
+	if err := os.Rename(tmp, filename); err != nil {
+		_ = os.Remove(tmp)
+		return fmt.Errorf("writing manifest: %w", err)
+	}
+	return nil
+}
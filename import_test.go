@@ -0,0 +1,116 @@
+package filestore_test
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/hashing"
+	"github.com/networkteam/filestore/local"
+	"github.com/networkteam/filestore/memory"
+)
+
+func TestImportTree(t *testing.T) {
+	ctx := context.Background()
+
+	root := t.TempDir()
+	files := map[string]string{
+		"logo.png":                "PNG",
+		"uploads/2019/report.pdf": "PDF",
+		"uploads/2019/photo.jpg":  "JPEG",
+		"uploads/.git/config":     "git",
+		"uploads/notes.txt":       "notes",
+	}
+	for name, content := range files {
+		filename := filepath.Join(root, filepath.FromSlash(name))
+		require.NoError(t, os.MkdirAll(filepath.Dir(filename), 0o755))
+		require.NoError(t, os.WriteFile(filename, []byte(content), 0o644))
+	}
+
+	t.Run("all files", func(t *testing.T) {
+		store := memory.NewFilestore()
+
+		hashes, err := filestore.ImportTree(ctx, store, root, filestore.WithImportWorkers(2))
+		require.NoError(t, err)
+		require.Len(t, hashes, len(files))
+		for name, content := range files {
+			assert.Equal(t, hashing.HashBytes([]byte(content)), hashes[name], name)
+		}
+
+		info, err := store.Stat(ctx, hashes["uploads/2019/report.pdf"])
+		require.NoError(t, err)
+		assert.Equal(t, "application/pdf", info.ContentType)
+		assert.Equal(t, int64(3), info.Size)
+	})
+
+	t.Run("include and exclude", func(t *testing.T) {
+		store := memory.NewFilestore()
+
+		hashes, err := filestore.ImportTree(ctx, store, root,
+			filestore.WithInclude("*.jpg", "*.pdf", "uploads/*.txt"),
+			filestore.WithExclude(".git", "uploads/2019/report.pdf"),
+		)
+		require.NoError(t, err)
+		assert.Equal(t, map[string]string{
+			"uploads/2019/photo.jpg": hashing.HashBytes([]byte("JPEG")),
+			"uploads/notes.txt":      hashing.HashBytes([]byte("notes")),
+		}, hashes)
+	})
+
+	t.Run("manifest", func(t *testing.T) {
+		store := memory.NewFilestore()
+		manifest := filepath.Join(t.TempDir(), "manifest.json")
+
+		hashes, err := filestore.ImportTree(ctx, store, root, filestore.WithImportManifest(manifest))
+		require.NoError(t, err)
+
+		data, err := os.ReadFile(manifest)
+		require.NoError(t, err)
+		var written map[string]string
+		require.NoError(t, json.Unmarshal(data, &written))
+		assert.Equal(t, hashes, written)
+	})
+
+	t.Run("linked files", func(t *testing.T) {
+		storeDir := t.TempDir()
+		store, err := local.NewFilestore(
+			filepath.Join(storeDir, "tmp"),
+			filepath.Join(storeDir, "assets"),
+			local.WithLinking(local.LinkModeHardLink),
+		)
+		require.NoError(t, err)
+
+		hashes, err := filestore.ImportTree(ctx, store, root, filestore.WithInclude("*.pdf"))
+		require.NoError(t, err)
+		hash := hashes["uploads/2019/report.pdf"]
+		require.NotEmpty(t, hash)
+
+		sourceInfo, err := os.Stat(filepath.Join(root, "uploads", "2019", "report.pdf"))
+		require.NoError(t, err)
+		targetInfo, err := os.Stat(filepath.Join(storeDir, "assets", hash[:2], hash))
+		require.NoError(t, err)
+		assert.True(t, os.SameFile(sourceInfo, targetInfo), "imported file should be a hard link to the source")
+
+		info, err := store.Stat(ctx, hash)
+		require.NoError(t, err)
+		assert.Equal(t, "application/pdf", info.ContentType)
+	})
+
+	t.Run("invalid pattern", func(t *testing.T) {
+		_, err := filestore.ImportTree(ctx, memory.NewFilestore(), root, filestore.WithInclude("[a-"))
+		assert.Error(t, err)
+	})
+
+	t.Run("store error", func(t *testing.T) {
+		store := memory.NewFilestore(memory.WithMaxObjectSize(4))
+
+		_, err := filestore.ImportTree(ctx, store, root, filestore.WithImportWorkers(1))
+		assert.ErrorIs(t, err, filestore.ErrTooLarge)
+	})
+}
@@ -0,0 +1,66 @@
+// Package bufpool provides a shared pool of buffers for copying content, so copies under heavy load do not allocate
+// a new buffer every time.
+package bufpool
+
+import (
+	"io"
+	"sync"
+	"sync/atomic"
+)
+
+// DefaultSize is the default size of pooled buffers (the same as the buffer of io.Copy).
+const DefaultSize = 32 * 1024
+
+var (
+	size atomic.Int64
+	pool sync.Pool
+)
+
+func init() {
+	size.Store(DefaultSize)
+}
+
+// SetSize sets the size of pooled buffers. Buffers with another size are discarded when they are returned.
+// A size <= 0 resets the size to DefaultSize.
+func SetSize(n int) {
+	if n <= 0 {
+		n = DefaultSize
+	}
+	size.Store(int64(n))
+}
+
+// Size returns the size of pooled buffers.
+func Size() int {
+	return int(size.Load())
+}
+
+// Get returns a buffer from the pool, it should be returned with Put after use.
+func Get() *[]byte {
+	if buf, ok := pool.Get().(*[]byte); ok && len(*buf) == Size() {
+		return buf
+	}
+	buf := make([]byte, Size())
+	return &buf
+}
+
+// Put returns a buffer to the pool.
+func Put(buf *[]byte) {
+	if len(*buf) != Size() {
+		return
+	}
+	pool.Put(buf)
+}
+
+// Copy copies from src to dst like io.Copy with a pooled buffer.
+// Since *os.File implements io.ReaderFrom with its own buffer for other readers, dst is only used as an io.Writer.
+func Copy(dst io.Writer, src io.Reader) (int64, error) {
+	buf := Get()
+	defer Put(buf)
+
+	return io.CopyBuffer(writerOnly{dst}, src, *buf)
+}
+
+// writerOnly hides other methods of a writer (e.g. io.ReaderFrom), so io.CopyBuffer uses the buffer.
+type writerOnly struct {
+	io.Writer
+}
@@ -0,0 +1,59 @@
+// Package parallel runs functions concurrently with a bounded number of workers.
+package parallel
+
+import (
+	"context"
+	"sync"
+)
+
+// ForEach calls fn for each item with up to workers concurrent calls.
+// The first error cancels the context passed to the remaining calls, no further items are processed and the error
+// is returned. If ctx is cancelled, the context error is returned.
+func ForEach[T any](ctx context.Context, items []T, workers int, fn func(ctx context.Context, item T) error) error {
+	if workers < 1 {
+		workers = 1
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var (
+		wg       sync.WaitGroup
+		errOnce  sync.Once
+		firstErr error
+	)
+	itemCh := make(chan T)
+	for i := 0; i < workers && i < len(items); i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for item := range itemCh {
+				if ctx.Err() != nil {
+					continue
+				}
+				if err := fn(ctx, item); err != nil {
+					errOnce.Do(func() {
+						firstErr = err
+						cancel()
+					})
+				}
+			}
+		}()
+	}
+
+sendLoop:
+	for _, item := range items {
+		select {
+		case itemCh <- item:
+		case <-ctx.Done():
+			break sendLoop
+		}
+	}
+	close(itemCh)
+	wg.Wait()
+
+	if firstErr != nil {
+		return firstErr
+	}
+	return ctx.Err()
+}
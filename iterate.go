@@ -0,0 +1,15 @@
+package filestore
+
+import "context"
+
+// iterateBatchSize is the batch size used by IterateParallel for stores that do not implement ParallelIterator.
+const iterateBatchSize = 1000
+
+// IterateParallel iterates over all files of store with up to workers concurrent goroutines if store implements
+// ParallelIterator. Otherwise, it falls back to Iterate (callback is then not called concurrently).
+func IterateParallel(ctx context.Context, store Iterator, workers int, callback func(hashes []string) error) error {
+	if parallelIterator, ok := store.(ParallelIterator); ok {
+		return parallelIterator.IterateParallel(ctx, workers, callback)
+	}
+	return store.Iterate(ctx, iterateBatchSize, callback)
+}
@@ -0,0 +1,35 @@
+package filestore_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/memory"
+)
+
+func TestIterateParallel(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewFilestore()
+
+	var expected []string
+	for i := 0; i < 5; i++ {
+		hash, err := store.Store(ctx, strings.NewReader(fmt.Sprintf("Content %d", i)))
+		require.NoError(t, err)
+		expected = append(expected, hash)
+	}
+
+	// The memory store does not implement filestore.ParallelIterator, so Iterate is used
+	var hashes []string
+	err := filestore.IterateParallel(ctx, store, 4, func(batch []string) error {
+		hashes = append(hashes, batch...)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, expected, hashes)
+}
@@ -0,0 +1,116 @@
+// Package keycheck provides a file store wrapper that rejects keys that are not valid hashes, so keys from requests
+// can be passed to any backend without risking path traversal (local store) or junk keys (S3).
+package keycheck
+
+import (
+	"context"
+	"io"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/hashing"
+)
+
+// Filestore wraps a file store and rejects invalid keys with an error wrapping hashing.ErrInvalidKey before they
+// are passed to the wrapped store. Only the methods of filestore.FileStore are available on the wrapper.
+type Filestore struct {
+	filestore.FileStore
+
+	keyEncoding hashing.KeyEncoding
+	hexLength   int
+}
+
+type options struct {
+	keyEncoding hashing.KeyEncoding
+	hexLength   int
+}
+
+// Option is a functional option for creating a key checking file store.
+type Option func(*options)
+
+// WithKeyEncoding sets the encoding of valid keys (defaults to hashing.HexKeys). It should match the key encoding
+// of the wrapped store, bare hex keys are always valid.
+func WithKeyEncoding(encoding hashing.KeyEncoding) Option {
+	return func(opts *options) {
+		opts.keyEncoding = encoding
+	}
+}
+
+// WithHexLength sets the length of the hex encoded hash of valid keys (defaults to the length of SHA256 hashes),
+// e.g. for stores with content hashed by other systems (see hashing.ParseHexLength). A length of 0 allows any length.
+func WithHexLength(hexLength int) Option {
+	return func(opts *options) {
+		opts.hexLength = hexLength
+	}
+}
+
+var _ filestore.FileStore = &Filestore{}
+
+// NewFilestore creates a file store that only passes valid keys to store.
+func NewFilestore(store filestore.FileStore, opts ...Option) *Filestore {
+	o := options{
+		keyEncoding: hashing.HexKeys,
+		hexLength:   2 * hashing.New().Size(),
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return &Filestore{
+		FileStore:   store,
+		keyEncoding: o.keyEncoding,
+		hexLength:   o.hexLength,
+	}
+}
+
+// Validate returns an error wrapping hashing.ErrInvalidKey if key is not valid.
+func (f *Filestore) Validate(key string) error {
+	return hashing.ValidateKey(key, f.keyEncoding, f.hexLength)
+}
+
+// StoreHashed stores the content in the wrapped store if the hash is valid.
+func (f *Filestore) StoreHashed(ctx context.Context, r io.Reader, hash string) error {
+	if err := f.Validate(hash); err != nil {
+		return err
+	}
+	return f.FileStore.StoreHashed(ctx, r, hash)
+}
+
+// Exists checks the wrapped store if the hash is valid.
+func (f *Filestore) Exists(ctx context.Context, hash string) (bool, error) {
+	if err := f.Validate(hash); err != nil {
+		return false, err
+	}
+	return f.FileStore.Exists(ctx, hash)
+}
+
+// Fetch fetches the content from the wrapped store if the hash is valid.
+func (f *Filestore) Fetch(ctx context.Context, hash string) (io.ReadCloser, error) {
+	if err := f.Validate(hash); err != nil {
+		return nil, err
+	}
+	return f.FileStore.Fetch(ctx, hash)
+}
+
+// Remove removes the file from the wrapped store if the hash is valid.
+func (f *Filestore) Remove(ctx context.Context, hash string) error {
+	if err := f.Validate(hash); err != nil {
+		return err
+	}
+	return f.FileStore.Remove(ctx, hash)
+}
+
+// Size returns the size of the file in the wrapped store if the hash is valid.
+func (f *Filestore) Size(ctx context.Context, hash string) (int64, error) {
+	if err := f.Validate(hash); err != nil {
+		return 0, err
+	}
+	return f.FileStore.Size(ctx, hash)
+}
+
+// ImgproxyURLSource returns the source URL of the wrapped store if the hash is valid.
+func (f *Filestore) ImgproxyURLSource(hash string) (string, error) {
+	if err := f.Validate(hash); err != nil {
+		return "", err
+	}
+	return f.FileStore.ImgproxyURLSource(hash)
+}
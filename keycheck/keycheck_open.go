@@ -0,0 +1,29 @@
+package keycheck
+
+import (
+	"context"
+	"net/url"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/hashing"
+)
+
+func init() {
+	filestore.RegisterWrapper("keycheck", wrapKeyCheck)
+}
+
+// wrapKeyCheck wraps a store opened by filestore.Open with "wrap=keycheck" to reject invalid keys.
+// The key encoding is taken from the keyEncoding parameter (like the backends) and the expected hash length from the
+// keyAlgorithm parameter (e.g. "sha256" or "sha1", see hashing.ParseHexLength).
+func wrapKeyCheck(ctx context.Context, store filestore.FileStore, params url.Values) (filestore.FileStore, error) {
+	keyEncoding, err := hashing.ParseKeyEncoding(params.Get("keyEncoding"))
+	if err != nil {
+		return nil, err
+	}
+	hexLength, err := hashing.ParseHexLength(params.Get("keyAlgorithm"))
+	if err != nil {
+		return nil, err
+	}
+
+	return NewFilestore(store, WithKeyEncoding(keyEncoding), WithHexLength(hexLength)), nil
+}
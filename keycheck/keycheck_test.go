@@ -0,0 +1,67 @@
+package keycheck_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/hashing"
+	"github.com/networkteam/filestore/keycheck"
+	"github.com/networkteam/filestore/memory"
+)
+
+func TestFilestore(t *testing.T) {
+	ctx := context.Background()
+	store := keycheck.NewFilestore(memory.NewFilestore())
+
+	hash, err := store.Store(ctx, strings.NewReader("Hello World"))
+	require.NoError(t, err)
+
+	exists, err := store.Exists(ctx, hash)
+	require.NoError(t, err)
+	assert.True(t, exists)
+	size, err := store.Size(ctx, hash)
+	require.NoError(t, err)
+	assert.Equal(t, int64(11), size)
+
+	for _, invalidKey := range []string{"../../etc/passwd", "a0b1c2", strings.ToUpper(hash), hash + "/x"} {
+		t.Run(invalidKey, func(t *testing.T) {
+			_, err := store.Fetch(ctx, invalidKey)
+			assert.ErrorIs(t, err, hashing.ErrInvalidKey)
+			_, err = store.Exists(ctx, invalidKey)
+			assert.ErrorIs(t, err, hashing.ErrInvalidKey)
+			_, err = store.Size(ctx, invalidKey)
+			assert.ErrorIs(t, err, hashing.ErrInvalidKey)
+			err = store.Remove(ctx, invalidKey)
+			assert.ErrorIs(t, err, hashing.ErrInvalidKey)
+			err = store.StoreHashed(ctx, strings.NewReader("Junk"), invalidKey)
+			assert.ErrorIs(t, err, hashing.ErrInvalidKey)
+			_, err = store.ImgproxyURLSource(invalidKey)
+			assert.ErrorIs(t, err, hashing.ErrInvalidKey)
+		})
+	}
+
+	t.Run("other algorithm", func(t *testing.T) {
+		sha1Length, err := hashing.ParseHexLength("sha1")
+		require.NoError(t, err)
+		store := keycheck.NewFilestore(memory.NewFilestore(), keycheck.WithHexLength(sha1Length))
+
+		sha1Key := "2aae6c35c94fcfb415dbe95f408b9ce91ee846ed"
+		require.NoError(t, store.StoreHashed(ctx, strings.NewReader("hello world"), sha1Key))
+		assert.ErrorIs(t, store.StoreHashed(ctx, strings.NewReader("Hello World"), hash), hashing.ErrInvalidKey)
+	})
+}
+
+func TestOpen(t *testing.T) {
+	store, err := filestore.Open(context.Background(), "memory://?wrap=keycheck&keyEncoding=prefixed")
+	require.NoError(t, err)
+	require.IsType(t, &keycheck.Filestore{}, store)
+	assert.NoError(t, store.(*keycheck.Filestore).Validate("sha256-"+hashing.HashBytes([]byte("Hello"))))
+
+	_, err = filestore.Open(context.Background(), "memory://?wrap=keycheck&keyAlgorithm=crc32")
+	assert.ErrorIs(t, err, hashing.ErrUnknownAlgorithm)
+}
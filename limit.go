@@ -0,0 +1,55 @@
+package filestore
+
+import "io"
+
+// LimitReader returns a reader that reads from r and fails with ErrTooLarge as soon as more than n bytes are read.
+// If r implements Sized with a size larger than n, the first read fails without reading from r.
+// The returned reader implements ContentTyped and ContentDispositioned and also Sized if r implements Sized.
+func LimitReader(r io.Reader, n int64) io.Reader {
+	lr := &labeledReader{
+		Reader: &limitedReader{r: r, remaining: n},
+	}
+	if typedReader, ok := r.(ContentTyped); ok {
+		lr.contentType = typedReader.ContentType()
+	}
+	if dispoReader, ok := r.(ContentDispositioned); ok {
+		lr.contentDisposition = dispoReader.ContentDisposition()
+	}
+	if sizedReader, ok := r.(Sized); ok {
+		size := sizedReader.Size()
+		if size > n {
+			lr.Reader = errReader{ErrTooLarge}
+		}
+		return &sizedLabeledReader{labeledReader: lr, size: size}
+	}
+	return lr
+}
+
+type limitedReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *limitedReader) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, ErrTooLarge
+	}
+	// Read one more byte than allowed to detect exceeding content
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n, ErrTooLarge
+	}
+	return n, err
+}
+
+type errReader struct {
+	err error
+}
+
+func (r errReader) Read([]byte) (int, error) {
+	return 0, r.err
+}
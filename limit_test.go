@@ -0,0 +1,37 @@
+package filestore_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/networkteam/filestore"
+)
+
+func TestLimitReader(t *testing.T) {
+	t.Run("within limit", func(t *testing.T) {
+		content, err := io.ReadAll(filestore.LimitReader(strings.NewReader("Hello World"), 11))
+		require.NoError(t, err)
+		assert.Equal(t, "Hello World", string(content))
+	})
+
+	t.Run("exceeding limit", func(t *testing.T) {
+		_, err := io.ReadAll(filestore.LimitReader(strings.NewReader("Hello World"), 10))
+		require.ErrorIs(t, err, filestore.ErrTooLarge)
+	})
+
+	t.Run("sized reader exceeding limit", func(t *testing.T) {
+		r := filestore.LimitReader(filestore.NewReader(strings.NewReader("Hello World"), filestore.WithSize(11), filestore.WithContentType("text/plain")), 10)
+
+		assert.Equal(t, int64(11), r.(filestore.Sized).Size())
+		assert.Equal(t, "text/plain", r.(filestore.ContentTyped).ContentType())
+
+		buf := make([]byte, 5)
+		n, err := r.Read(buf)
+		assert.Equal(t, 0, n)
+		require.ErrorIs(t, err, filestore.ErrTooLarge)
+	})
+}
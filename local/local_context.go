@@ -0,0 +1,60 @@
+package local
+
+import (
+	"context"
+	"io"
+	"os"
+)
+
+// contextReader stops reading with the context error if ctx is done, so copying a large stream is aborted
+// when the context is cancelled.
+type contextReader struct {
+	ctx context.Context
+	r   io.Reader
+}
+
+func newContextReader(ctx context.Context, r io.Reader) io.Reader {
+	return &contextReader{ctx: ctx, r: r}
+}
+
+func (r *contextReader) Read(p []byte) (int, error) {
+	if err := r.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return r.r.Read(p)
+}
+
+// contextFile is a file returned by Fetch that stops reading with the context error if ctx is done.
+// It intentionally does not embed *os.File, so io.Copy cannot bypass Read (e.g. with WriteTo).
+type contextFile struct {
+	ctx  context.Context
+	file *os.File
+}
+
+var (
+	_ io.ReadCloser = &contextFile{}
+	_ io.ReadSeeker = &contextFile{}
+	_ io.ReaderAt   = &contextFile{}
+)
+
+func (f *contextFile) Read(p []byte) (int, error) {
+	if err := f.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return f.file.Read(p)
+}
+
+func (f *contextFile) ReadAt(p []byte, off int64) (int, error) {
+	if err := f.ctx.Err(); err != nil {
+		return 0, err
+	}
+	return f.file.ReadAt(p, off)
+}
+
+func (f *contextFile) Seek(offset int64, whence int) (int64, error) {
+	return f.file.Seek(offset, whence)
+}
+
+func (f *contextFile) Close() error {
+	return f.file.Close()
+}
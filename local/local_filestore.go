@@ -2,26 +2,35 @@ package local
 
 import (
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
 	"errors"
 	"fmt"
 	"io"
 	"io/fs"
 	"os"
 	"path/filepath"
-	"regexp"
+	"strings"
+	"sync"
+	"syscall"
 
 	"github.com/hashicorp/go-multierror"
 
 	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/hashing"
+	"github.com/networkteam/filestore/internal/bufpool"
+	"github.com/networkteam/filestore/internal/parallel"
 )
 
 const (
 	// DefaultPrefixSize is the default path prefix size.
 	DefaultPrefixSize = 2
+	// DefaultPrefixDepth is the default number of nested prefix directories.
+	DefaultPrefixDepth = 1
 	// DefaultTargetFileMode is the default file mode when storing assets.
 	DefaultTargetFileMode = 0644
+	// DefaultDirMode is the default mode of created directories.
+	DefaultDirMode = 0755
+	// DefaultImgproxySource is the default template of ImgproxyURLSource (see WithImgproxySource).
+	DefaultImgproxySource = "local:///{prefix}/{hash}"
 )
 
 // Filestore is a file store that stores files on a local filesystem.
@@ -29,40 +38,189 @@ type Filestore struct {
 	tmpPath    string
 	assetsPath string
 
+	// TargetFileMode is the mode of stored files (see WithFileMode).
 	TargetFileMode os.FileMode
-	PrefixSize     int
+	// DirMode is the mode of created directories (see WithDirMode).
+	DirMode os.FileMode
+	// PrefixSize is the number of hash characters used for each prefix directory.
+	// If it is 0, files are stored directly in the assets path without prefix directories (see WithFlatLayout).
+	PrefixSize int
+	// PrefixDepth is the number of nested prefix directories (e.g. 2 for "ab/cd/abcd...").
+	// Files stored with a different depth or prefix size are found by falling back to the default layout,
+	// use Reshard to move them to the current layout.
+	PrefixDepth int
+
+	durableWrites   bool
+	linkMode        LinkMode
+	fileLocking     bool
+	minFreeSpace    uint64
+	readOnly        bool
+	maxObjectSize   int64
+	keyEncoding     hashing.KeyEncoding
+	keyDerivation   hashing.KeyDerivation
+	writeOnce       bool
+	publicURL       string
+	imgproxySource  string
+	iterateSnapshot bool
+	keepEmptyDirs   bool
+	owner           *owner
+	index           *bloomFilter
+	uploadLocks     sync.Map
 }
 
-var _ filestore.FileStore = &Filestore{}
+var (
+	_ filestore.FileStore        = &Filestore{}
+	_ filestore.Stater           = &Filestore{}
+	_ filestore.ParallelIterator = &Filestore{}
+	_ filestore.IfAbsentStorer   = &Filestore{}
+	_ filestore.InfoFetcher      = &Filestore{}
+	_ filestore.SortedIterator   = &Filestore{}
+	_ filestore.RangeFetcher     = &Filestore{}
+	_ filestore.PublicURLer      = &Filestore{}
+	_ filestore.Pinger           = &Filestore{}
+	_ filestore.LocalPather      = &Filestore{}
+	_ filestore.BatchExister     = &Filestore{}
+)
 
 // NewFilestore creates a new file store operating on a (local) filesystem.
 //
 // The assetsPath is the path to a directory where the assets will be stored.
 // The tmpPath is the path to a directory where temporary files will be stored.
-// It should be on the same filesystem as assetsPath to support atomic renames.
-func NewFilestore(tmpPath, assetsPath string) (*Filestore, error) {
-	// Create tmp folder if it does not exist
-	if err := os.MkdirAll(tmpPath, 0755); err != nil {
-		return nil, fmt.Errorf("creating tmp folder: %w", err)
+// It should be on the same filesystem as assetsPath to support atomic renames, otherwise files are copied
+// to the assetsPath after writing them. If tmpPath is empty, temporary files are stored as hidden files in the
+// assetsPath, which guarantees atomic renames.
+func NewFilestore(tmpPath, assetsPath string, opts ...Option) (*Filestore, error) {
+	localOptions := &options{}
+	for _, opt := range opts {
+		opt(localOptions)
+	}
+
+	if localOptions.readOnly {
+		// Only check that the assets folder exists
+		info, err := os.Stat(assetsPath)
+		if err != nil {
+			return nil, fmt.Errorf("checking assets folder: %w", err)
+		}
+		if !info.IsDir() {
+			return nil, fmt.Errorf("assets folder %s is not a directory", assetsPath)
+		}
 	}
 
-	// Create assets folder if it does not exist
-	if err := os.MkdirAll(assetsPath, 0755); err != nil {
-		return nil, fmt.Errorf("creating assets folder: %w", err)
+	keyEncoding := localOptions.keyEncoding
+	if keyEncoding == nil {
+		keyEncoding = hashing.HexKeys
 	}
 
-	return &Filestore{
+	f := &Filestore{
 		tmpPath:        tmpPath,
 		assetsPath:     assetsPath,
 		TargetFileMode: DefaultTargetFileMode,
+		DirMode:        DefaultDirMode,
 		PrefixSize:     DefaultPrefixSize,
-	}, nil
+		PrefixDepth:    DefaultPrefixDepth,
+
+		durableWrites:   localOptions.durableWrites,
+		linkMode:        localOptions.linkMode,
+		fileLocking:     localOptions.fileLocking,
+		minFreeSpace:    localOptions.minFreeSpace,
+		readOnly:        localOptions.readOnly,
+		maxObjectSize:   localOptions.maxObjectSize,
+		keyEncoding:     keyEncoding,
+		keyDerivation:   localOptions.keyDerivation,
+		writeOnce:       localOptions.writeOnce,
+		publicURL:       localOptions.publicURL,
+		imgproxySource:  localOptions.imgproxySource,
+		iterateSnapshot: localOptions.iterateSnapshot,
+		keepEmptyDirs:   localOptions.keepEmptyDirs,
+		owner:           localOptions.owner,
+	}
+	if f.imgproxySource == "" {
+		f.imgproxySource = DefaultImgproxySource
+	}
+	if localOptions.fileMode != 0 {
+		f.TargetFileMode = localOptions.fileMode
+	}
+	if localOptions.dirMode != 0 {
+		f.DirMode = localOptions.dirMode
+	}
+	if localOptions.flatLayout {
+		f.PrefixSize = 0
+	}
+
+	if !localOptions.readOnly {
+		// Create tmp folder if it does not exist
+		if tmpPath != "" {
+			if err := f.mkdirAll(tmpPath); err != nil {
+				return nil, fmt.Errorf("creating tmp folder: %w", err)
+			}
+		}
+
+		// Create assets folder if it does not exist
+		if err := f.mkdirAll(assetsPath); err != nil {
+			return nil, fmt.Errorf("creating assets folder: %w", err)
+		}
+	}
+
+	if localOptions.bloomFilterKeys > 0 {
+		if err := f.buildIndex(localOptions.bloomFilterKeys, localOptions.bloomFilterFalsePositiveRate); err != nil {
+			return nil, err
+		}
+	}
+
+	return f, nil
+}
+
+// Ping implements filestore.Pinger and checks that the assets path (and the temp path if set and not read-only) is a
+// directory.
+func (f *Filestore) Ping(ctx context.Context) error {
+	paths := []string{f.assetsPath}
+	// Without a temp path, temporary files are stored in the assets path
+	if !f.readOnly && f.tmpPath != "" {
+		paths = append(paths, f.tmpPath)
+	}
+	for _, p := range paths {
+		info, err := os.Stat(p)
+		if err != nil {
+			return fmt.Errorf("checking directory: %w", err)
+		}
+		if !info.IsDir() {
+			return fmt.Errorf("checking directory: %s is not a directory", p)
+		}
+	}
+	return nil
+}
+
+// limitReader limits r to the max object size if set.
+func (f *Filestore) limitReader(r io.Reader) io.Reader {
+	if f.maxObjectSize <= 0 {
+		return r
+	}
+	return filestore.LimitReader(r, f.maxObjectSize)
 }
 
 // Store stores the content of the reader in a local file.
 // The content is first stored in a temporary file to compute a consistent hash (SHA256)
 // and then the file is renamed to the hash in the assets path.
+// If ctx is cancelled while copying the content, Store stops and removes the temporary file.
 func (f *Filestore) Store(ctx context.Context, r io.Reader) (hash string, err error) {
+	if f.readOnly {
+		return "", filestore.ErrReadOnly
+	}
+
+	if err = f.checkFreeSpace(); err != nil {
+		return "", err
+	}
+
+	if file, ok := filestore.UnwrapReader(r).(*os.File); ok && f.linkMode != LinkModeNone {
+		hash, linked, err := f.storeLinked(ctx, file, r)
+		if err != nil {
+			return "", err
+		}
+		if linked {
+			return hash, nil
+		}
+	}
+
 	var (
 		tempFile      *os.File
 		tmpWasRenamed bool
@@ -70,7 +228,7 @@ func (f *Filestore) Store(ctx context.Context, r io.Reader) (hash string, err er
 	)
 
 	// Create temporary file to store uploaded file, will be renamed with hash later
-	tempFile, err = os.CreateTemp(f.tmpPath, "image-upload-*")
+	tempFile, err = f.createTemp("image-upload-*")
 	if err != nil {
 		return "", fmt.Errorf("creating temp file: %w", err)
 	}
@@ -96,22 +254,17 @@ func (f *Filestore) Store(ctx context.Context, r io.Reader) (hash string, err er
 		}
 	}()
 
-	// Read from given file and write to temp file while simultaneously writing into a SHA256 digest to calculate the hash on the fly
-	tmpReader := io.TeeReader(r, tempFile)
+	// Read from given file and write to temp file while simultaneously calculating the hash on the fly
+	hashingReader := hashing.NewHashingReader(f.limitReader(newContextReader(ctx, r)))
 
-	digest := sha256.New()
-
-	if _, err = io.Copy(digest, tmpReader); err != nil {
-		return "", fmt.Errorf("copying reader: %w", err)
+	if _, err = bufpool.Copy(tempFile, hashingReader); err != nil {
+		return "", fmt.Errorf("copying reader: %w", wrapNoSpace(err))
 	}
 
-	var hashBytes []byte
-	hashBytes = digest.Sum(hashBytes)
-	hashHex := hex.EncodeToString(hashBytes)
-
-	pathPrefix, err := f.prefixPath(hashHex)
-	if err != nil {
-		return "", err
+	if f.durableWrites {
+		if err = tempFile.Sync(); err != nil {
+			return "", fmt.Errorf("syncing temp file: %w", err)
+		}
 	}
 
 	if err = tempFile.Close(); err != nil {
@@ -119,99 +272,242 @@ func (f *Filestore) Store(ctx context.Context, r io.Reader) (hash string, err er
 	}
 	tmpWasClosed = true
 
-	targetPath := fmt.Sprintf("%s/%s/%s", f.assetsPath, pathPrefix, hashHex)
-	// Check if target path exists
-	if _, err = os.Stat(targetPath); err == nil {
-		return hashHex, nil
+	key, tmpWasRenamed, err := f.storeTempFile(tempFile.Name(), hashingReader.SumHex(), r)
+	return key, err
+}
+
+// storeTempFile moves a (closed) temporary file with the given hash to its path in the assets path and writes the
+// metadata of r. If a file with the hash already exists, only the metadata is updated and renamed is false, so the
+// caller has to remove the temporary file.
+func (f *Filestore) storeTempFile(tempPath, hashHex string, r any) (key string, renamed bool, err error) {
+	hashHex = f.deriveHash(hashHex)
+	key = f.keyEncoding.Encode(hashHex)
+
+	targetPath, err := f.filePath(key)
+	if err != nil {
+		return "", false, err
 	}
 
-	if err = os.MkdirAll(fmt.Sprintf("%s/%s", f.assetsPath, pathPrefix), 0755); err != nil {
-		return "", fmt.Errorf("creating asset subdirectory: %w", err)
+	unlock, err := f.lock(hashHex)
+	if err != nil {
+		return "", false, err
 	}
+	defer unlock()
 
-	if err = os.Rename(tempFile.Name(), targetPath); err != nil {
-		return "", fmt.Errorf("renaming temp file: %w", err)
+	// Check if the file exists (also with a legacy key)
+	if existingPath, _, statErr := f.statFile(key); statErr == nil {
+		// Update metadata like the S3 store does when storing existing content
+		if err = f.writeMetadata(existingPath, r); err != nil {
+			return "", false, err
+		}
+		return key, false, nil
 	}
 
-	tmpWasRenamed = true
-	err = os.Chmod(targetPath, f.TargetFileMode)
+	err = f.intoPrefixDir(filepath.Dir(targetPath), func() error {
+		if err := os.Rename(tempPath, targetPath); err != nil {
+			if !errors.Is(err, syscall.EXDEV) {
+				return fmt.Errorf("renaming temp file: %w", err)
+			}
+			// The tmp path is on another filesystem, so we have to copy the file
+			return f.moveAcrossFilesystems(tempPath, targetPath)
+		}
+		return nil
+	})
 	if err != nil {
-		return "", fmt.Errorf("setting file mode: %w", err)
+		return "", false, err
 	}
 
-	return hashHex, nil
+	f.indexAdd(key)
+	if err = f.setPathMode(targetPath); err != nil {
+		return "", true, err
+	}
+
+	if f.durableWrites {
+		if err = syncDir(filepath.Dir(targetPath)); err != nil {
+			return "", true, err
+		}
+	}
+
+	if err = f.writeMetadata(targetPath, r); err != nil {
+		return "", true, err
+	}
+
+	return key, true, nil
+}
+
+// deriveHash returns the hash used for the key of content with the hex encoded hash (see WithKeyDerivation).
+func (f *Filestore) deriveHash(hexHash string) string {
+	if f.keyDerivation == nil {
+		return hexHash
+	}
+	return f.keyDerivation(hexHash)
 }
 
-var hashRegex = regexp.MustCompile(`^[a-f0-9]+$`)
+// validKey checks if the key is a valid key of the key encoding (which includes bare hex keys).
+func (f *Filestore) validKey(key string) bool {
+	_, ok := f.keyEncoding.Decode(key)
+	return ok
+}
 
+// StoreHashed stores the content of the reader with the given hash.
+// The content is written to a temporary file first and then linked to the target path, so an existing file is never
+// replaced or truncated and concurrent writers with the same hash cannot produce partially written files.
 func (f *Filestore) StoreHashed(ctx context.Context, r io.Reader, hash string) error {
-	// Check hash is a valid hash (hex encoded)
-	if !hashRegex.MatchString(hash) {
-		return errInvalidHash
+	_, err := f.storeHashed(ctx, r, hash)
+	return err
+}
+
+// StoreIfAbsent implements filestore.IfAbsentStorer. The file is linked to the target path without replacing
+// an existing file, so only one of concurrent writers (also in other processes) reports that it stored the file.
+func (f *Filestore) StoreIfAbsent(ctx context.Context, r io.Reader, hash string) (created bool, err error) {
+	return f.storeHashed(ctx, r, hash)
+}
+
+// storeHashed stores the content of the reader with the given hash and returns true if it was stored.
+func (f *Filestore) storeHashed(ctx context.Context, r io.Reader, hash string) (created bool, err error) {
+	if f.readOnly {
+		return false, filestore.ErrReadOnly
 	}
 
-	pathPrefix, err := f.prefixPath(hash)
-	if err != nil {
-		return err
+	// Check hash is a valid hash (hex encoded)
+	if !f.validKey(hash) {
+		return false, errInvalidHash
 	}
 
-	targetPath := fmt.Sprintf("%s/%s/%s", f.assetsPath, pathPrefix, hash)
-	// Check if target path exists
-	if _, err = os.Stat(targetPath); err == nil {
-		return nil
+	if err = f.checkFreeSpace(); err != nil {
+		return false, err
 	}
 
-	if err = os.MkdirAll(fmt.Sprintf("%s/%s", f.assetsPath, pathPrefix), 0755); err != nil {
-		return fmt.Errorf("creating asset subdirectory: %w", err)
+	targetPath, err := f.filePath(hash)
+	if err != nil {
+		return false, err
+	}
+	// Check if target path exists
+	if existingPath, _, err := f.statFile(hash); err == nil {
+		if f.writeOnce {
+			var size int64 = -1
+			if sizedReader, ok := r.(filestore.Sized); ok {
+				size = sizedReader.Size()
+			}
+			return false, checkSameContent(newContextReader(ctx, r), size, hash, existingPath)
+		}
+		return false, nil
 	}
 
-	targetFile, err := os.Create(targetPath)
+	tempFile, err := f.createTemp("image-upload-*")
 	if err != nil {
-		return fmt.Errorf("creating target file: %w", err)
+		return false, fmt.Errorf("creating temp file: %w", err)
 	}
 
+	tmpWasClosed := false
 	defer func() {
-		previousErr := err
-
-		if closeErr := targetFile.Close(); closeErr != nil {
-			err = multierror.Append(
-				err,
-				fmt.Errorf("closing target file (with previous error): %w", closeErr),
-			)
-			return
-		}
-
-		if previousErr != nil {
-			if removeErr := os.Remove(targetPath); removeErr != nil {
+		if !tmpWasClosed {
+			if closeErr := tempFile.Close(); closeErr != nil {
 				err = multierror.Append(
 					err,
-					fmt.Errorf("removing target file (with previous error): %w", removeErr),
+					fmt.Errorf("closing temporary file (with previous error): %w", closeErr),
 				)
-				return
 			}
 		}
+		// The temporary file is always removed, since it is linked to the target path
+		if removeErr := os.Remove(tempFile.Name()); removeErr != nil && !errors.Is(removeErr, fs.ErrNotExist) {
+			err = multierror.Append(
+				err,
+				fmt.Errorf("removing temporary file: %w", removeErr),
+			)
+		}
 	}()
 
-	if _, err = io.Copy(targetFile, r); err != nil {
-		return fmt.Errorf("copying reader: %w", err)
+	if _, err = bufpool.Copy(tempFile, f.limitReader(newContextReader(ctx, r))); err != nil {
+		return false, fmt.Errorf("copying reader: %w", wrapNoSpace(err))
 	}
 
-	err = os.Chmod(targetPath, f.TargetFileMode)
+	if err = f.setFileMode(tempFile); err != nil {
+		return false, err
+	}
+
+	if f.durableWrites {
+		if err = tempFile.Sync(); err != nil {
+			return false, fmt.Errorf("syncing temp file: %w", err)
+		}
+	}
+
+	if err = tempFile.Close(); err != nil {
+		return false, fmt.Errorf("closing temp file: %w", err)
+	}
+	tmpWasClosed = true
+
+	unlock, err := f.lock(hash)
 	if err != nil {
-		return fmt.Errorf("setting file mode: %w", err)
+		return false, err
 	}
+	defer unlock()
 
-	return nil
+	err = f.intoPrefixDir(filepath.Dir(targetPath), func() error {
+		created, err = f.linkNoReplace(tempFile.Name(), targetPath)
+		return err
+	})
+	if err != nil {
+		return false, err
+	}
+	if !created {
+		// Another writer stored the same hash concurrently
+		if f.writeOnce {
+			tmpFile, err := os.Open(tempFile.Name())
+			if err != nil {
+				return false, fmt.Errorf("opening temp file: %w", err)
+			}
+			defer tmpFile.Close()
+			return false, checkSameContent(tmpFile, -1, hash, targetPath)
+		}
+		return false, nil
+	}
+	f.indexAdd(hash)
+
+	if f.durableWrites {
+		if err = syncDir(filepath.Dir(targetPath)); err != nil {
+			return false, err
+		}
+	}
+
+	if err = f.writeMetadata(targetPath, r); err != nil {
+		return false, err
+	}
+
+	return true, nil
 }
 
-func (f *Filestore) Exists(ctx context.Context, hash string) (bool, error) {
-	prefixPath, err := f.prefixPath(hash)
+// checkSameContent returns filestore.ErrAlreadyExists if the content of r (with the given size or -1 if unknown)
+// differs from the file at path.
+func checkSameContent(r io.Reader, size int64, hash, path string) error {
+	file, err := os.Open(path)
 	if err != nil {
-		return false, err
+		return fmt.Errorf("opening existing file: %w", err)
 	}
+	defer file.Close()
 
-	path := fmt.Sprintf("%s/%s/%s", f.assetsPath, prefixPath, hash)
-	_, err = os.Stat(path)
+	if size >= 0 {
+		info, err := file.Stat()
+		if err != nil {
+			return fmt.Errorf("stat existing file: %w", err)
+		}
+		if size != info.Size() {
+			return fmt.Errorf("%w: %s", filestore.ErrAlreadyExists, hash)
+		}
+	}
+
+	same, err := hashing.Equal(r, file)
+	if err != nil {
+		return fmt.Errorf("comparing content: %w", err)
+	}
+	if !same {
+		return fmt.Errorf("%w: %s", filestore.ErrAlreadyExists, hash)
+	}
+	return nil
+}
+
+func (f *Filestore) Exists(ctx context.Context, hash string) (bool, error) {
+	_, _, err := f.statFile(hash)
 	if errors.Is(err, fs.ErrNotExist) {
 		return false, nil
 	} else if err != nil {
@@ -220,49 +516,207 @@ func (f *Filestore) Exists(ctx context.Context, hash string) (bool, error) {
 	return true, nil
 }
 
+// ExistsMany implements filestore.BatchExister by checking the files one after another, which is cheap for
+// local files.
+func (f *Filestore) ExistsMany(ctx context.Context, hashes []string) (map[string]bool, error) {
+	exists := make(map[string]bool, len(hashes))
+	for _, hash := range hashes {
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		ok, err := f.Exists(ctx, hash)
+		if err != nil {
+			return nil, err
+		}
+		exists[hash] = ok
+	}
+	return exists, nil
+}
+
 // Fetch returns a reader to the file with the given hash.
 // If the file does not exist, ErrNotExist is returned.
+// Reading fails with the context error after ctx is done, the reader also implements io.Seeker and io.ReaderAt.
 func (f *Filestore) Fetch(ctx context.Context, hash string) (io.ReadCloser, error) {
-	prefixPath, err := f.prefixPath(hash)
+	file, err := f.openFile(hash)
 	if err != nil {
-		return nil, err
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, &filestore.NotExistError{Op: "fetch", Hash: hash}
+		}
+		return nil, fmt.Errorf("opening file: %w", err)
 	}
+	return &contextFile{ctx: ctx, file: file}, nil
+}
 
-	path := fmt.Sprintf("%s/%s/%s", f.assetsPath, prefixPath, hash)
-	file, err := os.Open(path)
+// LocalPath implements filestore.LocalPather and returns the path of the file with the given hash.
+// If the file does not exist, ErrNotExist is returned.
+func (f *Filestore) LocalPath(ctx context.Context, hash string) (string, error) {
+	filePath, _, err := f.statFile(hash)
 	if err != nil {
 		if errors.Is(err, os.ErrNotExist) {
-			return nil, filestore.ErrNotExist
+			return "", &filestore.NotExistError{Op: "local path", Hash: hash}
+		}
+		return "", fmt.Errorf("stat file: %w", err)
+	}
+	return filePath, nil
+}
+
+// FetchRange implements filestore.RangeFetcher and returns a reader to a part of the file with the given hash.
+func (f *Filestore) FetchRange(ctx context.Context, hash string, offset, length int64) (io.ReadCloser, error) {
+	file, err := f.openFile(hash)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, &filestore.NotExistError{Op: "fetch range", Hash: hash}
 		}
 		return nil, fmt.Errorf("opening file: %w", err)
 	}
-	return file, nil
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("stat file: %w", err)
+	}
+	if offset < 0 || offset > info.Size() {
+		_ = file.Close()
+		return nil, fmt.Errorf("offset %d of %d bytes: %w", offset, info.Size(), filestore.ErrInvalidRange)
+	}
+	if _, err = file.Seek(offset, io.SeekStart); err != nil {
+		_ = file.Close()
+		return nil, fmt.Errorf("seeking file: %w", err)
+	}
+
+	cf := &contextFile{ctx: ctx, file: file}
+	if length < 0 {
+		return cf, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(cf, length), cf}, nil
 }
 
 var errInvalidHash = errors.New("invalid hash")
 
-// ImgproxyURLSource gets a source URL to a local file for imgproxy.
+// ImgproxyURLSource gets a source URL to a local file for imgproxy from the template set with WithImgproxySource.
 func (f *Filestore) ImgproxyURLSource(hash string) (string, error) {
 	prefixPath, err := f.prefixPath(hash)
 	if err != nil {
 		return "", err
 	}
 
-	return fmt.Sprintf("local:///%s/%s", prefixPath, hash), nil
+	if prefixPath == "" {
+		// Files are stored directly in the assets path with the flat layout
+		return strings.NewReplacer("{prefix}/", "", "{prefix}", "", "{hash}", hash).Replace(f.imgproxySource), nil
+	}
+	return strings.NewReplacer("{prefix}", prefixPath, "{hash}", hash).Replace(f.imgproxySource), nil
+}
+
+// IteratesSorted implements filestore.SortedIterator.
+// Iterate returns hashes in lexicographic order if all files are stored in the current layout.
+func (f *Filestore) IteratesSorted() bool {
+	return true
 }
 
 // Iterate over all files in the store with a batch size of maxBatch.
+//
+// Hashes are returned in lexicographic order: directory entries are walked in sorted order and prefix directories
+// are named after the hash prefix. This allows to merge-join the iterations of two stores without buffering them.
+// The order is only guaranteed if all files are stored in the current layout (see Reshard).
+// With WithIterateSnapshot, all hashes are listed before the first callback.
 func (f *Filestore) Iterate(ctx context.Context, maxBatch int, callback func(hashes []string) error) error {
-	hashes := make([]string, 0, maxBatch)
-	err := filepath.Walk(f.assetsPath, func(path string, info os.FileInfo, err error) error {
+	if f.iterateSnapshot {
+		hashes, err := f.snapshotHashes(ctx)
 		if err != nil {
 			return err
 		}
-		if info.IsDir() || info.Name()[0] == '.' {
-			return nil
+		for _, batch := range batches(hashes, maxBatch) {
+			if err = callback(batch); err != nil {
+				return err
+			}
 		}
+		return nil
+	}
+
+	return walkHashes(ctx, f.assetsPath, maxBatch, callback)
+}
 
-		hashes = append(hashes, info.Name())
+// snapshotHashes lists the names of all files in the assets path in lexicographic order (see Iterate).
+func (f *Filestore) snapshotHashes(ctx context.Context) ([]string, error) {
+	var hashes []string
+	err := walkFiles(ctx, f.assetsPath, true, func(name string) error {
+		hashes = append(hashes, name)
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return hashes, nil
+}
+
+// batches splits hashes into batches of up to size hashes.
+func batches(hashes []string, size int) [][]string {
+	var result [][]string
+	for len(hashes) > size {
+		result = append(result, hashes[:size:size])
+		hashes = hashes[size:]
+	}
+	if len(hashes) > 0 {
+		result = append(result, hashes)
+	}
+	return result
+}
+
+// iterateParallelBatchSize is the maximum number of hashes per callback of IterateParallel.
+const iterateParallelBatchSize = 1000
+
+// IterateParallel implements filestore.ParallelIterator. The prefix directories of the assets path are walked by
+// up to workers concurrent goroutines, callback is called with batches of hashes of a single prefix directory.
+// With WithIterateSnapshot, all hashes are listed first and the batches are passed to up to workers concurrent callbacks.
+func (f *Filestore) IterateParallel(ctx context.Context, workers int, callback func(hashes []string) error) error {
+	if f.iterateSnapshot {
+		hashes, err := f.snapshotHashes(ctx)
+		if err != nil {
+			return err
+		}
+		return parallel.ForEach(ctx, batches(hashes, iterateParallelBatchSize), workers, func(ctx context.Context, batch []string) error {
+			return callback(batch)
+		})
+	}
+
+	entries, err := os.ReadDir(f.assetsPath)
+	if err != nil {
+		return fmt.Errorf("reading assets folder: %w", err)
+	}
+
+	var (
+		shards []string
+		hashes []string
+	)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			shards = append(shards, filepath.Join(f.assetsPath, entry.Name()))
+		} else if entry.Name()[0] != '.' {
+			hashes = append(hashes, entry.Name())
+		}
+	}
+	// Files directly in the assets path are stored with the flat layout
+	err = parallel.ForEach(ctx, batches(hashes, iterateParallelBatchSize), workers, func(ctx context.Context, batch []string) error {
+		return callback(batch)
+	})
+	if err != nil {
+		return err
+	}
+
+	return parallel.ForEach(ctx, shards, workers, func(ctx context.Context, shard string) error {
+		return walkHashes(ctx, shard, iterateParallelBatchSize, callback)
+	})
+}
+
+// walkHashes walks dir and calls callback with batches of up to maxBatch file names in lexicographic order,
+// hidden files are skipped.
+func walkHashes(ctx context.Context, dir string, maxBatch int, callback func(hashes []string) error) error {
+	hashes := make([]string, 0, maxBatch)
+	err := walkFiles(ctx, dir, true, func(name string) error {
+		hashes = append(hashes, name)
 
 		// If we have enough hashes, invoke the callback
 		if len(hashes) == maxBatch {
@@ -272,7 +726,6 @@ func (f *Filestore) Iterate(ctx context.Context, maxBatch int, callback func(has
 			// Reset slice
 			hashes = hashes[:0]
 		}
-
 		return nil
 	})
 	if err != nil {
@@ -286,65 +739,388 @@ func (f *Filestore) Iterate(ctx context.Context, maxBatch int, callback func(has
 	return nil
 }
 
+// walkFiles calls fn with the names of all files in dir and its subdirectories, hidden files are skipped.
+// Unlike filepath.Walk, it does not stat every file: the type of an entry is taken from the directory listing.
+// Entries are only sorted by name if sorted is set, since sorting large directories is expensive.
+func walkFiles(ctx context.Context, dir string, sorted bool, fn func(name string) error) error {
+	entries, err := readDir(dir, sorted)
+	if err != nil {
+		return err
+	}
+
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if entry.IsDir() {
+			if err := walkFiles(ctx, filepath.Join(dir, entry.Name()), sorted, fn); err != nil {
+				return err
+			}
+			continue
+		}
+		if entry.Name()[0] == '.' {
+			continue
+		}
+		if err := fn(entry.Name()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// readDir reads the entries of dir, sorted by name if sorted is set.
+func readDir(dir string, sorted bool) ([]fs.DirEntry, error) {
+	if sorted {
+		return os.ReadDir(dir)
+	}
+
+	d, err := os.Open(dir)
+	if err != nil {
+		return nil, err
+	}
+	defer d.Close()
+
+	return d.ReadDir(-1)
+}
+
 // Remove a file from the store with the given hash.
 func (f *Filestore) Remove(ctx context.Context, hash string) error {
-	prefixPath, err := f.prefixPath(hash)
+	if f.readOnly {
+		return filestore.ErrReadOnly
+	}
+
+	unlock, err := f.lock(hash)
+	if err != nil {
+		return err
+	}
+	defer unlock()
+
+	fileName, err := f.existingFilePath(hash)
 	if err != nil {
 		return err
 	}
 
-	dirName := fmt.Sprintf("%s/%s", f.assetsPath, prefixPath)
-	fileName := fmt.Sprintf("%s/%s", dirName, hash)
 	err = os.Remove(fileName)
 	if err != nil {
 		if os.IsNotExist(err) {
-			return filestore.ErrNotExist
+			return &filestore.NotExistError{Op: "remove", Hash: hash}
 		}
 		return fmt.Errorf("removing file %q: %w", fileName, err)
 	}
 
-	// Check if directory for prefix is empty
+	if err = removeMetadata(fileName); err != nil {
+		return err
+	}
+
+	if f.keepEmptyDirs {
+		return nil
+	}
+	return f.removeEmptyDirs(filepath.Dir(fileName))
+}
+
+// maxPrefixDirAttempts is the number of attempts to move a file into a prefix directory that is removed concurrently.
+const maxPrefixDirAttempts = 5
+
+// intoPrefixDir creates the prefix directory dir and calls fn to move a file into it. If fn fails because the
+// directory was removed concurrently (by Remove of the last file in the directory), the directory is created again.
+func (f *Filestore) intoPrefixDir(dir string, fn func() error) error {
+	for attempt := 1; ; attempt++ {
+		err := f.mkdirAll(dir)
+		if err != nil {
+			err = fmt.Errorf("creating asset subdirectory: %w", err)
+			// Creating a directory fails with an exists error if it was created and removed again concurrently
+			if (!errors.Is(err, fs.ErrNotExist) && !errors.Is(err, fs.ErrExist)) || attempt == maxPrefixDirAttempts {
+				return err
+			}
+			continue
+		}
+
+		err = fn()
+		if err == nil || !errors.Is(err, fs.ErrNotExist) || attempt == maxPrefixDirAttempts {
+			return err
+		}
+		if _, statErr := os.Stat(dir); statErr == nil {
+			// The directory exists, so something else is missing
+			return err
+		}
+	}
+}
+
+// removeEmptyDirs removes the given prefix directory and its parents up to the assets path if they are empty.
+// Directories that are not empty anymore or were removed concurrently (e.g. by a concurrent Store or Remove in the
+// same prefix) are skipped without an error.
+func (f *Filestore) removeEmptyDirs(dirName string) error {
+	assetsPath := filepath.Clean(f.assetsPath)
+	for dirName = filepath.Clean(dirName); dirName != assetsPath && strings.HasPrefix(dirName, assetsPath); dirName = filepath.Dir(dirName) {
+		// Removing a directory fails if it is not empty, so it is not checked in advance
+		err := os.Remove(dirName)
+		if err == nil {
+			continue
+		}
+		if errors.Is(err, fs.ErrNotExist) || errors.Is(err, syscall.ENOTEMPTY) || errors.Is(err, syscall.EEXIST) {
+			return nil
+		}
+		// The error for a directory that is not empty differs between platforms
+		if empty, emptyErr := isEmptyDir(dirName); (emptyErr == nil && !empty) || errors.Is(emptyErr, fs.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("removing empty directory %s: %w", dirName, err)
+	}
+
+	return nil
+}
+
+// syncDir syncs a directory to make sure renamed or created entries are persisted.
+func syncDir(dirName string) error {
 	dir, err := os.Open(dirName)
 	if err != nil {
 		return fmt.Errorf("opening directory %s: %w", dirName, err)
 	}
 	defer dir.Close()
 
+	if err = dir.Sync(); err != nil {
+		return fmt.Errorf("syncing directory %s: %w", dirName, err)
+	}
+	return nil
+}
+
+func isEmptyDir(dirName string) (bool, error) {
+	dir, err := os.Open(dirName)
+	if err != nil {
+		return false, fmt.Errorf("opening directory %s: %w", dirName, err)
+	}
+	defer dir.Close()
+
 	_, err = dir.Readdirnames(1)
 	if err != nil {
 		// io.EOF means the directory is empty
 		if errors.Is(err, io.EOF) {
-			err = os.Remove(dirName)
-			if err != nil {
-				return fmt.Errorf("removing empty directory %s: %w", dirName, err)
-			}
-			return nil
+			return true, nil
 		}
-		return fmt.Errorf("reading directory %s: %w", dirName, err)
+		return false, fmt.Errorf("reading directory %s: %w", dirName, err)
 	}
 
-	return nil
+	return false, nil
 }
 
 // Size returns the size of the file with the given hash.
 func (f *Filestore) Size(ctx context.Context, hash string) (int64, error) {
+	_, stat, err := f.statFile(hash)
+	if errors.Is(err, fs.ErrNotExist) {
+		return 0, &filestore.NotExistError{Op: "size", Hash: hash}
+	} else if err != nil {
+		return 0, fmt.Errorf("stat file: %w", err)
+	}
+
+	return stat.Size(), nil
+}
+
+func (f *Filestore) prefixPath(hash string) (string, error) {
+	return layoutPrefixPath(f.shardHash(hash), f.PrefixSize, f.PrefixDepth)
+}
+
+// shardHash returns the hex encoded hash of a key for the prefix directories, so files with the same hash
+// are stored in the same directory regardless of the key encoding.
+func (f *Filestore) shardHash(key string) string {
+	if hexHash, ok := f.keyEncoding.Decode(key); ok {
+		return hexHash
+	}
+	return key
+}
+
+// layoutPrefixPath returns the prefix directories of hash, which are empty for the flat layout (a prefixSize of 0).
+func layoutPrefixPath(hash string, prefixSize, prefixDepth int) (string, error) {
+	if prefixSize <= 0 {
+		if hash == "" {
+			return "", errInvalidHash
+		}
+		return "", nil
+	}
+	if prefixDepth < 1 {
+		prefixDepth = 1
+	}
+	if len(hash) < prefixSize*prefixDepth {
+		return "", errInvalidHash
+	}
+
+	parts := make([]string, prefixDepth)
+	for i := range parts {
+		parts[i] = hash[i*prefixSize : (i+1)*prefixSize]
+	}
+	return strings.Join(parts, "/"), nil
+}
+
+// filePath returns the path of the file with the given hash in the current layout.
+func (f *Filestore) filePath(hash string) (string, error) {
 	prefixPath, err := f.prefixPath(hash)
 	if err != nil {
-		return 0, err
+		return "", err
+	}
+	if prefixPath == "" {
+		return fmt.Sprintf("%s/%s", f.assetsPath, hash), nil
+	}
+	return fmt.Sprintf("%s/%s/%s", f.assetsPath, prefixPath, hash), nil
+}
+
+// existingFilePath returns the path of the file with the given hash.
+// If the file does not exist in the current layout but in the default layout, the path in the default layout is returned.
+// If the file does not exist with an encoded key but with the bare hex key, the path of the bare hex key is returned.
+// If the file does not exist at all, the path in the current layout is returned.
+func (f *Filestore) existingFilePath(hash string) (string, error) {
+	paths, err := f.candidatePaths(hash)
+	if err != nil {
+		return "", err
 	}
 
-	path := fmt.Sprintf("%s/%s/%s", f.assetsPath, prefixPath, hash)
-	stat, err := os.Stat(path)
+	for _, path := range paths {
+		if _, err := os.Stat(path); !errors.Is(err, fs.ErrNotExist) {
+			return path, nil
+		}
+	}
+
+	return paths[0], nil
+}
+
+// statFile returns the path and file info of the file with the given hash by trying the candidate paths in order.
+// An error wrapping fs.ErrNotExist is returned if the file does not exist (or is not in the index).
+func (f *Filestore) statFile(hash string) (string, fs.FileInfo, error) {
+	paths, err := f.existingCandidatePaths(hash)
 	if err != nil {
-		return 0, err
+		return "", nil, err
 	}
 
-	return stat.Size(), nil
+	for _, path := range paths {
+		info, err := os.Stat(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		return path, info, err
+	}
+	return "", nil, fs.ErrNotExist
 }
 
-func (f *Filestore) prefixPath(hash string) (string, error) {
-	if len(hash) < f.PrefixSize {
-		return "", errInvalidHash
+// openFile opens the file with the given hash by trying the candidate paths in order, so the file is not stat'ed
+// before it is opened. An error wrapping fs.ErrNotExist is returned if the file does not exist (or is not in the index).
+func (f *Filestore) openFile(hash string) (*os.File, error) {
+	paths, err := f.existingCandidatePaths(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, path := range paths {
+		file, err := os.Open(path)
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		return file, err
+	}
+	return nil, fs.ErrNotExist
+}
+
+// existingCandidatePaths returns the candidate paths of the file with the given hash or none if the index
+// rules out that the file exists.
+func (f *Filestore) existingCandidatePaths(hash string) ([]string, error) {
+	paths, err := f.candidatePaths(hash)
+	if err != nil {
+		return nil, err
 	}
-	return hash[0:f.PrefixSize], nil
+	if !f.mayExist(hash) {
+		return nil, nil
+	}
+	return paths, nil
+}
+
+// candidatePaths returns the paths where the file with the given hash could be stored, in the order they are checked:
+// the path in the current layout, the path in the default layout (if the layout differs) and the same paths
+// for the legacy key of the hash (see hashing.LegacyKey).
+func (f *Filestore) candidatePaths(hash string) ([]string, error) {
+	path, err := f.filePath(hash)
+	if err != nil {
+		return nil, err
+	}
+
+	paths := []string{path}
+	if defaultPath, ok := f.defaultLayoutFilePath(hash); ok {
+		paths = append(paths, defaultPath)
+	}
+	if legacyKey, ok := hashing.LegacyKey(f.keyEncoding, hash); ok {
+		if legacyPath, err := f.filePath(legacyKey); err == nil {
+			paths = append(paths, legacyPath)
+		}
+		if defaultPath, ok := f.defaultLayoutFilePath(legacyKey); ok {
+			paths = append(paths, defaultPath)
+		}
+	}
+	return paths, nil
+}
+
+// defaultLayoutFilePath returns the path of the file with the given hash in the default layout if the current layout
+// differs from it.
+func (f *Filestore) defaultLayoutFilePath(hash string) (string, bool) {
+	if f.PrefixSize == DefaultPrefixSize && f.PrefixDepth <= DefaultPrefixDepth {
+		return "", false
+	}
+	shardHash := f.shardHash(hash)
+	if len(shardHash) < DefaultPrefixSize {
+		return "", false
+	}
+	return fmt.Sprintf("%s/%s/%s", f.assetsPath, shardHash[:DefaultPrefixSize], hash), true
+}
+
+// Reshard moves all files that are not stored in the current layout (e.g. after changing PrefixSize or PrefixDepth)
+// to their path in the current layout and removes empty prefix directories.
+func (f *Filestore) Reshard(ctx context.Context) error {
+	if f.readOnly {
+		return filestore.ErrReadOnly
+	}
+
+	var paths []string
+	err := filepath.Walk(f.assetsPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if info.IsDir() || info.Name()[0] == '.' {
+			return nil
+		}
+
+		paths = append(paths, path)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("walking assets: %w", err)
+	}
+
+	for _, path := range paths {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		targetPath, err := f.filePath(filepath.Base(path))
+		if err != nil {
+			return fmt.Errorf("getting path for %s: %w", path, err)
+		}
+		if filepath.Clean(targetPath) == filepath.Clean(path) {
+			continue
+		}
+
+		if err = f.mkdirAll(filepath.Dir(targetPath)); err != nil {
+			return fmt.Errorf("creating asset subdirectory: %w", err)
+		}
+		if err = os.Rename(path, targetPath); err != nil {
+			return fmt.Errorf("moving %s: %w", path, err)
+		}
+		if err = os.Rename(metadataPath(path), metadataPath(targetPath)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return fmt.Errorf("moving metadata of %s: %w", path, err)
+		}
+		if err = f.removeEmptyDirs(filepath.Dir(path)); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// FS returns an fs.FS that opens files by hash (e.g. for use with http.FileServer via http.FS).
+func (f *Filestore) FS() fs.FS {
+	return filestore.NewFS(f)
 }
@@ -5,15 +5,26 @@ import (
 	"errors"
 	"fmt"
 	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
 	"os"
 	"path"
+	"path/filepath"
+	"sort"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/filestoretest"
+	"github.com/networkteam/filestore/hashing"
 	"github.com/networkteam/filestore/local"
 )
 
@@ -43,6 +54,151 @@ func TestFilestore_Store(t *testing.T) {
 	assert.Equal(t, 0, len(files), "tmp dir should be empty")
 }
 
+func TestFilestore_StoreWithoutTmpPath(t *testing.T) {
+	testDir := t.TempDir()
+	ctx := context.Background()
+
+	store, err := local.NewFilestore("", testDir)
+	require.NoError(t, err)
+
+	hash, err := store.Store(ctx, strings.NewReader("Test content"))
+	require.NoError(t, err)
+	assert.Equal(t, "9d9595c5d94fb65b824f56e9999527dba9542481580d69feb89056aabaa0aa87", hash)
+
+	// Only the prefix directory is left in the assets path
+	files, err := os.ReadDir(testDir)
+	require.NoError(t, err)
+	require.Len(t, files, 1)
+	assert.Equal(t, "9d", files[0].Name())
+}
+
+func TestFilestore_StoreWithDurableWrites(t *testing.T) {
+	testDir := t.TempDir()
+	ctx := context.Background()
+
+	store, err := local.NewFilestore(path.Join(testDir, "tmp"), path.Join(testDir, "assets"), local.WithDurableWrites())
+	require.NoError(t, err)
+
+	hash, err := store.Store(ctx, strings.NewReader("Test content"))
+	require.NoError(t, err)
+	assert.Equal(t, "9d9595c5d94fb65b824f56e9999527dba9542481580d69feb89056aabaa0aa87", hash)
+
+	err = store.StoreHashed(ctx, strings.NewReader("Other content"), "a0b1c2d3e4f5")
+	require.NoError(t, err)
+
+	assert.FileExists(t, path.Join(testDir, "assets", "9d", hash))
+	assert.FileExists(t, path.Join(testDir, "assets", "a0", "a0b1c2d3e4f5"))
+}
+
+func TestFilestore_StoreWithHardLink(t *testing.T) {
+	testDir := t.TempDir()
+	ctx := context.Background()
+
+	store, err := local.NewFilestore(path.Join(testDir, "tmp"), path.Join(testDir, "assets"), local.WithLinking(local.LinkModeHardLink))
+	require.NoError(t, err)
+
+	sourcePath := path.Join(testDir, "source.txt")
+	err = os.WriteFile(sourcePath, []byte("Test content"), 0600)
+	require.NoError(t, err)
+
+	source, err := os.Open(sourcePath)
+	require.NoError(t, err)
+	defer source.Close()
+
+	hash, err := store.Store(ctx, source)
+	require.NoError(t, err)
+	assert.Equal(t, "9d9595c5d94fb65b824f56e9999527dba9542481580d69feb89056aabaa0aa87", hash)
+
+	sourceInfo, err := os.Stat(sourcePath)
+	require.NoError(t, err)
+	targetInfo, err := os.Stat(path.Join(testDir, "assets", "9d", hash))
+	require.NoError(t, err)
+	assert.True(t, os.SameFile(sourceInfo, targetInfo), "stored file should be a hard link to the source")
+}
+
+func TestFilestore_StoreWithReflink(t *testing.T) {
+	testDir := t.TempDir()
+	ctx := context.Background()
+
+	store, err := local.NewFilestore(path.Join(testDir, "tmp"), path.Join(testDir, "assets"), local.WithLinking(local.LinkModeReflink))
+	require.NoError(t, err)
+
+	sourcePath := path.Join(testDir, "source.txt")
+	err = os.WriteFile(sourcePath, []byte("Test content"), 0600)
+	require.NoError(t, err)
+
+	source, err := os.Open(sourcePath)
+	require.NoError(t, err)
+	defer source.Close()
+
+	// Falls back to copying if the filesystem does not support reflinks
+	hash, err := store.Store(ctx, source)
+	require.NoError(t, err)
+	assert.Equal(t, "9d9595c5d94fb65b824f56e9999527dba9542481580d69feb89056aabaa0aa87", hash)
+
+	content, err := os.ReadFile(path.Join(testDir, "assets", "9d", hash))
+	require.NoError(t, err)
+	assert.Equal(t, "Test content", string(content))
+}
+
+func TestFilestore_StoreAndRemoveWithFileLocking(t *testing.T) {
+	testDir := t.TempDir()
+	ctx := context.Background()
+
+	store, err := local.NewFilestore(path.Join(testDir, "tmp"), path.Join(testDir, "assets"), local.WithFileLocking())
+	require.NoError(t, err)
+
+	// Concurrently store and remove files with the same prefix
+	var wg sync.WaitGroup
+	errs := make(chan error, 40)
+	for i := 0; i < 20; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			hash := fmt.Sprintf("a0%02d", i)
+			if err := store.StoreHashed(ctx, strings.NewReader("Test content"), hash); err != nil {
+				errs <- err
+				return
+			}
+			if err := store.Remove(ctx, hash); err != nil {
+				errs <- err
+			}
+		}(i)
+	}
+	wg.Wait()
+	close(errs)
+
+	for err := range errs {
+		assert.NoError(t, err)
+	}
+
+	// Only lock files are left
+	var hashes []string
+	err = store.Iterate(ctx, 10, func(hshs []string) error {
+		hashes = append(hashes, hshs...)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Empty(t, hashes)
+}
+
+func TestFilestore_FileLockingWithFlatLayout(t *testing.T) {
+	testDir := t.TempDir()
+	ctx := context.Background()
+
+	assetsPath := path.Join(testDir, "assets")
+	store, err := local.NewFilestore(path.Join(testDir, "tmp"), assetsPath, local.WithFileLocking(), local.WithFlatLayout())
+	require.NoError(t, err)
+
+	require.NoError(t, store.StoreHashed(ctx, strings.NewReader("Test content"), "a0b1c2"))
+	require.NoError(t, store.StoreHashed(ctx, strings.NewReader("Other content"), "b0c1d2"))
+
+	// Hashes with different prefixes use different lock files
+	assert.FileExists(t, path.Join(assetsPath, ".a0.lock"))
+	assert.FileExists(t, path.Join(assetsPath, ".b0.lock"))
+	assert.NoFileExists(t, path.Join(assetsPath, "..lock"))
+}
+
 func TestFilestore_StoreHashed(t *testing.T) {
 	testDir := t.TempDir()
 	ctx := context.Background()
@@ -85,6 +241,165 @@ func TestFilestore_StoreHashed(t *testing.T) {
 	})
 }
 
+func TestFilestore_StoreHashedConcurrently(t *testing.T) {
+	testDir := t.TempDir()
+	ctx := context.Background()
+
+	store, err := local.NewFilestore(path.Join(testDir, "tmp"), path.Join(testDir, "assets"))
+	require.NoError(t, err)
+
+	contents := make([]string, 10)
+	for i := range contents {
+		contents[i] = strings.Repeat(fmt.Sprintf("content %d ", i), 10000)
+	}
+
+	var wg sync.WaitGroup
+	for _, content := range contents {
+		wg.Add(1)
+		go func(content string) {
+			defer wg.Done()
+			err := store.StoreHashed(ctx, strings.NewReader(content), "a0b1c2d3e4f5")
+			assert.NoError(t, err)
+		}(content)
+	}
+	wg.Wait()
+
+	out, err := store.Fetch(ctx, "a0b1c2d3e4f5")
+	require.NoError(t, err)
+	defer out.Close()
+
+	content, err := io.ReadAll(out)
+	require.NoError(t, err)
+	assert.Contains(t, contents, string(content), "stored content should be complete")
+
+	files, err := os.ReadDir(path.Join(testDir, "tmp"))
+	require.NoError(t, err)
+	assert.Empty(t, files, "tmp dir should be empty")
+}
+
+func TestFilestore_StoreIfAbsent(t *testing.T) {
+	testDir := t.TempDir()
+
+	store, err := local.NewFilestore(path.Join(testDir, "tmp"), path.Join(testDir, "assets"))
+	require.NoError(t, err)
+
+	filestoretest.TestStoreIfAbsent(t, store)
+}
+
+func TestFilestore_StoreIfAbsentConcurrently(t *testing.T) {
+	testDir := t.TempDir()
+	ctx := context.Background()
+
+	store, err := local.NewFilestore(path.Join(testDir, "tmp"), path.Join(testDir, "assets"))
+	require.NoError(t, err)
+
+	var (
+		wg      sync.WaitGroup
+		created int32
+	)
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			ok, err := store.StoreIfAbsent(ctx, strings.NewReader(fmt.Sprintf("content %d", i)), "a0b1c2d3e4f5")
+			assert.NoError(t, err)
+			if ok {
+				atomic.AddInt32(&created, 1)
+			}
+		}(i)
+	}
+	wg.Wait()
+
+	assert.Equal(t, int32(1), created, "exactly one store should report created")
+}
+
+func TestFilestore_KeyEncoding(t *testing.T) {
+	for _, encoding := range []hashing.KeyEncoding{hashing.PrefixedKeys, hashing.MultihashKeys} {
+		testDir := t.TempDir()
+
+		store, err := local.NewFilestore(path.Join(testDir, "tmp"), path.Join(testDir, "assets"), local.WithKeyEncoding(encoding))
+		require.NoError(t, err)
+
+		filestoretest.TestKeyEncoding(t, store, encoding)
+	}
+
+	t.Run("shards by hash", func(t *testing.T) {
+		testDir := t.TempDir()
+		ctx := context.Background()
+
+		store, err := local.NewFilestore(path.Join(testDir, "tmp"), path.Join(testDir, "assets"), local.WithKeyEncoding(hashing.PrefixedKeys))
+		require.NoError(t, err)
+
+		hash, err := store.Store(ctx, strings.NewReader("Test content"))
+		require.NoError(t, err)
+		assert.Equal(t, "sha256-9d9595c5d94fb65b824f56e9999527dba9542481580d69feb89056aabaa0aa87", hash)
+		assert.FileExists(t, path.Join(testDir, "assets", "9d", hash))
+	})
+}
+
+func TestFilestore_KeyDerivation(t *testing.T) {
+	testDir := t.TempDir()
+	derivation := hashing.HMACKeys([]byte("secret"))
+
+	store, err := local.NewFilestore(path.Join(testDir, "tmp"), path.Join(testDir, "assets"), local.WithKeyDerivation(derivation))
+	require.NoError(t, err)
+
+	filestoretest.TestKeyDerivation(t, store, derivation)
+
+	report, err := store.Verify(context.Background(), local.VerifyOptions{})
+	require.NoError(t, err)
+	assert.Empty(t, report.Mismatched)
+}
+
+func TestFilestore_Ping(t *testing.T) {
+	testDir := t.TempDir()
+
+	store, err := local.NewFilestore(path.Join(testDir, "tmp"), path.Join(testDir, "assets"))
+	require.NoError(t, err)
+	require.NoError(t, store.Ping(context.Background()))
+	require.NoError(t, filestore.CheckHealth(context.Background(), store, filestore.WithWriteProbe()))
+
+	require.NoError(t, os.RemoveAll(path.Join(testDir, "assets")))
+	assert.Error(t, store.Ping(context.Background()))
+}
+
+func TestFilestore_Ping_WithoutTmpPath(t *testing.T) {
+	testDir := t.TempDir()
+
+	store, err := local.NewFilestore("", path.Join(testDir, "assets"))
+	require.NoError(t, err)
+	require.NoError(t, store.Ping(context.Background()))
+	require.NoError(t, filestore.CheckHealth(context.Background(), store, filestore.WithWriteProbe()))
+}
+
+func TestFilestore_LocalPath(t *testing.T) {
+	ctx := context.Background()
+	testDir := t.TempDir()
+
+	store, err := local.NewFilestore(path.Join(testDir, "tmp"), path.Join(testDir, "assets"))
+	require.NoError(t, err)
+	hash, err := store.Store(ctx, strings.NewReader("Hello world"))
+	require.NoError(t, err)
+
+	localPath, err := store.LocalPath(ctx, hash)
+	require.NoError(t, err)
+	content, err := os.ReadFile(localPath)
+	require.NoError(t, err)
+	assert.Equal(t, "Hello world", string(content))
+
+	_, err = store.LocalPath(ctx, "a0b1c2d3e4f5")
+	assert.ErrorIs(t, err, filestore.ErrNotExist)
+}
+
+func TestFilestore_WriteOnce(t *testing.T) {
+	testDir := t.TempDir()
+
+	store, err := local.NewFilestore(path.Join(testDir, "tmp"), path.Join(testDir, "assets"), local.WithWriteOnce())
+	require.NoError(t, err)
+
+	filestoretest.TestWriteOnce(t, store)
+}
+
 func TestFilestore_Exists(t *testing.T) {
 	testDir := t.TempDir()
 	ctx := context.Background()
@@ -123,6 +438,15 @@ func TestFilestore_ImgproxyURLSource(t *testing.T) {
 	require.NoError(t, err)
 
 	assert.Equal(t, "local:///9d/9d9595c5d94fb65b824f56e9999527dba9542481580d69feb89056aabaa0aa87", url)
+
+	t.Run("with template", func(t *testing.T) {
+		store, err := local.NewFilestore(path.Join(testDir, "tmp"), path.Join(testDir, "assets"), local.WithImgproxySource("local:///mnt/assets/{prefix}/{hash}"))
+		require.NoError(t, err)
+
+		url, err := store.ImgproxyURLSource(hash)
+		require.NoError(t, err)
+		assert.Equal(t, "local:///mnt/assets/9d/"+hash, url)
+	})
 }
 
 func TestFilestore_Fetch(t *testing.T) {
@@ -193,6 +517,7 @@ func TestFilestore_Iterate(t *testing.T) {
 	assert.Equal(t, 4, calls)
 
 	assert.Len(t, files, 16)
+	assert.True(t, sort.StringsAreSorted(files), "hashes should be sorted")
 
 	// Check that iterate stops when callback returns error
 	myErr := errors.New("my error")
@@ -202,6 +527,41 @@ func TestFilestore_Iterate(t *testing.T) {
 	require.ErrorIs(t, err, myErr)
 }
 
+func TestFilestore_IterateParallel(t *testing.T) {
+	testDir := t.TempDir()
+	ctx := context.Background()
+
+	store, err := local.NewFilestore(path.Join(testDir, "tmp"), path.Join(testDir, "assets"))
+	require.NoError(t, err)
+
+	var expected []string
+	for i := 0; i < 50; i++ {
+		hash, err := store.Store(ctx, strings.NewReader(fmt.Sprintf("Test content %d", i)))
+		require.NoError(t, err)
+		expected = append(expected, hash)
+	}
+
+	var (
+		mx    sync.Mutex
+		files []string
+	)
+	err = store.IterateParallel(ctx, 4, func(hashes []string) error {
+		mx.Lock()
+		defer mx.Unlock()
+		files = append(files, hashes...)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, expected, files)
+
+	// Check that iterate stops when callback returns error
+	myErr := errors.New("my error")
+	err = store.IterateParallel(ctx, 4, func(hashes []string) error {
+		return myErr
+	})
+	require.ErrorIs(t, err, myErr)
+}
+
 func TestFilestore_Remove(t *testing.T) {
 	testDir := t.TempDir()
 	ctx := context.Background()
@@ -226,3 +586,833 @@ func TestFilestore_Remove(t *testing.T) {
 	require.NoError(t, err)
 	assert.Empty(t, files, "assets dir should be empty")
 }
+
+func TestFilestore_Remove_Concurrent(t *testing.T) {
+	testDir := t.TempDir()
+	ctx := context.Background()
+
+	store, err := local.NewFilestore(path.Join(testDir, "tmp"), path.Join(testDir, "assets"))
+	require.NoError(t, err)
+	// Use few prefix directories, so they are removed and created again concurrently
+	store.PrefixSize = 1
+
+	var wg sync.WaitGroup
+	for w := 0; w < 8; w++ {
+		wg.Add(1)
+		go func(w int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				content := fmt.Sprintf("Content %d-%d", w, i)
+				hash, err := store.Store(ctx, strings.NewReader(content))
+				if !assert.NoError(t, err) {
+					return
+				}
+				err = store.StoreHashed(ctx, strings.NewReader(content+"!"), hashing.HashBytes([]byte(content+"!")))
+				if !assert.NoError(t, err) {
+					return
+				}
+				if !assert.NoError(t, store.Remove(ctx, hash)) {
+					return
+				}
+				if !assert.NoError(t, store.Remove(ctx, hashing.HashBytes([]byte(content+"!")))) {
+					return
+				}
+			}
+		}(w)
+	}
+	wg.Wait()
+
+	files, err := os.ReadDir(path.Join(testDir, "assets"))
+	require.NoError(t, err)
+	assert.Empty(t, files, "assets dir should be empty")
+}
+
+func TestFilestore_KeepEmptyDirs(t *testing.T) {
+	testDir := t.TempDir()
+	ctx := context.Background()
+
+	store, err := local.NewFilestore(path.Join(testDir, "tmp"), path.Join(testDir, "assets"), local.WithKeepEmptyDirs())
+	require.NoError(t, err)
+
+	hash, err := store.Store(ctx, strings.NewReader("Test content"))
+	require.NoError(t, err)
+	require.NoError(t, store.Remove(ctx, hash))
+
+	assert.DirExists(t, path.Join(testDir, "assets", hash[0:2]))
+}
+
+func TestFilestore_PrefixDepth(t *testing.T) {
+	testDir := t.TempDir()
+	ctx := context.Background()
+
+	store, err := local.NewFilestore(path.Join(testDir, "tmp"), path.Join(testDir, "assets"))
+	require.NoError(t, err)
+
+	// Store a file with the default layout
+	hash, err := store.Store(ctx, strings.NewReader("Test content"))
+	require.NoError(t, err)
+	assert.FileExists(t, path.Join(testDir, "assets", "9d", hash))
+
+	// Change the layout, the file can still be fetched
+	store.PrefixDepth = 2
+
+	exists, err := store.Exists(ctx, hash)
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	out, err := store.Fetch(ctx, hash)
+	require.NoError(t, err)
+	_ = out.Close()
+
+	// New files are stored with the new layout
+	otherHash, err := store.Store(ctx, strings.NewReader("Other content"))
+	require.NoError(t, err)
+	assert.FileExists(t, path.Join(testDir, "assets", otherHash[0:2], otherHash[2:4], otherHash))
+
+	// Reshard moves existing files to the new layout
+	err = store.Reshard(ctx)
+	require.NoError(t, err)
+	assert.FileExists(t, path.Join(testDir, "assets", "9d", "95", hash))
+	assert.NoFileExists(t, path.Join(testDir, "assets", "9d", hash))
+
+	// Remove cleans up all empty prefix directories
+	err = store.Remove(ctx, hash)
+	require.NoError(t, err)
+	err = store.Remove(ctx, otherHash)
+	require.NoError(t, err)
+
+	files, err := os.ReadDir(path.Join(testDir, "assets"))
+	require.NoError(t, err)
+	assert.Empty(t, files, "assets dir should be empty")
+}
+
+func TestFilestore_FlatLayout(t *testing.T) {
+	testDir := t.TempDir()
+	ctx := context.Background()
+
+	// Store a file with the default layout
+	store, err := local.NewFilestore(path.Join(testDir, "tmp"), path.Join(testDir, "assets"))
+	require.NoError(t, err)
+	hash, err := store.Store(ctx, strings.NewReader("Test content"))
+	require.NoError(t, err)
+
+	store, err = local.NewFilestore(path.Join(testDir, "tmp"), path.Join(testDir, "assets"), local.WithFlatLayout())
+	require.NoError(t, err)
+	assert.Equal(t, 0, store.PrefixSize)
+
+	// New files are stored directly in the assets path
+	otherHash, err := store.Store(ctx, filestore.NewReader(strings.NewReader("Other content"), filestore.WithContentType("text/plain")))
+	require.NoError(t, err)
+	assert.FileExists(t, path.Join(testDir, "assets", otherHash))
+
+	source, err := store.ImgproxyURLSource(otherHash)
+	require.NoError(t, err)
+	assert.Equal(t, "local:///"+otherHash, source)
+
+	// Files in both layouts can be fetched and iterated
+	for _, h := range []string{hash, otherHash} {
+		out, err := store.Fetch(ctx, h)
+		require.NoError(t, err)
+		_ = out.Close()
+	}
+
+	var (
+		mx    sync.Mutex
+		files []string
+	)
+	err = store.IterateParallel(ctx, 2, func(hashes []string) error {
+		mx.Lock()
+		defer mx.Unlock()
+		files = append(files, hashes...)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{hash, otherHash}, files)
+
+	// Reshard moves existing files to the assets path
+	err = store.Reshard(ctx)
+	require.NoError(t, err)
+	assert.FileExists(t, path.Join(testDir, "assets", hash))
+	assert.NoDirExists(t, path.Join(testDir, "assets", hash[0:2]))
+
+	info, err := store.Stat(ctx, otherHash)
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain", info.ContentType)
+
+	// Remove does not remove the assets path
+	require.NoError(t, store.Remove(ctx, hash))
+	require.NoError(t, store.Remove(ctx, otherHash))
+	assert.DirExists(t, path.Join(testDir, "assets"))
+}
+
+func TestFilestore_ServeHash(t *testing.T) {
+	testDir := t.TempDir()
+	ctx := context.Background()
+
+	store, err := local.NewFilestore(path.Join(testDir, "tmp"), path.Join(testDir, "assets"))
+	require.NoError(t, err)
+
+	hash, err := store.Store(ctx, strings.NewReader("Test content"))
+	require.NoError(t, err)
+
+	handler := store.Handler()
+
+	t.Run("full content", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/assets/"+hash, nil))
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "Test content", rec.Body.String())
+		assert.Equal(t, `"`+hash+`"`, rec.Header().Get("ETag"))
+		assert.Equal(t, "text/plain; charset=utf-8", rec.Header().Get("Content-Type"))
+	})
+
+	t.Run("range request", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/assets/"+hash, nil)
+		req.Header.Set("Range", "bytes=5-11")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusPartialContent, rec.Code)
+		assert.Equal(t, "content", rec.Body.String())
+	})
+
+	t.Run("conditional request", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodGet, "/assets/"+hash, nil)
+		req.Header.Set("If-None-Match", `"`+hash+`"`)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusNotModified, rec.Code)
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, httptest.NewRequest(http.MethodGet, "/assets/a0b1c2d3e4f5", nil))
+
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+func TestFilestore_ServeOffloaded(t *testing.T) {
+	testDir := t.TempDir()
+	ctx := context.Background()
+
+	store, err := local.NewFilestore(path.Join(testDir, "tmp"), path.Join(testDir, "assets"))
+	require.NoError(t, err)
+
+	hash, err := store.Store(ctx, &metadataReader{
+		Reader:      strings.NewReader("Test content"),
+		contentType: "text/plain",
+	})
+	require.NoError(t, err)
+
+	t.Run("X-Accel-Redirect", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		store.ServeAccelRedirect(rec, httptest.NewRequest(http.MethodGet, "/assets/"+hash, nil), hash, "/protected-assets/")
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Empty(t, rec.Body.String())
+		assert.Equal(t, "/protected-assets/"+hash[:2]+"/"+hash, rec.Header().Get("X-Accel-Redirect"))
+		assert.Equal(t, "text/plain", rec.Header().Get("Content-Type"))
+	})
+
+	t.Run("X-Sendfile", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		store.ServeSendfile(rec, httptest.NewRequest(http.MethodGet, "/assets/"+hash, nil), hash)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, path.Join(testDir, "assets", hash[:2], hash), rec.Header().Get("X-Sendfile"))
+	})
+
+	t.Run("not found", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		store.ServeSendfile(rec, httptest.NewRequest(http.MethodGet, "/assets/a0b1c2d3e4f5", nil), "a0b1c2d3e4f5")
+
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+	})
+}
+
+func TestFilestore_Stat(t *testing.T) {
+	testDir := t.TempDir()
+	ctx := context.Background()
+
+	store, err := local.NewFilestore(path.Join(testDir, "tmp"), path.Join(testDir, "assets"))
+	require.NoError(t, err)
+
+	t.Run("without metadata", func(t *testing.T) {
+		hash, err := store.Store(ctx, strings.NewReader("Test content"))
+		require.NoError(t, err)
+
+		info, err := store.Stat(ctx, hash)
+		require.NoError(t, err)
+		assert.Equal(t, filestore.ObjectInfo{Hash: hash, Size: 12}, info)
+	})
+
+	t.Run("with metadata", func(t *testing.T) {
+		r := &metadataReader{
+			Reader:             strings.NewReader("Other content"),
+			contentType:        "text/plain",
+			contentDisposition: `attachment; filename="other.txt"`,
+		}
+		hash, err := store.Store(ctx, r)
+		require.NoError(t, err)
+
+		info, err := store.Stat(ctx, hash)
+		require.NoError(t, err)
+		assert.Equal(t, filestore.ObjectInfo{
+			Hash:               hash,
+			Size:               13,
+			ContentType:        "text/plain",
+			ContentDisposition: `attachment; filename="other.txt"`,
+		}, info)
+
+		// Metadata is not returned as a hash
+		var hashes []string
+		err = store.Iterate(ctx, 10, func(hshs []string) error {
+			hashes = append(hashes, hshs...)
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Len(t, hashes, 2)
+
+		// Metadata is served
+		rec := httptest.NewRecorder()
+		store.ServeHash(rec, httptest.NewRequest(http.MethodGet, "/"+hash, nil), hash)
+		assert.Equal(t, "text/plain", rec.Header().Get("Content-Type"))
+		assert.Equal(t, `attachment; filename="other.txt"`, rec.Header().Get("Content-Disposition"))
+
+		// Metadata is removed
+		err = store.Remove(ctx, hash)
+		require.NoError(t, err)
+		assert.NoDirExists(t, path.Join(testDir, "assets", hash[0:2]))
+	})
+
+	_, err = store.Stat(ctx, "a0b1c2d3e4f5")
+	require.ErrorIs(t, err, filestore.ErrNotExist)
+}
+
+type metadataReader struct {
+	io.Reader
+	contentType        string
+	contentDisposition string
+}
+
+func (r *metadataReader) ContentType() string {
+	return r.contentType
+}
+
+func (r *metadataReader) ContentDisposition() string {
+	return r.contentDisposition
+}
+
+func TestFilestore_Usage(t *testing.T) {
+	testDir := t.TempDir()
+	ctx := context.Background()
+
+	store, err := local.NewFilestore(path.Join(testDir, "tmp"), path.Join(testDir, "assets"))
+	require.NoError(t, err)
+
+	_, err = store.Store(ctx, strings.NewReader("Test content"))
+	require.NoError(t, err)
+	_, err = store.Store(ctx, strings.NewReader("Other content"))
+	require.NoError(t, err)
+
+	usage, err := store.Usage(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, filestore.Usage{Objects: 2, Bytes: 25}, usage)
+}
+
+func TestFilestore_Count(t *testing.T) {
+	testDir := t.TempDir()
+	ctx := context.Background()
+
+	store, err := local.NewFilestore(path.Join(testDir, "tmp"), path.Join(testDir, "assets"))
+	require.NoError(t, err)
+
+	count, err := store.Count(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(0), count)
+
+	for i := 0; i < 20; i++ {
+		// Metadata files of the content type are not counted
+		_, err := store.Store(ctx, filestore.NewReader(strings.NewReader(fmt.Sprintf("Test content %d", i)), filestore.WithContentType("text/plain")))
+		require.NoError(t, err)
+	}
+
+	count, err = store.Count(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(20), count)
+
+	cancelledCtx, cancel := context.WithCancel(ctx)
+	cancel()
+	_, err = store.Count(cancelledCtx)
+	assert.ErrorIs(t, err, context.Canceled)
+}
+
+func TestFilestore_ExistsFast(t *testing.T) {
+	testDir := t.TempDir()
+	ctx := context.Background()
+
+	store, err := local.NewFilestore(path.Join(testDir, "tmp"), path.Join(testDir, "assets"))
+	require.NoError(t, err)
+
+	hash, err := store.Store(ctx, strings.NewReader("Test content"))
+	require.NoError(t, err)
+
+	exists, err := store.ExistsFast(ctx, hash)
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	exists, err = store.ExistsFast(ctx, "a09595c5d94fb65b824f56e9999527dba9542481580d69feb89056aabaa0aa87")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	_, err = store.ExistsFast(ctx, "a")
+	assert.Error(t, err)
+}
+
+func TestFilestore_WithBloomFilter(t *testing.T) {
+	testDir := t.TempDir()
+	ctx := context.Background()
+	tmpPath, assetsPath := path.Join(testDir, "tmp"), path.Join(testDir, "assets")
+
+	store, err := local.NewFilestore(tmpPath, assetsPath)
+	require.NoError(t, err)
+	var hashes []string
+	for i := 0; i < 50; i++ {
+		hash, err := store.Store(ctx, strings.NewReader(fmt.Sprintf("Test content %d", i)))
+		require.NoError(t, err)
+		hashes = append(hashes, hash)
+	}
+
+	// Existing files are added to the bloom filter when opening the store
+	store, err = local.NewFilestore(tmpPath, assetsPath, local.WithBloomFilter(100, 0))
+	require.NoError(t, err)
+
+	for _, hash := range hashes {
+		exists, err := store.Exists(ctx, hash)
+		require.NoError(t, err)
+		assert.True(t, exists)
+	}
+
+	missingHash := "a09595c5d94fb65b824f56e9999527dba9542481580d69feb89056aabaa0aa87"
+	exists, err := store.Exists(ctx, missingHash)
+	require.NoError(t, err)
+	assert.False(t, exists)
+	_, err = store.Fetch(ctx, missingHash)
+	assert.ErrorIs(t, err, filestore.ErrNotExist)
+
+	// Stored files are added to the bloom filter
+	hash, err := store.Store(ctx, strings.NewReader("New content"))
+	require.NoError(t, err)
+	exists, err = store.ExistsFast(ctx, hash)
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	err = store.StoreHashed(ctx, strings.NewReader("Test content"), missingHash)
+	require.NoError(t, err)
+	out, err := store.Fetch(ctx, missingHash)
+	require.NoError(t, err)
+	defer out.Close()
+	content, err := io.ReadAll(out)
+	require.NoError(t, err)
+	assert.Equal(t, "Test content", string(content))
+}
+
+func TestFilestore_StoreWithMinFreeSpace(t *testing.T) {
+	testDir := t.TempDir()
+	ctx := context.Background()
+
+	store, err := local.NewFilestore(path.Join(testDir, "tmp"), path.Join(testDir, "assets"), local.WithMinFreeSpace(math.MaxUint64))
+	require.NoError(t, err)
+
+	_, err = store.Store(ctx, strings.NewReader("Test content"))
+	require.ErrorIs(t, err, filestore.ErrNoSpace)
+
+	err = store.StoreHashed(ctx, strings.NewReader("Test content"), "a0b1c2d3e4f5")
+	require.ErrorIs(t, err, filestore.ErrNoSpace)
+}
+
+func TestFilestore_StoreWithMaxObjectSize(t *testing.T) {
+	testDir := t.TempDir()
+	ctx := context.Background()
+
+	store, err := local.NewFilestore(path.Join(testDir, "tmp"), path.Join(testDir, "assets"), local.WithMaxObjectSize(12))
+	require.NoError(t, err)
+
+	_, err = store.Store(ctx, strings.NewReader("Test content"))
+	require.NoError(t, err)
+
+	_, err = store.Store(ctx, strings.NewReader("Other test content"))
+	require.ErrorIs(t, err, filestore.ErrTooLarge)
+
+	err = store.StoreHashed(ctx, strings.NewReader("Other test content"), "a0b1c2d3e4f5")
+	require.ErrorIs(t, err, filestore.ErrTooLarge)
+
+	tmpFiles, err := os.ReadDir(path.Join(testDir, "tmp"))
+	require.NoError(t, err)
+	assert.Empty(t, tmpFiles, "temp files should be removed")
+
+	usage, err := store.Usage(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), usage.Objects)
+}
+
+func TestFilestore_ContextCancellation(t *testing.T) {
+	testDir := t.TempDir()
+
+	store, err := local.NewFilestore(path.Join(testDir, "tmp"), path.Join(testDir, "assets"))
+	require.NoError(t, err)
+
+	t.Run("store", func(t *testing.T) {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+
+		// An endless reader that cancels the context after some reads
+		reads := 0
+		r := readerFunc(func(p []byte) (int, error) {
+			reads++
+			if reads == 10 {
+				cancel()
+			}
+			return len(p), nil
+		})
+
+		_, err := store.Store(ctx, r)
+		require.ErrorIs(t, err, context.Canceled)
+
+		err = store.StoreHashed(ctx, r, "a0b1c2d3e4f5")
+		require.ErrorIs(t, err, context.Canceled)
+
+		tmpFiles, err := os.ReadDir(path.Join(testDir, "tmp"))
+		require.NoError(t, err)
+		assert.Empty(t, tmpFiles, "temp files should be removed")
+	})
+
+	t.Run("fetch", func(t *testing.T) {
+		hash, err := store.Store(context.Background(), strings.NewReader("Test content"))
+		require.NoError(t, err)
+
+		ctx, cancel := context.WithCancel(context.Background())
+		r, err := store.Fetch(ctx, hash)
+		require.NoError(t, err)
+		defer r.Close()
+
+		cancel()
+		_, err = io.ReadAll(r)
+		require.ErrorIs(t, err, context.Canceled)
+	})
+}
+
+type readerFunc func(p []byte) (int, error)
+
+func (f readerFunc) Read(p []byte) (int, error) {
+	return f(p)
+}
+
+func TestFilestore_NotExist(t *testing.T) {
+	testDir := t.TempDir()
+
+	store, err := local.NewFilestore(path.Join(testDir, "tmp"), path.Join(testDir, "assets"))
+	require.NoError(t, err)
+
+	filestoretest.TestNotExist(t, store)
+}
+
+func TestFilestore_ExistsMany(t *testing.T) {
+	testDir := t.TempDir()
+
+	store, err := local.NewFilestore(path.Join(testDir, "tmp"), path.Join(testDir, "assets"))
+	require.NoError(t, err)
+
+	filestoretest.TestExistsMany(t, store)
+}
+
+func TestFilestore_FetchInfo(t *testing.T) {
+	testDir := t.TempDir()
+
+	store, err := local.NewFilestore(path.Join(testDir, "tmp"), path.Join(testDir, "assets"))
+	require.NoError(t, err)
+
+	filestoretest.TestFetchInfo(t, store)
+}
+
+func TestFilestore_FetchRange(t *testing.T) {
+	testDir := t.TempDir()
+
+	store, err := local.NewFilestore(path.Join(testDir, "tmp"), path.Join(testDir, "assets"))
+	require.NoError(t, err)
+
+	filestoretest.TestFetchRange(t, store)
+}
+
+func TestFilestore_ResumableUpload(t *testing.T) {
+	testDir := t.TempDir()
+
+	store, err := local.NewFilestore(path.Join(testDir, "tmp"), path.Join(testDir, "assets"))
+	require.NoError(t, err)
+
+	filestoretest.TestResumableUpload(t, store)
+
+	t.Run("without tmp path", func(t *testing.T) {
+		store, err := local.NewFilestore("", path.Join(testDir, "assets-only"))
+		require.NoError(t, err)
+
+		filestoretest.TestResumableUpload(t, store)
+	})
+
+	t.Run("max object size", func(t *testing.T) {
+		ctx := context.Background()
+		store, err := local.NewFilestore(path.Join(testDir, "tmp"), path.Join(testDir, "assets"), local.WithMaxObjectSize(10))
+		require.NoError(t, err)
+
+		id, err := store.CreateUpload(ctx)
+		require.NoError(t, err)
+		offset, err := store.AppendUpload(ctx, id, 0, strings.NewReader("12345678"))
+		require.NoError(t, err)
+
+		_, err = store.AppendUpload(ctx, id, offset, strings.NewReader("too large"))
+		assert.ErrorIs(t, err, filestore.ErrTooLarge)
+
+		// The rejected chunk is discarded
+		offset, err = store.UploadOffset(ctx, id)
+		require.NoError(t, err)
+		assert.Equal(t, int64(8), offset)
+	})
+}
+
+func TestFilestore_IterateSnapshot(t *testing.T) {
+	ctx := context.Background()
+	testDir := t.TempDir()
+
+	store, err := local.NewFilestore(path.Join(testDir, "tmp"), path.Join(testDir, "assets"), local.WithIterateSnapshot())
+	require.NoError(t, err)
+
+	var initial []string
+	for i := 0; i < 50; i++ {
+		hash, err := store.Store(ctx, strings.NewReader(fmt.Sprintf("Content %d", i)))
+		require.NoError(t, err)
+		initial = append(initial, hash)
+	}
+	sort.Strings(initial)
+
+	// Files stored and removed during the iteration do not change the visited hashes
+	var (
+		visited []string
+		i       int
+	)
+	err = store.Iterate(ctx, 7, func(hashes []string) error {
+		visited = append(visited, hashes...)
+		for _, hash := range hashes {
+			if err := store.Remove(ctx, hash); err != nil {
+				return err
+			}
+			if _, err := store.Store(ctx, strings.NewReader(fmt.Sprintf("New content %d", i))); err != nil {
+				return err
+			}
+			i++
+		}
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, initial, visited)
+
+	t.Run("parallel", func(t *testing.T) {
+		var (
+			mx      sync.Mutex
+			visited []string
+		)
+		err := store.IterateParallel(ctx, 4, func(hashes []string) error {
+			mx.Lock()
+			defer mx.Unlock()
+			visited = append(visited, hashes...)
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Len(t, visited, 50)
+	})
+}
+
+func TestFilestore_PublicURL(t *testing.T) {
+	ctx := context.Background()
+	testDir := t.TempDir()
+
+	store, err := local.NewFilestore(path.Join(testDir, "tmp"), path.Join(testDir, "assets"))
+	require.NoError(t, err)
+	hash, err := store.Store(ctx, strings.NewReader("Hello World"))
+	require.NoError(t, err)
+
+	publicURL, err := store.PublicURL(hash)
+	require.NoError(t, err)
+	u, err := url.Parse(publicURL)
+	require.NoError(t, err)
+	assert.Equal(t, "file", u.Scheme)
+	content, err := os.ReadFile(filepath.FromSlash(u.Path))
+	require.NoError(t, err)
+	assert.Equal(t, "Hello World", string(content))
+
+	_, err = store.PublicURL("../invalid")
+	assert.Error(t, err)
+
+	store, err = local.NewFilestore(path.Join(testDir, "tmp"), path.Join(testDir, "assets"), local.WithPublicURL("https://example.com/assets/{hash}?v=1"))
+	require.NoError(t, err)
+	publicURL, err = store.PublicURL(hash)
+	require.NoError(t, err)
+	assert.Equal(t, "https://example.com/assets/"+hash+"?v=1", publicURL)
+}
+
+func TestFilestore_ReadOnly(t *testing.T) {
+	testDir := t.TempDir()
+	ctx := context.Background()
+
+	// Assets path must exist
+	_, err := local.NewFilestore("", path.Join(testDir, "assets"), local.WithReadOnly())
+	require.Error(t, err)
+
+	store, err := local.NewFilestore(path.Join(testDir, "tmp"), path.Join(testDir, "assets"))
+	require.NoError(t, err)
+	hash, err := store.Store(ctx, strings.NewReader("Test content"))
+	require.NoError(t, err)
+
+	readOnlyStore, err := local.NewFilestore(path.Join(testDir, "other-tmp"), path.Join(testDir, "assets"), local.WithReadOnly())
+	require.NoError(t, err)
+	assert.NoDirExists(t, path.Join(testDir, "other-tmp"), "tmp dir should not be created")
+
+	out, err := readOnlyStore.Fetch(ctx, hash)
+	require.NoError(t, err)
+	_ = out.Close()
+
+	_, err = readOnlyStore.Store(ctx, strings.NewReader("Other content"))
+	require.ErrorIs(t, err, filestore.ErrReadOnly)
+
+	err = readOnlyStore.StoreHashed(ctx, strings.NewReader("Other content"), "a0b1c2d3e4f5")
+	require.ErrorIs(t, err, filestore.ErrReadOnly)
+
+	err = readOnlyStore.Remove(ctx, hash)
+	require.ErrorIs(t, err, filestore.ErrReadOnly)
+}
+
+func TestFilestore_IterateSortedWithPrefixDepth(t *testing.T) {
+	testDir := t.TempDir()
+	ctx := context.Background()
+
+	store, err := local.NewFilestore(path.Join(testDir, "tmp"), path.Join(testDir, "assets"))
+	require.NoError(t, err)
+	store.PrefixDepth = 2
+
+	for i := 0; i < 50; i++ {
+		_, err = store.Store(ctx, strings.NewReader(fmt.Sprintf("Test content %d", i)))
+		require.NoError(t, err)
+	}
+
+	var files []string
+	err = store.Iterate(ctx, 7, func(hashes []string) error {
+		files = append(files, hashes...)
+		return nil
+	})
+	require.NoError(t, err)
+
+	assert.Len(t, files, 50)
+	assert.True(t, sort.StringsAreSorted(files), "hashes should be sorted")
+}
+
+func TestFilestore_Verify(t *testing.T) {
+	testDir := t.TempDir()
+	ctx := context.Background()
+
+	store, err := local.NewFilestore(path.Join(testDir, "tmp"), path.Join(testDir, "assets"))
+	require.NoError(t, err)
+
+	validHash, err := store.Store(ctx, strings.NewReader("Test content"))
+	require.NoError(t, err)
+	emptyHash, err := store.Store(ctx, strings.NewReader(""))
+	require.NoError(t, err)
+
+	// Content does not match hash
+	err = store.StoreHashed(ctx, strings.NewReader("Other content"), "a0b1c2d3e4f5")
+	require.NoError(t, err)
+	// Zero-byte file
+	err = store.StoreHashed(ctx, strings.NewReader(""), "b0b1c2d3e4f5")
+	require.NoError(t, err)
+	// Stray files
+	err = os.WriteFile(path.Join(testDir, "assets", "README.txt"), []byte("Hello"), 0644)
+	require.NoError(t, err)
+	err = os.WriteFile(path.Join(testDir, "assets", "9d", "c0b1c2d3e4f5"), []byte("Hello"), 0644)
+	require.NoError(t, err)
+
+	report, err := store.Verify(ctx, local.VerifyOptions{})
+	require.NoError(t, err)
+	assert.False(t, report.Valid())
+	assert.Equal(t, 6, report.Checked)
+	assert.Equal(t, []string{"a0/a0b1c2d3e4f5"}, report.Mismatched)
+	assert.Equal(t, []string{"b0/b0b1c2d3e4f5"}, report.Empty)
+	assert.Equal(t, []string{"9d/c0b1c2d3e4f5", "README.txt"}, report.Stray)
+
+	quarantinePath := path.Join(testDir, "quarantine")
+	report, err = store.Verify(ctx, local.VerifyOptions{QuarantinePath: quarantinePath, SkipContentHash: true})
+	require.NoError(t, err)
+	assert.Empty(t, report.Mismatched)
+	assert.Equal(t, []string{"9d/c0b1c2d3e4f5", "README.txt", "b0/b0b1c2d3e4f5"}, report.Quarantined)
+	assert.FileExists(t, path.Join(quarantinePath, "b0", "b0b1c2d3e4f5"))
+
+	report, err = store.Verify(ctx, local.VerifyOptions{SkipContentHash: true})
+	require.NoError(t, err)
+	assert.True(t, report.Valid())
+	assert.Equal(t, 3, report.Checked)
+
+	for _, hash := range []string{validHash, emptyHash, "a0b1c2d3e4f5"} {
+		exists, err := store.Exists(ctx, hash)
+		require.NoError(t, err)
+		assert.True(t, exists)
+	}
+}
+
+func TestFilestore_Watch(t *testing.T) {
+	testDir := t.TempDir()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	store, err := local.NewFilestore(path.Join(testDir, "tmp"), path.Join(testDir, "assets"))
+	require.NoError(t, err)
+
+	existingHash, err := store.Store(ctx, strings.NewReader("Existing content"))
+	require.NoError(t, err)
+
+	events := make(chan filestore.Event, 10)
+	watchErr := make(chan error, 1)
+	go func() {
+		watchErr <- store.Watch(ctx, 10*time.Millisecond, func(event filestore.Event) error {
+			events <- event
+			return nil
+		})
+	}()
+
+	// Give the watcher time for the initial scan
+	time.Sleep(50 * time.Millisecond)
+
+	// Simulate external tools changing the assets directory
+	err = os.MkdirAll(path.Join(testDir, "assets", "ab"), 0755)
+	require.NoError(t, err)
+	err = os.WriteFile(path.Join(testDir, "assets", "ab", "abcdef"), []byte("Restored"), 0644)
+	require.NoError(t, err)
+	err = os.Remove(path.Join(testDir, "assets", existingHash[:2], existingHash))
+	require.NoError(t, err)
+
+	var received []filestore.Event
+	for len(received) < 2 {
+		select {
+		case event := <-events:
+			received = append(received, event)
+		case <-time.After(5 * time.Second):
+			t.Fatalf("timeout waiting for events, received %v", received)
+		}
+	}
+	assert.ElementsMatch(t, []filestore.Event{
+		{Type: filestore.EventStored, Hash: "abcdef"},
+		{Type: filestore.EventRemoved, Hash: existingHash},
+	}, received)
+
+	cancel()
+	assert.ErrorIs(t, <-watchErr, context.Canceled)
+}
@@ -0,0 +1,66 @@
+//go:build unix
+
+package local_test
+
+import (
+	"context"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/local"
+)
+
+func TestFilestore_Modes(t *testing.T) {
+	ctx := context.Background()
+	testDir := t.TempDir()
+
+	// Only root can set another group that the process is not a member of
+	gid := os.Getgid()
+	if os.Getuid() == 0 {
+		gid = 12345
+	}
+
+	// Modes must not be restricted by the umask
+	oldUmask := syscall.Umask(0o027)
+	defer syscall.Umask(oldUmask)
+
+	assetsPath := path.Join(testDir, "data", "assets")
+	store, err := local.NewFilestore(path.Join(testDir, "tmp"), assetsPath,
+		local.WithDirMode(0o775),
+		local.WithFileMode(0o664),
+		local.WithOwner(-1, gid),
+		local.WithFileLocking(),
+	)
+	require.NoError(t, err)
+
+	hash, err := store.Store(ctx, filestore.NewReader(strings.NewReader("Hello world"), filestore.WithContentType("text/plain")))
+	require.NoError(t, err)
+
+	localPath, err := store.LocalPath(ctx, hash)
+	require.NoError(t, err)
+
+	assertMode := func(p string, mode os.FileMode) {
+		t.Helper()
+		info, err := os.Stat(p)
+		require.NoError(t, err)
+		assert.Equal(t, mode, info.Mode().Perm(), p)
+		assert.Equal(t, uint32(gid), info.Sys().(*syscall.Stat_t).Gid, p)
+	}
+	assertMode(filepath.Join(testDir, "data"), 0o775)
+	assertMode(assetsPath, 0o775)
+	assertMode(filepath.Dir(localPath), 0o775)
+	assertMode(localPath, 0o664)
+	assertMode(filepath.Join(assetsPath, "."+hash[:2]+".lock"), 0o664)
+
+	info, err := os.Stat(testDir)
+	require.NoError(t, err)
+	assert.NotEqual(t, os.FileMode(0o775), info.Mode().Perm(), "existing directories are not changed")
+}
@@ -0,0 +1,153 @@
+package local
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"net/url"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/networkteam/filestore"
+)
+
+// ServeHash serves the file with the given hash using http.ServeContent.
+// This supports range and conditional requests and uses sendfile if possible.
+// The ETag is set to the hash, so conditional requests with If-None-Match are answered with 304 Not Modified.
+// The content type and disposition are taken from the stored metadata, the content type is detected from the content
+// if it is unknown. Headers already set in the response are not overwritten.
+func (f *Filestore) ServeHash(w http.ResponseWriter, r *http.Request, hash string) {
+	file, err := f.openFile(hash)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) || errors.Is(err, errInvalidHash) {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	meta, err := readMetadata(file.Name())
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if meta.ContentType != "" && w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", meta.ContentType)
+	}
+	if meta.ContentDisposition != "" && w.Header().Get("Content-Disposition") == "" {
+		w.Header().Set("Content-Disposition", meta.ContentDisposition)
+	}
+
+	w.Header().Set("ETag", `"`+hash+`"`)
+	http.ServeContent(w, r, "", info.ModTime(), file)
+}
+
+// Handler returns an http.Handler that serves files with ServeHash.
+// The hash is taken from the last element of the request path (e.g. "/assets/<hash>").
+func (f *Filestore) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		hash := path.Base(r.URL.Path)
+		if !f.validKey(hash) {
+			http.NotFound(w, r)
+			return
+		}
+		f.ServeHash(w, r, hash)
+	})
+}
+
+// PublicURL implements filestore.PublicURLer. It returns the URL of the hash for the template set with WithPublicURL
+// (the route of Handler), or a file URL of the absolute file path otherwise (e.g. for local development).
+func (f *Filestore) PublicURL(hash string) (string, error) {
+	if !f.validKey(hash) {
+		return "", fmt.Errorf("public URL of %q: %w", hash, errInvalidHash)
+	}
+	if f.publicURL != "" {
+		return filestore.ExpandPublicURL(f.publicURL, hash), nil
+	}
+
+	filePath, err := f.existingFilePath(hash)
+	if err != nil {
+		return "", err
+	}
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return "", fmt.Errorf("getting absolute path: %w", err)
+	}
+	urlPath := filepath.ToSlash(absPath)
+	if !strings.HasPrefix(urlPath, "/") {
+		// Windows paths like C:/assets
+		urlPath = "/" + urlPath
+	}
+	return (&url.URL{Scheme: "file", Path: urlPath}).String(), nil
+}
+
+// ServeAccelRedirect lets a reverse proxy (nginx) serve the file with the given hash by responding with
+// an X-Accel-Redirect header to the internal location internalPrefix followed by the path of the file relative
+// to the assets path (e.g. "/protected-assets/ab/abcdef"), so the content is not streamed through Go.
+// The internal location must be an alias of the assets path.
+func (f *Filestore) ServeAccelRedirect(w http.ResponseWriter, r *http.Request, hash, internalPrefix string) {
+	f.serveOffloaded(w, r, hash, func(filePath string) (string, string, error) {
+		relPath, err := filepath.Rel(f.assetsPath, filePath)
+		if err != nil {
+			return "", "", err
+		}
+		return "X-Accel-Redirect", strings.TrimRight(internalPrefix, "/") + "/" + filepath.ToSlash(relPath), nil
+	})
+}
+
+// ServeSendfile lets a reverse proxy or web server (e.g. Apache mod_xsendfile, caddy or lighttpd) serve the file
+// with the given hash by responding with an X-Sendfile header with the absolute path of the file.
+func (f *Filestore) ServeSendfile(w http.ResponseWriter, r *http.Request, hash string) {
+	f.serveOffloaded(w, r, hash, func(filePath string) (string, string, error) {
+		absPath, err := filepath.Abs(filePath)
+		if err != nil {
+			return "", "", err
+		}
+		return "X-Sendfile", absPath, nil
+	})
+}
+
+// serveOffloaded responds with a header (from offloadHeader) to let a proxy serve the file.
+// Content type and disposition are set from the stored metadata like in ServeHash.
+func (f *Filestore) serveOffloaded(w http.ResponseWriter, r *http.Request, hash string, offloadHeader func(filePath string) (string, string, error)) {
+	filePath, _, err := f.statFile(hash)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) || errors.Is(err, errInvalidHash) {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	meta, err := readMetadata(filePath)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	name, value, err := offloadHeader(filePath)
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	if meta.ContentType != "" && w.Header().Get("Content-Type") == "" {
+		w.Header().Set("Content-Type", meta.ContentType)
+	}
+	if meta.ContentDisposition != "" && w.Header().Get("Content-Disposition") == "" {
+		w.Header().Set("Content-Disposition", meta.ContentDisposition)
+	}
+	w.Header().Set("ETag", `"`+hash+`"`)
+	w.Header().Set(name, value)
+	w.WriteHeader(http.StatusOK)
+}
@@ -0,0 +1,141 @@
+package local
+
+import (
+	"context"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"os"
+	"sync"
+
+	"github.com/networkteam/filestore/hashing"
+)
+
+// DefaultBloomFilterFalsePositiveRate is the false positive rate of the bloom filter if it is not set.
+const DefaultBloomFilterFalsePositiveRate = 0.01
+
+// bloomFilter is a set of keys that can report false positives, but no false negatives.
+// Removed keys cannot be deleted, so they are reported as false positives.
+type bloomFilter struct {
+	mx     sync.RWMutex
+	bits   []uint64
+	hashes uint64
+}
+
+// newBloomFilter creates a bloom filter sized for the expected number of keys with the false positive rate.
+func newBloomFilter(expectedKeys int, falsePositiveRate float64) *bloomFilter {
+	if expectedKeys < 1 {
+		expectedKeys = 1
+	}
+	if falsePositiveRate <= 0 || falsePositiveRate >= 1 {
+		falsePositiveRate = DefaultBloomFilterFalsePositiveRate
+	}
+
+	// Optimal number of bits and hash functions for the expected number of keys
+	bits := math.Ceil(-float64(expectedKeys) * math.Log(falsePositiveRate) / (math.Ln2 * math.Ln2))
+	hashes := math.Max(1, math.Round(bits/float64(expectedKeys)*math.Ln2))
+
+	return &bloomFilter{
+		bits:   make([]uint64, uint64(bits)/64+1),
+		hashes: uint64(hashes),
+	}
+}
+
+func (b *bloomFilter) add(key string) {
+	h1, h2 := bloomHash(key)
+	n := uint64(len(b.bits)) * 64
+
+	b.mx.Lock()
+	defer b.mx.Unlock()
+
+	for i := uint64(0); i < b.hashes; i++ {
+		bit := (h1 + i*h2) % n
+		b.bits[bit/64] |= 1 << (bit % 64)
+	}
+}
+
+func (b *bloomFilter) mayContain(key string) bool {
+	h1, h2 := bloomHash(key)
+	n := uint64(len(b.bits)) * 64
+
+	b.mx.RLock()
+	defer b.mx.RUnlock()
+
+	for i := uint64(0); i < b.hashes; i++ {
+		bit := (h1 + i*h2) % n
+		if b.bits[bit/64]&(1<<(bit%64)) == 0 {
+			return false
+		}
+	}
+	return true
+}
+
+// bloomHash returns two independent hashes of the key for double hashing.
+func bloomHash(key string) (uint64, uint64) {
+	h := fnv.New128a()
+	_, _ = h.Write([]byte(key))
+	sum := h.Sum(nil)
+
+	var h1, h2 uint64
+	for i := 0; i < 8; i++ {
+		h1 = h1<<8 | uint64(sum[i])
+		h2 = h2<<8 | uint64(sum[8+i])
+	}
+	// An odd second hash visits different bits for every hash function
+	return h1, h2 | 1
+}
+
+// buildIndex creates the bloom filter of the file store and adds the keys of all stored files.
+func (f *Filestore) buildIndex(expectedKeys int, falsePositiveRate float64) error {
+	index := newBloomFilter(expectedKeys, falsePositiveRate)
+	err := walkFiles(context.Background(), f.assetsPath, false, func(name string) error {
+		index.add(name)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("indexing assets: %w", err)
+	}
+	f.index = index
+	return nil
+}
+
+// indexAdd adds a stored key to the index (if enabled).
+func (f *Filestore) indexAdd(key string) {
+	if f.index != nil {
+		f.index.add(key)
+	}
+}
+
+// mayExist returns false if the index (if enabled) rules out that a file with the hash (or its legacy key) exists.
+func (f *Filestore) mayExist(hash string) bool {
+	if f.index == nil || f.index.mayContain(hash) {
+		return true
+	}
+	legacyKey, ok := hashing.LegacyKey(f.keyEncoding, hash)
+	return ok && f.index.mayContain(legacyKey)
+}
+
+// ExistsFast checks if a file with the given hash exists with as few filesystem operations as possible:
+// negative lookups are answered by the bloom filter (see WithBloomFilter) without touching the filesystem,
+// otherwise only the path in the current layout is checked (a single lstat).
+//
+// Unlike Exists, files stored in another layout (before Reshard) or with a legacy key are not found, so a false
+// result is only definite for stores in the current layout. It is meant for deduplication checks, where a false
+// negative only causes the content to be stored again.
+func (f *Filestore) ExistsFast(ctx context.Context, hash string) (bool, error) {
+	path, err := f.filePath(hash)
+	if err != nil {
+		return false, err
+	}
+	if f.index != nil && !f.index.mayContain(hash) {
+		return false, nil
+	}
+
+	_, err = os.Lstat(path)
+	if os.IsNotExist(err) {
+		return false, nil
+	} else if err != nil {
+		return false, fmt.Errorf("stat file: %w", err)
+	}
+	return true, nil
+}
@@ -0,0 +1,123 @@
+package local
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/hashing"
+)
+
+// storeLinked stores the file by linking it into the assets path according to the link mode, the metadata is read from
+// r (the file or a reader wrapping it). If the file cannot be linked, it is rewound and false is returned, so the
+// content can be copied instead.
+func (f *Filestore) storeLinked(ctx context.Context, file *os.File, r io.Reader) (hash string, linked bool, err error) {
+	info, err := file.Stat()
+	if err != nil {
+		return "", false, fmt.Errorf("stat source file: %w", err)
+	}
+	if !info.Mode().IsRegular() {
+		return "", false, nil
+	}
+	if f.maxObjectSize > 0 && info.Size() > f.maxObjectSize {
+		return "", false, filestore.ErrTooLarge
+	}
+	// Only the whole file can be linked
+	offset, err := file.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return "", false, fmt.Errorf("getting source file offset: %w", err)
+	}
+	if offset != 0 {
+		return "", false, nil
+	}
+
+	hashHex, err := hashing.HashReader(newContextReader(ctx, file))
+	if err != nil {
+		return "", false, fmt.Errorf("hashing source file: %w", err)
+	}
+
+	hashHex = f.deriveHash(hashHex)
+	key := f.keyEncoding.Encode(hashHex)
+	targetPath, err := f.filePath(key)
+	if err != nil {
+		return "", false, err
+	}
+	unlock, err := f.lock(hashHex)
+	if err != nil {
+		return "", false, err
+	}
+	defer unlock()
+
+	// Check if the file exists (also with a legacy key)
+	if existingPath, _, statErr := f.statFile(key); statErr == nil {
+		// Update metadata like Store does when storing existing content
+		if err = f.writeMetadata(existingPath, r); err != nil {
+			return "", false, err
+		}
+		return key, true, nil
+	}
+
+	if err = f.mkdirAll(filepath.Dir(targetPath)); err != nil {
+		return "", false, fmt.Errorf("creating asset subdirectory: %w", err)
+	}
+
+	switch f.linkMode {
+	case LinkModeHardLink:
+		err = os.Link(file.Name(), targetPath)
+	case LinkModeReflink:
+		err = f.reflink(file, targetPath)
+	default:
+		err = fmt.Errorf("unknown link mode %d", f.linkMode)
+	}
+	if err != nil {
+		// Fall back to copying the content
+		if _, seekErr := file.Seek(0, io.SeekStart); seekErr != nil {
+			return "", false, fmt.Errorf("rewinding source file after failed link: %w", seekErr)
+		}
+		return "", false, nil
+	}
+	f.indexAdd(key)
+
+	if f.durableWrites {
+		if err = syncDir(filepath.Dir(targetPath)); err != nil {
+			return "", false, err
+		}
+	}
+
+	if err = f.writeMetadata(targetPath, r); err != nil {
+		return "", false, err
+	}
+
+	return key, true, nil
+}
+
+// reflink clones the file to a temporary file that is renamed to the target path.
+func (f *Filestore) reflink(file *os.File, targetPath string) error {
+	tempFile, err := f.createTemp("image-upload-*")
+	if err != nil {
+		return fmt.Errorf("creating temp file: %w", err)
+	}
+
+	err = cloneFile(tempFile, file)
+	if err == nil {
+		err = f.setFileMode(tempFile)
+	}
+	if err == nil && f.durableWrites {
+		err = tempFile.Sync()
+	}
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tempFile.Name(), targetPath)
+	}
+	if err != nil {
+		_ = os.Remove(tempFile.Name())
+		return err
+	}
+
+	return nil
+}
@@ -0,0 +1,64 @@
+package local
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// flatLockPrefixSize is the length of the hash prefix naming the lock files of the flat layout, which has no prefix
+// directories, so writers of different hashes do not all share a single lock file.
+const flatLockPrefixSize = 2
+
+// lock acquires an exclusive lock for the top-level prefix of the hash if file locking is enabled.
+// The returned function releases the lock.
+func (f *Filestore) lock(hash string) (unlock func(), err error) {
+	if !f.fileLocking {
+		return func() {}, nil
+	}
+
+	prefixSize := f.PrefixSize
+	if prefixSize <= 0 {
+		prefixSize = flatLockPrefixSize
+	}
+	prefix, err := layoutPrefixPath(f.shardHash(hash), prefixSize, 1)
+	if err != nil {
+		return nil, err
+	}
+
+	lockPath := filepath.Join(f.assetsPath, "."+prefix+".lock")
+	lockFile, err := f.openLockFile(lockPath)
+	if err != nil {
+		return nil, fmt.Errorf("opening lock file: %w", err)
+	}
+
+	if err = flock(lockFile); err != nil {
+		_ = lockFile.Close()
+		return nil, fmt.Errorf("locking %s: %w", lockPath, err)
+	}
+
+	return func() {
+		_ = funlock(lockFile)
+		_ = lockFile.Close()
+	}, nil
+}
+
+// openLockFile opens a lock file for reading, which is enough for locking it. A created lock file gets the mode and
+// owner of stored files (see WithFileMode and WithOwner), so processes sharing the store can lock it.
+func (f *Filestore) openLockFile(lockPath string) (*os.File, error) {
+	lockFile, err := os.OpenFile(lockPath, os.O_CREATE|os.O_EXCL|os.O_RDONLY, f.TargetFileMode)
+	if errors.Is(err, fs.ErrExist) {
+		return os.Open(lockPath)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if err = f.setFileMode(lockFile); err != nil {
+		_ = lockFile.Close()
+		return nil, err
+	}
+	return lockFile, nil
+}
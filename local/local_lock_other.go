@@ -0,0 +1,16 @@
+//go:build !unix
+
+package local
+
+import (
+	"errors"
+	"os"
+)
+
+func flock(file *os.File) error {
+	return errors.New("file locking is not supported on this platform")
+}
+
+func funlock(file *os.File) error {
+	return nil
+}
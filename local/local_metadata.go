@@ -0,0 +1,149 @@
+package local
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/networkteam/filestore"
+)
+
+// metadata is stored in a sidecar JSON file next to the stored file.
+type metadata struct {
+	ContentType        string `json:"contentType,omitempty"`
+	ContentDisposition string `json:"contentDisposition,omitempty"`
+}
+
+// metadataPath returns the path of the sidecar metadata file for a file path.
+// It starts with a dot, so it is ignored when iterating.
+func metadataPath(filePath string) string {
+	return filepath.Join(filepath.Dir(filePath), "."+filepath.Base(filePath)+".json")
+}
+
+// writeMetadata writes a sidecar metadata file if the reader has a content type or content disposition.
+func (f *Filestore) writeMetadata(filePath string, r any) error {
+	var meta metadata
+	if typedReader, ok := r.(filestore.ContentTyped); ok {
+		meta.ContentType = typedReader.ContentType()
+	}
+	if dispoReader, ok := r.(filestore.ContentDispositioned); ok {
+		meta.ContentDisposition = dispoReader.ContentDisposition()
+	}
+	if meta == (metadata{}) {
+		return nil
+	}
+
+	data, err := json.Marshal(meta)
+	if err != nil {
+		return fmt.Errorf("encoding metadata: %w", err)
+	}
+
+	// Write to a temporary file and rename it, so metadata is never read partially
+	tempFile, err := f.createTemp("metadata-*")
+	if err != nil {
+		return fmt.Errorf("creating temp metadata file: %w", err)
+	}
+	_, err = tempFile.Write(data)
+	if err == nil {
+		err = f.setFileMode(tempFile)
+	}
+	if err == nil && f.durableWrites {
+		err = tempFile.Sync()
+	}
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tempFile.Name(), metadataPath(filePath))
+	}
+	if err != nil {
+		_ = os.Remove(tempFile.Name())
+		return fmt.Errorf("writing metadata: %w", err)
+	}
+
+	return nil
+}
+
+// readMetadata reads the sidecar metadata file for a file path, an empty metadata is returned if it does not exist.
+func readMetadata(filePath string) (metadata, error) {
+	var meta metadata
+
+	data, err := os.ReadFile(metadataPath(filePath))
+	if errors.Is(err, fs.ErrNotExist) {
+		return meta, nil
+	} else if err != nil {
+		return meta, fmt.Errorf("reading metadata: %w", err)
+	}
+
+	if err = json.Unmarshal(data, &meta); err != nil {
+		return meta, fmt.Errorf("decoding metadata: %w", err)
+	}
+	return meta, nil
+}
+
+// removeMetadata removes the sidecar metadata file for a file path if it exists.
+func removeMetadata(filePath string) error {
+	err := os.Remove(metadataPath(filePath))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("removing metadata: %w", err)
+	}
+	return nil
+}
+
+// Stat returns information about the file with the given hash including the content type and content disposition
+// given when storing the file.
+func (f *Filestore) Stat(ctx context.Context, hash string) (filestore.ObjectInfo, error) {
+	filePath, info, err := f.statFile(hash)
+	if errors.Is(err, fs.ErrNotExist) {
+		return filestore.ObjectInfo{}, &filestore.NotExistError{Op: "stat", Hash: hash}
+	} else if err != nil {
+		return filestore.ObjectInfo{}, fmt.Errorf("stat file: %w", err)
+	}
+
+	meta, err := readMetadata(filePath)
+	if err != nil {
+		return filestore.ObjectInfo{}, err
+	}
+
+	return filestore.ObjectInfo{
+		Hash:               hash,
+		Size:               info.Size(),
+		ContentType:        meta.ContentType,
+		ContentDisposition: meta.ContentDisposition,
+	}, nil
+}
+
+// FetchInfo implements filestore.InfoFetcher and returns the content of the file with the given hash together with
+// the information returned by Stat.
+func (f *Filestore) FetchInfo(ctx context.Context, hash string) (io.ReadCloser, filestore.ObjectInfo, error) {
+	file, err := f.openFile(hash)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, filestore.ObjectInfo{}, &filestore.NotExistError{Op: "fetch info", Hash: hash}
+	} else if err != nil {
+		return nil, filestore.ObjectInfo{}, fmt.Errorf("opening file: %w", err)
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		_ = file.Close()
+		return nil, filestore.ObjectInfo{}, fmt.Errorf("stat file: %w", err)
+	}
+
+	meta, err := readMetadata(file.Name())
+	if err != nil {
+		_ = file.Close()
+		return nil, filestore.ObjectInfo{}, err
+	}
+
+	return &contextFile{ctx: ctx, file: file}, filestore.ObjectInfo{
+		Hash:               hash,
+		Size:               info.Size(),
+		ContentType:        meta.ContentType,
+		ContentDisposition: meta.ContentDisposition,
+	}, nil
+}
@@ -0,0 +1,72 @@
+package local
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+)
+
+// mkdirAll creates dir and all missing parents with DirMode (and the owner set with WithOwner).
+// The mode of created directories is set explicitly, so it is not restricted by the umask of the process.
+func (f *Filestore) mkdirAll(dir string) error {
+	// Collect the missing directories from dir up to the first existing parent
+	var missing []string
+	for d := filepath.Clean(dir); ; d = filepath.Dir(d) {
+		if _, err := os.Stat(d); err == nil || !errors.Is(err, fs.ErrNotExist) {
+			break
+		}
+		missing = append(missing, d)
+		if filepath.Dir(d) == d {
+			break
+		}
+	}
+	if len(missing) == 0 {
+		return nil
+	}
+
+	if err := os.MkdirAll(dir, f.DirMode); err != nil {
+		return err
+	}
+	for i := len(missing) - 1; i >= 0; i-- {
+		if err := os.Chmod(missing[i], f.DirMode); err != nil {
+			return fmt.Errorf("setting directory mode: %w", err)
+		}
+		if err := f.chown(missing[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// setFileMode sets TargetFileMode (and the owner set with WithOwner) for a stored file.
+func (f *Filestore) setFileMode(file *os.File) error {
+	if err := file.Chmod(f.TargetFileMode); err != nil {
+		return fmt.Errorf("setting file mode: %w", err)
+	}
+	if f.owner != nil {
+		if err := file.Chown(f.owner.uid, f.owner.gid); err != nil {
+			return fmt.Errorf("setting file owner: %w", err)
+		}
+	}
+	return nil
+}
+
+// setPathMode is like setFileMode for a file path.
+func (f *Filestore) setPathMode(path string) error {
+	if err := os.Chmod(path, f.TargetFileMode); err != nil {
+		return fmt.Errorf("setting file mode: %w", err)
+	}
+	return f.chown(path)
+}
+
+func (f *Filestore) chown(path string) error {
+	if f.owner == nil {
+		return nil
+	}
+	if err := os.Chown(path, f.owner.uid, f.owner.gid); err != nil {
+		return fmt.Errorf("setting owner: %w", err)
+	}
+	return nil
+}
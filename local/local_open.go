@@ -0,0 +1,88 @@
+package local
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/hashing"
+)
+
+func init() {
+	filestore.Register("local", Open)
+}
+
+// Open opens a local file store from a DSN like "local:///var/assets?tmp=/var/tmp" for filestore.Open. Supported query
+// parameters are tmp (the temp path), readonly, durable, locking, writeOnce, iterateSnapshot, keepEmptyDirs, flat (true
+// or false), minFreeSpace and maxObjectSize (in bytes), keyEncoding (hex, prefixed or multihash), bloomFilter (the
+// expected number of files, see WithBloomFilter), publicURL (see WithPublicURL), imgproxySource (see
+// WithImgproxySource), fileMode and dirMode (octal like "0640").
+func Open(ctx context.Context, dsn *url.URL) (filestore.FileStore, error) {
+	params := dsn.Query()
+
+	var opts []Option
+	for param, opt := range map[string]Option{
+		"readonly":        WithReadOnly(),
+		"durable":         WithDurableWrites(),
+		"locking":         WithFileLocking(),
+		"writeOnce":       WithWriteOnce(),
+		"iterateSnapshot": WithIterateSnapshot(),
+		"keepEmptyDirs":   WithKeepEmptyDirs(),
+		"flat":            WithFlatLayout(),
+	} {
+		if enabled, _ := strconv.ParseBool(params.Get(param)); enabled {
+			opts = append(opts, opt)
+		}
+	}
+	if minFreeSpace := params.Get("minFreeSpace"); minFreeSpace != "" {
+		bytes, err := strconv.ParseUint(minFreeSpace, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parsing minFreeSpace: %w", err)
+		}
+		opts = append(opts, WithMinFreeSpace(bytes))
+	}
+	if keyEncoding := params.Get("keyEncoding"); keyEncoding != "" {
+		encoding, err := hashing.ParseKeyEncoding(keyEncoding)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithKeyEncoding(encoding))
+	}
+	if maxObjectSize := params.Get("maxObjectSize"); maxObjectSize != "" {
+		n, err := strconv.ParseInt(maxObjectSize, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parsing maxObjectSize: %w", err)
+		}
+		opts = append(opts, WithMaxObjectSize(n))
+	}
+	if bloomFilter := params.Get("bloomFilter"); bloomFilter != "" {
+		n, err := strconv.Atoi(bloomFilter)
+		if err != nil {
+			return nil, fmt.Errorf("parsing bloomFilter: %w", err)
+		}
+		opts = append(opts, WithBloomFilter(n, 0))
+	}
+	for param, opt := range map[string]func(os.FileMode) Option{
+		"fileMode": WithFileMode,
+		"dirMode":  WithDirMode,
+	} {
+		if value := params.Get(param); value != "" {
+			mode, err := strconv.ParseUint(value, 8, 32)
+			if err != nil {
+				return nil, fmt.Errorf("parsing %s: %w", param, err)
+			}
+			opts = append(opts, opt(os.FileMode(mode)))
+		}
+	}
+	if publicURL := params.Get("publicURL"); publicURL != "" {
+		opts = append(opts, WithPublicURL(publicURL))
+	}
+	if imgproxySource := params.Get("imgproxySource"); imgproxySource != "" {
+		opts = append(opts, WithImgproxySource(imgproxySource))
+	}
+
+	return NewFilestore(params.Get("tmp"), dsn.Path, opts...)
+}
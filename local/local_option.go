@@ -0,0 +1,219 @@
+package local
+
+import (
+	"os"
+
+	"github.com/networkteam/filestore/hashing"
+)
+
+type options struct {
+	durableWrites   bool
+	linkMode        LinkMode
+	fileLocking     bool
+	minFreeSpace    uint64
+	readOnly        bool
+	maxObjectSize   int64
+	keyEncoding     hashing.KeyEncoding
+	keyDerivation   hashing.KeyDerivation
+	writeOnce       bool
+	publicURL       string
+	imgproxySource  string
+	iterateSnapshot bool
+	keepEmptyDirs   bool
+	flatLayout      bool
+	fileMode        os.FileMode
+	dirMode         os.FileMode
+	owner           *owner
+
+	bloomFilterKeys              int
+	bloomFilterFalsePositiveRate float64
+}
+
+// Option is a functional option for creating a local file store.
+type Option func(*options)
+
+// owner is the user and group of stored files and created directories.
+type owner struct {
+	uid, gid int
+}
+
+// WithFileMode sets the mode of stored files (defaults to DefaultTargetFileMode).
+// The mode is set explicitly, so it is not restricted by the umask of the process.
+func WithFileMode(mode os.FileMode) Option {
+	return func(opts *options) {
+		opts.fileMode = mode
+	}
+}
+
+// WithDirMode sets the mode of created directories (defaults to DefaultDirMode), e.g. 0750 to only allow a group
+// (see WithOwner) to list the directories. The mode is set explicitly, so it is not restricted by the umask.
+func WithDirMode(mode os.FileMode) Option {
+	return func(opts *options) {
+		opts.dirMode = mode
+	}
+}
+
+// WithOwner sets the user and group ID of stored files and created directories (like os.Chown, an ID of -1 keeps
+// the current value), e.g. the group of a web server that serves the assets path. Changing the user requires
+// privileges, the group can be set to any group of the process. It is not supported on Windows.
+func WithOwner(uid, gid int) Option {
+	return func(opts *options) {
+		opts.owner = &owner{uid: uid, gid: gid}
+	}
+}
+
+// WithDurableWrites enables durable writes: stored files are synced to disk (fsync) before they are renamed
+// to their final path and the parent directory is synced after the rename.
+// This ensures that stored files survive a crash or power loss at the cost of slower writes.
+func WithDurableWrites() Option {
+	return func(opts *options) {
+		opts.durableWrites = true
+	}
+}
+
+// LinkMode defines how Store links files that are already on the same filesystem into the assets path.
+type LinkMode int
+
+const (
+	// LinkModeNone copies the content of all readers.
+	LinkModeNone LinkMode = iota
+	// LinkModeHardLink creates a hard link to the source file.
+	// The stored file shares the inode with the source file, so the source must not be modified afterwards
+	// and TargetFileMode is not applied (it would also change the mode of the source).
+	LinkModeHardLink
+	// LinkModeReflink creates a copy-on-write clone of the source file (FICLONE, e.g. on Btrfs or XFS).
+	// It is only supported on Linux.
+	LinkModeReflink
+)
+
+// WithLinking enables a fast path in Store for readers that are an *os.File at offset 0:
+// the file is hashed in place and linked into the assets path according to the mode instead of copying the content.
+// If linking fails (e.g. the file is on another filesystem), Store falls back to copying the content.
+func WithLinking(mode LinkMode) Option {
+	return func(opts *options) {
+		opts.linkMode = mode
+	}
+}
+
+// WithFileLocking enables advisory file locking (flock) for Store, StoreHashed and Remove.
+// This allows multiple processes (e.g. replicas sharing a network volume) to operate on the same assets path
+// without races between storing files and removing empty prefix directories.
+// Lock files are created as hidden files in the assets path, one per top-level prefix (or per two-character hash prefix
+// for the flat layout), with the mode and owner of stored files.
+// File locking is only supported on Unix systems.
+func WithFileLocking() Option {
+	return func(opts *options) {
+		opts.fileLocking = true
+	}
+}
+
+// WithMinFreeSpace refuses to store files with filestore.ErrNoSpace if the free space of the filesystem of the
+// assets path is below the given number of bytes. Checking the free space is only supported on Unix systems.
+func WithMinFreeSpace(bytes uint64) Option {
+	return func(opts *options) {
+		opts.minFreeSpace = bytes
+	}
+}
+
+// WithReadOnly opens the file store in read-only mode (e.g. for a read-only mounted volume).
+// NewFilestore does not create any directories and all mutating methods return filestore.ErrReadOnly.
+func WithReadOnly() Option {
+	return func(opts *options) {
+		opts.readOnly = true
+	}
+}
+
+// WithKeepEmptyDirs keeps prefix directories that are empty after Remove instead of removing them, which avoids
+// removing and recreating directories for prefixes with frequent changes.
+func WithKeepEmptyDirs() Option {
+	return func(opts *options) {
+		opts.keepEmptyDirs = true
+	}
+}
+
+// WithFlatLayout stores files directly in the assets path instead of prefix directories (sets PrefixSize to 0),
+// which simplifies inspecting and syncing small stores. Files stored in the default layout are still found,
+// use Reshard to move them to the assets path.
+func WithFlatLayout() Option {
+	return func(opts *options) {
+		opts.flatLayout = true
+	}
+}
+
+// WithMaxObjectSize limits the size of stored files. Store and StoreHashed fail with filestore.ErrTooLarge
+// as soon as more than maxObjectSize bytes are read and remove the temporary file.
+func WithMaxObjectSize(maxObjectSize int64) Option {
+	return func(opts *options) {
+		opts.maxObjectSize = maxObjectSize
+	}
+}
+
+// WithKeyEncoding sets the encoding of the keys returned by Store (defaults to hashing.HexKeys), e.g.
+// hashing.PrefixedKeys for keys like "sha256-<hex>". Files are stored with the encoded key as file name, files
+// stored with bare hex keys before the encoding was set are still found by the encoded keys.
+func WithKeyEncoding(encoding hashing.KeyEncoding) Option {
+	return func(opts *options) {
+		opts.keyEncoding = encoding
+	}
+}
+
+// WithKeyDerivation derives the keys of stored files from the content hash, e.g. with hashing.HMACKeys so keys
+// cannot be computed from the content without the secret. The derived hash is encoded with the key encoding and used
+// for the prefix directories. Files stored before the derivation was set are not found by their derived keys.
+func WithKeyDerivation(derivation hashing.KeyDerivation) Option {
+	return func(opts *options) {
+		opts.keyDerivation = derivation
+	}
+}
+
+// WithWriteOnce makes StoreHashed (and StoreIfAbsent) fail with filestore.ErrAlreadyExists if a file with the hash
+// already exists with different content. Existing files are never overwritten by StoreHashed, but without this option
+// different content is silently discarded. The content is compared by size (for filestore.Sized readers) and hash.
+func WithWriteOnce() Option {
+	return func(opts *options) {
+		opts.writeOnce = true
+	}
+}
+
+// WithPublicURL sets the URL template of PublicURL for files served by Handler, e.g. "https://example.com/assets/{hash}"
+// or a base URL like "https://example.com/assets" the hash is appended to (see filestore.ExpandPublicURL).
+func WithPublicURL(template string) Option {
+	return func(opts *options) {
+		opts.publicURL = template
+	}
+}
+
+// WithImgproxySource sets the template of ImgproxyURLSource (defaults to DefaultImgproxySource), e.g.
+// "local:///assets/{prefix}/{hash}" if imgproxy mounts the assets path under a different root than its local
+// filesystem root. The placeholders "{prefix}" and "{hash}" are replaced by the prefix directories and the hash.
+func WithImgproxySource(template string) Option {
+	return func(opts *options) {
+		opts.imgproxySource = template
+	}
+}
+
+// WithIterateSnapshot makes Iterate and IterateParallel list all hashes before the first callback is called, so
+// files stored or removed concurrently (e.g. while a garbage collection is running) cannot be visited twice or
+// be skipped: the iteration returns the files that existed when the listing was made (including files that were
+// removed since then).
+// The snapshot is kept in memory (about 100 bytes per file) and callbacks are only called after the whole assets path
+// was listed.
+func WithIterateSnapshot() Option {
+	return func(opts *options) {
+		opts.iterateSnapshot = true
+	}
+}
+
+// WithBloomFilter keeps an in-memory bloom filter of the stored hashes, so Exists, Fetch and ExistsFast answer
+// lookups of missing files without touching the filesystem (e.g. for deduplication checks in large stores).
+// The filter is sized for expectedFiles with the false positive rate (DefaultBloomFilterFalsePositiveRate if <= 0)
+// and built by listing all files in NewFilestore, which takes some time for large stores.
+//
+// Files stored by other processes after the filter was built are not known and reported as missing, so the option
+// must only be used if no other process stores files in the assets path.
+func WithBloomFilter(expectedFiles int, falsePositiveRate float64) Option {
+	return func(opts *options) {
+		opts.bloomFilterKeys = expectedFiles
+		opts.bloomFilterFalsePositiveRate = falsePositiveRate
+	}
+}
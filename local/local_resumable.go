@@ -0,0 +1,199 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sync"
+
+	"github.com/gofrs/uuid"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/hashing"
+	"github.com/networkteam/filestore/internal/bufpool"
+	"github.com/networkteam/filestore/resumable"
+)
+
+var _ resumable.Uploader = &Filestore{}
+
+// CreateUpload implements resumable.Uploader. The content of the upload is appended to a file in the tmp path
+// (or a hidden file in the assets path if no tmp path is set).
+func (f *Filestore) CreateUpload(ctx context.Context) (string, error) {
+	if f.readOnly {
+		return "", filestore.ErrReadOnly
+	}
+
+	id, err := uuid.NewV4()
+	if err != nil {
+		return "", fmt.Errorf("generating upload id: %w", err)
+	}
+	uploadPath, _ := f.uploadPath(id.String())
+
+	file, err := os.OpenFile(uploadPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return "", fmt.Errorf("creating upload file: %w", err)
+	}
+	if err = file.Close(); err != nil {
+		return "", fmt.Errorf("closing upload file: %w", err)
+	}
+
+	return id.String(), nil
+}
+
+// AppendUpload implements resumable.Uploader. A chunk exceeding the max object size is discarded and
+// filestore.ErrTooLarge is returned.
+func (f *Filestore) AppendUpload(ctx context.Context, id string, offset int64, r io.Reader) (int64, error) {
+	if f.readOnly {
+		return 0, filestore.ErrReadOnly
+	}
+	uploadPath, err := f.uploadPath(id)
+	if err != nil {
+		return 0, err
+	}
+
+	mu := f.uploadLock(id)
+	if !mu.TryLock() {
+		return 0, fmt.Errorf("appending to upload %s while another chunk is appended: %w", id, resumable.ErrOffsetMismatch)
+	}
+	defer mu.Unlock()
+
+	if err = f.checkFreeSpace(); err != nil {
+		return 0, err
+	}
+
+	file, err := os.OpenFile(uploadPath, os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return 0, resumable.ErrUploadNotFound
+		}
+		return 0, fmt.Errorf("opening upload file: %w", err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return 0, fmt.Errorf("stat upload file: %w", err)
+	}
+	if info.Size() != offset {
+		return info.Size(), fmt.Errorf("appending at offset %d to upload of size %d: %w", offset, info.Size(), resumable.ErrOffsetMismatch)
+	}
+
+	src := newContextReader(ctx, r)
+	if f.maxObjectSize > 0 {
+		src = filestore.LimitReader(src, f.maxObjectSize-offset)
+	}
+	n, err := bufpool.Copy(file, src)
+	if errors.Is(err, filestore.ErrTooLarge) {
+		if truncateErr := file.Truncate(offset); truncateErr != nil {
+			return 0, fmt.Errorf("discarding chunk: %v: %w", truncateErr, err)
+		}
+		return offset, err
+	}
+	if err != nil {
+		return offset + n, fmt.Errorf("appending to upload: %w", wrapNoSpace(err))
+	}
+
+	if f.durableWrites {
+		if err = file.Sync(); err != nil {
+			return offset + n, fmt.Errorf("syncing upload file: %w", err)
+		}
+	}
+
+	return offset + n, nil
+}
+
+// UploadOffset implements resumable.Uploader.
+func (f *Filestore) UploadOffset(ctx context.Context, id string) (int64, error) {
+	uploadPath, err := f.uploadPath(id)
+	if err != nil {
+		return 0, err
+	}
+
+	info, err := os.Stat(uploadPath)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return 0, resumable.ErrUploadNotFound
+		}
+		return 0, fmt.Errorf("stat upload file: %w", err)
+	}
+	return info.Size(), nil
+}
+
+// FinalizeUpload implements resumable.Uploader. The upload file is hashed and moved to the assets path.
+func (f *Filestore) FinalizeUpload(ctx context.Context, id string) (string, error) {
+	if f.readOnly {
+		return "", filestore.ErrReadOnly
+	}
+	uploadPath, err := f.uploadPath(id)
+	if err != nil {
+		return "", err
+	}
+
+	mu := f.uploadLock(id)
+	mu.Lock()
+	defer mu.Unlock()
+
+	if _, err = os.Stat(uploadPath); errors.Is(err, fs.ErrNotExist) {
+		return "", resumable.ErrUploadNotFound
+	}
+	hashHex, err := hashing.HashFile(uploadPath)
+	if err != nil {
+		return "", err
+	}
+
+	key, renamed, err := f.storeTempFile(uploadPath, hashHex, nil)
+	if err != nil {
+		return "", err
+	}
+	if !renamed {
+		if err = os.Remove(uploadPath); err != nil {
+			return "", fmt.Errorf("removing upload file: %w", err)
+		}
+	}
+	f.uploadLocks.Delete(id)
+
+	return key, nil
+}
+
+// AbortUpload implements resumable.Uploader.
+func (f *Filestore) AbortUpload(ctx context.Context, id string) error {
+	uploadPath, err := f.uploadPath(id)
+	if err != nil {
+		return err
+	}
+
+	mu := f.uploadLock(id)
+	mu.Lock()
+	defer mu.Unlock()
+
+	if err = os.Remove(uploadPath); err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return resumable.ErrUploadNotFound
+		}
+		return fmt.Errorf("removing upload file: %w", err)
+	}
+	f.uploadLocks.Delete(id)
+
+	return nil
+}
+
+// uploadPath returns the path of the file of an upload. Only IDs created by CreateUpload are accepted.
+func (f *Filestore) uploadPath(id string) (string, error) {
+	if parsed, err := uuid.FromString(id); err != nil || parsed.String() != id {
+		return "", resumable.ErrUploadNotFound
+	}
+	if f.tmpPath == "" {
+		return filepath.Join(f.assetsPath, ".upload-"+id), nil
+	}
+	return filepath.Join(f.tmpPath, "upload-"+id), nil
+}
+
+// uploadLock returns the mutex serializing operations on an upload.
+func (f *Filestore) uploadLock(id string) *sync.Mutex {
+	mu, _ := f.uploadLocks.LoadOrStore(id, &sync.Mutex{})
+	return mu.(*sync.Mutex)
+}
@@ -0,0 +1,102 @@
+package local
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/hashicorp/go-multierror"
+)
+
+// createTemp creates a temporary file in the tmp path or as a hidden file in the assets path if no tmp path is set.
+func (f *Filestore) createTemp(pattern string) (*os.File, error) {
+	if f.tmpPath == "" {
+		return os.CreateTemp(f.assetsPath, "."+pattern)
+	}
+	return os.CreateTemp(f.tmpPath, pattern)
+}
+
+// moveAcrossFilesystems moves a file to a target path on another filesystem.
+// It is copied to a hidden temporary file in the target directory first, so the final rename is atomic.
+func (f *Filestore) moveAcrossFilesystems(sourcePath, targetPath string) error {
+	hiddenPath, err := f.copyToTargetDir(sourcePath, targetPath)
+	if err != nil {
+		return err
+	}
+
+	if err = os.Rename(hiddenPath, targetPath); err != nil {
+		_ = os.Remove(hiddenPath)
+		return fmt.Errorf("renaming temp file: %w", err)
+	}
+
+	if err = os.Remove(sourcePath); err != nil {
+		return fmt.Errorf("removing temp file: %w", err)
+	}
+	return nil
+}
+
+// copyToTargetDir copies a file to a hidden temporary file in the directory of the target path and returns its path.
+func (f *Filestore) copyToTargetDir(sourcePath, targetPath string) (hiddenPath string, err error) {
+	source, err := os.Open(sourcePath)
+	if err != nil {
+		return "", fmt.Errorf("opening temp file: %w", err)
+	}
+	defer source.Close()
+
+	target, err := os.CreateTemp(filepath.Dir(targetPath), ".move-*")
+	if err != nil {
+		return "", fmt.Errorf("creating temp file in asset subdirectory: %w", err)
+	}
+
+	_, err = io.Copy(target, source)
+	if err == nil {
+		err = f.setFileMode(target)
+	}
+	if err == nil && f.durableWrites {
+		err = target.Sync()
+	}
+	if closeErr := target.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		if removeErr := os.Remove(target.Name()); removeErr != nil {
+			err = multierror.Append(err, fmt.Errorf("removing temp file in asset subdirectory: %w", removeErr))
+		}
+		return "", fmt.Errorf("copying temp file: %w", wrapNoSpace(err))
+	}
+
+	return target.Name(), nil
+}
+
+// linkNoReplace links a temporary file to the target path without replacing an existing file.
+// It returns false if the target path already exists. The temporary file is not removed.
+func (f *Filestore) linkNoReplace(tempPath, targetPath string) (created bool, err error) {
+	err = os.Link(tempPath, targetPath)
+	switch {
+	case err == nil:
+		return true, nil
+	case errors.Is(err, fs.ErrExist):
+		return false, nil
+	case errors.Is(err, syscall.EXDEV):
+		// The tmp path is on another filesystem, so we copy the file to the target directory and link it from there
+		hiddenPath, err := f.copyToTargetDir(tempPath, targetPath)
+		if err != nil {
+			return false, err
+		}
+		defer os.Remove(hiddenPath)
+		return f.linkNoReplace(hiddenPath, targetPath)
+	}
+
+	// The filesystem might not support hard links, so we fall back to a rename if the target does not exist
+	if _, statErr := os.Stat(targetPath); statErr == nil {
+		return false, nil
+	}
+	if err = os.Rename(tempPath, targetPath); err != nil {
+		return false, fmt.Errorf("renaming temp file: %w", err)
+	}
+	return true, nil
+}
@@ -0,0 +1,76 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"syscall"
+
+	"github.com/networkteam/filestore"
+)
+
+// Usage returns the number of stored files and their total size in bytes.
+func (f *Filestore) Usage(ctx context.Context) (filestore.Usage, error) {
+	var usage filestore.Usage
+	err := filepath.Walk(f.assetsPath, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if info.IsDir() || info.Name()[0] == '.' {
+			return nil
+		}
+
+		usage.Objects++
+		usage.Bytes += info.Size()
+		return nil
+	})
+	if err != nil {
+		return filestore.Usage{}, fmt.Errorf("walking assets: %w", err)
+	}
+
+	return usage, nil
+}
+
+// Count returns the number of stored files. It is faster than Usage and Iterate for large stores, since the file
+// names are neither sorted nor collected and files are not stat'ed.
+func (f *Filestore) Count(ctx context.Context) (int64, error) {
+	var count int64
+	err := walkFiles(ctx, f.assetsPath, false, func(name string) error {
+		count++
+		return nil
+	})
+	if err != nil {
+		return 0, fmt.Errorf("walking assets: %w", err)
+	}
+
+	return count, nil
+}
+
+// checkFreeSpace returns filestore.ErrNoSpace if a minimum free space is configured and not available.
+func (f *Filestore) checkFreeSpace() error {
+	if f.minFreeSpace == 0 {
+		return nil
+	}
+
+	free, err := freeSpace(f.assetsPath)
+	if err != nil {
+		return fmt.Errorf("getting free space: %w", err)
+	}
+	if free < f.minFreeSpace {
+		return fmt.Errorf("%d bytes free, need at least %d: %w", free, f.minFreeSpace, filestore.ErrNoSpace)
+	}
+	return nil
+}
+
+// wrapNoSpace wraps errors caused by a full filesystem with filestore.ErrNoSpace.
+func wrapNoSpace(err error) error {
+	if errors.Is(err, syscall.ENOSPC) {
+		return fmt.Errorf("%v: %w", err, filestore.ErrNoSpace)
+	}
+	return err
+}
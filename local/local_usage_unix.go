@@ -0,0 +1,17 @@
+//go:build unix
+
+package local
+
+import (
+	"syscall"
+)
+
+// freeSpace returns the number of bytes available to unprivileged users on the filesystem of path.
+func freeSpace(path string) (uint64, error) {
+	var stat syscall.Statfs_t
+	if err := syscall.Statfs(path, &stat); err != nil {
+		return 0, err
+	}
+	// The field types differ between platforms
+	return uint64(stat.Bavail) * uint64(stat.Bsize), nil
+}
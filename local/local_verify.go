@@ -0,0 +1,158 @@
+package local
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/hashing"
+)
+
+// emptyHash is the SHA256 hash of empty content.
+const emptyHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+
+// VerifyOptions configure Verify.
+type VerifyOptions struct {
+	// QuarantinePath is a directory where invalid files are moved to (keeping their relative path).
+	// Invalid files are only reported if it is empty.
+	QuarantinePath string
+	// SkipContentHash skips hashing the content of files, e.g. if files were stored with StoreHashed using
+	// hashes that are not the SHA256 hash of their content.
+	SkipContentHash bool
+}
+
+// VerifyReport is the result of Verify. All paths are relative to the assets path.
+type VerifyReport struct {
+	// Checked is the number of checked files.
+	Checked int
+	// Mismatched are files whose name does not match the hash of their content.
+	Mismatched []string
+	// Empty are zero-byte files (except for the hash of empty content).
+	Empty []string
+	// Stray are files that are not a hash or not in the prefix directory of their hash.
+	Stray []string
+	// Quarantined are the invalid files that were moved to the quarantine path.
+	Quarantined []string
+}
+
+// Valid returns true if no invalid files were found.
+func (r VerifyReport) Valid() bool {
+	return len(r.Mismatched) == 0 && len(r.Empty) == 0 && len(r.Stray) == 0
+}
+
+// Verify walks all files in the assets path, re-hashes them and reports invalid files.
+// Hidden files (e.g. metadata) are ignored.
+func (f *Filestore) Verify(ctx context.Context, opts VerifyOptions) (VerifyReport, error) {
+	if opts.QuarantinePath != "" && f.readOnly {
+		return VerifyReport{}, filestore.ErrReadOnly
+	}
+
+	var report VerifyReport
+	err := filepath.WalkDir(f.assetsPath, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if entry.IsDir() || entry.Name()[0] == '.' {
+			return nil
+		}
+
+		relPath, err := filepath.Rel(f.assetsPath, path)
+		if err != nil {
+			return err
+		}
+		report.Checked++
+
+		invalid, err := f.verifyFile(path, relPath, opts, &report)
+		if err != nil {
+			return err
+		}
+		if invalid && opts.QuarantinePath != "" {
+			if err := f.quarantine(path, relPath, opts.QuarantinePath); err != nil {
+				return err
+			}
+			report.Quarantined = append(report.Quarantined, relPath)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return report, fmt.Errorf("walking assets: %w", err)
+	}
+
+	return report, nil
+}
+
+func (f *Filestore) verifyFile(path, relPath string, opts VerifyOptions, report *VerifyReport) (invalid bool, err error) {
+	hash := filepath.Base(path)
+	hexHash, ok := f.keyEncoding.Decode(hash)
+	if !ok || !f.isHashPath(hash, path) {
+		report.Stray = append(report.Stray, relPath)
+		return true, nil
+	}
+
+	file, err := os.Open(path)
+	if err != nil {
+		return false, fmt.Errorf("opening %s: %w", relPath, err)
+	}
+	defer file.Close()
+
+	info, err := file.Stat()
+	if err != nil {
+		return false, fmt.Errorf("stat %s: %w", relPath, err)
+	}
+	if info.Size() == 0 && hexHash != f.deriveHash(emptyHash) {
+		report.Empty = append(report.Empty, relPath)
+		return true, nil
+	}
+
+	if opts.SkipContentHash {
+		return false, nil
+	}
+
+	contentHash, err := hashing.HashReader(file)
+	if err != nil {
+		return false, fmt.Errorf("hashing %s: %w", relPath, err)
+	}
+	if f.deriveHash(contentHash) != hexHash {
+		report.Mismatched = append(report.Mismatched, relPath)
+		return true, nil
+	}
+
+	return false, nil
+}
+
+// isHashPath checks if the path is the path of the hash in the current or default layout.
+func (f *Filestore) isHashPath(hash, path string) bool {
+	if currentPath, err := f.filePath(hash); err == nil && filepath.Clean(currentPath) == filepath.Clean(path) {
+		return true
+	}
+	if shardHash := f.shardHash(hash); len(shardHash) >= DefaultPrefixSize {
+		defaultPath := filepath.Join(f.assetsPath, shardHash[:DefaultPrefixSize], hash)
+		return filepath.Clean(defaultPath) == filepath.Clean(path)
+	}
+	return false
+}
+
+// quarantine moves an invalid file (and its metadata) to the quarantine path.
+func (f *Filestore) quarantine(path, relPath, quarantinePath string) error {
+	targetPath := filepath.Join(quarantinePath, relPath)
+	if err := f.mkdirAll(filepath.Dir(targetPath)); err != nil {
+		return fmt.Errorf("creating quarantine directory: %w", err)
+	}
+
+	if err := os.Rename(path, targetPath); err != nil {
+		return fmt.Errorf("quarantining %s: %w", relPath, err)
+	}
+	if err := os.Rename(metadataPath(path), metadataPath(targetPath)); err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return fmt.Errorf("quarantining metadata of %s: %w", relPath, err)
+	}
+
+	return f.removeEmptyDirs(filepath.Dir(path))
+}
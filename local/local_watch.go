@@ -0,0 +1,79 @@
+package local
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/networkteam/filestore"
+)
+
+// Watch detects files that were added to or removed from the assets path (also by external tools like rsync or
+// manual cleanup) and calls handler with a filestore.Event for every change. Files existing when Watch is called
+// do not emit events. It blocks until the context is done or the handler returns an error.
+//
+// Changes are detected by scanning the assets path every interval, so this works on all platforms and file systems
+// (including network file systems without change notifications) at the cost of a full directory walk per scan.
+func (f *Filestore) Watch(ctx context.Context, interval time.Duration, handler func(event filestore.Event) error) error {
+	known, err := f.scanHashes(ctx)
+	if err != nil {
+		return err
+	}
+
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+
+		current, err := f.scanHashes(ctx)
+		if err != nil {
+			return err
+		}
+
+		for _, event := range diffHashes(known, current) {
+			if err := handler(event); err != nil {
+				return err
+			}
+		}
+		known = current
+	}
+}
+
+func (f *Filestore) scanHashes(ctx context.Context) (map[string]struct{}, error) {
+	hashes := make(map[string]struct{})
+	err := f.Iterate(ctx, 1000, func(batch []string) error {
+		for _, hash := range batch {
+			hashes[hash] = struct{}{}
+		}
+		return ctx.Err()
+	})
+	if err != nil {
+		return nil, fmt.Errorf("scanning assets: %w", err)
+	}
+	return hashes, nil
+}
+
+// diffHashes returns events for removed and stored hashes sorted by hash.
+func diffHashes(previous, current map[string]struct{}) []filestore.Event {
+	var events []filestore.Event
+	for hash := range previous {
+		if _, ok := current[hash]; !ok {
+			events = append(events, filestore.Event{Type: filestore.EventRemoved, Hash: hash})
+		}
+	}
+	for hash := range current {
+		if _, ok := previous[hash]; !ok {
+			events = append(events, filestore.Event{Type: filestore.EventStored, Hash: hash})
+		}
+	}
+	sort.Slice(events, func(i, j int) bool {
+		return events[i].Hash < events[j].Hash
+	})
+	return events
+}
@@ -2,99 +2,413 @@ package memory
 
 import (
 	"bytes"
+	"container/list"
 	"context"
-	"crypto/sha256"
-	"encoding/hex"
+	"fmt"
 	"io"
+	"io/fs"
+	"sort"
 	"sync"
 
 	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/hashing"
+	"github.com/networkteam/filestore/internal/bufpool"
 )
 
+// ErrTooLarge is returned if an object is larger than the maximum total size of the store.
+// It wraps filestore.ErrTooLarge.
+var ErrTooLarge = fmt.Errorf("object exceeds max bytes of memory store: %w", filestore.ErrTooLarge)
+
 // Filestore is an in-memory file store for testing purposes.
+// It can be used as a bounded cache by setting a capacity limit with WithMaxBytes or WithMaxObjects.
 type Filestore struct {
 	mx    sync.RWMutex
-	files map[string][]byte
+	files map[string]*entry
+	// order contains the hashes of all files, the next to evict at the back
+	order      *list.List
+	totalBytes int64
+
+	maxBytes       int64
+	maxObjects     int
+	maxObjectSize  int64
+	evictionPolicy EvictionPolicy
+	onEvict        func(hash string, size int64)
+	recorder       *recorder
+	keyEncoding    hashing.KeyEncoding
+	keyDerivation  hashing.KeyDerivation
+	writeOnce      bool
 }
 
-var _ filestore.FileStore = &Filestore{}
+type entry struct {
+	data     []byte
+	metadata metadata
+	element  *list.Element
+}
+
+type metadata struct {
+	contentType        string
+	contentDisposition string
+}
+
+func metadataFromReader(r io.Reader) metadata {
+	var meta metadata
+	if typedReader, ok := r.(filestore.ContentTyped); ok {
+		meta.contentType = typedReader.ContentType()
+	}
+	if dispoReader, ok := r.(filestore.ContentDispositioned); ok {
+		meta.contentDisposition = dispoReader.ContentDisposition()
+	}
+	return meta
+}
+
+type evicted struct {
+	hash string
+	size int64
+}
+
+var (
+	_ filestore.FileStore      = &Filestore{}
+	_ filestore.Stater         = &Filestore{}
+	_ filestore.IfAbsentStorer = &Filestore{}
+	_ filestore.InfoFetcher    = &Filestore{}
+	_ filestore.SortedIterator = &Filestore{}
+	_ filestore.RangeFetcher   = &Filestore{}
+	_ filestore.Pinger         = &Filestore{}
+	_ filestore.BatchExister   = &Filestore{}
+)
 
 // NewFilestore creates a new in-memory file store.
-func NewFilestore() *Filestore {
-	return &Filestore{
-		files: make(map[string][]byte),
+func NewFilestore(opts ...Option) *Filestore {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	f := &Filestore{
+		files:          make(map[string]*entry),
+		order:          list.New(),
+		maxBytes:       o.maxBytes,
+		maxObjects:     o.maxObjects,
+		maxObjectSize:  o.maxObjectSize,
+		evictionPolicy: o.evictionPolicy,
+		onEvict:        o.onEvict,
+		keyEncoding:    o.keyEncoding,
+		keyDerivation:  o.keyDerivation,
+		writeOnce:      o.writeOnce,
+	}
+	if f.keyEncoding == nil {
+		f.keyEncoding = hashing.HexKeys
+	}
+	if o.recording {
+		f.recorder = &recorder{}
 	}
+	return f
+}
+
+// Ping implements filestore.Pinger, an in-memory store is always reachable.
+func (f *Filestore) Ping(ctx context.Context) error {
+	return nil
+}
+
+// key returns the key of content with the hex encoded hash.
+func (f *Filestore) key(hexHash string) string {
+	if f.keyDerivation != nil {
+		hexHash = f.keyDerivation(hexHash)
+	}
+	return f.keyEncoding.Encode(hexHash)
 }
 
 // Store implements filestore.Storer.
+// The content is read and hashed before locking the store, so concurrent operations are not blocked by slow readers.
 func (f *Filestore) Store(ctx context.Context, r io.Reader) (hash string, err error) {
-	f.mx.Lock()
-	defer f.mx.Unlock()
+	var data []byte
+	defer func() {
+		f.record(Call{Op: OpStore, Hash: hash, Bytes: int64(len(data)), Err: err})
+	}()
 
-	data, err := io.ReadAll(r)
+	hashingReader := hashing.NewHashingReader(f.limitReader(r))
+	data, err = f.readAll(hashingReader, r)
 	if err != nil {
 		return "", err
 	}
+	hash = f.key(hashingReader.SumHex())
 
-	digest := sha256.New()
-	digest.Write(data)
-	hashBytes := digest.Sum(nil)
-	hash = hex.EncodeToString(hashBytes)
+	f.mx.Lock()
+	var evictions []evicted
+	defer func() {
+		f.mx.Unlock()
+		f.notifyEvicted(evictions)
+	}()
 
-	f.files[hash] = data
+	// Content stored with a legacy key is updated instead of stored again
+	storedKey, _, _ := f.lookup(hash)
+	evictions, err = f.put(storedKey, data, metadataFromReader(r))
+	if err != nil {
+		return "", err
+	}
 
 	return hash, nil
 }
 
+// StoreHashed implements filestore.HashedStorer.
+// The content is read before locking the store, so concurrent operations are not blocked by slow readers.
 func (f *Filestore) StoreHashed(ctx context.Context, r io.Reader, hash string) error {
+	_, err := f.storeHashed(r, hash)
+	return err
+}
+
+// StoreIfAbsent implements filestore.IfAbsentStorer.
+func (f *Filestore) StoreIfAbsent(ctx context.Context, r io.Reader, hash string) (created bool, err error) {
+	return f.storeHashed(r, hash)
+}
+
+// storeHashed stores the content of r with the given hash and returns true if it was stored.
+func (f *Filestore) storeHashed(r io.Reader, hash string) (created bool, err error) {
+	var data []byte
+	defer func() {
+		f.record(Call{Op: OpStoreHashed, Hash: hash, Bytes: int64(len(data)), Err: err})
+	}()
+
+	// With write-once, the content has to be read to compare it with an existing file
+	if !f.writeOnce && f.touchExisting(hash) {
+		return false, nil
+	}
+
+	data, err = f.readAll(f.limitReader(r), r)
+	if err != nil {
+		return false, err
+	}
+
 	f.mx.Lock()
-	defer f.mx.Unlock()
+	var evictions []evicted
+	defer func() {
+		f.mx.Unlock()
+		f.notifyEvicted(evictions)
+	}()
 
-	if _, ok := f.files[hash]; ok {
-		return nil
+	// The hash could have been stored concurrently while reading
+	if _, e, ok := f.lookup(hash); ok {
+		f.touch(e)
+		if f.writeOnce && !bytes.Equal(e.data, data) {
+			return false, fmt.Errorf("%w: %s", filestore.ErrAlreadyExists, hash)
+		}
+		return false, nil
 	}
 
-	data, err := io.ReadAll(r)
+	evictions, err = f.put(hash, data, metadataFromReader(r))
 	if err != nil {
-		return err
+		return false, err
 	}
+	return true, nil
+}
 
-	f.files[hash] = data
+// limitReader limits r to the max object size if set.
+func (f *Filestore) limitReader(r io.Reader) io.Reader {
+	if f.maxObjectSize <= 0 {
+		return r
+	}
+	return filestore.LimitReader(r, f.maxObjectSize)
+}
 
-	return nil
+// readAll reads r completely with a pooled copy buffer. If the original reader implements filestore.Sized,
+// the data is allocated once with the expected size.
+func (f *Filestore) readAll(r, original io.Reader) ([]byte, error) {
+	var buf bytes.Buffer
+	if sized, ok := original.(filestore.Sized); ok && sized.Size() > 0 && (f.maxObjectSize <= 0 || sized.Size() <= f.maxObjectSize) {
+		buf.Grow(int(sized.Size()))
+	}
+	if _, err := bufpool.Copy(&buf, r); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// touchExisting marks the file as recently used and returns true if it exists.
+func (f *Filestore) touchExisting(hash string) bool {
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	_, e, ok := f.lookup(hash)
+	if ok {
+		f.touch(e)
+	}
+	return ok
+}
+
+// lookup returns the stored key and the entry of a key. If no entry exists for an encoded key, the entry of
+// the bare hex key (stored before the key encoding was set) is returned. It must be called with the lock held.
+func (f *Filestore) lookup(key string) (storedKey string, e *entry, ok bool) {
+	if e, ok := f.files[key]; ok {
+		return key, e, true
+	}
+	if legacyKey, ok := hashing.LegacyKey(f.keyEncoding, key); ok {
+		if e, ok := f.files[legacyKey]; ok {
+			return legacyKey, e, true
+		}
+	}
+	return key, nil, false
+}
+
+// touchedEntry marks the file with the given hash as recently used and returns its data and metadata.
+// They are copied while holding the lock, since storing the same content concurrently replaces them.
+func (f *Filestore) touchedEntry(hash string) (data []byte, meta metadata, ok bool) {
+	// A write lock is needed to mark the file as recently used
+	f.mx.Lock()
+	defer f.mx.Unlock()
+
+	_, e, ok := f.lookup(hash)
+	if !ok {
+		return nil, metadata{}, false
+	}
+	f.touch(e)
+	return e.data, e.metadata, true
+}
+
+// put stores data under hash and evicts other files if a capacity limit is exceeded.
+// It must be called with the write lock held.
+func (f *Filestore) put(hash string, data []byte, meta metadata) ([]evicted, error) {
+	if f.maxBytes > 0 && int64(len(data)) > f.maxBytes {
+		return nil, ErrTooLarge
+	}
+
+	if e, ok := f.files[hash]; ok {
+		f.totalBytes -= int64(len(e.data))
+		e.data = data
+		e.metadata = meta
+		f.totalBytes += int64(len(data))
+		f.touch(e)
+	} else {
+		f.files[hash] = &entry{
+			data:     data,
+			metadata: meta,
+			element:  f.order.PushFront(hash),
+		}
+		f.totalBytes += int64(len(data))
+	}
+
+	var evictions []evicted
+	for f.exceedsCapacity() {
+		oldest := f.order.Back()
+		evictedHash := oldest.Value.(string)
+		if evictedHash == hash {
+			break
+		}
+		evictions = append(evictions, evicted{hash: evictedHash, size: int64(len(f.files[evictedHash].data))})
+		f.delete(evictedHash)
+	}
+
+	return evictions, nil
+}
+
+func (f *Filestore) exceedsCapacity() bool {
+	return (f.maxBytes > 0 && f.totalBytes > f.maxBytes) || (f.maxObjects > 0 && len(f.files) > f.maxObjects)
+}
+
+// touch marks an entry as recently used. It must be called with the write lock held.
+func (f *Filestore) touch(e *entry) {
+	if f.evictionPolicy == EvictionLRU {
+		f.order.MoveToFront(e.element)
+	}
+}
+
+// delete removes a file. It must be called with the write lock held.
+func (f *Filestore) delete(hash string) {
+	e := f.files[hash]
+	f.order.Remove(e.element)
+	f.totalBytes -= int64(len(e.data))
+	delete(f.files, hash)
+}
+
+func (f *Filestore) notifyEvicted(evictions []evicted) {
+	if f.onEvict == nil {
+		return
+	}
+	for _, e := range evictions {
+		f.onEvict(e.hash, e.size)
+	}
 }
 
 func (f *Filestore) Exists(ctx context.Context, hash string) (bool, error) {
+	defer f.record(Call{Op: OpExists, Hash: hash})
+
 	f.mx.RLock()
 	defer f.mx.RUnlock()
 
-	_, ok := f.files[hash]
+	_, _, ok := f.lookup(hash)
 	return ok, nil
 }
 
+// ExistsMany implements filestore.BatchExister.
+func (f *Filestore) ExistsMany(ctx context.Context, hashes []string) (map[string]bool, error) {
+	f.mx.RLock()
+	exists := make(map[string]bool, len(hashes))
+	for _, hash := range hashes {
+		_, _, exists[hash] = f.lookup(hash)
+	}
+	f.mx.RUnlock()
+
+	for _, hash := range hashes {
+		f.record(Call{Op: OpExists, Hash: hash})
+	}
+	return exists, nil
+}
+
 // Fetch implements filestore.Fetcher.
 func (f *Filestore) Fetch(ctx context.Context, hash string) (io.ReadCloser, error) {
-	f.mx.RLock()
-	defer f.mx.RUnlock()
+	data, _, ok := f.touchedEntry(hash)
+	if !ok {
+		err := &filestore.NotExistError{Op: "fetch", Hash: hash}
+		f.record(Call{Op: OpFetch, Hash: hash, Err: err})
+		return nil, err
+	}
 
-	data, ok := f.files[hash]
+	f.record(Call{Op: OpFetch, Hash: hash, Bytes: int64(len(data))})
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+// FetchRange implements filestore.RangeFetcher.
+func (f *Filestore) FetchRange(ctx context.Context, hash string, offset, length int64) (io.ReadCloser, error) {
+	data, _, ok := f.touchedEntry(hash)
 	if !ok {
-		return nil, filestore.ErrNotExist
+		err := &filestore.NotExistError{Op: "fetch range", Hash: hash}
+		f.record(Call{Op: OpFetchRange, Hash: hash, Err: err})
+		return nil, err
+	}
+
+	if offset < 0 || offset > int64(len(data)) {
+		err := fmt.Errorf("offset %d of %d bytes: %w", offset, len(data), filestore.ErrInvalidRange)
+		f.record(Call{Op: OpFetchRange, Hash: hash, Err: err})
+		return nil, err
+	}
+	data = data[offset:]
+	if length >= 0 && length < int64(len(data)) {
+		data = data[:length]
 	}
 
+	f.record(Call{Op: OpFetchRange, Hash: hash, Bytes: int64(len(data))})
 	return io.NopCloser(bytes.NewReader(data)), nil
 }
 
-// Iterate implements filestore.Iterator.
-func (f *Filestore) Iterate(ctx context.Context, maxBatch int, callback func(hashes []string) error) error {
+// Iterate implements filestore.Iterator. Hashes are returned in lexicographic order.
+func (f *Filestore) Iterate(ctx context.Context, maxBatch int, callback func(hashes []string) error) (err error) {
+	defer func() {
+		f.record(Call{Op: OpIterate, Err: err})
+	}()
+
 	f.mx.RLock()
 	defer f.mx.RUnlock()
 
-	hashes := make([]string, 0, maxBatch)
+	keys := make([]string, 0, len(f.files))
 	for hash := range f.files {
+		keys = append(keys, hash)
+	}
+	sort.Strings(keys)
+
+	hashes := make([]string, 0, maxBatch)
+	for _, hash := range keys {
 		hashes = append(hashes, hash)
 		if len(hashes) == maxBatch {
-			if err := callback(hashes); err != nil {
+			if err = callback(hashes); err != nil {
 				return err
 			}
 			hashes = hashes[:0]
@@ -106,34 +420,105 @@ func (f *Filestore) Iterate(ctx context.Context, maxBatch int, callback func(has
 	return nil
 }
 
+// IteratesSorted implements filestore.SortedIterator.
+func (f *Filestore) IteratesSorted() bool {
+	return true
+}
+
 // Remove implements filestore.Remover.
-func (f *Filestore) Remove(ctx context.Context, hash string) error {
+func (f *Filestore) Remove(ctx context.Context, hash string) (err error) {
+	defer func() {
+		f.record(Call{Op: OpRemove, Hash: hash, Err: err})
+	}()
+
 	f.mx.Lock()
 	defer f.mx.Unlock()
 
-	if _, ok := f.files[hash]; !ok {
-		return filestore.ErrNotExist
+	storedKey, _, ok := f.lookup(hash)
+	if !ok {
+		return &filestore.NotExistError{Op: "remove", Hash: hash}
 	}
 
-	delete(f.files, hash)
+	f.delete(storedKey)
 
 	return nil
 }
 
 // Size implements filestore.Sizer.
-func (f *Filestore) Size(ctx context.Context, hash string) (int64, error) {
+func (f *Filestore) Size(ctx context.Context, hash string) (size int64, err error) {
+	defer func() {
+		f.record(Call{Op: OpSize, Hash: hash, Err: err})
+	}()
+
+	f.mx.RLock()
+	defer f.mx.RUnlock()
+
+	_, e, ok := f.lookup(hash)
+	if !ok {
+		return 0, &filestore.NotExistError{Op: "size", Hash: hash}
+	}
+
+	return int64(len(e.data)), nil
+}
+
+// Stat implements filestore.Stater. Content type and disposition are retained from readers implementing
+// filestore.ContentTyped or filestore.ContentDispositioned like in the other stores.
+func (f *Filestore) Stat(ctx context.Context, hash string) (info filestore.ObjectInfo, err error) {
+	defer func() {
+		f.record(Call{Op: OpStat, Hash: hash, Err: err})
+	}()
+
 	f.mx.RLock()
 	defer f.mx.RUnlock()
 
-	data, ok := f.files[hash]
+	_, e, ok := f.lookup(hash)
 	if !ok {
-		return 0, filestore.ErrNotExist
+		return filestore.ObjectInfo{}, &filestore.NotExistError{Op: "stat", Hash: hash}
 	}
 
-	return int64(len(data)), nil
+	return filestore.ObjectInfo{
+		Hash:               hash,
+		Size:               int64(len(e.data)),
+		ContentType:        e.metadata.contentType,
+		ContentDisposition: e.metadata.contentDisposition,
+	}, nil
+}
+
+// FetchInfo implements filestore.InfoFetcher.
+func (f *Filestore) FetchInfo(ctx context.Context, hash string) (io.ReadCloser, filestore.ObjectInfo, error) {
+	data, meta, ok := f.touchedEntry(hash)
+	if !ok {
+		err := &filestore.NotExistError{Op: "fetch info", Hash: hash}
+		f.record(Call{Op: OpFetchInfo, Hash: hash, Err: err})
+		return nil, filestore.ObjectInfo{}, err
+	}
+
+	f.record(Call{Op: OpFetchInfo, Hash: hash, Bytes: int64(len(data))})
+	return io.NopCloser(bytes.NewReader(data)), filestore.ObjectInfo{
+		Hash:               hash,
+		Size:               int64(len(data)),
+		ContentType:        meta.contentType,
+		ContentDisposition: meta.contentDisposition,
+	}, nil
+}
+
+// Usage returns the number of stored objects and their total size.
+func (f *Filestore) Usage(ctx context.Context) (filestore.Usage, error) {
+	f.mx.RLock()
+	defer f.mx.RUnlock()
+
+	return filestore.Usage{
+		Objects: int64(len(f.files)),
+		Bytes:   f.totalBytes,
+	}, nil
 }
 
 // ImgproxyURLSource returns a dummy URL to the hash in memory. It should only be used for testing purposes.
 func (f *Filestore) ImgproxyURLSource(hash string) (string, error) {
 	return "memory://" + hash, nil
 }
+
+// FS returns an fs.FS that opens files by hash (e.g. for use with http.FileServer via http.FS).
+func (f *Filestore) FS() fs.FS {
+	return filestore.NewFS(f)
+}
@@ -1,18 +1,22 @@
 package memory_test
 
 import (
+	"bytes"
 	"context"
 	"errors"
 	"fmt"
 	"io"
 	"path"
 	"strings"
+	"sync"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
 
 	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/filestoretest"
+	"github.com/networkteam/filestore/hashing"
 	"github.com/networkteam/filestore/local"
 	"github.com/networkteam/filestore/memory"
 )
@@ -199,3 +203,287 @@ func TestFilestore_Remove(t *testing.T) {
 	err = store.Remove(ctx, "a09595c5d94fb65b824f56e9999527dba9542481580d69feb89056aabaa0aa87")
 	require.ErrorIs(t, err, filestore.ErrNotExist)
 }
+
+func TestFilestore_Eviction(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("LRU with max objects", func(t *testing.T) {
+		var evicted []string
+		store := memory.NewFilestore(
+			memory.WithMaxObjects(2),
+			memory.WithEvictionCallback(func(hash string, size int64) {
+				evicted = append(evicted, hash)
+			}),
+		)
+
+		require.NoError(t, store.StoreHashed(ctx, strings.NewReader("a"), "aa"))
+		require.NoError(t, store.StoreHashed(ctx, strings.NewReader("b"), "bb"))
+
+		// Use aa, so bb is the least recently used
+		r, err := store.Fetch(ctx, "aa")
+		require.NoError(t, err)
+		_ = r.Close()
+
+		require.NoError(t, store.StoreHashed(ctx, strings.NewReader("c"), "cc"))
+
+		assert.Equal(t, []string{"bb"}, evicted)
+		assertExists(t, store, "aa", "cc")
+	})
+
+	t.Run("FIFO with max bytes", func(t *testing.T) {
+		var evictedSize int64
+		store := memory.NewFilestore(
+			memory.WithMaxBytes(10),
+			memory.WithEvictionPolicy(memory.EvictionFIFO),
+			memory.WithEvictionCallback(func(hash string, size int64) {
+				evictedSize += size
+			}),
+		)
+
+		require.NoError(t, store.StoreHashed(ctx, strings.NewReader("aaaa"), "aa"))
+		require.NoError(t, store.StoreHashed(ctx, strings.NewReader("bbbb"), "bb"))
+
+		// Fetch does not change the order with FIFO
+		r, err := store.Fetch(ctx, "aa")
+		require.NoError(t, err)
+		_ = r.Close()
+
+		require.NoError(t, store.StoreHashed(ctx, strings.NewReader("cccccc"), "cc"))
+
+		assert.Equal(t, int64(4), evictedSize)
+		assertExists(t, store, "bb", "cc")
+
+		usage, err := store.Usage(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, filestore.Usage{Objects: 2, Bytes: 10}, usage)
+	})
+
+	t.Run("object larger than max bytes", func(t *testing.T) {
+		store := memory.NewFilestore(memory.WithMaxBytes(4))
+
+		_, err := store.Store(ctx, strings.NewReader("Test content"))
+		assert.ErrorIs(t, err, memory.ErrTooLarge)
+	})
+}
+
+func assertExists(t *testing.T, store *memory.Filestore, expectedHashes ...string) {
+	t.Helper()
+
+	var hashes []string
+	err := store.Iterate(context.Background(), 10, func(batch []string) error {
+		hashes = append(hashes, batch...)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.ElementsMatch(t, expectedHashes, hashes)
+}
+
+func TestFilestore_StoreWithMaxObjectSize(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewFilestore(memory.WithMaxObjectSize(12))
+
+	_, err := store.Store(ctx, strings.NewReader("Test content"))
+	require.NoError(t, err)
+
+	_, err = store.Store(ctx, strings.NewReader("Other test content"))
+	require.ErrorIs(t, err, filestore.ErrTooLarge)
+
+	err = store.StoreHashed(ctx, strings.NewReader("Other test content"), "a0b1c2d3e4f5")
+	require.ErrorIs(t, err, filestore.ErrTooLarge)
+
+	usage, err := store.Usage(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, filestore.Usage{Objects: 1, Bytes: 12}, usage)
+}
+
+func TestFilestore_StoreIfAbsent(t *testing.T) {
+	filestoretest.TestStoreIfAbsent(t, memory.NewFilestore())
+}
+
+func TestFilestore_KeyDerivation(t *testing.T) {
+	derivation := hashing.HMACKeys([]byte("secret"))
+	filestoretest.TestKeyDerivation(t, memory.NewFilestore(memory.WithKeyDerivation(derivation)), derivation)
+}
+
+func TestFilestore_KeyEncoding(t *testing.T) {
+	filestoretest.TestKeyEncoding(t, memory.NewFilestore(memory.WithKeyEncoding(hashing.PrefixedKeys)), hashing.PrefixedKeys)
+}
+
+func TestFilestore_WriteOnce(t *testing.T) {
+	filestoretest.TestWriteOnce(t, memory.NewFilestore(memory.WithWriteOnce()))
+}
+
+func TestFilestore_NotExist(t *testing.T) {
+	filestoretest.TestNotExist(t, memory.NewFilestore())
+}
+
+func TestFilestore_ExistsMany(t *testing.T) {
+	filestoretest.TestExistsMany(t, memory.NewFilestore())
+}
+
+func TestFilestore_FetchInfo(t *testing.T) {
+	filestoretest.TestFetchInfo(t, memory.NewFilestore())
+}
+
+func TestFilestore_FetchRange(t *testing.T) {
+	filestoretest.TestFetchRange(t, memory.NewFilestore())
+}
+
+func TestFilestore_Stat(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewFilestore()
+
+	hash, err := store.Store(ctx, filestore.ContentTypedReader(strings.NewReader("Test content"), "text/plain"))
+	require.NoError(t, err)
+
+	info, err := store.Stat(ctx, hash)
+	require.NoError(t, err)
+	assert.Equal(t, filestore.ObjectInfo{
+		Hash:        hash,
+		Size:        12,
+		ContentType: "text/plain",
+	}, info)
+
+	err = store.StoreHashed(ctx, filestore.ContentDispositionedReader(strings.NewReader("Other content"), "attachment"), "a0b1c2d3e4f5")
+	require.NoError(t, err)
+
+	info, err = store.Stat(ctx, "a0b1c2d3e4f5")
+	require.NoError(t, err)
+	assert.Equal(t, filestore.ObjectInfo{
+		Hash:               "a0b1c2d3e4f5",
+		Size:               13,
+		ContentDisposition: "attachment",
+	}, info)
+
+	_, err = store.Stat(ctx, "not-existing")
+	assert.ErrorIs(t, err, filestore.ErrNotExist)
+}
+
+func TestFilestore_StoreDoesNotBlockReaders(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewFilestore()
+
+	hash, err := store.Store(ctx, strings.NewReader("Test content"))
+	require.NoError(t, err)
+
+	// Start a store with a reader that blocks until the pipe is closed
+	pr, pw := io.Pipe()
+	storeDone := make(chan error, 1)
+	go func() {
+		_, err := store.Store(ctx, pr)
+		storeDone <- err
+	}()
+	_, err = pw.Write([]byte("Partial"))
+	require.NoError(t, err)
+
+	// Reading is possible while the store is still in progress
+	exists, err := store.Exists(ctx, hash)
+	require.NoError(t, err)
+	assert.True(t, exists)
+	r, err := store.Fetch(ctx, hash)
+	require.NoError(t, err)
+	_ = r.Close()
+
+	require.NoError(t, pw.Close())
+	require.NoError(t, <-storeDone)
+}
+
+func TestFilestore_ConcurrentFetchAndStore(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewFilestore()
+
+	hash, err := store.Store(ctx, strings.NewReader("Test content"))
+	require.NoError(t, err)
+
+	// Storing the same content replaces the data of the file while it is fetched (run with -race)
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(2)
+		go func() {
+			defer wg.Done()
+			_, err := store.Store(ctx, strings.NewReader("Test content"))
+			assert.NoError(t, err)
+		}()
+		go func() {
+			defer wg.Done()
+			r, _, err := store.FetchInfo(ctx, hash)
+			if assert.NoError(t, err) {
+				_ = r.Close()
+			}
+			r, err = store.FetchRange(ctx, hash, 5, 4)
+			if assert.NoError(t, err) {
+				content, _ := io.ReadAll(r)
+				assert.Equal(t, "cont", string(content))
+			}
+			r, err = store.Fetch(ctx, hash)
+			if assert.NoError(t, err) {
+				content, _ := io.ReadAll(r)
+				assert.Equal(t, "Test content", string(content))
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func TestFilestore_SaveToLoadFrom(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewFilestore()
+
+	hash, err := store.Store(ctx, filestore.ContentTypedReader(strings.NewReader("Test content"), "text/plain"))
+	require.NoError(t, err)
+	err = store.StoreHashed(ctx, strings.NewReader("Other content"), "a0b1c2d3e4f5")
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	err = store.SaveTo(&buf)
+	require.NoError(t, err)
+
+	restored := memory.NewFilestore()
+	err = restored.LoadFrom(&buf)
+	require.NoError(t, err)
+
+	assertExists(t, restored, hash, "a0b1c2d3e4f5")
+
+	info, err := restored.Stat(ctx, hash)
+	require.NoError(t, err)
+	assert.Equal(t, filestore.ObjectInfo{Hash: hash, Size: 12, ContentType: "text/plain"}, info)
+
+	r, err := restored.Fetch(ctx, "a0b1c2d3e4f5")
+	require.NoError(t, err)
+	defer r.Close()
+	content, err := io.ReadAll(r)
+	require.NoError(t, err)
+	assert.Equal(t, "Other content", string(content))
+}
+
+func TestFilestore_Recording(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewFilestore(memory.WithRecording())
+
+	hash, err := store.Store(ctx, strings.NewReader("Test content"))
+	require.NoError(t, err)
+
+	r, err := store.Fetch(ctx, hash)
+	require.NoError(t, err)
+	_ = r.Close()
+
+	_, err = store.Fetch(ctx, "not-existing")
+	require.ErrorIs(t, err, filestore.ErrNotExist)
+
+	err = store.Remove(ctx, hash)
+	require.NoError(t, err)
+
+	assert.Equal(t, []memory.Call{
+		{Op: memory.OpStore, Hash: hash, Bytes: 12},
+		{Op: memory.OpFetch, Hash: hash, Bytes: 12},
+		{Op: memory.OpFetch, Hash: "not-existing", Err: &filestore.NotExistError{Op: "fetch", Hash: "not-existing"}},
+		{Op: memory.OpRemove, Hash: hash},
+	}, store.Calls())
+	assert.Len(t, store.CallsOf(memory.OpFetch), 2)
+
+	store.ResetCalls()
+	assert.Empty(t, store.Calls())
+
+	// Calls are not recorded without WithRecording
+	assert.Nil(t, memory.NewFilestore().Calls())
+}
@@ -0,0 +1,58 @@
+package memory
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strconv"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/hashing"
+)
+
+func init() {
+	filestore.Register("memory", Open)
+}
+
+// Open opens a new in-memory file store from a DSN like "memory://" for filestore.Open.
+// Supported query parameters are maxBytes, maxObjects, maxObjectSize, writeOnce (true or false)
+// and keyEncoding (hex, prefixed or multihash).
+func Open(ctx context.Context, dsn *url.URL) (filestore.FileStore, error) {
+	params := dsn.Query()
+
+	var opts []Option
+	if maxBytes := params.Get("maxBytes"); maxBytes != "" {
+		n, err := strconv.ParseInt(maxBytes, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parsing maxBytes: %w", err)
+		}
+		opts = append(opts, WithMaxBytes(n))
+	}
+	if maxObjects := params.Get("maxObjects"); maxObjects != "" {
+		n, err := strconv.Atoi(maxObjects)
+		if err != nil {
+			return nil, fmt.Errorf("parsing maxObjects: %w", err)
+		}
+		opts = append(opts, WithMaxObjects(n))
+	}
+	if maxObjectSize := params.Get("maxObjectSize"); maxObjectSize != "" {
+		n, err := strconv.ParseInt(maxObjectSize, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parsing maxObjectSize: %w", err)
+		}
+		opts = append(opts, WithMaxObjectSize(n))
+	}
+
+	if writeOnce, _ := strconv.ParseBool(params.Get("writeOnce")); writeOnce {
+		opts = append(opts, WithWriteOnce())
+	}
+	if keyEncoding := params.Get("keyEncoding"); keyEncoding != "" {
+		encoding, err := hashing.ParseKeyEncoding(keyEncoding)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithKeyEncoding(encoding))
+	}
+
+	return NewFilestore(opts...), nil
+}
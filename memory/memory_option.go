@@ -0,0 +1,99 @@
+package memory
+
+import "github.com/networkteam/filestore/hashing"
+
+type options struct {
+	maxBytes       int64
+	maxObjects     int
+	maxObjectSize  int64
+	evictionPolicy EvictionPolicy
+	onEvict        func(hash string, size int64)
+	recording      bool
+	keyEncoding    hashing.KeyEncoding
+	keyDerivation  hashing.KeyDerivation
+	writeOnce      bool
+}
+
+// Option is a functional option for creating an in-memory file store.
+type Option func(*options)
+
+// EvictionPolicy defines which objects are evicted first if a capacity limit is reached.
+type EvictionPolicy int
+
+const (
+	// EvictionLRU evicts the least recently used (stored or fetched) object first.
+	EvictionLRU EvictionPolicy = iota
+	// EvictionFIFO evicts the oldest stored object first.
+	EvictionFIFO
+)
+
+// WithMaxBytes limits the total size of all stored objects. Objects are evicted according to the eviction policy
+// to make room for new objects. Storing a single object larger than maxBytes fails with ErrTooLarge.
+func WithMaxBytes(maxBytes int64) Option {
+	return func(opts *options) {
+		opts.maxBytes = maxBytes
+	}
+}
+
+// WithMaxObjects limits the number of stored objects. Objects are evicted according to the eviction policy
+// to make room for new objects.
+func WithMaxObjects(maxObjects int) Option {
+	return func(opts *options) {
+		opts.maxObjects = maxObjects
+	}
+}
+
+// WithMaxObjectSize limits the size of a single object. Store and StoreHashed fail with filestore.ErrTooLarge
+// as soon as more than maxObjectSize bytes are read.
+func WithMaxObjectSize(maxObjectSize int64) Option {
+	return func(opts *options) {
+		opts.maxObjectSize = maxObjectSize
+	}
+}
+
+// WithEvictionPolicy sets the eviction policy used if a capacity limit is set (defaults to EvictionLRU).
+func WithEvictionPolicy(policy EvictionPolicy) Option {
+	return func(opts *options) {
+		opts.evictionPolicy = policy
+	}
+}
+
+// WithEvictionCallback sets a callback that is called for every evicted object.
+// It is called after the store was unlocked, so it is safe to access the store from the callback.
+func WithEvictionCallback(onEvict func(hash string, size int64)) Option {
+	return func(opts *options) {
+		opts.onEvict = onEvict
+	}
+}
+
+// WithRecording records every call to the store, so it can be used as a spy in tests (see Filestore.Calls).
+func WithRecording() Option {
+	return func(opts *options) {
+		opts.recording = true
+	}
+}
+
+// WithKeyEncoding sets the encoding of the keys returned by Store (defaults to hashing.HexKeys), e.g.
+// hashing.PrefixedKeys for keys like "sha256-<hex>". Files stored with bare hex keys (e.g. loaded from a snapshot)
+// are still found by the encoded keys.
+func WithKeyEncoding(encoding hashing.KeyEncoding) Option {
+	return func(opts *options) {
+		opts.keyEncoding = encoding
+	}
+}
+
+// WithKeyDerivation derives the keys returned by Store from the content hash, e.g. with hashing.HMACKeys so keys
+// cannot be computed from the content without a secret. The derived hash is encoded with the key encoding.
+func WithKeyDerivation(derivation hashing.KeyDerivation) Option {
+	return func(opts *options) {
+		opts.keyDerivation = derivation
+	}
+}
+
+// WithWriteOnce makes StoreHashed (and StoreIfAbsent) fail with filestore.ErrAlreadyExists if a file with the hash
+// already exists with different content instead of silently keeping the existing file.
+func WithWriteOnce() Option {
+	return func(opts *options) {
+		opts.writeOnce = true
+	}
+}
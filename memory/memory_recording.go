@@ -0,0 +1,84 @@
+package memory
+
+import "sync"
+
+// Op is the name of a recorded operation.
+type Op string
+
+// Recorded operations.
+const (
+	OpStore       Op = "Store"
+	OpStoreHashed Op = "StoreHashed"
+	OpExists      Op = "Exists"
+	OpFetch       Op = "Fetch"
+	OpIterate     Op = "Iterate"
+	OpRemove      Op = "Remove"
+	OpSize        Op = "Size"
+	OpStat        Op = "Stat"
+	OpFetchInfo   Op = "FetchInfo"
+	OpFetchRange  Op = "FetchRange"
+)
+
+// Call is a recorded call to the store.
+type Call struct {
+	Op Op
+	// Hash is the hash of the call (empty for Iterate).
+	Hash string
+	// Bytes is the number of bytes stored or fetched.
+	Bytes int64
+	// Err is the error returned by the call.
+	Err error
+}
+
+type recorder struct {
+	mx    sync.Mutex
+	calls []Call
+}
+
+func (f *Filestore) record(call Call) {
+	if f.recorder == nil {
+		return
+	}
+
+	f.recorder.mx.Lock()
+	defer f.recorder.mx.Unlock()
+
+	f.recorder.calls = append(f.recorder.calls, call)
+}
+
+// Calls returns all recorded calls in order. Only available with WithRecording.
+func (f *Filestore) Calls() []Call {
+	if f.recorder == nil {
+		return nil
+	}
+
+	f.recorder.mx.Lock()
+	defer f.recorder.mx.Unlock()
+
+	calls := make([]Call, len(f.recorder.calls))
+	copy(calls, f.recorder.calls)
+	return calls
+}
+
+// CallsOf returns all recorded calls of the given operation in order.
+func (f *Filestore) CallsOf(op Op) []Call {
+	var calls []Call
+	for _, call := range f.Calls() {
+		if call.Op == op {
+			calls = append(calls, call)
+		}
+	}
+	return calls
+}
+
+// ResetCalls removes all recorded calls.
+func (f *Filestore) ResetCalls() {
+	if f.recorder == nil {
+		return
+	}
+
+	f.recorder.mx.Lock()
+	defer f.recorder.mx.Unlock()
+
+	f.recorder.calls = nil
+}
@@ -0,0 +1,102 @@
+package memory
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// PAX record keys for metadata of files in a snapshot.
+const (
+	paxContentType        = "NETWORKTEAM.filestore.contentType"
+	paxContentDisposition = "NETWORKTEAM.filestore.contentDisposition"
+)
+
+// SaveTo writes all files of the store as a tar archive to w. Every file is stored as an entry named by its hash,
+// content type and disposition are stored as PAX records.
+func (f *Filestore) SaveTo(w io.Writer) error {
+	f.mx.RLock()
+	defer f.mx.RUnlock()
+
+	hashes := make([]string, 0, len(f.files))
+	for hash := range f.files {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+
+	tw := tar.NewWriter(w)
+	for _, hash := range hashes {
+		e := f.files[hash]
+
+		hdr := &tar.Header{
+			Typeflag: tar.TypeReg,
+			Name:     hash,
+			Mode:     0644,
+			Size:     int64(len(e.data)),
+			Format:   tar.FormatPAX,
+		}
+		if e.metadata != (metadata{}) {
+			hdr.PAXRecords = make(map[string]string)
+			if e.metadata.contentType != "" {
+				hdr.PAXRecords[paxContentType] = e.metadata.contentType
+			}
+			if e.metadata.contentDisposition != "" {
+				hdr.PAXRecords[paxContentDisposition] = e.metadata.contentDisposition
+			}
+		}
+
+		if err := tw.WriteHeader(hdr); err != nil {
+			return fmt.Errorf("writing header of %s: %w", hash, err)
+		}
+		if _, err := tw.Write(e.data); err != nil {
+			return fmt.Errorf("writing %s: %w", hash, err)
+		}
+	}
+
+	if err := tw.Close(); err != nil {
+		return fmt.Errorf("closing archive: %w", err)
+	}
+	return nil
+}
+
+// LoadFrom reads files from a tar archive written by SaveTo and adds them to the store.
+// Existing files are kept, files with the same hash are replaced.
+func (f *Filestore) LoadFrom(r io.Reader) error {
+	f.mx.Lock()
+	var evictions []evicted
+	defer func() {
+		f.mx.Unlock()
+		f.notifyEvicted(evictions)
+	}()
+
+	tr := tar.NewReader(r)
+	for {
+		hdr, err := tr.Next()
+		if errors.Is(err, io.EOF) {
+			return nil
+		}
+		if err != nil {
+			return fmt.Errorf("reading archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+
+		data, err := io.ReadAll(tr)
+		if err != nil {
+			return fmt.Errorf("reading %s: %w", hdr.Name, err)
+		}
+		meta := metadata{
+			contentType:        hdr.PAXRecords[paxContentType],
+			contentDisposition: hdr.PAXRecords[paxContentDisposition],
+		}
+
+		putEvictions, err := f.put(hdr.Name, data, meta)
+		evictions = append(evictions, putEvictions...)
+		if err != nil {
+			return fmt.Errorf("storing %s: %w", hdr.Name, err)
+		}
+	}
+}
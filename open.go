@@ -0,0 +1,104 @@
+package filestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// ErrUnknownScheme is returned by Open if no backend is registered for the scheme of the DSN.
+var ErrUnknownScheme = errors.New("unknown file store scheme")
+
+// ErrUnknownWrapper is returned by Open if no wrapper is registered for a name in the wrap query parameter.
+var ErrUnknownWrapper = errors.New("unknown file store wrapper")
+
+// An OpenFunc opens a file store from a parsed DSN.
+type OpenFunc func(ctx context.Context, dsn *url.URL) (FileStore, error)
+
+// A WrapFunc wraps a file store opened by Open. It gets the query parameters of the DSN for its configuration.
+type WrapFunc func(ctx context.Context, store FileStore, params url.Values) (FileStore, error)
+
+var (
+	registryMx sync.RWMutex
+	backends   = make(map[string]OpenFunc)
+	wrappers   = make(map[string]WrapFunc)
+)
+
+// Register registers a backend for a DSN scheme. It is called by backend packages in an init function,
+// so a backend must be imported (e.g. import _ "github.com/networkteam/filestore/s3") to be used with Open.
+func Register(scheme string, open OpenFunc) {
+	registryMx.Lock()
+	defer registryMx.Unlock()
+
+	backends[scheme] = open
+}
+
+// RegisterWrapper registers a wrapper that can be applied by Open with the wrap query parameter.
+func RegisterWrapper(name string, wrap WrapFunc) {
+	registryMx.Lock()
+	defer registryMx.Unlock()
+
+	wrappers[name] = wrap
+}
+
+// Open opens a file store from a DSN like:
+//
+//	local:///var/assets?tmp=/var/tmp
+//	s3://key:secret@endpoint/bucket?region=eu-central-1&secure=true
+//	memory://
+//
+// The backends are registered by their packages (see Register), the supported query parameters are documented
+// by the packages. Wrappers are applied in order with the wrap query parameter (e.g. "wrap=clamav,other"
+// or multiple wrap parameters), see RegisterWrapper.
+func Open(ctx context.Context, dsn string) (FileStore, error) {
+	u, err := url.Parse(dsn)
+	if err != nil {
+		return nil, fmt.Errorf("parsing DSN: %w", err)
+	}
+
+	registryMx.RLock()
+	open, ok := backends[u.Scheme]
+	registryMx.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("%w: %q (registered: %s)", ErrUnknownScheme, u.Scheme, strings.Join(registeredSchemes(), ", "))
+	}
+
+	store, err := open(ctx, u)
+	if err != nil {
+		return nil, fmt.Errorf("opening %s file store: %w", u.Scheme, err)
+	}
+
+	params := u.Query()
+	for _, wrapParam := range params["wrap"] {
+		for _, name := range strings.Split(wrapParam, ",") {
+			registryMx.RLock()
+			wrap, ok := wrappers[name]
+			registryMx.RUnlock()
+			if !ok {
+				return nil, fmt.Errorf("%w: %q", ErrUnknownWrapper, name)
+			}
+
+			if store, err = wrap(ctx, store, params); err != nil {
+				return nil, fmt.Errorf("wrapping file store with %s: %w", name, err)
+			}
+		}
+	}
+
+	return store, nil
+}
+
+func registeredSchemes() []string {
+	registryMx.RLock()
+	defer registryMx.RUnlock()
+
+	schemes := make([]string, 0, len(backends))
+	for scheme := range backends {
+		schemes = append(schemes, scheme)
+	}
+	sort.Strings(schemes)
+	return schemes
+}
@@ -0,0 +1,55 @@
+package filestore_test
+
+import (
+	"context"
+	"net/url"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/local"
+	"github.com/networkteam/filestore/memory"
+)
+
+func TestOpen(t *testing.T) {
+	ctx := context.Background()
+
+	t.Run("memory", func(t *testing.T) {
+		store, err := filestore.Open(ctx, "memory://?maxObjects=10")
+		require.NoError(t, err)
+		assert.IsType(t, &memory.Filestore{}, store)
+	})
+
+	t.Run("local", func(t *testing.T) {
+		testDir := t.TempDir()
+
+		store, err := filestore.Open(ctx, "local://"+path.Join(testDir, "assets")+"?tmp="+url.QueryEscape(path.Join(testDir, "tmp"))+"&readonly=false")
+		require.NoError(t, err)
+		assert.IsType(t, &local.Filestore{}, store)
+		assert.DirExists(t, path.Join(testDir, "assets"))
+	})
+
+	t.Run("wrapper", func(t *testing.T) {
+		var wrapped filestore.FileStore
+		filestore.RegisterWrapper("test", func(ctx context.Context, store filestore.FileStore, params url.Values) (filestore.FileStore, error) {
+			wrapped = store
+			assert.Equal(t, "value", params.Get("option"))
+			return store, nil
+		})
+
+		store, err := filestore.Open(ctx, "memory://?wrap=test&option=value")
+		require.NoError(t, err)
+		assert.Same(t, wrapped, store)
+
+		_, err = filestore.Open(ctx, "memory://?wrap=unknown")
+		assert.ErrorIs(t, err, filestore.ErrUnknownWrapper)
+	})
+
+	t.Run("unknown scheme", func(t *testing.T) {
+		_, err := filestore.Open(ctx, "ftp://example.com/assets")
+		assert.ErrorIs(t, err, filestore.ErrUnknownScheme)
+	})
+}
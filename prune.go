@@ -0,0 +1,128 @@
+package filestore
+
+import (
+	"context"
+	"errors"
+	"fmt"
+)
+
+// DefaultPruneBatchSize is the default number of files removed with one call by Prune.
+const DefaultPruneBatchSize = 1000
+
+// A PruneStore can iterate, remove and return the size of files.
+type PruneStore interface {
+	Iterator
+	Remover
+	Sizer
+}
+
+// PruneResult describes the files removed by Prune (or that would be removed in a dry run).
+type PruneResult struct {
+	Removed int
+	Bytes   int64
+}
+
+type pruneOptions struct {
+	dryRun    bool
+	batchSize int
+}
+
+// PruneOption is a functional option for Prune.
+type PruneOption func(*pruneOptions)
+
+// WithDryRun only reports the files that would be removed by Prune without removing them.
+func WithDryRun() PruneOption {
+	return func(opts *pruneOptions) {
+		opts.dryRun = true
+	}
+}
+
+// WithPruneBatchSize sets the number of files removed with one call if the store implements BatchRemover
+// (defaults to DefaultPruneBatchSize).
+func WithPruneBatchSize(batchSize int) PruneOption {
+	return func(opts *pruneOptions) {
+		opts.batchSize = batchSize
+	}
+}
+
+// Prune removes all files of store for which keep returns false and returns the number and total size of the
+// removed files. Files are removed in batches with RemoveBatch if store implements BatchRemover.
+// The hashes to remove are collected while iterating and removed afterwards, so stores do not need to support
+// removing files while iterating. Files that were removed concurrently are skipped.
+func Prune(ctx context.Context, store PruneStore, keep func(hash string) bool, opts ...PruneOption) (PruneResult, error) {
+	o := pruneOptions{batchSize: DefaultPruneBatchSize}
+	for _, opt := range opts {
+		opt(&o)
+	}
+	if o.batchSize < 1 {
+		o.batchSize = 1
+	}
+
+	var (
+		result PruneResult
+		hashes []string
+	)
+	err := store.Iterate(ctx, o.batchSize, func(batch []string) error {
+		for _, hash := range batch {
+			if !keep(hash) {
+				hashes = append(hashes, hash)
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return result, fmt.Errorf("iterating files: %w", err)
+	}
+
+	for start := 0; start < len(hashes); start += o.batchSize {
+		if err := ctx.Err(); err != nil {
+			return result, err
+		}
+
+		end := start + o.batchSize
+		if end > len(hashes) {
+			end = len(hashes)
+		}
+		batch := make([]string, 0, end-start)
+		var bytes int64
+		for _, hash := range hashes[start:end] {
+			size, err := store.Size(ctx, hash)
+			if errors.Is(err, ErrNotExist) {
+				continue
+			}
+			if err != nil {
+				return result, fmt.Errorf("getting size of %s: %w", hash, err)
+			}
+			batch = append(batch, hash)
+			bytes += size
+		}
+
+		if !o.dryRun {
+			if err := removeBatch(ctx, store, batch); err != nil {
+				return result, err
+			}
+		}
+		result.Removed += len(batch)
+		result.Bytes += bytes
+	}
+
+	return result, nil
+}
+
+func removeBatch(ctx context.Context, store PruneStore, hashes []string) error {
+	if len(hashes) == 0 {
+		return nil
+	}
+	if batchRemover, ok := store.(BatchRemover); ok {
+		if err := batchRemover.RemoveBatch(ctx, hashes); err != nil {
+			return fmt.Errorf("removing batch: %w", err)
+		}
+		return nil
+	}
+	for _, hash := range hashes {
+		if err := store.Remove(ctx, hash); err != nil && !errors.Is(err, ErrNotExist) {
+			return fmt.Errorf("removing %s: %w", hash, err)
+		}
+	}
+	return nil
+}
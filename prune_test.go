@@ -0,0 +1,91 @@
+package filestore_test
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/memory"
+)
+
+func TestPrune(t *testing.T) {
+	ctx := context.Background()
+
+	newStore := func(t *testing.T) (*memory.Filestore, map[string]bool) {
+		store := memory.NewFilestore()
+		keep := make(map[string]bool)
+		for i := 0; i < 10; i++ {
+			hash, err := store.Store(ctx, strings.NewReader(fmt.Sprintf("Content %d", i)))
+			require.NoError(t, err)
+			keep[hash] = i%2 == 0
+		}
+		return store, keep
+	}
+
+	t.Run("removes rejected files", func(t *testing.T) {
+		store, keep := newStore(t)
+
+		result, err := filestore.Prune(ctx, store, func(hash string) bool {
+			return keep[hash]
+		}, filestore.WithPruneBatchSize(2))
+		require.NoError(t, err)
+		assert.Equal(t, filestore.PruneResult{Removed: 5, Bytes: 45}, result)
+
+		for hash, kept := range keep {
+			exists, err := store.Exists(ctx, hash)
+			require.NoError(t, err)
+			assert.Equal(t, kept, exists)
+		}
+	})
+
+	t.Run("dry run", func(t *testing.T) {
+		store, keep := newStore(t)
+
+		result, err := filestore.Prune(ctx, store, func(hash string) bool {
+			return keep[hash]
+		}, filestore.WithDryRun())
+		require.NoError(t, err)
+		assert.Equal(t, filestore.PruneResult{Removed: 5, Bytes: 45}, result)
+
+		usage, err := store.Usage(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(10), usage.Objects)
+	})
+
+	t.Run("BatchRemover", func(t *testing.T) {
+		store, keep := newStore(t)
+		batchStore := &batchRemoverStore{Filestore: store}
+
+		result, err := filestore.Prune(ctx, batchStore, func(hash string) bool {
+			return keep[hash]
+		}, filestore.WithPruneBatchSize(3))
+		require.NoError(t, err)
+		assert.Equal(t, 5, result.Removed)
+		assert.Equal(t, []int{3, 2}, batchStore.batches)
+
+		usage, err := store.Usage(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, int64(5), usage.Objects)
+	})
+}
+
+// batchRemoverStore records the sizes of removed batches.
+type batchRemoverStore struct {
+	*memory.Filestore
+	batches []int
+}
+
+func (s *batchRemoverStore) RemoveBatch(ctx context.Context, hashes []string) error {
+	s.batches = append(s.batches, len(hashes))
+	for _, hash := range hashes {
+		if err := s.Remove(ctx, hash); err != nil {
+			return err
+		}
+	}
+	return nil
+}
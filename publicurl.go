@@ -0,0 +1,17 @@
+package filestore
+
+import (
+	"net/url"
+	"strings"
+)
+
+// ExpandPublicURL returns the public URL of a hash for a URL template, e.g. for implementations of PublicURLer.
+// The placeholder "{hash}" in the template is replaced by the path escaped hash. If the template has no placeholder,
+// the hash is appended as the last path element (e.g. to a CDN base URL like "https://cdn.example.com/assets").
+func ExpandPublicURL(template, hash string) string {
+	escapedHash := url.PathEscape(hash)
+	if strings.Contains(template, "{hash}") {
+		return strings.ReplaceAll(template, "{hash}", escapedHash)
+	}
+	return strings.TrimRight(template, "/") + "/" + escapedHash
+}
@@ -0,0 +1,27 @@
+package filestore_test
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/networkteam/filestore"
+)
+
+func TestExpandPublicURL(t *testing.T) {
+	for _, test := range []struct {
+		name     string
+		template string
+		hash     string
+		expected string
+	}{
+		{name: "base URL", template: "https://cdn.example.com/assets", hash: "abc", expected: "https://cdn.example.com/assets/abc"},
+		{name: "base URL with slash", template: "https://cdn.example.com/assets/", hash: "abc", expected: "https://cdn.example.com/assets/abc"},
+		{name: "template", template: "https://example.com/files/{hash}?download=1", hash: "abc", expected: "https://example.com/files/abc?download=1"},
+		{name: "escaped hash", template: "/assets/{hash}", hash: "a b", expected: "/assets/a%20b"},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			assert.Equal(t, test.expected, filestore.ExpandPublicURL(test.template, test.hash))
+		})
+	}
+}
@@ -0,0 +1,216 @@
+package filestore
+
+import "io"
+
+// Sized is a reader that can return the size of the data.
+type Sized interface {
+	// Size of the data that can be read.
+	Size() int64
+}
+
+// ContentTyped is a reader that also returns the content type of the data.
+type ContentTyped interface {
+	// ContentType (media type) of the data.
+	ContentType() string
+}
+
+// ContentDispositioned is a reader that also returns the content disposition of the data.
+type ContentDispositioned interface {
+	// ContentDisposition of the data (e.g. "inline; filename=\"test.png\"").
+	ContentDisposition() string
+}
+
+// Hashed is a reader that also returns the expected (hex encoded SHA256) hash of the data.
+type Hashed interface {
+	// Hash of the data that will be read.
+	Hash() string
+}
+
+// SizedReader wraps a reader and its size of the data to implement Sized.
+func SizedReader(r io.Reader, size int64) io.Reader {
+	return &sizedReader{r, size}
+}
+
+type sizedReader struct {
+	io.Reader
+	size int64
+}
+
+func (s *sizedReader) Size() int64 {
+	return s.size
+}
+
+var _ Sized = &sizedReader{}
+
+// ContentTypedReader wraps a reader and its content type to implement ContentTyped.
+func ContentTypedReader(r io.Reader, contentType string) io.Reader {
+	return &contentTypedReader{r, contentType}
+}
+
+type contentTypedReader struct {
+	io.Reader
+	contentType string
+}
+
+func (s *contentTypedReader) ContentType() string {
+	return s.contentType
+}
+
+var _ ContentTyped = &contentTypedReader{}
+
+// ContentDispositionedReader wraps a reader and its content disposition to implement ContentDispositioned.
+func ContentDispositionedReader(r io.Reader, contentDisposition string) io.Reader {
+	return &contentDispositionedReader{r, contentDisposition}
+}
+
+type contentDispositionedReader struct {
+	io.Reader
+	contentDisposition string
+}
+
+func (s *contentDispositionedReader) ContentDisposition() string {
+	return s.contentDisposition
+}
+
+var _ ContentDispositioned = &contentDispositionedReader{}
+
+// HashedReader wraps a reader and the expected hash of the data to implement Hashed.
+func HashedReader(r io.Reader, hash string) io.Reader {
+	return &hashedReader{r, hash}
+}
+
+type hashedReader struct {
+	io.Reader
+	hash string
+}
+
+func (s *hashedReader) Hash() string {
+	return s.hash
+}
+
+var _ Hashed = &hashedReader{}
+
+// ReaderOption sets information about the data of a reader created by NewReader.
+type ReaderOption func(*readerOptions)
+
+type readerOptions struct {
+	size               int64
+	contentType        string
+	contentDisposition string
+}
+
+// WithSize sets the size of the data, so the reader implements Sized.
+func WithSize(size int64) ReaderOption {
+	return func(opts *readerOptions) {
+		opts.size = size
+	}
+}
+
+// WithContentType sets the content type of the data.
+func WithContentType(contentType string) ReaderOption {
+	return func(opts *readerOptions) {
+		opts.contentType = contentType
+	}
+}
+
+// WithContentDisposition sets the content disposition of the data.
+func WithContentDisposition(contentDisposition string) ReaderOption {
+	return func(opts *readerOptions) {
+		opts.contentDisposition = contentDisposition
+	}
+}
+
+// WithFilename sets an attachment content disposition for the given raw filename (see ContentDisposition).
+func WithFilename(filename string) ReaderOption {
+	return func(opts *readerOptions) {
+		opts.contentDisposition = ContentDisposition("attachment", filename)
+	}
+}
+
+// NewReader wraps a reader with information about its data that is used by all filestore implementations.
+// The returned reader implements ContentTyped and ContentDispositioned and also Sized if WithSize was given and
+// io.Seeker if r implements it. The wrapped reader is returned by UnwrapReader (e.g. to link an *os.File).
+func NewReader(r io.Reader, opts ...ReaderOption) io.Reader {
+	options := readerOptions{size: -1}
+	for _, opt := range opts {
+		opt(&options)
+	}
+
+	lr := &labeledReader{
+		Reader:             r,
+		contentType:        options.contentType,
+		contentDisposition: options.contentDisposition,
+	}
+	_, seekable := r.(io.Seeker)
+	if options.size >= 0 {
+		sr := &sizedLabeledReader{labeledReader: lr, size: options.size}
+		if seekable {
+			return &seekableSizedLabeledReader{sr}
+		}
+		return sr
+	}
+	if seekable {
+		return &seekableLabeledReader{lr}
+	}
+	return lr
+}
+
+// UnwrapReader returns the reader wrapped by NewReader or r for other readers. Stores use it to access the underlying
+// reader (e.g. an *os.File) while still reading the information about the data from r.
+func UnwrapReader(r io.Reader) io.Reader {
+	if lr, ok := r.(interface{ unwrap() io.Reader }); ok {
+		return lr.unwrap()
+	}
+	return r
+}
+
+type labeledReader struct {
+	io.Reader
+	contentType        string
+	contentDisposition string
+}
+
+func (r *labeledReader) unwrap() io.Reader {
+	return r.Reader
+}
+
+func (r *labeledReader) ContentType() string {
+	return r.contentType
+}
+
+func (r *labeledReader) ContentDisposition() string {
+	return r.contentDisposition
+}
+
+type sizedLabeledReader struct {
+	*labeledReader
+	size int64
+}
+
+func (r *sizedLabeledReader) Size() int64 {
+	return r.size
+}
+
+type seekableLabeledReader struct {
+	*labeledReader
+}
+
+func (r *seekableLabeledReader) Seek(offset int64, whence int) (int64, error) {
+	return r.Reader.(io.Seeker).Seek(offset, whence)
+}
+
+type seekableSizedLabeledReader struct {
+	*sizedLabeledReader
+}
+
+func (r *seekableSizedLabeledReader) Seek(offset int64, whence int) (int64, error) {
+	return r.Reader.(io.Seeker).Seek(offset, whence)
+}
+
+var (
+	_ ContentTyped         = &labeledReader{}
+	_ ContentDispositioned = &labeledReader{}
+	_ Sized                = &sizedLabeledReader{}
+	_ io.Seeker            = &seekableLabeledReader{}
+	_ io.Seeker            = &seekableSizedLabeledReader{}
+)
@@ -0,0 +1,96 @@
+package filestore_test
+
+import (
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/networkteam/filestore"
+)
+
+func TestNewReader(t *testing.T) {
+	t.Run("with all options", func(t *testing.T) {
+		r := filestore.NewReader(
+			strings.NewReader("Hello World"),
+			filestore.WithSize(11),
+			filestore.WithContentType("text/plain"),
+			filestore.WithFilename("hello world.txt"),
+		)
+
+		require.Implements(t, (*filestore.Sized)(nil), r)
+		assert.Equal(t, int64(11), r.(filestore.Sized).Size())
+		require.Implements(t, (*filestore.ContentTyped)(nil), r)
+		assert.Equal(t, "text/plain", r.(filestore.ContentTyped).ContentType())
+		require.Implements(t, (*filestore.ContentDispositioned)(nil), r)
+		assert.Equal(t, `attachment; filename="hello world.txt"`, r.(filestore.ContentDispositioned).ContentDisposition())
+
+		content, err := io.ReadAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, "Hello World", string(content))
+	})
+
+	t.Run("without size", func(t *testing.T) {
+		r := filestore.NewReader(strings.NewReader("Hello World"), filestore.WithContentDisposition("inline"))
+
+		_, sized := r.(filestore.Sized)
+		assert.False(t, sized, "reader should not implement Sized")
+		assert.Equal(t, "inline", r.(filestore.ContentDispositioned).ContentDisposition())
+		assert.Empty(t, r.(filestore.ContentTyped).ContentType())
+	})
+
+	t.Run("seekable", func(t *testing.T) {
+		source := strings.NewReader("Hello World")
+		r := filestore.NewReader(source, filestore.WithSize(11), filestore.WithContentType("text/plain"))
+
+		require.Implements(t, (*io.Seeker)(nil), r)
+		content, err := io.ReadAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, "Hello World", string(content))
+		_, err = r.(io.Seeker).Seek(6, io.SeekStart)
+		require.NoError(t, err)
+		content, err = io.ReadAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, "World", string(content))
+
+		assert.Same(t, source, filestore.UnwrapReader(r))
+	})
+
+	t.Run("not seekable", func(t *testing.T) {
+		r := filestore.NewReader(io.LimitReader(strings.NewReader("Hello World"), 5))
+
+		_, seekable := r.(io.Seeker)
+		assert.False(t, seekable, "reader should not implement io.Seeker")
+	})
+}
+
+func TestContentDisposition(t *testing.T) {
+	tests := []struct {
+		name            string
+		dispositionType string
+		filename        string
+		expected        string
+	}{
+		{"ascii", "attachment", "report.pdf", `attachment; filename="report.pdf"`},
+		{"inline", "inline", "image.png", `inline; filename="image.png"`},
+		{"empty filename", "attachment", "", `attachment`},
+		{"quotes and backslash", "attachment", `a "b".txt`, `attachment; filename="a \"b\".txt"`},
+		{"directories removed", "attachment", `C:\Users\me\report.pdf`, `attachment; filename="report.pdf"`},
+		{"non-ascii", "attachment", "Übersicht 2023 €.pdf", `attachment; filename="_bersicht 2023 _.pdf"; filename*=UTF-8''%C3%9Cbersicht%202023%20%E2%82%AC.pdf`},
+		{"control characters", "attachment", "a\nb.txt", `attachment; filename="a_b.txt"; filename*=UTF-8''a%0Ab.txt`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			assert.Equal(t, tt.expected, filestore.ContentDisposition(tt.dispositionType, tt.filename))
+		})
+	}
+}
+
+func TestFilenameReader(t *testing.T) {
+	r := filestore.FilenameReader(strings.NewReader("Hello World"), "grüße.txt")
+
+	require.Implements(t, (*filestore.ContentDispositioned)(nil), r)
+	assert.Equal(t, `attachment; filename="gr__e.txt"; filename*=UTF-8''gr%C3%BC%C3%9Fe.txt`, r.(filestore.ContentDispositioned).ContentDisposition())
+}
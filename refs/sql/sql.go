@@ -0,0 +1,337 @@
+// Package sql records references from application entities (owners) to stored files in a database table,
+// so that unreferenced files can be removed with filestore.Prune:
+//
+//	refs, err := sql.New(db) // e.g. a *sql.DB opened with the pgx stdlib driver
+//	err = refs.CreateSchema(ctx)
+//	err = refs.Add(ctx, sql.Owner{Type: "article", ID: articleID}, imageHash)
+//
+//	keep, err := refs.Keep(ctx)
+//	result, err := filestore.Prune(ctx, store, keep)
+//
+// The queries work with database/sql for PostgreSQL (e.g. pgx via github.com/jackc/pgx/v5/stdlib), MySQL and
+// SQLite. Applications using pgx directly can execute the statements returned by Queries.
+package sql
+
+import (
+	"context"
+	dbsql "database/sql"
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// DefaultTable is the default name of the references table.
+const DefaultTable = "filestore_refs"
+
+var (
+	// ErrInvalidTable is returned by New for table names that are not plain (optionally schema qualified) identifiers.
+	ErrInvalidTable = errors.New("invalid table name")
+	// ErrInvalidOwner is returned if the type or ID of an owner is empty.
+	ErrInvalidOwner = errors.New("owner type and id must be set")
+)
+
+var tableRegexp = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)?$`)
+
+// Dialect selects the SQL syntax of the queries.
+type Dialect int
+
+const (
+	// Postgres uses numbered placeholders ($1) and ON CONFLICT DO NOTHING.
+	Postgres Dialect = iota
+	// MySQL uses ? placeholders and INSERT IGNORE.
+	MySQL
+	// SQLite uses ? placeholders and INSERT OR IGNORE.
+	SQLite
+)
+
+// DB executes statements, it is implemented by *sql.DB, *sql.Tx and *sql.Conn.
+type DB interface {
+	ExecContext(ctx context.Context, query string, args ...any) (dbsql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*dbsql.Rows, error)
+}
+
+// Owner identifies the application entity referencing a file (e.g. Type "article" and the ID of the article).
+type Owner struct {
+	Type string
+	ID   string
+}
+
+func (o Owner) validate() error {
+	if o.Type == "" || o.ID == "" {
+		return ErrInvalidOwner
+	}
+	return nil
+}
+
+// QuerySet contains the statements used for a table and dialect.
+// Placeholders are bound in the order given in the field comments.
+type QuerySet struct {
+	// Schema creates the table and index if they do not exist.
+	Schema []string
+	// Insert adds a reference (hash, owner type, owner ID) and ignores existing references.
+	Insert string
+	// Delete removes a reference (hash, owner type, owner ID).
+	Delete string
+	// DeleteOwner removes all references of an owner (owner type, owner ID).
+	DeleteOwner string
+	// SelectOwner selects the hashes referenced by an owner (owner type, owner ID).
+	SelectOwner string
+	// SelectHash selects the owners (type and ID) of a hash (hash).
+	SelectHash string
+	// SelectHashes selects all distinct referenced hashes.
+	SelectHashes string
+}
+
+// Queries returns the statements for the given table and dialect.
+func Queries(table string, dialect Dialect) (QuerySet, error) {
+	if !tableRegexp.MatchString(table) {
+		return QuerySet{}, fmt.Errorf("%w: %q", ErrInvalidTable, table)
+	}
+
+	placeholder := func(n int) string {
+		if dialect == Postgres {
+			return "$" + strconv.Itoa(n)
+		}
+		return "?"
+	}
+	placeholders := func(n int) string {
+		p := make([]string, n)
+		for i := range p {
+			p[i] = placeholder(i + 1)
+		}
+		return strings.Join(p, ", ")
+	}
+
+	index := strings.ReplaceAll(table, ".", "_") + "_hash_idx"
+	columns := []string{
+		"hash VARCHAR(128) NOT NULL",
+		"owner_type VARCHAR(64) NOT NULL",
+		"owner_id VARCHAR(255) NOT NULL",
+		"created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP",
+		"PRIMARY KEY (owner_type, owner_id, hash)",
+	}
+	createIndex := "CREATE INDEX IF NOT EXISTS " + index + " ON " + table + " (hash)"
+	switch dialect {
+	case Postgres:
+		columns[3] = "created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP"
+		// Index names are schema local in PostgreSQL
+		if _, name, ok := strings.Cut(table, "."); ok {
+			createIndex = "CREATE INDEX IF NOT EXISTS " + name + "_hash_idx ON " + table + " (hash)"
+		}
+	case MySQL:
+		// MySQL does not support IF NOT EXISTS for indexes, so the index is part of the table
+		columns = append(columns, "INDEX "+index+" (hash)")
+		createIndex = ""
+	}
+
+	q := QuerySet{
+		Schema:       []string{"CREATE TABLE IF NOT EXISTS " + table + " (" + strings.Join(columns, ", ") + ")"},
+		Delete:       "DELETE FROM " + table + " WHERE hash = " + placeholder(1) + " AND owner_type = " + placeholder(2) + " AND owner_id = " + placeholder(3),
+		DeleteOwner:  "DELETE FROM " + table + " WHERE owner_type = " + placeholder(1) + " AND owner_id = " + placeholder(2),
+		SelectOwner:  "SELECT hash FROM " + table + " WHERE owner_type = " + placeholder(1) + " AND owner_id = " + placeholder(2) + " ORDER BY hash",
+		SelectHash:   "SELECT owner_type, owner_id FROM " + table + " WHERE hash = " + placeholder(1) + " ORDER BY owner_type, owner_id",
+		SelectHashes: "SELECT DISTINCT hash FROM " + table,
+	}
+	if createIndex != "" {
+		q.Schema = append(q.Schema, createIndex)
+	}
+
+	insert := "INTO " + table + " (hash, owner_type, owner_id) VALUES (" + placeholders(3) + ")"
+	switch dialect {
+	case Postgres:
+		q.Insert = "INSERT " + insert + " ON CONFLICT DO NOTHING"
+	case MySQL:
+		q.Insert = "INSERT IGNORE " + insert
+	case SQLite:
+		q.Insert = "INSERT OR IGNORE " + insert
+	}
+
+	return q, nil
+}
+
+type options struct {
+	table   string
+	dialect Dialect
+}
+
+// Option is a functional option for New.
+type Option func(*options)
+
+// WithTable sets the name of the references table (defaults to DefaultTable).
+func WithTable(table string) Option {
+	return func(opts *options) {
+		opts.table = table
+	}
+}
+
+// WithDialect sets the SQL dialect (defaults to Postgres).
+func WithDialect(dialect Dialect) Option {
+	return func(opts *options) {
+		opts.dialect = dialect
+	}
+}
+
+// Refs records references to files in a database table.
+type Refs struct {
+	db      DB
+	queries QuerySet
+}
+
+// New creates references for the given database.
+func New(db DB, opts ...Option) (*Refs, error) {
+	o := options{table: DefaultTable}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	queries, err := Queries(o.table, o.dialect)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Refs{
+		db:      db,
+		queries: queries,
+	}, nil
+}
+
+// CreateSchema creates the references table if it does not exist.
+func (r *Refs) CreateSchema(ctx context.Context) error {
+	for _, query := range r.queries.Schema {
+		if _, err := r.db.ExecContext(ctx, query); err != nil {
+			return fmt.Errorf("creating schema: %w", err)
+		}
+	}
+	return nil
+}
+
+// Add adds references from owner to the given hashes. Existing references are ignored.
+func (r *Refs) Add(ctx context.Context, owner Owner, hashes ...string) error {
+	if err := owner.validate(); err != nil {
+		return err
+	}
+	for _, hash := range hashes {
+		if _, err := r.db.ExecContext(ctx, r.queries.Insert, hash, owner.Type, owner.ID); err != nil {
+			return fmt.Errorf("adding reference to %s: %w", hash, err)
+		}
+	}
+	return nil
+}
+
+// Remove removes references from owner to the given hashes.
+func (r *Refs) Remove(ctx context.Context, owner Owner, hashes ...string) error {
+	if err := owner.validate(); err != nil {
+		return err
+	}
+	for _, hash := range hashes {
+		if _, err := r.db.ExecContext(ctx, r.queries.Delete, hash, owner.Type, owner.ID); err != nil {
+			return fmt.Errorf("removing reference to %s: %w", hash, err)
+		}
+	}
+	return nil
+}
+
+// RemoveOwner removes all references of owner (e.g. after the entity was deleted).
+func (r *Refs) RemoveOwner(ctx context.Context, owner Owner) error {
+	if err := owner.validate(); err != nil {
+		return err
+	}
+	if _, err := r.db.ExecContext(ctx, r.queries.DeleteOwner, owner.Type, owner.ID); err != nil {
+		return fmt.Errorf("removing references: %w", err)
+	}
+	return nil
+}
+
+// Set replaces the references of owner with the given hashes.
+// It should be called with a *sql.Tx, so the references are replaced atomically.
+func (r *Refs) Set(ctx context.Context, owner Owner, hashes ...string) error {
+	if err := r.RemoveOwner(ctx, owner); err != nil {
+		return err
+	}
+	return r.Add(ctx, owner, hashes...)
+}
+
+// Hashes returns the hashes referenced by owner.
+func (r *Refs) Hashes(ctx context.Context, owner Owner) ([]string, error) {
+	if err := owner.validate(); err != nil {
+		return nil, err
+	}
+	var hashes []string
+	err := r.query(ctx, r.queries.SelectOwner, []any{owner.Type, owner.ID}, func(rows *dbsql.Rows) error {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return err
+		}
+		hashes = append(hashes, hash)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("selecting hashes: %w", err)
+	}
+	return hashes, nil
+}
+
+// Owners returns the owners referencing hash.
+func (r *Refs) Owners(ctx context.Context, hash string) ([]Owner, error) {
+	var owners []Owner
+	err := r.query(ctx, r.queries.SelectHash, []any{hash}, func(rows *dbsql.Rows) error {
+		var owner Owner
+		if err := rows.Scan(&owner.Type, &owner.ID); err != nil {
+			return err
+		}
+		owners = append(owners, owner)
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("selecting owners: %w", err)
+	}
+	return owners, nil
+}
+
+// Referenced returns all referenced hashes as a set.
+func (r *Refs) Referenced(ctx context.Context) (map[string]struct{}, error) {
+	referenced := make(map[string]struct{})
+	err := r.query(ctx, r.queries.SelectHashes, nil, func(rows *dbsql.Rows) error {
+		var hash string
+		if err := rows.Scan(&hash); err != nil {
+			return err
+		}
+		referenced[hash] = struct{}{}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("selecting referenced hashes: %w", err)
+	}
+	return referenced, nil
+}
+
+// Keep loads all referenced hashes and returns a keep function for filestore.Prune that keeps referenced files.
+// Files that are stored but not yet referenced when Keep is called are not kept, so Prune should not run
+// concurrently with storing new files.
+func (r *Refs) Keep(ctx context.Context) (func(hash string) bool, error) {
+	referenced, err := r.Referenced(ctx)
+	if err != nil {
+		return nil, err
+	}
+	return func(hash string) bool {
+		_, ok := referenced[hash]
+		return ok
+	}, nil
+}
+
+func (r *Refs) query(ctx context.Context, query string, args []any, scan func(rows *dbsql.Rows) error) error {
+	rows, err := r.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		if err := scan(rows); err != nil {
+			return err
+		}
+	}
+	return rows.Err()
+}
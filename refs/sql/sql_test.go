@@ -0,0 +1,237 @@
+package sql_test
+
+import (
+	"context"
+	dbsql "database/sql"
+	"database/sql/driver"
+	"errors"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/memory"
+	refsql "github.com/networkteam/filestore/refs/sql"
+)
+
+func TestQueries(t *testing.T) {
+	q, err := refsql.Queries("app.refs", refsql.Postgres)
+	require.NoError(t, err)
+	assert.Equal(t, "INSERT INTO app.refs (hash, owner_type, owner_id) VALUES ($1, $2, $3) ON CONFLICT DO NOTHING", q.Insert)
+	assert.Equal(t, "DELETE FROM app.refs WHERE hash = $1 AND owner_type = $2 AND owner_id = $3", q.Delete)
+	assert.Equal(t, []string{
+		"CREATE TABLE IF NOT EXISTS app.refs (hash VARCHAR(128) NOT NULL, owner_type VARCHAR(64) NOT NULL, owner_id VARCHAR(255) NOT NULL, created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP, PRIMARY KEY (owner_type, owner_id, hash))",
+		"CREATE INDEX IF NOT EXISTS refs_hash_idx ON app.refs (hash)",
+	}, q.Schema)
+
+	q, err = refsql.Queries("refs", refsql.MySQL)
+	require.NoError(t, err)
+	assert.Equal(t, "INSERT IGNORE INTO refs (hash, owner_type, owner_id) VALUES (?, ?, ?)", q.Insert)
+	require.Len(t, q.Schema, 1)
+	assert.Contains(t, q.Schema[0], "INDEX refs_hash_idx (hash)")
+
+	q, err = refsql.Queries("refs", refsql.SQLite)
+	require.NoError(t, err)
+	assert.Equal(t, "INSERT OR IGNORE INTO refs (hash, owner_type, owner_id) VALUES (?, ?, ?)", q.Insert)
+	assert.Equal(t, "SELECT hash FROM refs WHERE owner_type = ? AND owner_id = ? ORDER BY hash", q.SelectOwner)
+
+	_, err = refsql.Queries("refs; DROP TABLE users", refsql.Postgres)
+	assert.ErrorIs(t, err, refsql.ErrInvalidTable)
+}
+
+func TestRefs(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+
+	refs, err := refsql.New(db, refsql.WithDialect(refsql.SQLite))
+	require.NoError(t, err)
+	require.NoError(t, refs.CreateSchema(ctx))
+
+	article := refsql.Owner{Type: "article", ID: "1"}
+	page := refsql.Owner{Type: "page", ID: "2"}
+	require.NoError(t, refs.Add(ctx, article, "a1", "b2"))
+	require.NoError(t, refs.Add(ctx, article, "a1"))
+	require.NoError(t, refs.Add(ctx, page, "b2"))
+
+	hashes, err := refs.Hashes(ctx, article)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a1", "b2"}, hashes)
+
+	owners, err := refs.Owners(ctx, "b2")
+	require.NoError(t, err)
+	assert.Equal(t, []refsql.Owner{article, page}, owners)
+
+	require.NoError(t, refs.Remove(ctx, article, "b2"))
+	require.NoError(t, refs.Set(ctx, page, "c3"))
+
+	referenced, err := refs.Referenced(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]struct{}{"a1": {}, "c3": {}}, referenced)
+
+	require.NoError(t, refs.RemoveOwner(ctx, article))
+	hashes, err = refs.Hashes(ctx, article)
+	require.NoError(t, err)
+	assert.Empty(t, hashes)
+
+	err = refs.Add(ctx, refsql.Owner{Type: "article"}, "a1")
+	assert.ErrorIs(t, err, refsql.ErrInvalidOwner)
+}
+
+func TestRefs_Keep(t *testing.T) {
+	ctx := context.Background()
+	db := openTestDB(t)
+	store := memory.NewFilestore()
+
+	referencedHash, err := store.Store(ctx, strings.NewReader("referenced"))
+	require.NoError(t, err)
+	unreferencedHash, err := store.Store(ctx, strings.NewReader("unreferenced"))
+	require.NoError(t, err)
+
+	refs, err := refsql.New(db, refsql.WithDialect(refsql.SQLite))
+	require.NoError(t, err)
+	require.NoError(t, refs.Add(ctx, refsql.Owner{Type: "article", ID: "1"}, referencedHash))
+
+	keep, err := refs.Keep(ctx)
+	require.NoError(t, err)
+	result, err := filestore.Prune(ctx, store, keep)
+	require.NoError(t, err)
+	assert.Equal(t, 1, result.Removed)
+
+	exists, err := store.Exists(ctx, referencedHash)
+	require.NoError(t, err)
+	assert.True(t, exists)
+	exists, err = store.Exists(ctx, unreferencedHash)
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
+// refsDriver is a minimal database/sql driver that interprets the SQLite queries of the refs table in memory.
+type refsDriver struct {
+	mx   sync.Mutex
+	refs map[[3]string]struct{}
+}
+
+var testDriver = &refsDriver{}
+
+func init() {
+	dbsql.Register("filestore-refs-test", testDriver)
+}
+
+func openTestDB(t *testing.T) *dbsql.DB {
+	t.Helper()
+
+	testDriver.mx.Lock()
+	testDriver.refs = make(map[[3]string]struct{})
+	testDriver.mx.Unlock()
+
+	db, err := dbsql.Open("filestore-refs-test", "")
+	require.NoError(t, err)
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+func (d *refsDriver) Open(string) (driver.Conn, error) {
+	return &refsConn{d: d}, nil
+}
+
+type refsConn struct {
+	d *refsDriver
+}
+
+var (
+	_ driver.ExecerContext  = &refsConn{}
+	_ driver.QueryerContext = &refsConn{}
+)
+
+func (c *refsConn) Prepare(string) (driver.Stmt, error) { return nil, errors.New("not supported") }
+func (c *refsConn) Close() error                        { return nil }
+func (c *refsConn) Begin() (driver.Tx, error)           { return nil, errors.New("not supported") }
+
+func (c *refsConn) ExecContext(_ context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	c.d.mx.Lock()
+	defer c.d.mx.Unlock()
+
+	switch {
+	case strings.HasPrefix(query, "CREATE "):
+	case strings.HasPrefix(query, "INSERT OR IGNORE INTO filestore_refs "):
+		c.d.refs[[3]string{str(args[0]), str(args[1]), str(args[2])}] = struct{}{}
+	case strings.HasPrefix(query, "DELETE FROM filestore_refs WHERE hash = "):
+		delete(c.d.refs, [3]string{str(args[0]), str(args[1]), str(args[2])})
+	case strings.HasPrefix(query, "DELETE FROM filestore_refs WHERE owner_type = "):
+		for ref := range c.d.refs {
+			if ref[1] == str(args[0]) && ref[2] == str(args[1]) {
+				delete(c.d.refs, ref)
+			}
+		}
+	default:
+		return nil, errors.New("unexpected query: " + query)
+	}
+	return driver.RowsAffected(1), nil
+}
+
+func (c *refsConn) QueryContext(_ context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	c.d.mx.Lock()
+	defer c.d.mx.Unlock()
+
+	rows := &refsRows{}
+	switch {
+	case strings.HasPrefix(query, "SELECT hash FROM filestore_refs WHERE owner_type = "):
+		rows.columns = []string{"hash"}
+		for ref := range c.d.refs {
+			if ref[1] == str(args[0]) && ref[2] == str(args[1]) {
+				rows.values = append(rows.values, []string{ref[0]})
+			}
+		}
+	case strings.HasPrefix(query, "SELECT owner_type, owner_id FROM filestore_refs WHERE hash = "):
+		rows.columns = []string{"owner_type", "owner_id"}
+		for ref := range c.d.refs {
+			if ref[0] == str(args[0]) {
+				rows.values = append(rows.values, []string{ref[1], ref[2]})
+			}
+		}
+	case query == "SELECT DISTINCT hash FROM filestore_refs":
+		rows.columns = []string{"hash"}
+		seen := make(map[string]bool)
+		for ref := range c.d.refs {
+			if !seen[ref[0]] {
+				seen[ref[0]] = true
+				rows.values = append(rows.values, []string{ref[0]})
+			}
+		}
+	default:
+		return nil, errors.New("unexpected query: " + query)
+	}
+	sort.Slice(rows.values, func(i, j int) bool {
+		return strings.Join(rows.values[i], "/") < strings.Join(rows.values[j], "/")
+	})
+	return rows, nil
+}
+
+type refsRows struct {
+	columns []string
+	values  [][]string
+}
+
+func (r *refsRows) Columns() []string { return r.columns }
+func (r *refsRows) Close() error      { return nil }
+
+func (r *refsRows) Next(dest []driver.Value) error {
+	if len(r.values) == 0 {
+		return io.EOF
+	}
+	for i, v := range r.values[0] {
+		dest[i] = v
+	}
+	r.values = r.values[1:]
+	return nil
+}
+
+func str(arg driver.NamedValue) string {
+	s, _ := arg.Value.(string)
+	return s
+}
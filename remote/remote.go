@@ -0,0 +1,262 @@
+// Package remote stores content downloaded from remote URLs (e.g. to import images) in a file store.
+package remote
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/upload"
+)
+
+const (
+	// DefaultMaxSize is the default maximum size of downloaded content.
+	DefaultMaxSize = 32 << 20
+	// DefaultTimeout is the default timeout for downloading content (including redirects and reading the body).
+	DefaultTimeout = 30 * time.Second
+	// maxRedirects is the maximum number of redirects that are followed.
+	maxRedirects = 10
+)
+
+var (
+	// ErrSchemeNotAllowed is returned if the scheme of a URL (or a redirect) is not allowed.
+	ErrSchemeNotAllowed = errors.New("scheme not allowed")
+	// ErrHostNotAllowed is returned if the host of a URL (or a redirect) is not allowed.
+	ErrHostNotAllowed = errors.New("host not allowed")
+	// ErrAddressNotAllowed is returned if a host resolves to a loopback, private or otherwise non-public address.
+	ErrAddressNotAllowed = errors.New("address not allowed")
+	// ErrUnexpectedStatus is returned if the response status is not 200 OK.
+	ErrUnexpectedStatus = errors.New("unexpected response status")
+	// ErrTooManyRedirects is returned if more than 10 redirects are followed.
+	ErrTooManyRedirects = errors.New("too many redirects")
+)
+
+type options struct {
+	maxSize         int64
+	timeout         time.Duration
+	allowedSchemes  []string
+	allowedHosts    []string
+	privateNetworks bool
+}
+
+// Option is a functional option for StoreFromURL.
+type Option func(*options)
+
+// WithMaxSize limits the size of the downloaded content (defaults to DefaultMaxSize). Larger content fails with
+// upload.ErrTooLarge (wrapping filestore.ErrTooLarge). A size of 0 disables the limit.
+func WithMaxSize(maxSize int64) Option {
+	return func(opts *options) {
+		opts.maxSize = maxSize
+	}
+}
+
+// WithTimeout sets the timeout for downloading the content (defaults to DefaultTimeout).
+func WithTimeout(timeout time.Duration) Option {
+	return func(opts *options) {
+		opts.timeout = timeout
+	}
+}
+
+// WithAllowedSchemes sets the allowed URL schemes (defaults to "http" and "https").
+func WithAllowedSchemes(schemes ...string) Option {
+	return func(opts *options) {
+		opts.allowedSchemes = schemes
+	}
+}
+
+// WithAllowedHosts only allows URLs with the given hosts. A host can start with "*." to allow all subdomains
+// (e.g. "*.example.com"). All hosts are allowed by default.
+func WithAllowedHosts(hosts ...string) Option {
+	return func(opts *options) {
+		opts.allowedHosts = hosts
+	}
+}
+
+// WithPrivateNetworks allows connections to loopback, private and link-local addresses, which are refused by
+// default to prevent server-side request forgery (SSRF) to internal services.
+func WithPrivateNetworks() Option {
+	return func(opts *options) {
+		opts.privateNetworks = true
+	}
+}
+
+// StoreFromURL downloads the content of rawURL and stores it in store.
+// The result contains the hash, the size, the content type (detected from the content, see http.DetectContentType,
+// or the Content-Type response header if it cannot be detected) and the filename (from a Content-Disposition
+// response header or the URL path).
+//
+// Only URLs with allowed schemes and hosts are downloaded, which is also checked for redirects. Connections to
+// non-public addresses are refused after resolving the host, unless WithPrivateNetworks is set.
+// Proxies from the environment are not used.
+func StoreFromURL(ctx context.Context, store filestore.Storer, rawURL string, opts ...Option) (upload.Result, error) {
+	o := options{
+		maxSize:        DefaultMaxSize,
+		timeout:        DefaultTimeout,
+		allowedSchemes: []string{"http", "https"},
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return upload.Result{}, fmt.Errorf("parsing URL: %w", err)
+	}
+	if err = o.checkURL(u); err != nil {
+		return upload.Result{}, err
+	}
+
+	client, closeClient := o.client()
+	defer closeClient()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return upload.Result{}, fmt.Errorf("creating request: %w", err)
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return upload.Result{}, fmt.Errorf("downloading %s: %w", u.Redacted(), err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return upload.Result{}, fmt.Errorf("downloading %s: %w: %s", u.Redacted(), ErrUnexpectedStatus, resp.Status)
+	}
+
+	contentType, body, err := filestore.DetectContentType(resp.Body)
+	if err != nil {
+		return upload.Result{}, fmt.Errorf("reading response: %w", err)
+	}
+	if declared := resp.Header.Get("Content-Type"); contentType == "application/octet-stream" && declared != "" {
+		contentType = declared
+	}
+
+	return upload.Store(ctx, store, body, upload.Metadata{
+		ContentType: contentType,
+		Filename:    responseFilename(resp),
+		Size:        resp.ContentLength,
+	}, o.maxSize)
+}
+
+// checkURL checks that the scheme and host of u are allowed.
+func (o options) checkURL(u *url.URL) error {
+	if !contains(o.allowedSchemes, strings.ToLower(u.Scheme)) {
+		return fmt.Errorf("%w: %q", ErrSchemeNotAllowed, u.Scheme)
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if host == "" {
+		return fmt.Errorf("%w: empty host", ErrHostNotAllowed)
+	}
+	if len(o.allowedHosts) == 0 {
+		return nil
+	}
+	for _, allowed := range o.allowedHosts {
+		allowed = strings.ToLower(allowed)
+		if host == allowed || strings.HasPrefix(allowed, "*.") && strings.HasSuffix(host, allowed[1:]) {
+			return nil
+		}
+	}
+	return fmt.Errorf("%w: %q", ErrHostNotAllowed, host)
+}
+
+// client returns an HTTP client that checks redirects and connected addresses and a function to close it.
+func (o options) client() (*http.Client, func()) {
+	dialer := &net.Dialer{
+		Timeout: o.timeout,
+		Control: o.checkAddress,
+	}
+	transport := &http.Transport{
+		DialContext:           dialer.DialContext,
+		TLSHandshakeTimeout:   o.timeout,
+		ResponseHeaderTimeout: o.timeout,
+		ForceAttemptHTTP2:     true,
+	}
+	client := &http.Client{
+		Transport: transport,
+		Timeout:   o.timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= maxRedirects {
+				return ErrTooManyRedirects
+			}
+			return o.checkURL(req.URL)
+		},
+	}
+	return client, transport.CloseIdleConnections
+}
+
+// checkAddress is called with the resolved address before connecting and refuses non-public addresses.
+func (o options) checkAddress(network, address string, _ syscall.RawConn) error {
+	if o.privateNetworks {
+		return nil
+	}
+
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", ErrAddressNotAllowed, address)
+	}
+	ip := net.ParseIP(host)
+	if ip == nil || !isPublic(ip) {
+		return fmt.Errorf("%w: %s", ErrAddressNotAllowed, host)
+	}
+	return nil
+}
+
+// nonPublicNetworks are special-purpose networks not covered by the net.IP methods.
+var nonPublicNetworks = []*net.IPNet{
+	mustParseCIDR("0.0.0.0/8"),
+	mustParseCIDR("100.64.0.0/10"),
+	mustParseCIDR("192.0.0.0/24"),
+	mustParseCIDR("198.18.0.0/15"),
+}
+
+func isPublic(ip net.IP) bool {
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsMulticast() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() {
+		return false
+	}
+	for _, network := range nonPublicNetworks {
+		if network.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+func mustParseCIDR(s string) *net.IPNet {
+	_, network, err := net.ParseCIDR(s)
+	if err != nil {
+		panic(err)
+	}
+	return network
+}
+
+// responseFilename returns the filename of a Content-Disposition header or the last element of the URL path.
+func responseFilename(resp *http.Response) string {
+	if _, params, err := mime.ParseMediaType(resp.Header.Get("Content-Disposition")); err == nil && params["filename"] != "" {
+		return params["filename"]
+	}
+	name := path.Base(resp.Request.URL.Path)
+	if name == "." || name == "/" {
+		return ""
+	}
+	return name
+}
+
+func contains(values []string, value string) bool {
+	for _, v := range values {
+		if v == value {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,89 @@
+package remote_test
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/memory"
+	"github.com/networkteam/filestore/remote"
+	"github.com/networkteam/filestore/upload"
+)
+
+func TestStoreFromURL(t *testing.T) {
+	ctx := context.Background()
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/images/pixel.gif", func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("GIF89a"))
+	})
+	mux.HandleFunc("/download", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("Content-Disposition", `attachment; filename="report.pdf"`)
+		_, _ = w.Write([]byte("\x00\x01\x02"))
+	})
+	mux.HandleFunc("/redirect", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "http://example.com/", http.StatusFound)
+	})
+	server := httptest.NewServer(mux)
+	defer server.Close()
+
+	t.Run("download", func(t *testing.T) {
+		store := memory.NewFilestore()
+
+		result, err := remote.StoreFromURL(ctx, store, server.URL+"/images/pixel.gif", remote.WithPrivateNetworks())
+		require.NoError(t, err)
+		assert.Equal(t, upload.Result{
+			Hash:        "610f5ae4d76e332636a17bd357fd6ce99029316a99d320280d4d77a746bf29e8",
+			Size:        6,
+			ContentType: "image/gif",
+			Filename:    "pixel.gif",
+		}, result)
+
+		info, err := store.Stat(ctx, result.Hash)
+		require.NoError(t, err)
+		assert.Equal(t, "image/gif", info.ContentType)
+	})
+
+	t.Run("declared content type and filename", func(t *testing.T) {
+		result, err := remote.StoreFromURL(ctx, memory.NewFilestore(), server.URL+"/download", remote.WithPrivateNetworks())
+		require.NoError(t, err)
+		assert.Equal(t, "application/pdf", result.ContentType)
+		assert.Equal(t, "report.pdf", result.Filename)
+	})
+
+	t.Run("private address", func(t *testing.T) {
+		_, err := remote.StoreFromURL(ctx, memory.NewFilestore(), server.URL+"/images/pixel.gif")
+		require.ErrorIs(t, err, remote.ErrAddressNotAllowed)
+	})
+
+	t.Run("scheme not allowed", func(t *testing.T) {
+		_, err := remote.StoreFromURL(ctx, memory.NewFilestore(), "file:///etc/passwd")
+		require.ErrorIs(t, err, remote.ErrSchemeNotAllowed)
+	})
+
+	t.Run("host not allowed", func(t *testing.T) {
+		_, err := remote.StoreFromURL(ctx, memory.NewFilestore(), server.URL+"/images/pixel.gif", remote.WithAllowedHosts("*.example.com"))
+		require.ErrorIs(t, err, remote.ErrHostNotAllowed)
+	})
+
+	t.Run("redirect to host not allowed", func(t *testing.T) {
+		_, err := remote.StoreFromURL(ctx, memory.NewFilestore(), server.URL+"/redirect", remote.WithPrivateNetworks(), remote.WithAllowedHosts("127.0.0.1"))
+		require.ErrorIs(t, err, remote.ErrHostNotAllowed)
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		_, err := remote.StoreFromURL(ctx, memory.NewFilestore(), server.URL+"/images/pixel.gif", remote.WithPrivateNetworks(), remote.WithMaxSize(5))
+		require.ErrorIs(t, err, filestore.ErrTooLarge)
+	})
+
+	t.Run("unexpected status", func(t *testing.T) {
+		_, err := remote.StoreFromURL(ctx, memory.NewFilestore(), server.URL+"/missing", remote.WithPrivateNetworks())
+		require.ErrorIs(t, err, remote.ErrUnexpectedStatus)
+	})
+}
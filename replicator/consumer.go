@@ -0,0 +1,210 @@
+package replicator
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+)
+
+// ConsumerOptions configures a Consumer. Zero values are replaced with the defaults of the package.
+type ConsumerOptions struct {
+	// BatchSize is the number of entries handled before they are acknowledged (defaults to DefaultBatchSize).
+	BatchSize int
+	// PollInterval is the interval for checking the journal for new entries (defaults to DefaultPollInterval).
+	PollInterval time.Duration
+	// MinRetryDelay is the delay before retrying a failed entry, which is doubled for every failure up to
+	// MaxRetryDelay (defaults to DefaultMinRetryDelay and DefaultMaxRetryDelay).
+	MinRetryDelay time.Duration
+	MaxRetryDelay time.Duration
+	// OnAck is called after the entries up to seq were acknowledged (e.g. to truncate the journal).
+	OnAck func(seq uint64)
+}
+
+// A Consumer handles the entries of a journal in order and acknowledges them under a target name, so it continues
+// after the last acknowledged entry after a restart. A failed entry is retried with an increasing delay, later entries
+// are not handled until the failed entry succeeds.
+//
+// The Replicator runs a consumer for every target. Other packages recording operations in a journal use a consumer
+// to process the entries in the same way (e.g. the events package).
+type Consumer struct {
+	journal Journal
+	target  string
+	handle  func(ctx context.Context, entry Entry) error
+	opts    ConsumerOptions
+	notify  chan struct{}
+
+	mx        sync.Mutex
+	acked     uint64
+	failures  int
+	lastError error
+}
+
+// NewConsumer creates a consumer that handles the entries of journal with handle and acknowledges them for target.
+// The target must not change between restarts.
+func NewConsumer(journal Journal, target string, handle func(ctx context.Context, entry Entry) error, opts ConsumerOptions) *Consumer {
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = DefaultBatchSize
+	}
+	if opts.PollInterval <= 0 {
+		opts.PollInterval = DefaultPollInterval
+	}
+	if opts.MinRetryDelay <= 0 {
+		opts.MinRetryDelay = DefaultMinRetryDelay
+	}
+	if opts.MaxRetryDelay <= 0 {
+		opts.MaxRetryDelay = DefaultMaxRetryDelay
+	}
+
+	return &Consumer{
+		journal: journal,
+		target:  target,
+		handle:  handle,
+		opts:    opts,
+		notify:  make(chan struct{}, 1),
+	}
+}
+
+// Notify lets a running consumer check the journal immediately instead of after the poll interval
+// (e.g. after appending an entry).
+func (c *Consumer) Notify() {
+	select {
+	case c.notify <- struct{}{}:
+	default:
+	}
+}
+
+// Run handles the journal entries until ctx is cancelled and returns the error of the context.
+func (c *Consumer) Run(ctx context.Context) error {
+	if err := c.loadAcked(); err != nil {
+		return err
+	}
+	c.run(ctx)
+	return ctx.Err()
+}
+
+// Acked returns the sequence number of the last acknowledged entry (0 if Run was not called yet).
+func (c *Consumer) Acked() uint64 {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	return c.acked
+}
+
+// Failures returns the number of consecutive failures to handle an entry.
+func (c *Consumer) Failures() int {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	return c.failures
+}
+
+// LastError returns the error of the last failure or nil if the last entry was handled.
+func (c *Consumer) LastError() error {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	return c.lastError
+}
+
+func (c *Consumer) loadAcked() error {
+	acked, err := c.journal.Acked(c.target)
+	if err != nil {
+		return fmt.Errorf("getting acknowledged entries of target %s: %w", c.target, err)
+	}
+
+	c.mx.Lock()
+	c.acked = acked
+	c.mx.Unlock()
+	return nil
+}
+
+func (c *Consumer) run(ctx context.Context) {
+	for {
+		handled, err := c.handleBatch(ctx)
+		if err == nil && handled == c.opts.BatchSize {
+			// More entries could be pending
+			continue
+		}
+
+		delay, notify := c.opts.PollInterval, c.notify
+		if err != nil {
+			// A failed entry is only retried after the delay
+			delay, notify = c.retryDelay(), nil
+		}
+
+		timer := time.NewTimer(delay)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-notify:
+			timer.Stop()
+		case <-timer.C:
+		}
+	}
+}
+
+// handleBatch handles the next batch of entries and acknowledges the handled entries.
+func (c *Consumer) handleBatch(ctx context.Context) (handled int, err error) {
+	entries, err := c.journal.Read(c.Acked(), c.opts.BatchSize)
+	if err != nil {
+		return 0, c.fail(fmt.Errorf("reading journal: %w", err))
+	}
+
+	defer func() {
+		if handled == 0 {
+			return
+		}
+		seq := entries[handled-1].Seq
+		if ackErr := c.journal.Ack(c.target, seq); ackErr != nil {
+			err = c.fail(fmt.Errorf("acknowledging entries: %w", ackErr))
+			return
+		}
+		c.mx.Lock()
+		c.acked = seq
+		c.mx.Unlock()
+		if c.opts.OnAck != nil {
+			c.opts.OnAck(seq)
+		}
+	}()
+
+	for _, entry := range entries {
+		if ctx.Err() != nil {
+			return handled, ctx.Err()
+		}
+		if err := c.handle(ctx, entry); err != nil {
+			return handled, c.fail(fmt.Errorf("handling entry %d (%s %s): %w", entry.Seq, entry.Type, entry.Hash, err))
+		}
+		handled++
+
+		c.mx.Lock()
+		c.failures = 0
+		c.lastError = nil
+		c.mx.Unlock()
+	}
+
+	return handled, nil
+}
+
+func (c *Consumer) fail(err error) error {
+	c.mx.Lock()
+	defer c.mx.Unlock()
+
+	c.failures++
+	c.lastError = err
+	return err
+}
+
+func (c *Consumer) retryDelay() time.Duration {
+	failures := c.Failures()
+
+	delay := c.opts.MinRetryDelay
+	for i := 1; i < failures && delay < c.opts.MaxRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > c.opts.MaxRetryDelay {
+		delay = c.opts.MaxRetryDelay
+	}
+	return delay
+}
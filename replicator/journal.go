@@ -0,0 +1,281 @@
+package replicator
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/networkteam/filestore"
+)
+
+// An Entry is an operation recorded in a journal.
+type Entry struct {
+	// Seq is the sequence number of the entry, starting at 1 and increasing with every entry.
+	Seq  uint64
+	Time time.Time
+	filestore.Event
+}
+
+// A Journal durably records the operations of a file store, so they can be applied to target stores after a restart.
+// Journals must be safe for concurrent use.
+type Journal interface {
+	// Append records an event and returns the entry.
+	Append(event filestore.Event) (Entry, error)
+	// Read returns up to max entries with a sequence number greater than after, oldest first.
+	Read(after uint64, max int) ([]Entry, error)
+	// Ack records that all entries up to seq were applied to a target.
+	Ack(target string, seq uint64) error
+	// Acked returns the sequence number of the last entry applied to a target (0 if none).
+	Acked(target string) (uint64, error)
+	// Truncate discards all entries up to seq (e.g. after they were applied to all targets).
+	Truncate(seq uint64) error
+}
+
+const (
+	journalFileName = "journal.log"
+	stateFileName   = "state.json"
+)
+
+// FileJournal is a journal in a directory, entries are appended to a log file and synced to disk before Append
+// returns. Acknowledged sequence numbers are stored in a separate state file.
+type FileJournal struct {
+	dir string
+
+	mx      sync.Mutex
+	file    *os.File
+	entries []Entry
+	state   journalState
+}
+
+type journalState struct {
+	// Truncated is the sequence number of the last truncated entry, so sequence numbers continue after all entries
+	// were truncated.
+	Truncated uint64            `json:"truncated"`
+	Acked     map[string]uint64 `json:"acked"`
+}
+
+var _ Journal = &FileJournal{}
+
+// OpenFileJournal opens or creates a file journal in dir.
+// An incomplete entry at the end of the log file (e.g. after a crash while appending) is discarded.
+func OpenFileJournal(dir string) (*FileJournal, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("creating journal directory: %w", err)
+	}
+
+	j := &FileJournal{dir: dir}
+	if err := j.readState(); err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(filepath.Join(dir, journalFileName))
+	if err != nil && !errors.Is(err, fs.ErrNotExist) {
+		return nil, fmt.Errorf("reading journal: %w", err)
+	}
+	// Only complete lines are valid entries
+	data = data[:bytes.LastIndexByte(data, '\n')+1]
+	scanner := bufio.NewScanner(bytes.NewReader(data))
+	for scanner.Scan() {
+		var entry Entry
+		if err := json.Unmarshal(scanner.Bytes(), &entry); err != nil {
+			return nil, fmt.Errorf("decoding journal entry: %w", err)
+		}
+		if entry.Seq > j.state.Truncated {
+			j.entries = append(j.entries, entry)
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("reading journal: %w", err)
+	}
+
+	if err := j.rewrite(); err != nil {
+		return nil, err
+	}
+
+	return j, nil
+}
+
+// Append implements Journal.
+func (j *FileJournal) Append(event filestore.Event) (Entry, error) {
+	j.mx.Lock()
+	defer j.mx.Unlock()
+
+	entry := Entry{
+		Seq:   j.lastSeq() + 1,
+		Time:  time.Now(),
+		Event: event,
+	}
+	data, err := json.Marshal(entry)
+	if err != nil {
+		return Entry{}, fmt.Errorf("encoding journal entry: %w", err)
+	}
+	if _, err = j.file.Write(append(data, '\n')); err != nil {
+		return Entry{}, fmt.Errorf("writing journal entry: %w", err)
+	}
+	if err = j.file.Sync(); err != nil {
+		return Entry{}, fmt.Errorf("syncing journal: %w", err)
+	}
+	j.entries = append(j.entries, entry)
+
+	return entry, nil
+}
+
+// Read implements Journal.
+func (j *FileJournal) Read(after uint64, max int) ([]Entry, error) {
+	j.mx.Lock()
+	defer j.mx.Unlock()
+
+	i := sort.Search(len(j.entries), func(i int) bool {
+		return j.entries[i].Seq > after
+	})
+	n := len(j.entries) - i
+	if max > 0 && n > max {
+		n = max
+	}
+	entries := make([]Entry, n)
+	copy(entries, j.entries[i:i+n])
+	return entries, nil
+}
+
+// Ack implements Journal.
+func (j *FileJournal) Ack(target string, seq uint64) error {
+	j.mx.Lock()
+	defer j.mx.Unlock()
+
+	if j.state.Acked == nil {
+		j.state.Acked = make(map[string]uint64)
+	}
+	j.state.Acked[target] = seq
+	return j.writeState()
+}
+
+// Acked implements Journal.
+func (j *FileJournal) Acked(target string) (uint64, error) {
+	j.mx.Lock()
+	defer j.mx.Unlock()
+
+	return j.state.Acked[target], nil
+}
+
+// Truncate implements Journal and rewrites the log file without the truncated entries.
+func (j *FileJournal) Truncate(seq uint64) error {
+	j.mx.Lock()
+	defer j.mx.Unlock()
+
+	if seq <= j.state.Truncated {
+		return nil
+	}
+	if last := j.lastSeq(); seq > last {
+		seq = last
+	}
+
+	i := sort.Search(len(j.entries), func(i int) bool {
+		return j.entries[i].Seq > seq
+	})
+	j.entries = j.entries[i:]
+	j.state.Truncated = seq
+	if err := j.writeState(); err != nil {
+		return err
+	}
+
+	return j.rewrite()
+}
+
+// Close closes the log file of the journal.
+func (j *FileJournal) Close() error {
+	j.mx.Lock()
+	defer j.mx.Unlock()
+
+	return j.file.Close()
+}
+
+func (j *FileJournal) lastSeq() uint64 {
+	if len(j.entries) == 0 {
+		return j.state.Truncated
+	}
+	return j.entries[len(j.entries)-1].Seq
+}
+
+// rewrite atomically replaces the log file with the current entries and opens it for appending.
+func (j *FileJournal) rewrite() error {
+	var buf bytes.Buffer
+	for _, entry := range j.entries {
+		data, err := json.Marshal(entry)
+		if err != nil {
+			return fmt.Errorf("encoding journal entry: %w", err)
+		}
+		buf.Write(data)
+		buf.WriteByte('\n')
+	}
+
+	journalPath := filepath.Join(j.dir, journalFileName)
+	if err := writeFileSync(journalPath, buf.Bytes()); err != nil {
+		return fmt.Errorf("writing journal: %w", err)
+	}
+
+	if j.file != nil {
+		_ = j.file.Close()
+	}
+	file, err := os.OpenFile(journalPath, os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return fmt.Errorf("opening journal: %w", err)
+	}
+	j.file = file
+
+	return nil
+}
+
+func (j *FileJournal) readState() error {
+	data, err := os.ReadFile(filepath.Join(j.dir, stateFileName))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("reading journal state: %w", err)
+	}
+	if err = json.Unmarshal(data, &j.state); err != nil {
+		return fmt.Errorf("decoding journal state: %w", err)
+	}
+	return nil
+}
+
+func (j *FileJournal) writeState() error {
+	data, err := json.Marshal(j.state)
+	if err != nil {
+		return fmt.Errorf("encoding journal state: %w", err)
+	}
+	if err = writeFileSync(filepath.Join(j.dir, stateFileName), data); err != nil {
+		return fmt.Errorf("writing journal state: %w", err)
+	}
+	return nil
+}
+
+// writeFileSync atomically replaces a file by writing and syncing a temporary file and renaming it.
+func writeFileSync(path string, data []byte) error {
+	tmpFile, err := os.CreateTemp(filepath.Dir(path), "."+filepath.Base(path)+"-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmpFile.Name())
+
+	if _, err = tmpFile.Write(data); err != nil {
+		_ = tmpFile.Close()
+		return err
+	}
+	if err = tmpFile.Sync(); err != nil {
+		_ = tmpFile.Close()
+		return err
+	}
+	if err = tmpFile.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmpFile.Name(), path)
+}
@@ -0,0 +1,294 @@
+// Package replicator replicates the stored and removed files of a file store asynchronously to target stores
+// (e.g. an offsite copy in another region) without putting the targets on the write path.
+//
+// Operations are recorded in a durable Journal before they return, so replication continues after a restart.
+package replicator
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+	"time"
+
+	"github.com/networkteam/filestore"
+)
+
+const (
+	// DefaultBatchSize is the default number of journal entries applied to a target before they are acknowledged.
+	DefaultBatchSize = 100
+	// DefaultPollInterval is the default interval for checking the journal for new entries.
+	DefaultPollInterval = 5 * time.Second
+	// DefaultMinRetryDelay is the default delay before retrying a failed entry, doubled for every failure.
+	DefaultMinRetryDelay = time.Second
+	// DefaultMaxRetryDelay is the default maximum delay before retrying a failed entry.
+	DefaultMaxRetryDelay = time.Minute
+)
+
+// ErrNoTargets is returned by Run if no targets were added.
+var ErrNoTargets = errors.New("no replication targets")
+
+// Replicator wraps a source file store and records stored and removed files in a journal, which are applied
+// to the targets by Run. Only the methods of filestore.FileStore are available on the wrapper.
+//
+// An operation is recorded after it succeeded on the source store. If recording fails, the error is returned
+// although the operation succeeded.
+type Replicator struct {
+	filestore.FileStore
+
+	journal   Journal
+	consumers []*Consumer
+}
+
+type target struct {
+	name  string
+	store filestore.FileStore
+}
+
+type options struct {
+	targets       []*target
+	batchSize     int
+	pollInterval  time.Duration
+	minRetryDelay time.Duration
+	maxRetryDelay time.Duration
+}
+
+// Option is a functional option for creating a replicator.
+type Option func(*options)
+
+// WithTarget adds a target store to replicate to. The name identifies the progress of the target in the journal,
+// so it must not change between restarts.
+func WithTarget(name string, store filestore.FileStore) Option {
+	return func(opts *options) {
+		opts.targets = append(opts.targets, &target{
+			name:  name,
+			store: store,
+		})
+	}
+}
+
+// WithBatchSize sets the number of journal entries applied to a target before they are acknowledged
+// (defaults to DefaultBatchSize).
+func WithBatchSize(batchSize int) Option {
+	return func(opts *options) {
+		opts.batchSize = batchSize
+	}
+}
+
+// WithPollInterval sets the interval for checking the journal for new entries (defaults to DefaultPollInterval).
+// Entries recorded by the replicator itself are applied immediately.
+func WithPollInterval(pollInterval time.Duration) Option {
+	return func(opts *options) {
+		opts.pollInterval = pollInterval
+	}
+}
+
+// WithRetryDelay sets the delay before retrying a failed entry, which is doubled for every failure up to maxDelay
+// (defaults to DefaultMinRetryDelay and DefaultMaxRetryDelay).
+func WithRetryDelay(minDelay, maxDelay time.Duration) Option {
+	return func(opts *options) {
+		opts.minRetryDelay = minDelay
+		opts.maxRetryDelay = maxDelay
+	}
+}
+
+var _ filestore.FileStore = &Replicator{}
+
+// New creates a replicator for the source store that records operations in journal.
+func New(source filestore.FileStore, journal Journal, opts ...Option) *Replicator {
+	o := options{
+		batchSize:     DefaultBatchSize,
+		pollInterval:  DefaultPollInterval,
+		minRetryDelay: DefaultMinRetryDelay,
+		maxRetryDelay: DefaultMaxRetryDelay,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	r := &Replicator{
+		FileStore: source,
+		journal:   journal,
+	}
+	for _, t := range o.targets {
+		store := t.store
+		r.consumers = append(r.consumers, NewConsumer(journal, t.name, func(ctx context.Context, entry Entry) error {
+			return r.apply(ctx, store, entry)
+		}, ConsumerOptions{
+			BatchSize:     o.batchSize,
+			PollInterval:  o.pollInterval,
+			MinRetryDelay: o.minRetryDelay,
+			MaxRetryDelay: o.maxRetryDelay,
+			OnAck: func(uint64) {
+				r.truncate()
+			},
+		}))
+	}
+	return r
+}
+
+// Store stores the content in the source store and records it for replication.
+func (r *Replicator) Store(ctx context.Context, reader io.Reader) (string, error) {
+	hash, err := r.FileStore.Store(ctx, reader)
+	if err != nil {
+		return "", err
+	}
+	return hash, r.record(filestore.Event{Type: filestore.EventStored, Hash: hash})
+}
+
+// StoreHashed stores the content in the source store and records it for replication.
+func (r *Replicator) StoreHashed(ctx context.Context, reader io.Reader, hash string) error {
+	if err := r.FileStore.StoreHashed(ctx, reader, hash); err != nil {
+		return err
+	}
+	return r.record(filestore.Event{Type: filestore.EventStored, Hash: hash})
+}
+
+// Remove removes the file from the source store and records it for replication.
+func (r *Replicator) Remove(ctx context.Context, hash string) error {
+	if err := r.FileStore.Remove(ctx, hash); err != nil {
+		return err
+	}
+	return r.record(filestore.Event{Type: filestore.EventRemoved, Hash: hash})
+}
+
+func (r *Replicator) record(event filestore.Event) error {
+	if _, err := r.journal.Append(event); err != nil {
+		return fmt.Errorf("recording %s %s for replication: %w", event.Type, event.Hash, err)
+	}
+	for _, c := range r.consumers {
+		c.Notify()
+	}
+	return nil
+}
+
+// Run applies the journal entries to all targets until ctx is cancelled and returns the error of the context.
+// Failed entries are retried with an increasing delay, later entries are not applied to the target until the
+// failed entry succeeds, so the order of operations is kept. Entries applied to all targets are truncated from the
+// journal.
+func (r *Replicator) Run(ctx context.Context) error {
+	if len(r.consumers) == 0 {
+		return ErrNoTargets
+	}
+
+	for _, c := range r.consumers {
+		if err := c.loadAcked(); err != nil {
+			return err
+		}
+	}
+
+	var wg sync.WaitGroup
+	for _, c := range r.consumers {
+		wg.Add(1)
+		go func(c *Consumer) {
+			defer wg.Done()
+			c.run(ctx)
+		}(c)
+	}
+	wg.Wait()
+
+	return ctx.Err()
+}
+
+// apply applies an entry to a target store. Files that were removed from the source after they were stored are
+// skipped, the removal is applied by a later entry.
+func (r *Replicator) apply(ctx context.Context, store filestore.FileStore, entry Entry) error {
+	switch entry.Type {
+	case filestore.EventStored:
+		exists, err := store.Exists(ctx, entry.Hash)
+		if err != nil {
+			return err
+		}
+		if exists {
+			return nil
+		}
+
+		rc, info, err := filestore.FetchInfo(ctx, r.FileStore, entry.Hash)
+		if errors.Is(err, filestore.ErrNotExist) {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		defer rc.Close()
+
+		return store.StoreHashed(ctx, filestore.NewReader(
+			rc,
+			filestore.WithSize(info.Size),
+			filestore.WithContentType(info.ContentType),
+			filestore.WithContentDisposition(info.ContentDisposition),
+		), entry.Hash)
+	case filestore.EventRemoved:
+		err := store.Remove(ctx, entry.Hash)
+		if errors.Is(err, filestore.ErrNotExist) {
+			return nil
+		}
+		return err
+	}
+	return fmt.Errorf("unknown event type %q", entry.Type)
+}
+
+// truncate discards the entries applied to all targets from the journal.
+func (r *Replicator) truncate() {
+	var minAcked uint64
+	for i, c := range r.consumers {
+		acked := c.Acked()
+		if i == 0 || acked < minAcked {
+			minAcked = acked
+		}
+	}
+	// Truncating is an optimization, entries are truncated again with the next acknowledgement
+	_ = r.journal.Truncate(minAcked)
+}
+
+// Status describes the replication progress of a target.
+type Status struct {
+	Target string
+	// Acked is the sequence number of the last entry applied to the target.
+	Acked uint64
+	// Pending is the number of entries not applied to the target yet.
+	Pending int
+	// Lag is the age of the oldest entry not applied to the target yet (zero if there are no pending entries).
+	Lag time.Duration
+	// Failures is the number of consecutive failures to apply an entry.
+	Failures int
+	// LastError is the error of the last failure (nil if the last entry was applied).
+	LastError error
+}
+
+// Status returns the replication progress of all targets (e.g. to export lag metrics).
+func (r *Replicator) Status() ([]Status, error) {
+	statuses := make([]Status, 0, len(r.consumers))
+	for _, c := range r.consumers {
+		c.mx.Lock()
+		status := Status{
+			Target:    c.target,
+			Acked:     c.acked,
+			Failures:  c.failures,
+			LastError: c.lastError,
+		}
+		c.mx.Unlock()
+
+		if status.Acked == 0 {
+			// Run was not called yet
+			acked, err := r.journal.Acked(c.target)
+			if err != nil {
+				return nil, fmt.Errorf("getting acknowledged entries of target %s: %w", c.target, err)
+			}
+			status.Acked = acked
+		}
+
+		pending, err := r.journal.Read(status.Acked, 0)
+		if err != nil {
+			return nil, fmt.Errorf("reading journal: %w", err)
+		}
+		status.Pending = len(pending)
+		if len(pending) > 0 {
+			status.Lag = time.Since(pending[0].Time)
+		}
+
+		statuses = append(statuses, status)
+	}
+	return statuses, nil
+}
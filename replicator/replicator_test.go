@@ -0,0 +1,277 @@
+package replicator_test
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/memory"
+	"github.com/networkteam/filestore/replicator"
+)
+
+func TestReplicator(t *testing.T) {
+	ctx := context.Background()
+
+	journal, err := replicator.OpenFileJournal(t.TempDir())
+	require.NoError(t, err)
+	defer journal.Close()
+
+	source := memory.NewFilestore()
+	target := memory.NewFilestore()
+	r := replicator.New(source, journal, replicator.WithTarget("offsite", target))
+
+	hash, err := r.Store(ctx, filestore.NewReader(strings.NewReader("Hello World"), filestore.WithContentType("text/plain")))
+	require.NoError(t, err)
+	removedHash, err := r.Store(ctx, strings.NewReader("Removed content"))
+	require.NoError(t, err)
+	require.NoError(t, r.Remove(ctx, removedHash))
+
+	statuses, err := r.Status()
+	require.NoError(t, err)
+	require.Len(t, statuses, 1)
+	assert.Equal(t, "offsite", statuses[0].Target)
+	assert.Equal(t, 3, statuses[0].Pending)
+	assert.Greater(t, statuses[0].Lag, time.Duration(0))
+
+	runReplicator(t, r)
+
+	waitReplicated(t, r)
+
+	info, err := target.Stat(ctx, hash)
+	require.NoError(t, err)
+	assert.Equal(t, filestore.ObjectInfo{Hash: hash, Size: 11, ContentType: "text/plain"}, info)
+
+	exists, err := target.Exists(ctx, removedHash)
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	t.Run("applies new entries immediately", func(t *testing.T) {
+		newHash, err := r.Store(ctx, strings.NewReader("New content"))
+		require.NoError(t, err)
+
+		waitReplicated(t, r)
+		checkContent(t, target, newHash, "New content")
+	})
+}
+
+func TestReplicator_Restart(t *testing.T) {
+	ctx := context.Background()
+	journalDir := t.TempDir()
+
+	source := memory.NewFilestore()
+	target := memory.NewFilestore()
+
+	journal, err := replicator.OpenFileJournal(journalDir)
+	require.NoError(t, err)
+	hash, err := replicator.New(source, journal, replicator.WithTarget("offsite", target)).Store(ctx, strings.NewReader("Hello World"))
+	require.NoError(t, err)
+	require.NoError(t, journal.Close())
+
+	// The entry is replicated after reopening the journal
+	journal, err = replicator.OpenFileJournal(journalDir)
+	require.NoError(t, err)
+	defer journal.Close()
+
+	r := replicator.New(source, journal, replicator.WithTarget("offsite", target))
+	runReplicator(t, r)
+	waitReplicated(t, r)
+
+	checkContent(t, target, hash, "Hello World")
+}
+
+func TestReplicator_Retry(t *testing.T) {
+	ctx := context.Background()
+
+	journal, err := replicator.OpenFileJournal(t.TempDir())
+	require.NoError(t, err)
+	defer journal.Close()
+
+	source := memory.NewFilestore()
+	target := &failingStore{FileStore: memory.NewFilestore(), failures: 3}
+	r := replicator.New(source, journal,
+		replicator.WithTarget("offsite", target),
+		replicator.WithRetryDelay(time.Millisecond, 10*time.Millisecond),
+	)
+
+	hash, err := r.Store(ctx, strings.NewReader("Hello World"))
+	require.NoError(t, err)
+
+	runReplicator(t, r)
+	waitReplicated(t, r)
+
+	checkContent(t, target, hash, "Hello World")
+	assert.Equal(t, int32(0), atomic.LoadInt32(&target.failures))
+
+	statuses, err := r.Status()
+	require.NoError(t, err)
+	assert.Equal(t, 0, statuses[0].Failures)
+	assert.NoError(t, statuses[0].LastError)
+}
+
+func TestReplicator_NoTargets(t *testing.T) {
+	journal, err := replicator.OpenFileJournal(t.TempDir())
+	require.NoError(t, err)
+	defer journal.Close()
+
+	err = replicator.New(memory.NewFilestore(), journal).Run(context.Background())
+	assert.ErrorIs(t, err, replicator.ErrNoTargets)
+}
+
+func TestConsumer(t *testing.T) {
+	journal, err := replicator.OpenFileJournal(t.TempDir())
+	require.NoError(t, err)
+	defer journal.Close()
+
+	for _, hash := range []string{"a1", "b2", "c3"} {
+		_, err := journal.Append(filestore.Event{Type: filestore.EventStored, Hash: hash})
+		require.NoError(t, err)
+	}
+
+	var (
+		failures int32 = 2
+		handled  []string
+		ackedSeq uint64
+	)
+	consumer := replicator.NewConsumer(journal, "consumer", func(ctx context.Context, entry replicator.Entry) error {
+		if entry.Hash == "b2" && atomic.AddInt32(&failures, -1) >= 0 {
+			return errors.New("unavailable")
+		}
+		handled = append(handled, entry.Hash)
+		return nil
+	}, replicator.ConsumerOptions{
+		BatchSize:     2,
+		MinRetryDelay: time.Millisecond,
+		OnAck: func(seq uint64) {
+			atomic.StoreUint64(&ackedSeq, seq)
+		},
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- consumer.Run(ctx)
+	}()
+
+	require.Eventually(t, func() bool {
+		return atomic.LoadUint64(&ackedSeq) == 3
+	}, 5*time.Second, time.Millisecond)
+	cancel()
+	assert.ErrorIs(t, <-done, context.Canceled)
+
+	// Entries are handled in order, the failed entry is retried before later entries
+	assert.Equal(t, []string{"a1", "b2", "c3"}, handled)
+	assert.Equal(t, uint64(3), consumer.Acked())
+	assert.Equal(t, 0, consumer.Failures())
+	assert.NoError(t, consumer.LastError())
+
+	acked, err := journal.Acked("consumer")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(3), acked)
+}
+
+func TestFileJournal(t *testing.T) {
+	dir := t.TempDir()
+
+	journal, err := replicator.OpenFileJournal(dir)
+	require.NoError(t, err)
+
+	for _, hash := range []string{"a1", "b2", "c3"} {
+		_, err := journal.Append(filestore.Event{Type: filestore.EventStored, Hash: hash})
+		require.NoError(t, err)
+	}
+	require.NoError(t, journal.Ack("offsite", 2))
+	require.NoError(t, journal.Truncate(1))
+	require.NoError(t, journal.Close())
+
+	// Simulate a crash while appending an entry
+	f, err := os.OpenFile(filepath.Join(dir, "journal.log"), os.O_WRONLY|os.O_APPEND, 0644)
+	require.NoError(t, err)
+	_, err = f.WriteString(`{"Seq":4,"Ty`)
+	require.NoError(t, err)
+	require.NoError(t, f.Close())
+
+	journal, err = replicator.OpenFileJournal(dir)
+	require.NoError(t, err)
+	defer journal.Close()
+
+	entries, err := journal.Read(0, 0)
+	require.NoError(t, err)
+	require.Len(t, entries, 2)
+	assert.Equal(t, uint64(2), entries[0].Seq)
+	assert.Equal(t, "b2", entries[0].Hash)
+	assert.Equal(t, uint64(3), entries[1].Seq)
+
+	acked, err := journal.Acked("offsite")
+	require.NoError(t, err)
+	assert.Equal(t, uint64(2), acked)
+
+	entries, err = journal.Read(acked, 10)
+	require.NoError(t, err)
+	require.Len(t, entries, 1)
+	assert.Equal(t, "c3", entries[0].Hash)
+
+	// Sequence numbers continue after truncating all entries
+	require.NoError(t, journal.Truncate(3))
+	entry, err := journal.Append(filestore.Event{Type: filestore.EventRemoved, Hash: "a1"})
+	require.NoError(t, err)
+	assert.Equal(t, uint64(4), entry.Seq)
+}
+
+func runReplicator(t *testing.T, r *replicator.Replicator) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- r.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		assert.ErrorIs(t, <-done, context.Canceled)
+	})
+}
+
+func waitReplicated(t *testing.T, r *replicator.Replicator) {
+	t.Helper()
+
+	require.Eventually(t, func() bool {
+		statuses, err := r.Status()
+		require.NoError(t, err)
+		return statuses[0].Pending == 0
+	}, 5*time.Second, time.Millisecond)
+}
+
+func checkContent(t *testing.T, store filestore.Fetcher, hash, expected string) {
+	t.Helper()
+
+	rc, err := store.Fetch(context.Background(), hash)
+	require.NoError(t, err)
+	defer rc.Close()
+	content, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	assert.Equal(t, expected, string(content))
+}
+
+// failingStore fails to store files until the number of failures is reached.
+type failingStore struct {
+	filestore.FileStore
+	failures int32
+}
+
+func (s *failingStore) StoreHashed(ctx context.Context, r io.Reader, hash string) error {
+	if atomic.AddInt32(&s.failures, -1) >= 0 {
+		return errors.New("unavailable")
+	}
+	atomic.StoreInt32(&s.failures, 0)
+	return s.FileStore.StoreHashed(ctx, r, hash)
+}
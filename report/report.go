@@ -0,0 +1,223 @@
+// Package report generates statistics about the objects of a file store (e.g. before garbage collection).
+package report
+
+import (
+	"container/heap"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"text/tabwriter"
+
+	"github.com/networkteam/filestore"
+)
+
+// Store is a file store that can be iterated and returns the size of objects.
+type Store interface {
+	filestore.Iterator
+	filestore.Sizer
+}
+
+// DefaultHistogramBounds are the default upper bounds of the size histogram buckets.
+var DefaultHistogramBounds = []int64{1 << 10, 10 << 10, 100 << 10, 1 << 20, 10 << 20, 100 << 20, 1 << 30}
+
+// DefaultLargest is the default number of largest objects in a report.
+const DefaultLargest = 10
+
+// iterateBatchSize is the number of hashes fetched per batch when iterating the store.
+const iterateBatchSize = 1000
+
+// Object is a stored object in a report.
+type Object struct {
+	Hash string
+	Size int64
+}
+
+// Bucket is a bucket of the size histogram with all objects up to (including) MaxSize bytes
+// and larger than the MaxSize of the previous bucket. The last bucket has a MaxSize of math.MaxInt64.
+type Bucket struct {
+	MaxSize int64
+	Objects int64
+	Bytes   int64
+}
+
+// Report contains statistics about the objects of a store.
+type Report struct {
+	// Objects is the number of objects.
+	Objects int64
+	// Bytes is the total size of all objects.
+	Bytes int64
+	// Histogram contains the number and size of objects by size.
+	Histogram []Bucket
+	// Largest are the largest objects ordered by size (descending).
+	Largest []Object
+	// Unreferenced are the objects that are not referenced ordered by hash, only set if WithReferences is used.
+	Unreferenced []Object
+	// UnreferencedBytes is the total size of all unreferenced objects.
+	UnreferencedBytes int64
+}
+
+type options struct {
+	histogramBounds []int64
+	largest         int
+	isReferenced    func(hash string) bool
+}
+
+// Option is a functional option for generating a report.
+type Option func(*options)
+
+// WithHistogramBounds sets the upper bounds of the size histogram buckets (defaults to DefaultHistogramBounds).
+// A bucket for larger objects is always added.
+func WithHistogramBounds(bounds ...int64) Option {
+	return func(opts *options) {
+		opts.histogramBounds = bounds
+	}
+}
+
+// WithLargest sets the number of largest objects in the report (defaults to DefaultLargest).
+func WithLargest(n int) Option {
+	return func(opts *options) {
+		opts.largest = n
+	}
+}
+
+// WithReferences reports all objects as unreferenced for which isReferenced returns false.
+func WithReferences(isReferenced func(hash string) bool) Option {
+	return func(opts *options) {
+		opts.isReferenced = isReferenced
+	}
+}
+
+// WithReferenceSet reports all objects as unreferenced that are not in the set of referenced hashes.
+func WithReferenceSet(referenced map[string]struct{}) Option {
+	return WithReferences(func(hash string) bool {
+		_, ok := referenced[hash]
+		return ok
+	})
+}
+
+// Generate iterates all objects of store and returns a report.
+// Objects that are removed while iterating are skipped.
+func Generate(ctx context.Context, store Store, opts ...Option) (Report, error) {
+	o := options{
+		histogramBounds: DefaultHistogramBounds,
+		largest:         DefaultLargest,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	bounds := append([]int64{}, o.histogramBounds...)
+	sort.Slice(bounds, func(i, j int) bool { return bounds[i] < bounds[j] })
+	bounds = append(bounds, math.MaxInt64)
+
+	var (
+		report  Report
+		largest = &objectHeap{}
+	)
+	report.Histogram = make([]Bucket, len(bounds))
+	for i, bound := range bounds {
+		report.Histogram[i].MaxSize = bound
+	}
+
+	err := store.Iterate(ctx, iterateBatchSize, func(hashes []string) error {
+		for _, hash := range hashes {
+			size, err := store.Size(ctx, hash)
+			if err != nil {
+				if errors.Is(err, filestore.ErrNotExist) {
+					continue
+				}
+				return fmt.Errorf("getting size of %s: %w", hash, err)
+			}
+			obj := Object{Hash: hash, Size: size}
+
+			report.Objects++
+			report.Bytes += size
+
+			i := sort.Search(len(bounds), func(i int) bool { return bounds[i] >= size })
+			report.Histogram[i].Objects++
+			report.Histogram[i].Bytes += size
+
+			if o.largest > 0 {
+				heap.Push(largest, obj)
+				if largest.Len() > o.largest {
+					heap.Pop(largest)
+				}
+			}
+
+			if o.isReferenced != nil && !o.isReferenced(hash) {
+				report.Unreferenced = append(report.Unreferenced, obj)
+				report.UnreferencedBytes += size
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return Report{}, fmt.Errorf("iterating store: %w", err)
+	}
+
+	report.Largest = make([]Object, largest.Len())
+	for i := len(report.Largest) - 1; i >= 0; i-- {
+		report.Largest[i] = heap.Pop(largest).(Object)
+	}
+	sort.Slice(report.Unreferenced, func(i, j int) bool {
+		return report.Unreferenced[i].Hash < report.Unreferenced[j].Hash
+	})
+
+	return report, nil
+}
+
+// WriteText writes the report in a human readable format to w.
+func (r Report) WriteText(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "Objects:\t%d\t\n", r.Objects)
+	fmt.Fprintf(tw, "Bytes:\t%d\t\n", r.Bytes)
+	if r.Unreferenced != nil {
+		fmt.Fprintf(tw, "Unreferenced objects:\t%d\t\n", len(r.Unreferenced))
+		fmt.Fprintf(tw, "Unreferenced bytes:\t%d\t\n", r.UnreferencedBytes)
+	}
+
+	fmt.Fprintf(tw, "\nSize\tObjects\tBytes\t\n")
+	for _, bucket := range r.Histogram {
+		maxSize := fmt.Sprintf("<= %d", bucket.MaxSize)
+		if bucket.MaxSize == math.MaxInt64 {
+			maxSize = "larger"
+		}
+		fmt.Fprintf(tw, "%s\t%d\t%d\t\n", maxSize, bucket.Objects, bucket.Bytes)
+	}
+
+	if len(r.Largest) > 0 {
+		fmt.Fprintf(tw, "\nLargest\tBytes\t\n")
+		for _, obj := range r.Largest {
+			fmt.Fprintf(tw, "%s\t%d\t\n", obj.Hash, obj.Size)
+		}
+	}
+
+	return tw.Flush()
+}
+
+// objectHeap is a min-heap of objects by size (ties are broken by hash for a stable result).
+type objectHeap []Object
+
+func (h objectHeap) Len() int { return len(h) }
+
+func (h objectHeap) Less(i, j int) bool {
+	if h[i].Size != h[j].Size {
+		return h[i].Size < h[j].Size
+	}
+	return h[i].Hash > h[j].Hash
+}
+
+func (h objectHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *objectHeap) Push(x any) { *h = append(*h, x.(Object)) }
+
+func (h *objectHeap) Pop() any {
+	old := *h
+	obj := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return obj
+}
@@ -0,0 +1,49 @@
+package report_test
+
+import (
+	"context"
+	"math"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/networkteam/filestore/memory"
+	"github.com/networkteam/filestore/report"
+)
+
+func TestGenerate(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewFilestore()
+
+	var hashes []string
+	for _, content := range []string{"a", "bb", "ccc", strings.Repeat("d", 10), strings.Repeat("e", 100)} {
+		hash, err := store.Store(ctx, strings.NewReader(content))
+		require.NoError(t, err)
+		hashes = append(hashes, hash)
+	}
+
+	r, err := report.Generate(ctx, store,
+		report.WithHistogramBounds(10, 2),
+		report.WithLargest(2),
+		report.WithReferenceSet(map[string]struct{}{hashes[0]: {}, hashes[3]: {}, hashes[4]: {}}),
+	)
+	require.NoError(t, err)
+
+	assert.Equal(t, int64(5), r.Objects)
+	assert.Equal(t, int64(116), r.Bytes)
+	assert.Equal(t, []report.Bucket{
+		{MaxSize: 2, Objects: 2, Bytes: 3},
+		{MaxSize: 10, Objects: 2, Bytes: 13},
+		{MaxSize: math.MaxInt64, Objects: 1, Bytes: 100},
+	}, r.Histogram)
+	assert.Equal(t, []report.Object{{Hash: hashes[4], Size: 100}, {Hash: hashes[3], Size: 10}}, r.Largest)
+	assert.ElementsMatch(t, []report.Object{{Hash: hashes[1], Size: 2}, {Hash: hashes[2], Size: 3}}, r.Unreferenced)
+	assert.Equal(t, int64(5), r.UnreferencedBytes)
+
+	var sb strings.Builder
+	require.NoError(t, r.WriteText(&sb))
+	assert.Contains(t, sb.String(), "Unreferenced objects:  2")
+	assert.Contains(t, sb.String(), hashes[4])
+}
@@ -0,0 +1,37 @@
+// Package resumable provides upload sessions for resumable uploads, e.g. for mobile clients on flaky networks that
+// cannot send a large file in a single request. An upload is created, its content is appended in chunks (a failed
+// chunk is resumed at the offset stored so far) and finalized to store the content by its hash.
+//
+// The local and s3 stores implement Uploader: the local store appends chunks to a temporary file, the S3 store
+// uploads every chunk as a part of a multipart upload.
+package resumable
+
+import (
+	"context"
+	"errors"
+	"io"
+)
+
+// ErrUploadNotFound is returned if an upload does not exist (e.g. it was already finalized or aborted).
+var ErrUploadNotFound = errors.New("upload not found")
+
+// ErrOffsetMismatch is returned by AppendUpload if the offset of a chunk does not match the size of the upload
+// (e.g. a chunk was sent again after it was stored). The client should get the current offset and resume from there.
+var ErrOffsetMismatch = errors.New("offset does not match upload size")
+
+// An Uploader stores the content of resumable uploads. Implementations must be safe for concurrent use, but chunks
+// of one upload must be appended one after another.
+type Uploader interface {
+	// CreateUpload creates a new upload and returns its ID.
+	CreateUpload(ctx context.Context) (id string, err error)
+	// AppendUpload appends the content of r to the upload and returns the new size of the upload. The offset must
+	// match the current size of the upload, otherwise ErrOffsetMismatch is returned.
+	// If reading r fails, the content read so far may be kept, so the client must resume at UploadOffset.
+	AppendUpload(ctx context.Context, id string, offset int64, r io.Reader) (int64, error)
+	// UploadOffset returns the current size of the upload, which is the offset of the next chunk.
+	UploadOffset(ctx context.Context, id string) (int64, error)
+	// FinalizeUpload stores the content of the upload by its hash and removes the upload.
+	FinalizeUpload(ctx context.Context, id string) (hash string, err error)
+	// AbortUpload removes the upload and its content.
+	AbortUpload(ctx context.Context, id string) error
+}
@@ -0,0 +1,187 @@
+package resumable
+
+import (
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/networkteam/filestore"
+)
+
+type handlerOptions struct {
+	maxSize int64
+}
+
+// HandlerOption is a functional option for creating an upload handler.
+type HandlerOption func(*handlerOptions)
+
+// WithMaxSize limits the size of uploads. Chunks exceeding it are rejected with 413 Request Entity Too Large.
+func WithMaxSize(maxSize int64) HandlerOption {
+	return func(opts *handlerOptions) {
+		opts.maxSize = maxSize
+	}
+}
+
+// Result describes a finalized upload.
+type Result struct {
+	Hash string `json:"hash"`
+	Size int64  `json:"size"`
+}
+
+// Handler returns an http.Handler for resumable uploads with the uploader. The current offset of an upload is
+// exchanged in the Upload-Offset header:
+//
+//   - POST / creates an upload and responds with 201 Created and the URL of the upload in the Location header.
+//   - HEAD /{id} responds with the current offset of the upload.
+//   - PATCH /{id} appends the request body at the offset of the Upload-Offset request header and responds with
+//     204 No Content and the new offset. If the offset does not match, it responds with 409 Conflict and the
+//     current offset, so the client can resume from there.
+//   - POST /{id} finalizes the upload and responds with the Result as JSON.
+//   - DELETE /{id} aborts the upload.
+//
+// The handler must be mounted with http.StripPrefix (or a router mounting it below a prefix), unknown uploads are
+// answered with 404 Not Found.
+func Handler(uploader Uploader, opts ...HandlerOption) http.Handler {
+	var o handlerOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "no-store")
+
+		id := strings.Trim(r.URL.Path, "/")
+		if id == "" {
+			if r.Method != http.MethodPost {
+				methodNotAllowed(w, http.MethodPost)
+				return
+			}
+			createUpload(w, r, uploader)
+			return
+		}
+		if strings.Contains(id, "/") {
+			http.NotFound(w, r)
+			return
+		}
+
+		switch r.Method {
+		case http.MethodHead:
+			offset, err := uploader.UploadOffset(r.Context(), id)
+			if err != nil {
+				writeError(w, err)
+				return
+			}
+			setOffset(w, offset)
+		case http.MethodPatch:
+			o.appendUpload(w, r, uploader, id)
+		case http.MethodPost:
+			finalizeUpload(w, r, uploader, id)
+		case http.MethodDelete:
+			if err := uploader.AbortUpload(r.Context(), id); err != nil {
+				writeError(w, err)
+				return
+			}
+			w.WriteHeader(http.StatusNoContent)
+		default:
+			methodNotAllowed(w, http.MethodHead, http.MethodPatch, http.MethodPost, http.MethodDelete)
+		}
+	})
+}
+
+func createUpload(w http.ResponseWriter, r *http.Request, uploader Uploader) {
+	id, err := uploader.CreateUpload(r.Context())
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	// The request URI is used, since the path of the request URL is stripped when the handler is mounted
+	basePath := r.URL.Path
+	if requestURL, err := url.ParseRequestURI(r.RequestURI); err == nil {
+		basePath = requestURL.Path
+	}
+	w.Header().Set("Location", strings.TrimSuffix(basePath, "/")+"/"+url.PathEscape(id))
+	setOffset(w, 0)
+	w.WriteHeader(http.StatusCreated)
+}
+
+func (o handlerOptions) appendUpload(w http.ResponseWriter, r *http.Request, uploader Uploader, id string) {
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(w, "invalid Upload-Offset header", http.StatusBadRequest)
+		return
+	}
+
+	// A known size lets the uploader store the chunk without spooling it
+	var body io.Reader = r.Body
+	if r.ContentLength >= 0 {
+		body = filestore.NewReader(r.Body, filestore.WithSize(r.ContentLength))
+	}
+	if o.maxSize > 0 {
+		if offset+r.ContentLength > o.maxSize {
+			writeError(w, filestore.ErrTooLarge)
+			return
+		}
+		body = filestore.LimitReader(body, o.maxSize-offset)
+	}
+
+	newOffset, err := uploader.AppendUpload(r.Context(), id, offset, body)
+	if err != nil {
+		if errors.Is(err, ErrOffsetMismatch) {
+			if currentOffset, offsetErr := uploader.UploadOffset(r.Context(), id); offsetErr == nil {
+				setOffset(w, currentOffset)
+			}
+		}
+		writeError(w, err)
+		return
+	}
+
+	setOffset(w, newOffset)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func finalizeUpload(w http.ResponseWriter, r *http.Request, uploader Uploader, id string) {
+	size, err := uploader.UploadOffset(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+	hash, err := uploader.FinalizeUpload(r.Context(), id)
+	if err != nil {
+		writeError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	_ = json.NewEncoder(w).Encode(Result{Hash: hash, Size: size})
+}
+
+func setOffset(w http.ResponseWriter, offset int64) {
+	w.Header().Set("Upload-Offset", strconv.FormatInt(offset, 10))
+}
+
+func methodNotAllowed(w http.ResponseWriter, methods ...string) {
+	w.Header().Set("Allow", strings.Join(methods, ", "))
+	http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+}
+
+func writeError(w http.ResponseWriter, err error) {
+	status := http.StatusInternalServerError
+	switch {
+	case errors.Is(err, ErrUploadNotFound):
+		status = http.StatusNotFound
+	case errors.Is(err, ErrOffsetMismatch):
+		status = http.StatusConflict
+	case errors.Is(err, filestore.ErrTooLarge):
+		status = http.StatusRequestEntityTooLarge
+	case errors.Is(err, filestore.ErrNoSpace):
+		status = http.StatusInsufficientStorage
+	case errors.Is(err, filestore.ErrReadOnly):
+		status = http.StatusServiceUnavailable
+	}
+	http.Error(w, http.StatusText(status), status)
+}
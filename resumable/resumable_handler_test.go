@@ -0,0 +1,110 @@
+package resumable_test
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/networkteam/filestore/hashing"
+	"github.com/networkteam/filestore/local"
+	"github.com/networkteam/filestore/resumable"
+)
+
+func TestHandler(t *testing.T) {
+	testDir := t.TempDir()
+	store, err := local.NewFilestore(path.Join(testDir, "tmp"), path.Join(testDir, "assets"))
+	require.NoError(t, err)
+
+	mux := http.NewServeMux()
+	mux.Handle("/uploads/", http.StripPrefix("/uploads", resumable.Handler(store, resumable.WithMaxSize(20))))
+	ts := httptest.NewServer(mux)
+	defer ts.Close()
+
+	resp := request(t, http.MethodPost, ts.URL+"/uploads/", "", nil)
+	require.Equal(t, http.StatusCreated, resp.StatusCode)
+	assert.Equal(t, "0", resp.Header.Get("Upload-Offset"))
+	uploadURL := ts.URL + resp.Header.Get("Location")
+	require.True(t, strings.HasPrefix(uploadURL, ts.URL+"/uploads/"))
+
+	resp = request(t, http.MethodPatch, uploadURL, "Resumable ", map[string]string{"Upload-Offset": "0"})
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+	assert.Equal(t, "10", resp.Header.Get("Upload-Offset"))
+
+	t.Run("offset mismatch", func(t *testing.T) {
+		resp := request(t, http.MethodPatch, uploadURL, "Resumable ", map[string]string{"Upload-Offset": "0"})
+		assert.Equal(t, http.StatusConflict, resp.StatusCode)
+		assert.Equal(t, "10", resp.Header.Get("Upload-Offset"))
+	})
+
+	t.Run("invalid offset", func(t *testing.T) {
+		resp := request(t, http.MethodPatch, uploadURL, "content", nil)
+		assert.Equal(t, http.StatusBadRequest, resp.StatusCode)
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		resp := request(t, http.MethodPatch, uploadURL, "content exceeding the max size", map[string]string{"Upload-Offset": "10"})
+		assert.Equal(t, http.StatusRequestEntityTooLarge, resp.StatusCode)
+	})
+
+	resp = request(t, http.MethodHead, uploadURL, "", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	assert.Equal(t, "10", resp.Header.Get("Upload-Offset"))
+
+	resp = request(t, http.MethodPatch, uploadURL, "content", map[string]string{"Upload-Offset": "10"})
+	require.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+	resp = request(t, http.MethodPost, uploadURL, "", nil)
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var result resumable.Result
+	require.NoError(t, json.NewDecoder(resp.Body).Decode(&result))
+	assert.Equal(t, resumable.Result{Hash: hashing.HashBytes([]byte("Resumable content")), Size: 17}, result)
+
+	rc, err := store.Fetch(context.Background(), result.Hash)
+	require.NoError(t, err)
+	defer rc.Close()
+	content, err := io.ReadAll(rc)
+	require.NoError(t, err)
+	assert.Equal(t, "Resumable content", string(content))
+
+	t.Run("finalized upload", func(t *testing.T) {
+		resp := request(t, http.MethodHead, uploadURL, "", nil)
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+
+	t.Run("abort", func(t *testing.T) {
+		resp := request(t, http.MethodPost, ts.URL+"/uploads/", "", nil)
+		require.Equal(t, http.StatusCreated, resp.StatusCode)
+		uploadURL := ts.URL + resp.Header.Get("Location")
+
+		resp = request(t, http.MethodDelete, uploadURL, "", nil)
+		assert.Equal(t, http.StatusNoContent, resp.StatusCode)
+
+		resp = request(t, http.MethodPatch, uploadURL, "content", map[string]string{"Upload-Offset": "0"})
+		assert.Equal(t, http.StatusNotFound, resp.StatusCode)
+	})
+}
+
+func request(t *testing.T, method, url, body string, header map[string]string) *http.Response {
+	t.Helper()
+
+	req, err := http.NewRequest(method, url, strings.NewReader(body))
+	require.NoError(t, err)
+	for key, value := range header {
+		req.Header.Set(key, value)
+	}
+
+	resp, err := http.DefaultClient.Do(req)
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		_ = resp.Body.Close()
+	})
+	return resp
+}
@@ -0,0 +1,160 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+
+	"github.com/minio/minio-go/v7"
+
+	"github.com/networkteam/filestore"
+)
+
+const (
+	// DefaultArchiveStorageClass is the default storage class objects are transitioned to by Archive.
+	DefaultArchiveStorageClass = "GLACIER"
+	// DefaultRestoreDays is the default number of days a restored copy of an archived object is kept.
+	DefaultRestoreDays = 7
+)
+
+// restoreAlreadyInProgressCode is the error code for restore requests of objects that are being restored.
+const restoreAlreadyInProgressCode = "RestoreAlreadyInProgress"
+
+// archiveStorageClasses are the storage classes of objects that must be restored before they can be fetched.
+var archiveStorageClasses = map[string]bool{
+	"GLACIER":      true,
+	"DEEP_ARCHIVE": true,
+}
+
+// ErrArchiveInCompatibilityMode is returned by Archive with WithCompatibilityMode, since objects are archived with a
+// copy onto itself.
+var ErrArchiveInCompatibilityMode = errors.New("archiving is not supported in compatibility mode")
+
+// Archive implements filestore.Archiver and transitions an object by hash to the archive storage class
+// (see WithArchiveStorageClass) with a copy of the object onto itself. The content type, content disposition and
+// user metadata of the object are kept. With WithCompatibilityMode, Archive fails with ErrArchiveInCompatibilityMode.
+//
+// Lifecycle rules (see WithBucketLifecycle) are an alternative for archiving all objects by age.
+func (f *Filestore) Archive(ctx context.Context, hash string) error {
+	if f.compatibilityMode {
+		return ErrArchiveInCompatibilityMode
+	}
+
+	ctx, cancel := f.withOperationTimeout(ctx)
+	defer cancel()
+
+	objectKey, info, err := f.statObject(ctx, hash)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return &filestore.NotExistError{Op: "archive", Hash: hash}
+		}
+		return fmt.Errorf("getting object info %q: %w", hash, err)
+	}
+	if class := storageClass(info); class == f.archiveClass || archiveStorageClasses[class] {
+		return nil
+	}
+
+	metadata := map[string]string{
+		"X-Amz-Storage-Class": f.archiveClass,
+	}
+	if info.ContentType != "" {
+		metadata["Content-Type"] = info.ContentType
+	}
+	if contentDisposition := info.Metadata.Get("Content-Disposition"); contentDisposition != "" {
+		metadata["Content-Disposition"] = contentDisposition
+	}
+	for key, value := range info.UserMetadata {
+		metadata[key] = value
+	}
+
+	dstOpts := minio.CopyDestOptions{
+		Bucket:          f.BucketName,
+		Object:          objectKey,
+		UserMetadata:    metadata,
+		ReplaceMetadata: true,
+	}
+	srcOpts := minio.CopySrcOptions{
+		Bucket: f.BucketName,
+		Object: objectKey,
+	}
+	if info.Size > maxSinglePartSize {
+		_, err = f.Client.ComposeObject(ctx, dstOpts, srcOpts)
+	} else {
+		_, err = f.Client.CopyObject(ctx, dstOpts, srcOpts)
+	}
+	if err != nil {
+		return fmt.Errorf("archiving object %q: %w", objectKey, err)
+	}
+
+	return nil
+}
+
+// Restore implements filestore.Archiver and requests a temporary restored copy of an archived object by hash for
+// the configured number of days and retrieval tier (see WithRestore).
+func (f *Filestore) Restore(ctx context.Context, hash string) error {
+	ctx, cancel := f.withOperationTimeout(ctx)
+	defer cancel()
+
+	objectKey, info, err := f.statObject(ctx, hash)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return &filestore.NotExistError{Op: "restore", Hash: hash}
+		}
+		return fmt.Errorf("getting object info %q: %w", hash, err)
+	}
+	if status := restoreStatus(info); !status.Archived || status.Restoring {
+		return nil
+	}
+
+	var req minio.RestoreRequest
+	req.SetDays(f.restoreDays)
+	req.SetGlacierJobParameters(minio.GlacierJobParameters{Tier: f.restoreTier})
+	err = f.Client.RestoreObject(ctx, f.BucketName, objectKey, "", req)
+	if err != nil && minio.ToErrorResponse(err).Code != restoreAlreadyInProgressCode {
+		return fmt.Errorf("restoring object %q: %w", objectKey, err)
+	}
+
+	return nil
+}
+
+// RestoreStatus implements filestore.Archiver and returns the archive and restore status of an object by hash.
+func (f *Filestore) RestoreStatus(ctx context.Context, hash string) (filestore.RestoreStatus, error) {
+	ctx, cancel := f.withOperationTimeout(ctx)
+	defer cancel()
+
+	_, info, err := f.statObject(ctx, hash)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return filestore.RestoreStatus{}, &filestore.NotExistError{Op: "restore status", Hash: hash}
+		}
+		return filestore.RestoreStatus{}, fmt.Errorf("getting object info %q: %w", hash, err)
+	}
+
+	return restoreStatus(info), nil
+}
+
+// restoreStatus returns the restore status of an object from its storage class and restore header.
+func restoreStatus(info minio.ObjectInfo) filestore.RestoreStatus {
+	if !archiveStorageClasses[storageClass(info)] {
+		return filestore.RestoreStatus{}
+	}
+
+	status := filestore.RestoreStatus{Archived: true}
+	if info.Restore != nil {
+		status.Restoring = info.Restore.OngoingRestore
+		status.Restored = !info.Restore.OngoingRestore
+		if status.Restored {
+			status.RestoredUntil = info.Restore.ExpiryTime
+		}
+	}
+	return status
+}
+
+// storageClass returns the storage class of an object from the response headers of a stat
+// (the storage class is not set on the object info for stats).
+func storageClass(info minio.ObjectInfo) string {
+	if info.StorageClass != "" {
+		return info.StorageClass
+	}
+	return info.Metadata.Get("X-Amz-Storage-Class")
+}
@@ -0,0 +1,100 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+
+	"github.com/minio/minio-go/v7"
+)
+
+// ErrBucketNotExist is returned by Ping and EnsureBucket if the bucket does not exist
+// (and is not created automatically).
+var ErrBucketNotExist = errors.New("bucket does not exist")
+
+// bucketState records if the bucket was checked, so it is only checked once.
+type bucketState struct {
+	mx    sync.Mutex
+	ready bool
+}
+
+// EnsureBucket checks that the bucket exists and creates it if WithBucketAutoCreate was given, otherwise
+// ErrBucketNotExist is returned. After the bucket was checked successfully, further calls return immediately.
+// It is safe for concurrent use, concurrent calls wait for a running check.
+func (f *Filestore) EnsureBucket(ctx context.Context) error {
+	return f.ensureBucket(ctx, false)
+}
+
+// ensureBucketLazily checks the bucket before the first object is stored if WithLazyBucketCheck was given.
+func (f *Filestore) ensureBucketLazily(ctx context.Context) error {
+	if !f.lazyBucketCheck {
+		return nil
+	}
+	return f.ensureBucket(ctx, true)
+}
+
+func (f *Filestore) ensureBucket(ctx context.Context, allowAccessDenied bool) error {
+	state := f.bucket
+	if state == nil {
+		// The file store was not created by NewFilestore
+		state = &bucketState{}
+	}
+	state.mx.Lock()
+	defer state.mx.Unlock()
+
+	if state.ready {
+		return nil
+	}
+
+	ctx, cancel := f.withOperationTimeout(ctx)
+	defer cancel()
+
+	exists, err := f.Client.BucketExists(ctx, f.BucketName)
+	if allowAccessDenied && minio.ToErrorResponse(err).Code == "AccessDenied" {
+		// Assume the bucket exists if bucket level requests are not allowed
+		state.ready = true
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("checking if bucket %q exists: %w", f.BucketName, err)
+	}
+
+	if !exists {
+		if !f.bucketAutoCreate {
+			return fmt.Errorf("%w: %q", ErrBucketNotExist, f.BucketName)
+		}
+		if err := createBucket(ctx, f.Client, f.BucketName, f.bucketOptions); err != nil {
+			return err
+		}
+	}
+
+	state.ready = true
+	return nil
+}
+
+func createBucket(ctx context.Context, client *minio.Client, bucketName string, opts bucketOptions) error {
+	err := client.MakeBucket(ctx, bucketName, minio.MakeBucketOptions{
+		Region:        opts.region,
+		ObjectLocking: opts.objectLocking,
+	})
+	if err != nil {
+		return fmt.Errorf("creating bucket %q: %w", bucketName, err)
+	}
+
+	if opts.versioning {
+		err = client.EnableVersioning(ctx, bucketName)
+		if err != nil {
+			return fmt.Errorf("enabling versioning for bucket %q: %w", bucketName, err)
+		}
+	}
+
+	if opts.lifecycle != nil {
+		err = client.SetBucketLifecycle(ctx, bucketName, opts.lifecycle)
+		if err != nil {
+			return fmt.Errorf("setting lifecycle for bucket %q: %w", bucketName, err)
+		}
+	}
+
+	return nil
+}
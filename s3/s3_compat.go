@@ -0,0 +1,118 @@
+package s3
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/hashicorp/go-multierror"
+	"github.com/minio/minio-go/v7"
+
+	"github.com/networkteam/filestore/hashing"
+	"github.com/networkteam/filestore/internal/bufpool"
+)
+
+// storeDirect stores the content directly under its hash without using a temporary object.
+// Objects that already exist are not uploaded again.
+// The hash and size must be known before uploading, so readers that are not seekable or have no size are spooled
+// to a temporary file first.
+func (f *Filestore) storeDirect(ctx context.Context, r io.Reader, size int64, expectedHash []byte, putOptions minio.PutObjectOptions) (hash string, err error) {
+	seeker, seekable := r.(io.Seeker)
+
+	var hashBytes []byte
+	if size >= 0 && seekable {
+		hashBytes, err = hashAndRewind(r, seeker)
+		if err != nil {
+			return "", err
+		}
+	} else {
+		var spoolFile *os.File
+		spoolFile, hashBytes, size, err = f.spool(f.limitReader(r))
+		if err != nil {
+			return "", err
+		}
+		defer func() {
+			if closeErr := spoolFile.Close(); closeErr != nil {
+				err = multierror.Append(err, fmt.Errorf("closing spool file: %w", closeErr))
+			}
+			if removeErr := os.Remove(spoolFile.Name()); removeErr != nil {
+				err = multierror.Append(err, fmt.Errorf("removing spool file: %w", removeErr))
+			}
+		}()
+		r = spoolFile
+	}
+
+	if expectedHash != nil && !bytes.Equal(expectedHash, hashBytes) {
+		return "", fmt.Errorf("content does not match expected hash: %w", ErrChecksumMismatch)
+	}
+
+	key := f.key(hex.EncodeToString(hashBytes))
+
+	// Existing objects are not uploaded again, so they are never replaced or removed if the upload fails
+	if _, _, statErr := f.statObject(ctx, key); statErr == nil {
+		return key, nil
+	} else if minio.ToErrorResponse(statErr).Code != "NoSuchKey" {
+		return "", fmt.Errorf("getting object info %q: %w", key, statErr)
+	}
+
+	if f.verifyChecksum {
+		putOptions.UserMetadata = map[string]string{
+			"X-Amz-Checksum-Sha256": base64.StdEncoding.EncodeToString(hashBytes),
+		}
+	}
+	putOptions.DisableMultipart = size <= maxSinglePartSize
+	f.applyObjectLock(&putOptions)
+
+	putCtx := ctx
+	if f.writeOnce {
+		putCtx = withConditionalPut(ctx)
+	}
+
+	// Hash the content again while uploading to make sure it did not change since calculating the hash
+	hashingReader := hashing.NewHashingReader(r)
+	_, err = f.Client.PutObject(putCtx, f.BucketName, key, hashingReader, size, putOptions)
+	if f.writeOnce && minio.ToErrorResponse(err).Code == "PreconditionFailed" {
+		// The object was stored concurrently with the same hash
+		return key, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("putting object %q: %w", key, err)
+	}
+
+	if !bytes.Equal(hashingReader.Sum(), hashBytes) {
+		// The object did not exist before, so the invalid content can be removed. Without WithWriteOnce, a concurrent
+		// Store of the same content between checking and putting the object cannot be detected.
+		if removeErr := f.Client.RemoveObject(ctx, f.BucketName, key, minio.RemoveObjectOptions{}); removeErr != nil {
+			return "", fmt.Errorf("removing object after failed verification: %v: %w", removeErr, ErrChecksumMismatch)
+		}
+		return "", fmt.Errorf("reader content changed while uploading: %w", ErrChecksumMismatch)
+	}
+
+	return key, nil
+}
+
+// spool copies the content of the reader to a temporary file and returns the file (rewound to the start),
+// the hash and size of the content.
+func (f *Filestore) spool(r io.Reader) (spoolFile *os.File, hashBytes []byte, size int64, err error) {
+	spoolFile, err = os.CreateTemp(f.spoolDir, "s3-spool-*")
+	if err != nil {
+		return nil, nil, 0, fmt.Errorf("creating spool file: %w", err)
+	}
+
+	hashingReader := hashing.NewHashingReader(r)
+	size, err = bufpool.Copy(spoolFile, hashingReader)
+	if err == nil {
+		_, err = spoolFile.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		_ = spoolFile.Close()
+		_ = os.Remove(spoolFile.Name())
+		return nil, nil, 0, fmt.Errorf("spooling content: %w", err)
+	}
+
+	return spoolFile, hashingReader.Sum(), size, nil
+}
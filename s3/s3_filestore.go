@@ -1,16 +1,26 @@
 package s3
 
 import (
+	"bytes"
 	"context"
-	"crypto/sha256"
+	"encoding/base64"
 	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
+	"io/fs"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
 
 	"github.com/gofrs/uuid"
 	"github.com/minio/minio-go/v7"
 
 	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/hashing"
+	"github.com/networkteam/filestore/internal/bufpool"
+	"github.com/networkteam/filestore/internal/parallel"
 )
 
 // Filestore is a file store that stores files in a S3 compatible object storage (e.g. AWS S3 or MinIO).
@@ -18,9 +28,59 @@ type Filestore struct {
 	Client     *minio.Client
 	URL        string
 	BucketName string
+
+	verifyChecksum    bool
+	requesterPays     bool
+	operationTimeout  time.Duration
+	skipExisting      bool
+	maxObjectSize     int64
+	compatibilityMode bool
+	spoolDir          string
+	keyEncoding       hashing.KeyEncoding
+	keyDerivation     hashing.KeyDerivation
+	writeOnce         bool
+	retentionMode     minio.RetentionMode
+	retentionPeriod   time.Duration
+	legalHold         bool
+	tempPrefix        string
+	publicURL         string
+	imgproxySource    string
+	archiveClass      string
+	restoreDays       int
+	restoreTier       minio.TierType
+
+	bucketAutoCreate bool
+	bucketOptions    bucketOptions
+	lazyBucketCheck  bool
+	bucket           *bucketState
 }
 
-var _ filestore.FileStore = &Filestore{}
+const (
+	// DefaultTempPrefix is the default key prefix of temporary objects written by Store.
+	DefaultTempPrefix = "tmp/"
+	// DefaultImgproxySource is the default template of ImgproxyURLSource (see WithImgproxySource).
+	DefaultImgproxySource = "s3://{bucket}/{hash}"
+	// DefaultAccelerateEndpoint is the S3 Transfer Acceleration endpoint used by WithTransferAcceleration.
+	DefaultAccelerateEndpoint = "s3-accelerate.amazonaws.com"
+	// DefaultExistsManyConcurrency is the number of concurrent HEAD requests of ExistsMany.
+	DefaultExistsManyConcurrency = 16
+)
+
+var (
+	_ filestore.FileStore        = &Filestore{}
+	_ filestore.Stater           = &Filestore{}
+	_ filestore.DownloadURLer    = &Filestore{}
+	_ filestore.PublicURLer      = &Filestore{}
+	_ filestore.ParallelIterator = &Filestore{}
+	_ filestore.IfAbsentStorer   = &Filestore{}
+	_ filestore.InfoFetcher      = &Filestore{}
+	_ filestore.BatchRemover     = &Filestore{}
+	_ filestore.SortedIterator   = &Filestore{}
+	_ filestore.RangeFetcher     = &Filestore{}
+	_ filestore.Archiver         = &Filestore{}
+	_ filestore.Pinger           = &Filestore{}
+	_ filestore.BatchExister     = &Filestore{}
+)
 
 // NewFilestore creates a new S3 file store.
 func NewFilestore(ctx context.Context, endpoint, bucketName string, opts ...Option) (*Filestore, error) {
@@ -29,56 +89,158 @@ func NewFilestore(ctx context.Context, endpoint, bucketName string, opts ...Opti
 		opt(s3Options)
 	}
 
+	transport, err := buildTransport(s3Options)
+	if err != nil {
+		return nil, err
+	}
+
+	if s3Options.endpointResolver != nil {
+		endpoint, err = s3Options.endpointResolver(s3Options.region)
+		if err != nil {
+			return nil, fmt.Errorf("resolving endpoint for region %q: %w", s3Options.region, err)
+		}
+	}
+	if s3Options.accelerate != "" && strings.Contains(bucketName, ".") {
+		return nil, fmt.Errorf("transfer acceleration does not support bucket names with dots: %q", bucketName)
+	}
+
 	client, err := minio.New(endpoint, &minio.Options{
 		Creds:           s3Options.credentials,
 		Secure:          s3Options.secure,
 		Region:          s3Options.region,
 		BucketLookup:    s3Options.bucketLookup,
-		TrailingHeaders: s3Options.trailingHeaders,
-		Transport:       s3Options.transport,
+		TrailingHeaders: s3Options.trailingHeaders && !s3Options.compatibilityMode,
+		Transport:       transport,
 	})
 	if err != nil {
 		return nil, fmt.Errorf("creating MinIO client: %w", err)
 	}
 
+	if s3Options.accelerate != "" {
+		client.SetS3TransferAccelerate(s3Options.accelerate)
+	}
+
 	fileStore := &Filestore{
 		Client:     client,
 		URL:        endpoint,
 		BucketName: bucketName,
-	}
 
-	if !s3Options.bucketAutoCreate {
-		return fileStore, nil
+		verifyChecksum:   s3Options.verifyChecksum,
+		requesterPays:    s3Options.requesterPays,
+		operationTimeout: s3Options.operationTimeout,
+		skipExisting:     s3Options.skipExisting,
+		maxObjectSize:    s3Options.maxObjectSize,
+
+		compatibilityMode: s3Options.compatibilityMode,
+		spoolDir:          s3Options.spoolDir,
+		keyEncoding:       s3Options.keyEncoding,
+		keyDerivation:     s3Options.keyDerivation,
+		writeOnce:         s3Options.writeOnce,
+		retentionMode:     s3Options.retentionMode,
+		retentionPeriod:   s3Options.retentionPeriod,
+		legalHold:         s3Options.legalHold,
+		tempPrefix:        s3Options.tempPrefix,
+		publicURL:         s3Options.publicURL,
+		imgproxySource:    s3Options.imgproxySource,
+		archiveClass:      s3Options.archiveClass,
+		restoreDays:       s3Options.restoreDays,
+		restoreTier:       s3Options.restoreTier,
+
+		bucketAutoCreate: s3Options.bucketAutoCreate,
+		bucketOptions:    s3Options.bucketOptions,
+		lazyBucketCheck:  s3Options.lazyBucketCheck,
+		bucket:           &bucketState{},
 	}
-
-	bucketExists, err := client.BucketExists(ctx, bucketName)
-	if err != nil {
-		return nil, fmt.Errorf("checking if bucket %q exists: %w", bucketName, err)
+	if fileStore.keyEncoding == nil {
+		fileStore.keyEncoding = hashing.HexKeys
+	}
+	if fileStore.tempPrefix == "" {
+		fileStore.tempPrefix = DefaultTempPrefix
+	}
+	if fileStore.imgproxySource == "" {
+		fileStore.imgproxySource = DefaultImgproxySource
+	}
+	if fileStore.archiveClass == "" {
+		fileStore.archiveClass = DefaultArchiveStorageClass
+	}
+	if fileStore.restoreDays <= 0 {
+		fileStore.restoreDays = DefaultRestoreDays
+	}
+	if fileStore.restoreTier == "" {
+		fileStore.restoreTier = minio.TierStandard
 	}
 
-	if !bucketExists {
-		err = client.MakeBucket(ctx, bucketName, minio.MakeBucketOptions{})
-		if err != nil {
-			return nil, fmt.Errorf("creating bucket %q: %w", bucketName, err)
+	if s3Options.bucketAutoCreate && !s3Options.lazyBucketCheck {
+		if err := fileStore.EnsureBucket(ctx); err != nil {
+			return nil, err
 		}
 	}
 
 	return fileStore, nil
 }
 
+// Ping implements filestore.Pinger and checks that the bucket exists.
+func (f *Filestore) Ping(ctx context.Context) error {
+	ctx, cancel := f.withOperationTimeout(ctx)
+	defer cancel()
+
+	exists, err := f.Client.BucketExists(ctx, f.BucketName)
+	if err != nil {
+		return fmt.Errorf("checking if bucket %q exists: %w", f.BucketName, err)
+	}
+	if !exists {
+		return fmt.Errorf("%w: %q", ErrBucketNotExist, f.BucketName)
+	}
+	return nil
+}
+
 func (f *Filestore) StoreHashed(ctx context.Context, r io.Reader, hash string) error {
-	// Check if object already exists
-	_, err := f.Client.StatObject(ctx, f.BucketName, hash, minio.StatObjectOptions{})
-	if err == nil {
-		// Object already exists
-		return nil
+	_, err := f.storeHashed(ctx, r, hash)
+	return err
+}
+
+// StoreIfAbsent implements filestore.IfAbsentStorer.
+// The existence of the object is checked before it is put, because conditional puts are not supported by the client.
+// So concurrent calls for the same hash could all report that they stored the object.
+func (f *Filestore) StoreIfAbsent(ctx context.Context, r io.Reader, hash string) (created bool, err error) {
+	return f.storeHashed(ctx, r, hash)
+}
+
+// storeHashed stores the content of r with the given hash and returns true if it was stored.
+func (f *Filestore) storeHashed(ctx context.Context, r io.Reader, hash string) (created bool, err error) {
+	if err := f.ensureBucketLazily(ctx); err != nil {
+		return false, err
 	}
 
+	ctx, cancel := f.withOperationTimeout(ctx)
+	defer cancel()
+
 	var size int64 = -1
 	if sizedReader, ok := r.(Sized); ok {
 		size = sizedReader.Size()
 	}
 
+	// Check if object already exists
+	objectKey, info, err := f.statObject(ctx, hash)
+	if err == nil {
+		// Object already exists
+		if f.writeOnce {
+			if size >= 0 && size != info.Size {
+				return false, fmt.Errorf("%w: %s", filestore.ErrAlreadyExists, hash)
+			}
+			contentHash, err := hashing.HashReader(f.limitReader(r))
+			if err != nil {
+				return false, err
+			}
+			return false, f.checkSameContent(ctx, objectKey, hash, contentHash)
+		}
+		return false, nil
+	}
+
+	if f.maxObjectSize > 0 && size > f.maxObjectSize {
+		return false, filestore.ErrTooLarge
+	}
+
 	var contentType, contentDisposition string
 	if typedReader, ok := r.(ContentTyped); ok {
 		contentType = typedReader.ContentType()
@@ -87,20 +249,62 @@ func (f *Filestore) StoreHashed(ctx context.Context, r io.Reader, hash string) e
 		contentDisposition = dispoReader.ContentDisposition()
 	}
 
-	_, err = f.Client.PutObject(ctx, f.BucketName, hash, r, size, minio.PutObjectOptions{
+	var (
+		putCtx        = ctx
+		body          = f.limitReader(r)
+		hashingReader *hashing.HashingReader
+	)
+	if f.writeOnce {
+		putCtx = withConditionalPut(ctx)
+		hashingReader = hashing.NewHashingReader(body)
+		body = hashingReader
+	}
+	putOptions := minio.PutObjectOptions{
 		ContentType:        contentType,
 		ContentDisposition: contentDisposition,
-	})
+		DisableMultipart:   f.compatibilityMode && size >= 0 && size <= maxSinglePartSize,
+	}
+	f.applyObjectLock(&putOptions)
+	_, err = f.Client.PutObject(putCtx, f.BucketName, hash, body, size, putOptions)
+	if f.writeOnce && minio.ToErrorResponse(err).Code == "PreconditionFailed" {
+		// The object was stored concurrently, so the content is read completely to compare it
+		if _, err = bufpool.Copy(io.Discard, hashingReader); err != nil {
+			return false, fmt.Errorf("reading content: %w", err)
+		}
+		return false, f.checkSameContent(ctx, hash, hash, hashingReader.SumHex())
+	}
 	if err != nil {
-		return fmt.Errorf("putting object: %w", err)
+		return false, fmt.Errorf("putting object: %w", err)
 	}
 
+	return true, nil
+}
+
+// checkSameContent returns filestore.ErrAlreadyExists if the hex encoded hash of the content to store differs
+// from the hash of the content of the existing object.
+func (f *Filestore) checkSameContent(ctx context.Context, objectKey, hash, contentHash string) error {
+	object, _, err := f.getObject(ctx, objectKey)
+	if err != nil {
+		return err
+	}
+	defer object.Close()
+
+	existingHash, err := hashing.HashReader(object)
+	if err != nil {
+		return err
+	}
+	if existingHash != contentHash {
+		return fmt.Errorf("%w: %s", filestore.ErrAlreadyExists, hash)
+	}
 	return nil
 }
 
 func (f *Filestore) Exists(ctx context.Context, hash string) (bool, error) {
+	ctx, cancel := f.withOperationTimeout(ctx)
+	defer cancel()
+
 	// Check if object already exists
-	_, err := f.Client.StatObject(ctx, f.BucketName, hash, minio.StatObjectOptions{})
+	_, _, err := f.statObject(ctx, hash)
 	if err != nil {
 		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
 			return false, nil
@@ -111,33 +315,184 @@ func (f *Filestore) Exists(ctx context.Context, hash string) (bool, error) {
 	return true, nil
 }
 
+// ExistsMany implements filestore.BatchExister with up to DefaultExistsManyConcurrency concurrent HEAD requests.
+func (f *Filestore) ExistsMany(ctx context.Context, hashes []string) (map[string]bool, error) {
+	var (
+		mx     sync.Mutex
+		exists = make(map[string]bool, len(hashes))
+	)
+	err := parallel.ForEach(ctx, hashes, DefaultExistsManyConcurrency, func(ctx context.Context, hash string) error {
+		ok, err := f.Exists(ctx, hash)
+		if err != nil {
+			return err
+		}
+
+		mx.Lock()
+		exists[hash] = ok
+		mx.Unlock()
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return exists, nil
+}
+
 // Fetch gets an object from the S3 bucket by hash and returns a reader for the object.
 // It will stat the object to check for existence. If the object does not exist, it will return ErrNotExist.
 func (f *Filestore) Fetch(ctx context.Context, hash string) (io.ReadCloser, error) {
-	readCloser, err := f.Client.GetObject(ctx, f.BucketName, hash, minio.GetObjectOptions{})
+	r, _, err := f.fetch(ctx, "fetch", hash, 0)
+	return r, err
+}
+
+// FetchInfo implements filestore.InfoFetcher and returns a reader for the object together with the information of
+// the stat done by Fetch, so no separate request is needed.
+func (f *Filestore) FetchInfo(ctx context.Context, hash string) (io.ReadCloser, filestore.ObjectInfo, error) {
+	r, info, err := f.fetch(ctx, "fetch info", hash, 0)
+	if err != nil {
+		return nil, filestore.ObjectInfo{}, err
+	}
+	return r, objectInfo(hash, info), nil
+}
+
+// FetchRange implements filestore.RangeFetcher. The object is read with a range request starting at offset.
+func (f *Filestore) FetchRange(ctx context.Context, hash string, offset, length int64) (io.ReadCloser, error) {
+	r, _, err := f.fetch(ctx, "fetch range", hash, offset)
+	if err != nil {
+		return nil, err
+	}
+	if length < 0 {
+		return r, nil
+	}
+	return struct {
+		io.Reader
+		io.Closer
+	}{io.LimitReader(r, length), r}, nil
+}
+
+// fetch gets the object of a hash (or its legacy key) and seeks to offset, so the content is read with a range request.
+func (f *Filestore) fetch(ctx context.Context, op, hash string, offset int64) (_ io.ReadCloser, _ minio.ObjectInfo, err error) {
+	// The operation timeout also applies to reading the object, so it is cancelled when the reader is closed
+	ctx, cancel := f.withOperationTimeout(ctx)
+	defer func() {
+		if err != nil {
+			cancel()
+		}
+	}()
+
+	object, info, err := f.getObject(ctx, hash)
+	if legacyKey, ok := hashing.LegacyKey(f.keyEncoding, hash); ok && minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		object, info, err = f.getObject(ctx, legacyKey)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("getting object %q: %w", hash, err)
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return nil, minio.ObjectInfo{}, &filestore.NotExistError{Op: op, Hash: hash}
+		}
+		return nil, minio.ObjectInfo{}, err
+	}
+	if status := restoreStatus(info); status.Archived && !status.Restored {
+		_ = object.Close()
+		return nil, minio.ObjectInfo{}, fmt.Errorf("%s %q: %w", op, hash, filestore.ErrArchived)
+	}
+
+	if offset != 0 {
+		if offset < 0 || offset > info.Size {
+			_ = object.Close()
+			return nil, minio.ObjectInfo{}, fmt.Errorf("offset %d of %d bytes: %w", offset, info.Size, filestore.ErrInvalidRange)
+		}
+		if offset == info.Size {
+			// S3 rejects a range starting at the end of the object
+			_ = object.Close()
+			cancel()
+			return io.NopCloser(bytes.NewReader(nil)), info, nil
+		}
+		if _, err = object.Seek(offset, io.SeekStart); err != nil {
+			_ = object.Close()
+			return nil, minio.ObjectInfo{}, fmt.Errorf("seeking object: %w", err)
+		}
+	}
+
+	var readCloser io.ReadCloser = object
+	if f.operationTimeout > 0 {
+		readCloser = &cancelOnCloseReader{ReadCloser: object, cancel: cancel}
+	}
+	return readCloser, info, nil
+}
+
+// getObject gets an object by key and stats it to check for an error if the object does not exist.
+func (f *Filestore) getObject(ctx context.Context, key string) (*minio.Object, minio.ObjectInfo, error) {
+	object, err := f.Client.GetObject(ctx, f.BucketName, key, f.getObjectOptions())
+	if err != nil {
+		return nil, minio.ObjectInfo{}, fmt.Errorf("getting object %q: %w", key, err)
 	}
 
 	// We have to stat the object to check for an error if the hash does not exist
-	_, err = readCloser.Stat()
+	info, err := object.Stat()
 	if err != nil {
+		_ = object.Close()
 		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
-			return nil, filestore.ErrNotExist
+			return nil, minio.ObjectInfo{}, err
 		}
-		return nil, fmt.Errorf("getting object info %q: %w", hash, err)
+		return nil, minio.ObjectInfo{}, fmt.Errorf("getting object info %q: %w", key, err)
 	}
+	return object, info, nil
+}
 
-	return readCloser, nil
+// statObject stats the object of a key and returns its object key. If the object of an encoded key does not exist,
+// the object of the bare hex key (stored before the key encoding was set) is returned.
+func (f *Filestore) statObject(ctx context.Context, key string) (string, minio.ObjectInfo, error) {
+	info, err := f.Client.StatObject(ctx, f.BucketName, key, f.getObjectOptions())
+	if legacyKey, ok := hashing.LegacyKey(f.keyEncoding, key); ok && minio.ToErrorResponse(err).Code == "NoSuchKey" {
+		legacyInfo, legacyErr := f.Client.StatObject(ctx, f.BucketName, legacyKey, f.getObjectOptions())
+		if legacyErr == nil {
+			return legacyKey, legacyInfo, nil
+		}
+	}
+	return key, info, err
 }
 
 // ImgproxyURLSource implements the ImgproxyURLSourcer interface.
-// It returns a URL to the object that will be understood by imgproxy in the form of "s3://bucket-name/object-key".
+// It returns a URL to the object that will be understood by imgproxy in the form of "s3://bucket-name/object-key"
+// or from the template set with WithImgproxySource.
 func (f *Filestore) ImgproxyURLSource(hash string) (string, error) {
-	return fmt.Sprintf("s3://%s/%s", f.BucketName, hash), nil
+	return strings.NewReplacer("{bucket}", f.BucketName, "{hash}", hash).Replace(f.imgproxySource), nil
+}
+
+// DownloadURL implements filestore.DownloadURLer and returns a pre-signed URL to download the object.
+// If filename is not empty, the response has a content disposition of attachment with the filename.
+func (f *Filestore) DownloadURL(ctx context.Context, hash, filename string, expiry time.Duration) (string, error) {
+	reqParams := make(url.Values)
+	if filename != "" {
+		reqParams.Set("response-content-disposition", filestore.ContentDisposition("attachment", filename))
+	}
+	if f.requesterPays {
+		reqParams.Set("x-amz-request-payer", "requester")
+	}
+
+	u, err := f.Client.PresignedGetObject(ctx, f.BucketName, hash, expiry, reqParams)
+	if err != nil {
+		return "", fmt.Errorf("presigning object %q: %w", hash, err)
+	}
+	return u.String(), nil
+}
+
+// PublicURL implements filestore.PublicURLer. It returns the URL of the object below the base URL set with
+// WithPublicURL, or the path-style URL of the object on the endpoint otherwise (which requires public read access
+// to the bucket). The existence of the object is not checked.
+func (f *Filestore) PublicURL(hash string) (string, error) {
+	if f.publicURL != "" {
+		return filestore.ExpandPublicURL(f.publicURL, hash), nil
+	}
+	return f.Client.EndpointURL().JoinPath(f.BucketName, hash).String(), nil
+}
+
+// IteratesSorted implements filestore.SortedIterator.
+func (f *Filestore) IteratesSorted() bool {
+	return true
 }
 
 // Iterate iterates over all objects in the S3 bucket and calls the callback with a maxBatch amount of hashes.
+// Hashes are returned in lexicographic order as listed by S3.
 // Iteration will stop if the callback returns an error.
 func (f *Filestore) Iterate(ctx context.Context, maxBatch int, callback func(hashes []string) error) error {
 	objInfos := f.Client.ListObjects(ctx, f.BucketName, minio.ListObjectsOptions{})
@@ -149,6 +504,10 @@ func (f *Filestore) Iterate(ctx context.Context, maxBatch int, callback func(has
 			return fmt.Errorf("listing objects: %w", objInfo.Err)
 		}
 
+		if f.isTempKey(objInfo.Key) {
+			continue
+		}
+
 		hashes = append(hashes, objInfo.Key)
 		if len(hashes) == maxBatch {
 			err := callback(hashes)
@@ -165,39 +524,272 @@ func (f *Filestore) Iterate(ctx context.Context, maxBatch int, callback func(has
 	return nil
 }
 
+// isTempKey returns true if the key is a temporary object or a common prefix of a listing, which are no hashes.
+// Keys with a slash are always ignored, since other applications sharing the bucket can use other temp prefixes.
+func (f *Filestore) isTempKey(key string) bool {
+	return strings.HasPrefix(key, f.tempPrefix) || strings.Contains(key, "/")
+}
+
+// CleanupTemp removes temporary objects with the temp prefix of the file store (see WithTempPrefix) that were
+// modified before olderThan ago, e.g. after a process crashed while storing a file, and returns the number of
+// removed objects. Temporary objects of other prefixes are not touched.
+func (f *Filestore) CleanupTemp(ctx context.Context, olderThan time.Duration) (int, error) {
+	cutoff := time.Now().Add(-olderThan)
+
+	var keys []string
+	for objInfo := range f.Client.ListObjects(ctx, f.BucketName, minio.ListObjectsOptions{Prefix: f.tempPrefix, Recursive: true}) {
+		if objInfo.Err != nil {
+			return 0, fmt.Errorf("listing temp objects: %w", objInfo.Err)
+		}
+		if objInfo.LastModified.Before(cutoff) {
+			keys = append(keys, objInfo.Key)
+		}
+	}
+
+	for i, key := range keys {
+		if err := f.Client.RemoveObject(ctx, f.BucketName, key, minio.RemoveObjectOptions{}); err != nil {
+			return i, fmt.Errorf("removing temp object %q: %w", key, err)
+		}
+	}
+	return len(keys), nil
+}
+
+// iterateParallelBatchSize is the maximum number of hashes per callback of IterateParallel.
+const iterateParallelBatchSize = 1000
+
+// IterateParallel implements filestore.ParallelIterator. Objects are listed by the 256 hash prefixes "00" to "ff"
+// (and their encoded keys, see WithKeyEncoding) with up to workers concurrent listings, callback is called with
+// batches of hashes of a single prefix.
+// Objects with keys that are not hex encoded hashes are not returned.
+func (f *Filestore) IterateParallel(ctx context.Context, workers int, callback func(hashes []string) error) error {
+	type keyPrefix struct {
+		prefix  string
+		encoded bool
+	}
+	var prefixes []keyPrefix
+	for i := 0; i < 256; i++ {
+		hexPrefix := fmt.Sprintf("%02x", i)
+		prefixes = append(prefixes, keyPrefix{prefix: hexPrefix})
+		if encodedPrefix := f.keyEncoding.Encode(hexPrefix); encodedPrefix != hexPrefix {
+			prefixes = append(prefixes, keyPrefix{prefix: encodedPrefix, encoded: true})
+		}
+	}
+
+	return parallel.ForEach(ctx, prefixes, workers, func(ctx context.Context, p keyPrefix) error {
+		hashes := make([]string, 0, iterateParallelBatchSize)
+		for objInfo := range f.Client.ListObjects(ctx, f.BucketName, minio.ListObjectsOptions{Prefix: p.prefix}) {
+			if objInfo.Err != nil {
+				return fmt.Errorf("listing objects with prefix %q: %w", p.prefix, objInfo.Err)
+			}
+			// Encoded keys can start with a hex prefix (e.g. multihash keys), so they are only returned for encoded prefixes
+			if _, encoded := hashing.LegacyKey(f.keyEncoding, objInfo.Key); encoded != p.encoded || f.isTempKey(objInfo.Key) {
+				continue
+			}
+
+			hashes = append(hashes, objInfo.Key)
+			if len(hashes) == iterateParallelBatchSize {
+				if err := callback(hashes); err != nil {
+					return err
+				}
+				hashes = hashes[:0]
+			}
+		}
+
+		if len(hashes) > 0 {
+			return callback(hashes)
+		}
+		return nil
+	})
+}
+
 // Remove removes an object from the S3 bucket by hash.
-// It is not guaranteed to error if the hash does not exist.
+// Since S3 does not report missing objects when deleting, the object is checked for existence first
+// and a filestore.NotExistError is returned if it does not exist.
 func (f *Filestore) Remove(ctx context.Context, hash string) error {
-	err := f.Client.RemoveObject(ctx, f.BucketName, hash, minio.RemoveObjectOptions{})
+	ctx, cancel := f.withOperationTimeout(ctx)
+	defer cancel()
+
+	objectKey, _, err := f.statObject(ctx, hash)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return &filestore.NotExistError{Op: "remove", Hash: hash}
+		}
+		return fmt.Errorf("getting object info %q: %w", hash, err)
+	}
+
+	err = f.Client.RemoveObject(ctx, f.BucketName, objectKey, minio.RemoveObjectOptions{})
 	if err != nil {
 		return fmt.Errorf("removing object %q: %w", hash, err)
 	}
 	return nil
 }
 
+// RemoveBatch implements filestore.BatchRemover and removes objects with DeleteObjects requests of up to 1000 keys.
+// Keys must be given as returned by Iterate, missing objects are ignored.
+func (f *Filestore) RemoveBatch(ctx context.Context, hashes []string) error {
+	ctx, cancel := f.withOperationTimeout(ctx)
+	defer cancel()
+
+	objectsCh := make(chan minio.ObjectInfo)
+	go func() {
+		defer close(objectsCh)
+		for _, hash := range hashes {
+			select {
+			case objectsCh <- minio.ObjectInfo{Key: hash}:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	var err error
+	for removeErr := range f.Client.RemoveObjects(ctx, f.BucketName, objectsCh, minio.RemoveObjectsOptions{}) {
+		if err == nil {
+			err = fmt.Errorf("removing object %q: %w", removeErr.ObjectName, removeErr.Err)
+		}
+	}
+	if err != nil {
+		return err
+	}
+	return ctx.Err()
+}
+
+// Stat returns information about an object in the S3 bucket by hash.
+func (f *Filestore) Stat(ctx context.Context, hash string) (filestore.ObjectInfo, error) {
+	ctx, cancel := f.withOperationTimeout(ctx)
+	defer cancel()
+
+	_, info, err := f.statObject(ctx, hash)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return filestore.ObjectInfo{}, &filestore.NotExistError{Op: "stat", Hash: hash}
+		}
+		return filestore.ObjectInfo{}, fmt.Errorf("getting object info %q: %w", hash, err)
+	}
+
+	return objectInfo(hash, info), nil
+}
+
+func objectInfo(hash string, info minio.ObjectInfo) filestore.ObjectInfo {
+	return filestore.ObjectInfo{
+		Hash:               hash,
+		Size:               info.Size,
+		ContentType:        info.ContentType,
+		ContentDisposition: info.Metadata.Get("Content-Disposition"),
+	}
+}
+
 // Size returns the size of an object in the S3 bucket by hash.
 func (f *Filestore) Size(ctx context.Context, hash string) (int64, error) {
-	object, err := f.Client.GetObject(ctx, f.BucketName, hash, minio.GetObjectOptions{})
+	ctx, cancel := f.withOperationTimeout(ctx)
+	defer cancel()
+
+	_, info, err := f.statObject(ctx, hash)
 	if err != nil {
-		return 0, fmt.Errorf("getting object %q: %w", hash, err)
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return 0, &filestore.NotExistError{Op: "size", Hash: hash}
+		}
+		return 0, fmt.Errorf("getting object info %q: %w", hash, err)
 	}
 
-	stat, err := object.Stat()
+	return info.Size, nil
+}
+
+// CopyTo copies an object by hash to another S3 file store using a server-side copy, so the content is not
+// transferred through the application. Objects larger than 5 GiB are copied with a multipart copy.
+// The destination client must be able to read from this bucket (e.g. both stores use the same endpoint and credentials).
+// If the object already exists in the destination, nothing is copied.
+// If one of the stores uses WithCompatibilityMode, the object is fetched from this store and uploaded to the
+// destination instead of being copied.
+func (f *Filestore) CopyTo(ctx context.Context, dst *Filestore, hash string) error {
+	ctx, cancel := f.withOperationTimeout(ctx)
+	defer cancel()
+
+	exists, err := dst.Exists(ctx, hash)
 	if err != nil {
-		return 0, fmt.Errorf("statting object %q: %w", hash, err)
+		return fmt.Errorf("checking destination: %w", err)
+	}
+	if exists {
+		return nil
+	}
+
+	objectKey, info, err := f.statObject(ctx, hash)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return &filestore.NotExistError{Op: "copy", Hash: hash}
+		}
+		return fmt.Errorf("getting object info %q: %w", hash, err)
+	}
+
+	if f.compatibilityMode || dst.compatibilityMode {
+		return f.copyByUpload(ctx, dst, objectKey, hash, info)
 	}
 
-	return stat.Size, nil
+	dstOpts := minio.CopyDestOptions{
+		Bucket: dst.BucketName,
+		Object: hash,
+	}
+	dstOpts.Mode, dstOpts.RetainUntilDate, dstOpts.LegalHold = dst.objectLock()
+	srcOpts := minio.CopySrcOptions{
+		Bucket: f.BucketName,
+		Object: objectKey,
+	}
+	if info.Size > maxSinglePartSize {
+		_, err = dst.Client.ComposeObject(ctx, dstOpts, srcOpts)
+	} else {
+		_, err = dst.Client.CopyObject(ctx, dstOpts, srcOpts)
+	}
+	if err != nil {
+		return fmt.Errorf("copying object %q to bucket %q: %w", hash, dst.BucketName, err)
+	}
+
+	return nil
 }
 
+// copyByUpload copies an object to another S3 file store by fetching and uploading it, since objects cannot be copied
+// in compatibility mode.
+func (f *Filestore) copyByUpload(ctx context.Context, dst *Filestore, objectKey, hash string, info minio.ObjectInfo) error {
+	object, err := f.Client.GetObject(ctx, f.BucketName, objectKey, f.getObjectOptions())
+	if err != nil {
+		return fmt.Errorf("getting object %q: %w", objectKey, err)
+	}
+	defer object.Close()
+
+	_, err = dst.storeHashed(ctx, filestore.NewReader(
+		object,
+		filestore.WithSize(info.Size),
+		filestore.WithContentType(info.ContentType),
+		filestore.WithContentDisposition(info.Metadata.Get("Content-Disposition")),
+	), hash)
+	if err != nil {
+		return fmt.Errorf("uploading object %q to bucket %q: %w", hash, dst.BucketName, err)
+	}
+
+	return nil
+}
+
+// maxSinglePartSize is the maximum size of an object that can be uploaded or copied with a single request.
+const maxSinglePartSize = 5 * 1024 * 1024 * 1024
+
 // Store stores an object in the S3 bucket by hash.
 // The reader should implement Sized for better performance (the client can optimize the operation given the size and reduce memory usage).
 // The reader can implement ContentTyped or ContentDispositioned to set the content type or content disposition of the object.
+// The reader can implement Hashed to give the expected hash of the content, Store fails if the content does not match.
 func (f *Filestore) Store(ctx context.Context, r io.Reader) (string, error) {
+	if err := f.ensureBucketLazily(ctx); err != nil {
+		return "", err
+	}
+
+	ctx, cancel := f.withOperationTimeout(ctx)
+	defer cancel()
+
 	var size int64 = -1
 	if sizedReader, ok := r.(Sized); ok {
 		size = sizedReader.Size()
 	}
+	if f.maxObjectSize > 0 && size > f.maxObjectSize {
+		return "", filestore.ErrTooLarge
+	}
 
 	var contentType, contentDisposition string
 	if typedReader, ok := r.(ContentTyped); ok {
@@ -207,35 +799,83 @@ func (f *Filestore) Store(ctx context.Context, r io.Reader) (string, error) {
 		contentDisposition = dispoReader.ContentDisposition()
 	}
 
-	digest := sha256.New()
-	hashedReader := io.TeeReader(r, digest)
+	putOptions := minio.PutObjectOptions{
+		ContentType:        contentType,
+		ContentDisposition: contentDisposition,
+	}
+
+	expectedHash, err := f.expectedHash(r)
+	if err != nil {
+		return "", err
+	}
+
+	if f.skipExisting && expectedHash != nil {
+		expectedKey := f.key(hex.EncodeToString(expectedHash))
+		exists, err := f.Exists(ctx, expectedKey)
+		if err != nil {
+			return "", err
+		}
+		if exists {
+			return expectedKey, nil
+		}
+	}
+
+	if f.compatibilityMode {
+		return f.storeDirect(ctx, r, size, expectedHash, putOptions)
+	}
+
+	// Let the server verify the content if we know the hash in advance
+	if f.verifyChecksum && expectedHash != nil {
+		putOptions.UserMetadata = map[string]string{
+			"X-Amz-Checksum-Sha256": base64.StdEncoding.EncodeToString(expectedHash),
+		}
+	}
+
+	hashedReader := hashing.NewHashingReader(f.limitReader(r))
 
 	tmpID, err := uuid.NewV4()
 	if err != nil {
 		return "", fmt.Errorf("generating temp id: %w", err)
 	}
-	tmpObjectName := fmt.Sprintf("tmp/%s", tmpID)
+	tmpObjectName := f.tempPrefix + tmpID.String()
 
-	_, err = f.Client.PutObject(ctx, f.BucketName, tmpObjectName, hashedReader, size, minio.PutObjectOptions{
-		ContentType:        contentType,
-		ContentDisposition: contentDisposition,
-	})
+	_, err = f.Client.PutObject(ctx, f.BucketName, tmpObjectName, hashedReader, size, putOptions)
 	if err != nil {
 		return "", fmt.Errorf("putting temp object %q: %w", tmpObjectName, err)
 	}
 
-	hashBytes := digest.Sum(nil)
-	hashHex := hex.EncodeToString(hashBytes)
+	hashBytes := hashedReader.Sum()
+	key := f.key(hex.EncodeToString(hashBytes))
 
-	_, err = f.Client.CopyObject(ctx, minio.CopyDestOptions{
-		Bucket: f.BucketName,
-		Object: hashHex,
-	}, minio.CopySrcOptions{
-		Bucket: f.BucketName,
-		Object: tmpObjectName,
-	})
+	if f.verifyChecksum || expectedHash != nil {
+		if err = f.verifyTempObject(ctx, tmpObjectName, expectedHash, hashBytes); err != nil {
+			if removeErr := f.Client.RemoveObject(ctx, f.BucketName, tmpObjectName, minio.RemoveObjectOptions{}); removeErr != nil {
+				return "", fmt.Errorf("removing temp object after failed verification: %v: %w", removeErr, err)
+			}
+			return "", err
+		}
+	}
+
+	// Existing objects are not copied again, so every Store of the same content does not create a new (locked)
+	// version of the object
+	exists, err := f.Exists(ctx, key)
 	if err != nil {
-		return "", fmt.Errorf("copying temp object %q: %w", tmpObjectName, err)
+		return "", err
+	}
+	if !exists {
+		// The object lock is only applied to the final object, so the temp object can be removed
+		dstOpts := minio.CopyDestOptions{
+			Bucket: f.BucketName,
+			Object: key,
+		}
+		dstOpts.Mode, dstOpts.RetainUntilDate, dstOpts.LegalHold = f.objectLock()
+		_, err = f.Client.CopyObject(ctx, dstOpts, minio.CopySrcOptions{
+			Bucket: f.BucketName,
+			Object: tmpObjectName,
+		})
+		if err != nil {
+			return "", fmt.Errorf("copying temp object %q: %w", tmpObjectName, err)
+		}
 	}
 
 	err = f.Client.RemoveObject(ctx, f.BucketName, tmpObjectName, minio.RemoveObjectOptions{})
@@ -243,5 +883,114 @@ func (f *Filestore) Store(ctx context.Context, r io.Reader) (string, error) {
 		return "", fmt.Errorf("removing temp object: %w", err)
 	}
 
-	return hashHex, nil
+	return key, nil
+}
+
+// key returns the object key of content with the hex encoded hash.
+func (f *Filestore) key(hexHash string) string {
+	if f.keyDerivation != nil {
+		hexHash = f.keyDerivation(hexHash)
+	}
+	return f.keyEncoding.Encode(hexHash)
+}
+
+// limitReader limits r to the max object size if set.
+func (f *Filestore) limitReader(r io.Reader) io.Reader {
+	if f.maxObjectSize <= 0 {
+		return r
+	}
+	return filestore.LimitReader(r, f.maxObjectSize)
+}
+
+// ErrChecksumMismatch is returned by Store if the content received by the server does not match the hash calculated
+// while uploading (with checksum verification enabled) or the hash given by a Hashed reader.
+var ErrChecksumMismatch = errors.New("checksum mismatch")
+
+// verifyTempObject checks that the uploaded temp object matches the hash calculated during upload.
+// If the hash was known in advance, the calculated hash must match it (and the server already verified the content
+// with checksum verification enabled). Otherwise, the object is read back and hashed again.
+func (f *Filestore) verifyTempObject(ctx context.Context, objectName string, expectedHash, hashBytes []byte) error {
+	if expectedHash != nil {
+		if !bytes.Equal(expectedHash, hashBytes) {
+			return fmt.Errorf("verifying temp object %q: content does not match expected hash: %w", objectName, ErrChecksumMismatch)
+		}
+		return nil
+	}
+
+	object, err := f.Client.GetObject(ctx, f.BucketName, objectName, f.getObjectOptions())
+	if err != nil {
+		return fmt.Errorf("getting temp object %q: %w", objectName, err)
+	}
+	defer object.Close()
+
+	hashingReader := hashing.NewHashingReader(object)
+	if _, err = bufpool.Copy(io.Discard, hashingReader); err != nil {
+		return fmt.Errorf("reading temp object %q: %w", objectName, err)
+	}
+
+	if !bytes.Equal(hashingReader.Sum(), hashBytes) {
+		return fmt.Errorf("verifying temp object %q: %w", objectName, ErrChecksumMismatch)
+	}
+	return nil
+}
+
+// expectedHash returns the hash of the reader content if it is known before uploading.
+// It is given by a Hashed reader or calculated in advance if the reader can be rewound and the hash is needed for
+// checksum verification or skipping existing objects. Otherwise, nil is returned.
+func (f *Filestore) expectedHash(r io.Reader) ([]byte, error) {
+	if hashedReader, ok := r.(Hashed); ok {
+		expectedHash, err := hex.DecodeString(hashedReader.Hash())
+		if err != nil {
+			return nil, fmt.Errorf("decoding expected hash: %w", err)
+		}
+		return expectedHash, nil
+	}
+
+	if !f.verifyChecksum && !f.skipExisting {
+		return nil, nil
+	}
+	if seeker, ok := r.(io.Seeker); ok {
+		return hashAndRewind(r, seeker)
+	}
+	return nil, nil
+}
+
+// withOperationTimeout returns a context with the configured operation timeout (if any).
+func (f *Filestore) withOperationTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if f.operationTimeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, f.operationTimeout)
+}
+
+// getObjectOptions returns the options for getting or statting objects.
+func (f *Filestore) getObjectOptions() minio.GetObjectOptions {
+	var opts minio.GetObjectOptions
+	if f.requesterPays {
+		opts.Set("x-amz-request-payer", "requester")
+	}
+	return opts
+}
+
+func hashAndRewind(r io.Reader, seeker io.Seeker) ([]byte, error) {
+	offset, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, fmt.Errorf("getting reader offset: %w", err)
+	}
+
+	hashingReader := hashing.NewHashingReader(r)
+	if _, err = bufpool.Copy(io.Discard, hashingReader); err != nil {
+		return nil, fmt.Errorf("hashing reader: %w", err)
+	}
+
+	if _, err = seeker.Seek(offset, io.SeekStart); err != nil {
+		return nil, fmt.Errorf("rewinding reader: %w", err)
+	}
+
+	return hashingReader.Sum(), nil
+}
+
+// FS returns an fs.FS that opens files by hash (e.g. for use with http.FileServer via http.FS).
+func (f *Filestore) FS() fs.FS {
+	return filestore.NewFS(f)
 }
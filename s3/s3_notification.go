@@ -0,0 +1,64 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/minio/minio-go/v7/pkg/notification"
+
+	"github.com/networkteam/filestore"
+)
+
+// Subscribe listens for bucket notifications and calls handler with a filestore.Event for every object that was
+// stored or removed in the bucket (also by other writers than this file store). Temporary objects are ignored.
+// It blocks until the context is done or the handler returns an error.
+//
+// Listening for bucket notifications is a MinIO specific API and not supported by AWS S3.
+func (f *Filestore) Subscribe(ctx context.Context, handler func(event filestore.Event) error) error {
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	infos := f.Client.ListenBucketNotification(ctx, f.BucketName, "", "", []string{
+		string(notification.ObjectCreatedAll),
+		string(notification.ObjectRemovedAll),
+	})
+	for info := range infos {
+		if info.Err != nil {
+			return fmt.Errorf("listening for bucket notifications: %w", info.Err)
+		}
+
+		for _, record := range info.Records {
+			event, ok := f.eventFromRecord(record)
+			if !ok {
+				continue
+			}
+			if err := handler(event); err != nil {
+				return err
+			}
+		}
+	}
+
+	return ctx.Err()
+}
+
+func (f *Filestore) eventFromRecord(record notification.Event) (filestore.Event, bool) {
+	// Object keys in notifications are URL encoded
+	key, err := url.QueryUnescape(record.S3.Object.Key)
+	if err != nil {
+		key = record.S3.Object.Key
+	}
+	if f.isTempKey(key) {
+		return filestore.Event{}, false
+	}
+
+	switch {
+	case strings.HasPrefix(record.EventName, "s3:ObjectCreated:"):
+		return filestore.Event{Type: filestore.EventStored, Hash: key}, true
+	case strings.HasPrefix(record.EventName, "s3:ObjectRemoved:"):
+		return filestore.Event{Type: filestore.EventRemoved, Hash: key}, true
+	default:
+		return filestore.Event{}, false
+	}
+}
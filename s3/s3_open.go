@@ -0,0 +1,125 @@
+package s3
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/hashing"
+)
+
+func init() {
+	filestore.Register("s3", Open)
+}
+
+// ErrMissingBucket is returned by Open if the DSN has no bucket name in the path.
+var ErrMissingBucket = errors.New("missing bucket name")
+
+// Open opens an S3 file store from a DSN like "s3://key:secret@endpoint/bucket?region=eu-central-1&secure=true" for
+// filestore.Open. Supported query parameters are region, secure, bucketLookup (dns or path), autoCreate,
+// verifyChecksum, skipExisting, writeOnce, legalHold, accelerate (see WithTransferAcceleration), maxObjectSize (in
+// bytes), keyEncoding (hex, prefixed or multihash), retentionMode (governance or compliance), retentionPeriod (a
+// duration like "720h"), proxy (a proxy URL), tempPrefix, publicURL (see WithPublicURL), imgproxySource (see
+// WithImgproxySource), archiveStorageClass, restoreDays and restoreTier (Standard, Bulk or Expedited).
+func Open(ctx context.Context, dsn *url.URL) (filestore.FileStore, error) {
+	bucketName := strings.Trim(dsn.Path, "/")
+	if bucketName == "" {
+		return nil, ErrMissingBucket
+	}
+
+	params := dsn.Query()
+
+	var opts []Option
+	if dsn.User != nil {
+		secretKey, _ := dsn.User.Password()
+		opts = append(opts, WithCredentialsV4(dsn.User.Username(), secretKey, ""))
+	}
+	if region := params.Get("region"); region != "" {
+		opts = append(opts, WithRegion(region))
+	}
+	switch params.Get("bucketLookup") {
+	case "dns":
+		opts = append(opts, WithBucketLookupDNS())
+	case "path":
+		opts = append(opts, WithBucketLookupPath())
+	}
+	for param, opt := range map[string]Option{
+		"secure":          WithSecure(),
+		"autoCreate":      WithBucketAutoCreate(),
+		"verifyChecksum":  WithChecksumVerification(),
+		"skipExisting":    WithSkipExistingUploads(),
+		"writeOnce":       WithWriteOnce(),
+		"legalHold":       WithLegalHold(),
+		"accelerate":      WithTransferAcceleration(),
+		"lazyBucketCheck": WithLazyBucketCheck(),
+	} {
+		if enabled, _ := strconv.ParseBool(params.Get(param)); enabled {
+			opts = append(opts, opt)
+		}
+	}
+	if keyEncoding := params.Get("keyEncoding"); keyEncoding != "" {
+		encoding, err := hashing.ParseKeyEncoding(keyEncoding)
+		if err != nil {
+			return nil, err
+		}
+		opts = append(opts, WithKeyEncoding(encoding))
+	}
+	if maxObjectSize := params.Get("maxObjectSize"); maxObjectSize != "" {
+		n, err := strconv.ParseInt(maxObjectSize, 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("parsing maxObjectSize: %w", err)
+		}
+		opts = append(opts, WithMaxObjectSize(n))
+	}
+
+	if retentionMode := params.Get("retentionMode"); retentionMode != "" {
+		mode := minio.RetentionMode(strings.ToUpper(retentionMode))
+		if !mode.IsValid() {
+			return nil, fmt.Errorf("invalid retentionMode %q", retentionMode)
+		}
+		period, err := time.ParseDuration(params.Get("retentionPeriod"))
+		if err != nil {
+			return nil, fmt.Errorf("parsing retentionPeriod: %w", err)
+		}
+		opts = append(opts, WithRetention(mode, period))
+	}
+	if proxy := params.Get("proxy"); proxy != "" {
+		proxyURL, err := url.Parse(proxy)
+		if err != nil {
+			return nil, fmt.Errorf("parsing proxy: %w", err)
+		}
+		opts = append(opts, WithProxy(proxyURL))
+	}
+	if tempPrefix := params.Get("tempPrefix"); tempPrefix != "" {
+		opts = append(opts, WithTempPrefix(tempPrefix))
+	}
+	if publicURL := params.Get("publicURL"); publicURL != "" {
+		opts = append(opts, WithPublicURL(publicURL))
+	}
+	if imgproxySource := params.Get("imgproxySource"); imgproxySource != "" {
+		opts = append(opts, WithImgproxySource(imgproxySource))
+	}
+	if archiveClass := params.Get("archiveStorageClass"); archiveClass != "" {
+		opts = append(opts, WithArchiveStorageClass(archiveClass))
+	}
+	if params.Has("restoreDays") || params.Has("restoreTier") {
+		var days int
+		if restoreDays := params.Get("restoreDays"); restoreDays != "" {
+			var err error
+			days, err = strconv.Atoi(restoreDays)
+			if err != nil {
+				return nil, fmt.Errorf("parsing restoreDays: %w", err)
+			}
+		}
+		opts = append(opts, WithRestore(days, minio.TierType(params.Get("restoreTier"))))
+	}
+
+	return NewFilestore(ctx, dsn.Host, bucketName, opts...)
+}
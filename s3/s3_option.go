@@ -1,20 +1,59 @@
 package s3
 
 import (
+	"context"
+	"crypto/tls"
+	"net"
 	"net/http"
+	"net/url"
+	"time"
 
 	"github.com/minio/minio-go/v7"
 	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/lifecycle"
+
+	"github.com/networkteam/filestore/hashing"
 )
 
 type options struct {
 	credentials      *credentials.Credentials
 	secure           bool
 	region           string
+	endpointResolver EndpointResolver
+	accelerate       string
 	bucketLookup     minio.BucketLookupType
 	trailingHeaders  bool
 	transport        http.RoundTripper
+	httpClient       httpClientOptions
 	bucketAutoCreate bool
+	bucketOptions    bucketOptions
+	lazyBucketCheck  bool
+	verifyChecksum   bool
+	requesterPays    bool
+	requestHeaders   http.Header
+	operationTimeout time.Duration
+	requestTimeout   time.Duration
+	requestObservers []RequestObserver
+	maxRetries       int
+	retryBackoff     time.Duration
+	retryMaxBackoff  time.Duration
+	skipExisting     bool
+	maxObjectSize    int64
+	keyEncoding      hashing.KeyEncoding
+	keyDerivation    hashing.KeyDerivation
+	writeOnce        bool
+	retentionMode    minio.RetentionMode
+	retentionPeriod  time.Duration
+	legalHold        bool
+	tempPrefix       string
+	publicURL        string
+	imgproxySource   string
+	archiveClass     string
+	restoreDays      int
+	restoreTier      minio.TierType
+
+	compatibilityMode bool
+	spoolDir          string
 }
 
 // Option is a functional option for creating a S3 file store.
@@ -52,6 +91,35 @@ func WithRegion(region string) Option {
 	}
 }
 
+// An EndpointResolver returns the endpoint (host and optional port) for a region, e.g. a region specific endpoint
+// of an S3 compatible service or a VPC endpoint. The region is empty if no region was set.
+type EndpointResolver func(region string) (endpoint string, err error)
+
+// WithEndpointResolver resolves the endpoint of the S3 client for the region (see WithRegion) when creating the file
+// store. The resolved endpoint replaces the endpoint given to NewFilestore.
+func WithEndpointResolver(resolver EndpointResolver) Option {
+	return func(opts *options) {
+		opts.endpointResolver = resolver
+	}
+}
+
+// WithTransferAcceleration sends requests (and builds pre-signed URLs) for the bucket to the S3 Transfer Acceleration
+// endpoint, e.g. for uploads from another continent. Acceleration must be enabled for the bucket and is only
+// supported for AWS endpoints and bucket names without dots, for other endpoints the option has no effect.
+func WithTransferAcceleration() Option {
+	return func(opts *options) {
+		opts.accelerate = DefaultAccelerateEndpoint
+	}
+}
+
+// WithTransferAccelerationEndpoint is like WithTransferAcceleration with another acceleration endpoint
+// (e.g. "s3-accelerate.dualstack.amazonaws.com" for IPv6 support).
+func WithTransferAccelerationEndpoint(endpoint string) Option {
+	return func(opts *options) {
+		opts.accelerate = endpoint
+	}
+}
+
 // WithBucketLookupPath sets the bucket lookup to path style.
 // If not set, the bucket lookup is set to auto.
 func WithBucketLookupPath() Option {
@@ -75,15 +143,358 @@ func WithTrailingHeaders() Option {
 }
 
 // WithTransport sets a custom HTTP transport for testing or special needs.
+// It cannot be combined with options for the default transport (e.g. WithMaxIdleConnsPerHost or WithTLSConfig).
 func WithTransport(transport http.RoundTripper) Option {
 	return func(opts *options) {
 		opts.transport = transport
 	}
 }
 
+// httpClientOptions configure the default transport of the S3 client.
+type httpClientOptions struct {
+	maxIdleConnsPerHost int
+	idleConnTimeout     time.Duration
+	tlsConfig           *tls.Config
+	caCertificates      [][]byte
+	clientCertificates  []tls.Certificate
+	insecureSkipVerify  bool
+	proxy               func(*http.Request) (*url.URL, error)
+	dialContext         func(ctx context.Context, network, addr string) (net.Conn, error)
+	resolver            *net.Resolver
+}
+
+func (o httpClientOptions) isSet() bool {
+	return o.maxIdleConnsPerHost > 0 || o.idleConnTimeout > 0 || o.tlsConfig != nil || len(o.caCertificates) > 0 ||
+		len(o.clientCertificates) > 0 || o.insecureSkipVerify || o.proxy != nil || o.dialContext != nil || o.resolver != nil
+}
+
+// WithMaxIdleConnsPerHost sets the maximum number of idle (keep-alive) connections to the endpoint
+// (the MinIO client defaults to 16). It should be raised for many concurrent requests (e.g. parallel uploads).
+func WithMaxIdleConnsPerHost(n int) Option {
+	return func(opts *options) {
+		opts.httpClient.maxIdleConnsPerHost = n
+	}
+}
+
+// WithIdleConnTimeout sets the time after which idle connections are closed (the MinIO client defaults to a minute).
+func WithIdleConnTimeout(timeout time.Duration) Option {
+	return func(opts *options) {
+		opts.httpClient.idleConnTimeout = timeout
+	}
+}
+
+// WithTLSConfig sets the TLS configuration for connections to the endpoint.
+// CA certificates, client certificates and WithInsecureSkipVerify are applied to a copy of config.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(opts *options) {
+		opts.httpClient.tlsConfig = config
+	}
+}
+
+// WithCACertificates trusts the PEM encoded CA certificates in addition to the system certificates
+// (e.g. for an endpoint with a certificate of a private CA).
+func WithCACertificates(pemCerts []byte) Option {
+	return func(opts *options) {
+		opts.httpClient.caCertificates = append(opts.httpClient.caCertificates, pemCerts)
+	}
+}
+
+// WithClientCertificate presents the certificate to endpoints requiring mutual TLS.
+// Use tls.LoadX509KeyPair to load a certificate from files.
+func WithClientCertificate(cert tls.Certificate) Option {
+	return func(opts *options) {
+		opts.httpClient.clientCertificates = append(opts.httpClient.clientCertificates, cert)
+	}
+}
+
+// WithInsecureSkipVerify disables the verification of the certificate of the endpoint.
+// This is insecure and should only be used for development (e.g. with a self-signed certificate).
+func WithInsecureSkipVerify() Option {
+	return func(opts *options) {
+		opts.httpClient.insecureSkipVerify = true
+	}
+}
+
+// WithProxy sends all requests via the HTTP(S) proxy with the given URL (e.g. "http://proxy.example.com:3128",
+// credentials can be set as user info). By default, the proxy is taken from the HTTP_PROXY, HTTPS_PROXY and
+// NO_PROXY environment variables.
+func WithProxy(proxyURL *url.URL) Option {
+	return func(opts *options) {
+		opts.httpClient.proxy = http.ProxyURL(proxyURL)
+	}
+}
+
+// WithProxyFunc selects the proxy for each request (see http.Transport.Proxy), a nil URL sends the request directly.
+func WithProxyFunc(proxy func(*http.Request) (*url.URL, error)) Option {
+	return func(opts *options) {
+		opts.httpClient.proxy = proxy
+	}
+}
+
+// WithDialContext sets the function to open connections to the endpoint (or proxy), e.g. to connect via a tunnel.
+// It takes precedence over WithResolver.
+func WithDialContext(dialContext func(ctx context.Context, network, addr string) (net.Conn, error)) Option {
+	return func(opts *options) {
+		opts.httpClient.dialContext = dialContext
+	}
+}
+
+// WithResolver resolves the host names of the endpoint (and proxy) with the given resolver, e.g. to use an internal
+// DNS server (see net.Resolver.Dial).
+func WithResolver(resolver *net.Resolver) Option {
+	return func(opts *options) {
+		opts.httpClient.resolver = resolver
+	}
+}
+
 // WithBucketAutoCreate sets the automatic creation of the bucket if it doesn't exist yet.
-func WithBucketAutoCreate() Option {
+// Additional bucket options can be given to configure the bucket after it was created.
+func WithBucketAutoCreate(bucketOpts ...BucketOption) Option {
 	return func(opts *options) {
 		opts.bucketAutoCreate = true
+		for _, bucketOpt := range bucketOpts {
+			bucketOpt(&opts.bucketOptions)
+		}
+	}
+}
+
+// WithLazyBucketCheck skips the bucket check (and creation, see WithBucketAutoCreate) in NewFilestore, so no bucket
+// level request is sent when creating the file store. Instead, the bucket is checked once before the first object is
+// stored (see Filestore.EnsureBucket). If the credentials are not allowed to check the bucket (e.g. without the
+// s3:ListBucket permission), the bucket is assumed to exist.
+func WithLazyBucketCheck() Option {
+	return func(opts *options) {
+		opts.lazyBucketCheck = true
+	}
+}
+
+type bucketOptions struct {
+	region        string
+	objectLocking bool
+	versioning    bool
+	lifecycle     *lifecycle.Configuration
+}
+
+// BucketOption is a functional option for automatically created buckets (see WithBucketAutoCreate).
+type BucketOption func(*bucketOptions)
+
+// WithBucketRegion sets the region (location) for creating the bucket.
+// If not set, the region of the S3 client is used.
+func WithBucketRegion(region string) BucketOption {
+	return func(opts *bucketOptions) {
+		opts.region = region
+	}
+}
+
+// WithBucketObjectLocking enables object locking for the created bucket.
+// Object locking can only be enabled when creating a bucket and implies versioning.
+func WithBucketObjectLocking() BucketOption {
+	return func(opts *bucketOptions) {
+		opts.objectLocking = true
+	}
+}
+
+// WithBucketVersioning enables versioning for the created bucket.
+func WithBucketVersioning() BucketOption {
+	return func(opts *bucketOptions) {
+		opts.versioning = true
+	}
+}
+
+// WithBucketLifecycle sets a lifecycle configuration (e.g. expiration of noncurrent versions) for the created bucket.
+func WithBucketLifecycle(config *lifecycle.Configuration) BucketOption {
+	return func(opts *bucketOptions) {
+		opts.lifecycle = config
+	}
+}
+
+// WithChecksumVerification enables verification of the SHA256 checksum when storing content with Store.
+// If the reader implements io.Seeker, the hash is calculated in advance and sent as x-amz-checksum-sha256 header,
+// so the server rejects content that does not match. Otherwise, the uploaded object is read back and hashed again.
+// Store returns ErrChecksumMismatch if the checksums disagree.
+func WithChecksumVerification() Option {
+	return func(opts *options) {
+		opts.verifyChecksum = true
+	}
+}
+
+// WithRequesterPays sets the x-amz-request-payer header on all requests to the bucket (including uploads, copies,
+// removals and listings) and on download URLs. This is required for accessing buckets with requester pays enabled.
+func WithRequesterPays() Option {
+	return func(opts *options) {
+		opts.requesterPays = true
+	}
+}
+
+// WithRequestHeader adds a custom header to every request sent by the S3 client (e.g. for an S3 compatible CDN).
+// The header is added by the transport after signing the request, so it must not be an x-amz-* header.
+func WithRequestHeader(key, value string) Option {
+	return func(opts *options) {
+		if opts.requestHeaders == nil {
+			opts.requestHeaders = make(http.Header)
+		}
+		opts.requestHeaders.Add(key, value)
+	}
+}
+
+// WithOperationTimeout sets a timeout for each operation of the file store (e.g. Store or Fetch including reading
+// the object). It does not apply to Iterate, since iterating a large bucket can take an arbitrary amount of time.
+func WithOperationTimeout(timeout time.Duration) Option {
+	return func(opts *options) {
+		opts.operationTimeout = timeout
+	}
+}
+
+// WithRequestTimeout sets a timeout for a single HTTP request to receive the response headers.
+// This prevents requests to hung servers from blocking until the context of the operation is done.
+func WithRequestTimeout(timeout time.Duration) Option {
+	return func(opts *options) {
+		opts.requestTimeout = timeout
+	}
+}
+
+// WithRequestObserver adds an observer that is called after every request (including every attempt of retried
+// requests, see WithRetry), e.g. to record latency, retry and throttling metrics or to log slow requests
+// (see SlowRequestLogger).
+func WithRequestObserver(observer RequestObserver) Option {
+	return func(opts *options) {
+		opts.requestObservers = append(opts.requestObservers, observer)
+	}
+}
+
+// WithRetry retries HTTP requests that failed with a network error or a retryable status code
+// (429, 500, 502, 503, 504) up to maxRetries times.
+// The backoff is doubled for every retry and capped at maxBackoff.
+// Note that the MinIO client has its own retry logic for some errors that is applied in addition.
+func WithRetry(maxRetries int, backoff, maxBackoff time.Duration) Option {
+	return func(opts *options) {
+		opts.maxRetries = maxRetries
+		opts.retryBackoff = backoff
+		opts.retryMaxBackoff = maxBackoff
+	}
+}
+
+// WithSkipExistingUploads checks if an object already exists before uploading it in Store and skips the upload if so.
+// This needs the hash before uploading, so it only applies to readers that implement Hashed (the hash is given by
+// the caller) or io.Seeker (the content is read twice to calculate the hash in advance).
+func WithSkipExistingUploads() Option {
+	return func(opts *options) {
+		opts.skipExisting = true
+	}
+}
+
+// WithMaxObjectSize limits the size of stored objects. Store and StoreHashed fail with filestore.ErrTooLarge
+// if a Sized reader is larger or as soon as more than maxObjectSize bytes are read. Aborted uploads are cleaned up.
+func WithMaxObjectSize(maxObjectSize int64) Option {
+	return func(opts *options) {
+		opts.maxObjectSize = maxObjectSize
+	}
+}
+
+// WithKeyEncoding sets the encoding of the keys returned by Store (defaults to hashing.HexKeys), e.g.
+// hashing.PrefixedKeys for keys like "sha256-<hex>". Objects are stored with the encoded key as object key, objects
+// stored with bare hex keys before the encoding was set are still found by the encoded keys (with an additional
+// request). ImgproxyURLSource and DownloadURL always use the given key.
+func WithKeyEncoding(encoding hashing.KeyEncoding) Option {
+	return func(opts *options) {
+		opts.keyEncoding = encoding
+	}
+}
+
+// WithKeyDerivation derives the object keys of stored content from the content hash, e.g. with hashing.HMACKeys so
+// the key of a file in a shared bucket cannot be computed from its content without the secret. The derived hash is
+// encoded with the key encoding. Objects stored before the derivation was set are not found by their derived keys.
+func WithKeyDerivation(derivation hashing.KeyDerivation) Option {
+	return func(opts *options) {
+		opts.keyDerivation = derivation
+	}
+}
+
+// WithWriteOnce makes StoreHashed (and StoreIfAbsent) fail with filestore.ErrAlreadyExists if an object with the hash
+// already exists with different content. The content is compared by size (for Sized readers) and hash, which reads
+// the existing object. Objects are put with an "If-None-Match: *" header, so servers supporting conditional writes
+// (e.g. AWS S3 or MinIO) refuse to overwrite an object that was stored concurrently.
+func WithWriteOnce() Option {
+	return func(opts *options) {
+		opts.writeOnce = true
+	}
+}
+
+// WithRetention sets an object lock retention for stored objects, so they cannot be overwritten or removed for the
+// given period after they were stored. The mode is minio.Governance (users with special permissions can change or
+// remove the retention) or minio.Compliance (nobody can change or remove the retention).
+// The bucket must have object locking enabled (see WithBucketObjectLocking).
+// Use Filestore.SetRetention to change the retention of a single object.
+func WithRetention(mode minio.RetentionMode, period time.Duration) Option {
+	return func(opts *options) {
+		opts.retentionMode = mode
+		opts.retentionPeriod = period
+	}
+}
+
+// WithLegalHold enables a legal hold for stored objects, so they cannot be overwritten or removed until the legal
+// hold is disabled (see Filestore.SetLegalHold). The bucket must have object locking enabled.
+func WithLegalHold() Option {
+	return func(opts *options) {
+		opts.legalHold = true
+	}
+}
+
+// WithTempPrefix sets the key prefix of temporary objects written by Store (defaults to DefaultTempPrefix).
+// Applications sharing a bucket can use their own prefix (e.g. "tmp/app-1/"), so CleanupTemp only removes
+// their own temporary objects. Keys with the prefix (and all keys containing a slash) are never returned as hashes.
+func WithTempPrefix(prefix string) Option {
+	return func(opts *options) {
+		opts.tempPrefix = prefix
+	}
+}
+
+// WithPublicURL sets the base URL (e.g. of a CDN in front of the bucket) for PublicURL. The key is appended as
+// last path element, or replaces a "{hash}" placeholder (see filestore.ExpandPublicURL).
+func WithPublicURL(baseURL string) Option {
+	return func(opts *options) {
+		opts.publicURL = baseURL
+	}
+}
+
+// WithImgproxySource sets the template of ImgproxyURLSource (defaults to DefaultImgproxySource), e.g.
+// "s3://{bucket}/assets/{hash}". The placeholders "{bucket}" and "{hash}" are replaced by the bucket name and the hash.
+func WithImgproxySource(template string) Option {
+	return func(opts *options) {
+		opts.imgproxySource = template
+	}
+}
+
+// WithArchiveStorageClass sets the storage class objects are transitioned to by Archive (defaults to
+// DefaultArchiveStorageClass, e.g. "DEEP_ARCHIVE" for cheaper storage with slower restores).
+func WithArchiveStorageClass(storageClass string) Option {
+	return func(opts *options) {
+		opts.archiveClass = storageClass
+	}
+}
+
+// WithRestore sets the number of days a restored copy of an archived object is kept and the retrieval tier
+// for Restore (defaults to DefaultRestoreDays and minio.TierStandard).
+func WithRestore(days int, tier minio.TierType) Option {
+	return func(opts *options) {
+		opts.restoreDays = days
+		opts.restoreTier = tier
+	}
+}
+
+// WithCompatibilityMode enables a mode for S3 look-alikes (e.g. Cloudflare R2 or Google Cloud Storage interoperability)
+// that do not support all features used by default:
+//   - Store uploads the object directly to its hash without a temporary object and CopyObject.
+//     The hash is calculated in advance by reading seekable readers twice or by spooling the content to a temporary
+//     file in spoolDir (the default directory for temporary files if empty).
+//   - The size is always known before uploading, objects up to 5 GiB are uploaded without multipart uploads.
+//   - FinalizeUpload of resumable uploads uploads the completed temporary object again to its hash instead of copying
+//     it (the chunks are still uploaded as parts of a multipart upload).
+//   - CopyTo fetches and uploads the object instead of copying it, Archive is not supported.
+//   - Trailing headers are disabled.
+func WithCompatibilityMode(spoolDir string) Option {
+	return func(opts *options) {
+		opts.compatibilityMode = true
+		opts.spoolDir = spoolDir
 	}
 }
@@ -0,0 +1,242 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/gofrs/uuid"
+	"github.com/minio/minio-go/v7"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/hashing"
+	"github.com/networkteam/filestore/resumable"
+)
+
+var _ resumable.Uploader = &Filestore{}
+
+// CreateUpload implements resumable.Uploader. An upload is a multipart upload of a temporary object with the
+// temp prefix, every chunk is uploaded as a part. All chunks except the last must be at least 5 MiB (the minimum
+// part size of S3), otherwise FinalizeUpload fails. With WithCompatibilityMode, the backend must still support
+// multipart uploads, but the temporary object is not copied.
+func (f *Filestore) CreateUpload(ctx context.Context) (string, error) {
+	if err := f.ensureBucketLazily(ctx); err != nil {
+		return "", err
+	}
+
+	ctx, cancel := f.withOperationTimeout(ctx)
+	defer cancel()
+
+	tmpID, err := uuid.NewV4()
+	if err != nil {
+		return "", fmt.Errorf("generating upload id: %w", err)
+	}
+
+	core := minio.Core{Client: f.Client}
+	uploadID, err := core.NewMultipartUpload(ctx, f.BucketName, f.uploadKey(tmpID.String()), minio.PutObjectOptions{})
+	if err != nil {
+		return "", fmt.Errorf("creating multipart upload: %w", err)
+	}
+
+	return tmpID.String() + "." + uploadID, nil
+}
+
+// AppendUpload implements resumable.Uploader. Chunks of unknown size (see filestore.Sized) are spooled first,
+// since the size of a part must be known. Concurrent appends to the same upload are not detected.
+func (f *Filestore) AppendUpload(ctx context.Context, id string, offset int64, r io.Reader) (int64, error) {
+	ctx, cancel := f.withOperationTimeout(ctx)
+	defer cancel()
+
+	key, uploadID, err := f.parseUploadID(id)
+	if err != nil {
+		return 0, err
+	}
+	parts, size, err := f.listUploadParts(ctx, key, uploadID)
+	if err != nil {
+		return 0, err
+	}
+	if size != offset {
+		return size, fmt.Errorf("appending at offset %d to upload of size %d: %w", offset, size, resumable.ErrOffsetMismatch)
+	}
+
+	sizedReader, ok := r.(filestore.Sized)
+	if !ok {
+		spooled, err := filestore.Spool(r, filestore.WithSpoolTmpDir(f.spoolDir))
+		if err != nil {
+			return offset, err
+		}
+		defer spooled.Close()
+		r, sizedReader = spooled, spooled
+	}
+	if f.maxObjectSize > 0 && offset+sizedReader.Size() > f.maxObjectSize {
+		return offset, filestore.ErrTooLarge
+	}
+
+	core := minio.Core{Client: f.Client}
+	part, err := core.PutObjectPart(ctx, f.BucketName, key, uploadID, len(parts)+1, r, sizedReader.Size(), "", "", nil)
+	if err != nil {
+		return offset, fmt.Errorf("uploading part %d: %w", len(parts)+1, wrapNoSuchUpload(err))
+	}
+
+	return offset + part.Size, nil
+}
+
+// UploadOffset implements resumable.Uploader.
+func (f *Filestore) UploadOffset(ctx context.Context, id string) (int64, error) {
+	ctx, cancel := f.withOperationTimeout(ctx)
+	defer cancel()
+
+	key, uploadID, err := f.parseUploadID(id)
+	if err != nil {
+		return 0, err
+	}
+	_, size, err := f.listUploadParts(ctx, key, uploadID)
+	return size, err
+}
+
+// FinalizeUpload implements resumable.Uploader. The multipart upload is completed to the temporary object, which is
+// read back to compute the hash and then copied to the hash like in Store. With WithCompatibilityMode, the temporary
+// object is uploaded again under its hash instead of being copied.
+func (f *Filestore) FinalizeUpload(ctx context.Context, id string) (string, error) {
+	ctx, cancel := f.withOperationTimeout(ctx)
+	defer cancel()
+
+	key, uploadID, err := f.parseUploadID(id)
+	if err != nil {
+		return "", err
+	}
+	parts, size, err := f.listUploadParts(ctx, key, uploadID)
+	if err != nil {
+		return "", err
+	}
+
+	core := minio.Core{Client: f.Client}
+	if len(parts) == 0 {
+		// A multipart upload cannot be completed without parts, so empty content is stored directly
+		if err = core.AbortMultipartUpload(ctx, f.BucketName, key, uploadID); err != nil {
+			return "", fmt.Errorf("aborting empty multipart upload: %w", wrapNoSuchUpload(err))
+		}
+		return f.Store(ctx, filestore.NewReader(strings.NewReader(""), filestore.WithSize(0)))
+	}
+	completeParts := make([]minio.CompletePart, len(parts))
+	for i, part := range parts {
+		completeParts[i] = minio.CompletePart{PartNumber: part.PartNumber, ETag: part.ETag}
+	}
+	if _, err = core.CompleteMultipartUpload(ctx, f.BucketName, key, uploadID, completeParts, minio.PutObjectOptions{}); err != nil {
+		return "", fmt.Errorf("completing multipart upload: %w", wrapNoSuchUpload(err))
+	}
+
+	object, err := f.Client.GetObject(ctx, f.BucketName, key, f.getObjectOptions())
+	if err != nil {
+		return "", fmt.Errorf("getting temp object %q: %w", key, err)
+	}
+	if f.compatibilityMode {
+		return f.finalizeUploadDirect(ctx, key, object, size)
+	}
+	hashHex, err := hashing.HashReader(object)
+	_ = object.Close()
+	if err != nil {
+		return "", fmt.Errorf("reading temp object %q: %w", key, err)
+	}
+	hash := f.key(hashHex)
+
+	dstOpts := minio.CopyDestOptions{
+		Bucket: f.BucketName,
+		Object: hash,
+	}
+	dstOpts.Mode, dstOpts.RetainUntilDate, dstOpts.LegalHold = f.objectLock()
+	srcOpts := minio.CopySrcOptions{
+		Bucket: f.BucketName,
+		Object: key,
+	}
+	if size > maxSinglePartSize {
+		_, err = f.Client.ComposeObject(ctx, dstOpts, srcOpts)
+	} else {
+		_, err = f.Client.CopyObject(ctx, dstOpts, srcOpts)
+	}
+	if err != nil {
+		return "", fmt.Errorf("copying temp object %q: %w", key, err)
+	}
+
+	if err = f.Client.RemoveObject(ctx, f.BucketName, key, minio.RemoveObjectOptions{}); err != nil {
+		return "", fmt.Errorf("removing temp object: %w", err)
+	}
+
+	return hash, nil
+}
+
+// finalizeUploadDirect stores the completed temporary object of an upload under its hash with storeDirect, since
+// objects cannot be copied in compatibility mode, and removes the temporary object.
+func (f *Filestore) finalizeUploadDirect(ctx context.Context, key string, object *minio.Object, size int64) (string, error) {
+	hash, err := f.storeDirect(ctx, object, size, nil, minio.PutObjectOptions{})
+	_ = object.Close()
+	if err != nil {
+		return "", fmt.Errorf("storing temp object %q: %w", key, err)
+	}
+
+	if err = f.Client.RemoveObject(ctx, f.BucketName, key, minio.RemoveObjectOptions{}); err != nil {
+		return "", fmt.Errorf("removing temp object: %w", err)
+	}
+
+	return hash, nil
+}
+
+// AbortUpload implements resumable.Uploader.
+func (f *Filestore) AbortUpload(ctx context.Context, id string) error {
+	ctx, cancel := f.withOperationTimeout(ctx)
+	defer cancel()
+
+	key, uploadID, err := f.parseUploadID(id)
+	if err != nil {
+		return err
+	}
+
+	core := minio.Core{Client: f.Client}
+	if err = core.AbortMultipartUpload(ctx, f.BucketName, key, uploadID); err != nil {
+		return fmt.Errorf("aborting multipart upload: %w", wrapNoSuchUpload(err))
+	}
+	return nil
+}
+
+// uploadKey returns the key of the temporary object of an upload.
+func (f *Filestore) uploadKey(tmpID string) string {
+	return f.tempPrefix + "upload-" + tmpID
+}
+
+// parseUploadID returns the key and the multipart upload ID of an upload ID created by CreateUpload.
+func (f *Filestore) parseUploadID(id string) (key, uploadID string, err error) {
+	tmpID, uploadID, ok := strings.Cut(id, ".")
+	if parsed, err := uuid.FromString(tmpID); !ok || uploadID == "" || err != nil || parsed.String() != tmpID {
+		return "", "", resumable.ErrUploadNotFound
+	}
+	return f.uploadKey(tmpID), uploadID, nil
+}
+
+// listUploadParts returns the uploaded parts of a multipart upload and their total size.
+func (f *Filestore) listUploadParts(ctx context.Context, key, uploadID string) (parts []minio.ObjectPart, size int64, err error) {
+	core := minio.Core{Client: f.Client}
+	marker := 0
+	for {
+		result, err := core.ListObjectParts(ctx, f.BucketName, key, uploadID, marker, 1000)
+		if err != nil {
+			return nil, 0, fmt.Errorf("listing parts: %w", wrapNoSuchUpload(err))
+		}
+		for _, part := range result.ObjectParts {
+			parts = append(parts, part)
+			size += part.Size
+		}
+		if !result.IsTruncated {
+			return parts, size, nil
+		}
+		marker = result.NextPartNumberMarker
+	}
+}
+
+// wrapNoSuchUpload returns resumable.ErrUploadNotFound if the multipart upload does not exist.
+func wrapNoSuchUpload(err error) error {
+	if minio.ToErrorResponse(err).Code == "NoSuchUpload" {
+		return fmt.Errorf("%v: %w", err, resumable.ErrUploadNotFound)
+	}
+	return err
+}
@@ -0,0 +1,133 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+
+	"github.com/networkteam/filestore"
+)
+
+// noLockConfigurationCode is the error code for objects without retention or legal hold.
+const noLockConfigurationCode = "NoSuchObjectLockConfiguration"
+
+// Retention describes the object lock retention and legal hold of an object.
+type Retention struct {
+	// Mode is the retention mode (minio.Governance or minio.Compliance) or empty if the object has no retention.
+	Mode minio.RetentionMode
+	// RetainUntil is the date until the object cannot be overwritten or removed.
+	RetainUntil time.Time
+	// LegalHold prevents the object from being overwritten or removed (regardless of the retention) until it is
+	// disabled.
+	LegalHold bool
+}
+
+// Retention returns the object lock retention and legal hold of an object by hash.
+func (f *Filestore) Retention(ctx context.Context, hash string) (Retention, error) {
+	ctx, cancel := f.withOperationTimeout(ctx)
+	defer cancel()
+
+	objectKey, err := f.lockObjectKey(ctx, "retention", hash)
+	if err != nil {
+		return Retention{}, err
+	}
+
+	var retention Retention
+	mode, retainUntil, err := f.Client.GetObjectRetention(ctx, f.BucketName, objectKey, "")
+	if err != nil && minio.ToErrorResponse(err).Code != noLockConfigurationCode {
+		return Retention{}, fmt.Errorf("getting retention of object %q: %w", objectKey, err)
+	}
+	if mode != nil {
+		retention.Mode = *mode
+	}
+	if retainUntil != nil {
+		retention.RetainUntil = *retainUntil
+	}
+
+	status, err := f.Client.GetObjectLegalHold(ctx, f.BucketName, objectKey, minio.GetObjectLegalHoldOptions{})
+	if err != nil && minio.ToErrorResponse(err).Code != noLockConfigurationCode {
+		return Retention{}, fmt.Errorf("getting legal hold of object %q: %w", objectKey, err)
+	}
+	retention.LegalHold = status != nil && *status == minio.LegalHoldEnabled
+
+	return retention, nil
+}
+
+// SetRetention sets the object lock retention of an object by hash. An existing retention can only be extended.
+func (f *Filestore) SetRetention(ctx context.Context, hash string, mode minio.RetentionMode, retainUntil time.Time) error {
+	ctx, cancel := f.withOperationTimeout(ctx)
+	defer cancel()
+
+	objectKey, err := f.lockObjectKey(ctx, "retention", hash)
+	if err != nil {
+		return err
+	}
+
+	err = f.Client.PutObjectRetention(ctx, f.BucketName, objectKey, minio.PutObjectRetentionOptions{
+		Mode:            &mode,
+		RetainUntilDate: &retainUntil,
+	})
+	if err != nil {
+		return fmt.Errorf("setting retention of object %q: %w", objectKey, err)
+	}
+	return nil
+}
+
+// SetLegalHold enables or disables the legal hold of an object by hash.
+func (f *Filestore) SetLegalHold(ctx context.Context, hash string, enabled bool) error {
+	ctx, cancel := f.withOperationTimeout(ctx)
+	defer cancel()
+
+	objectKey, err := f.lockObjectKey(ctx, "legal hold", hash)
+	if err != nil {
+		return err
+	}
+
+	status := minio.LegalHoldDisabled
+	if enabled {
+		status = minio.LegalHoldEnabled
+	}
+	err = f.Client.PutObjectLegalHold(ctx, f.BucketName, objectKey, minio.PutObjectLegalHoldOptions{
+		Status: &status,
+	})
+	if err != nil {
+		return fmt.Errorf("setting legal hold of object %q: %w", objectKey, err)
+	}
+	return nil
+}
+
+// lockObjectKey returns the object key of an existing object for object lock operations.
+func (f *Filestore) lockObjectKey(ctx context.Context, op, hash string) (string, error) {
+	objectKey, _, err := f.statObject(ctx, hash)
+	if err != nil {
+		if minio.ToErrorResponse(err).Code == "NoSuchKey" {
+			return "", &filestore.NotExistError{Op: op, Hash: hash}
+		}
+		return "", fmt.Errorf("getting object info %q: %w", hash, err)
+	}
+	return objectKey, nil
+}
+
+// objectLock returns the retention mode, retain until date and legal hold status for stored objects
+// (see WithRetention and WithLegalHold).
+func (f *Filestore) objectLock() (mode minio.RetentionMode, retainUntil time.Time, legalHold minio.LegalHoldStatus) {
+	if f.retentionMode != "" && f.retentionPeriod > 0 {
+		mode = f.retentionMode
+		retainUntil = time.Now().Add(f.retentionPeriod).UTC()
+	}
+	if f.legalHold {
+		legalHold = minio.LegalHoldEnabled
+	}
+	return mode, retainUntil, legalHold
+}
+
+// applyObjectLock sets the object lock options for stored objects on put options.
+func (f *Filestore) applyObjectLock(opts *minio.PutObjectOptions) {
+	opts.Mode, opts.RetainUntilDate, opts.LegalHold = f.objectLock()
+	if opts.Mode != "" || opts.LegalHold != "" {
+		// Object lock requires a Content-MD5 header (or a checksum) for uploads
+		opts.SendContentMd5 = true
+	}
+}
@@ -0,0 +1,460 @@
+package s3
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+	"github.com/minio/minio-go/v7/pkg/credentials"
+	"github.com/minio/minio-go/v7/pkg/signer"
+)
+
+// ErrCustomTransport is returned by NewFilestore if options for the default transport (e.g. WithTLSConfig) are
+// combined with WithTransport.
+var ErrCustomTransport = errors.New("HTTP client options cannot be combined with a custom transport")
+
+// buildTransport wraps the configured transport (or a default transport) according to the options.
+func buildTransport(s3Options *options) (http.RoundTripper, error) {
+	transport := s3Options.transport
+	if s3Options.httpClient.isSet() {
+		if transport != nil {
+			return nil, ErrCustomTransport
+		}
+		defaultTransport, err := newHTTPTransport(s3Options.secure, s3Options.httpClient)
+		if err != nil {
+			return nil, err
+		}
+		transport = defaultTransport
+	}
+	if len(s3Options.requestHeaders) == 0 && s3Options.requestTimeout <= 0 && s3Options.maxRetries <= 0 &&
+		!s3Options.writeOnce && !s3Options.requesterPays && len(s3Options.requestObservers) == 0 {
+		return transport, nil
+	}
+
+	if transport == nil {
+		defaultTransport, err := minio.DefaultTransport(s3Options.secure)
+		if err != nil {
+			return nil, fmt.Errorf("creating default transport: %w", err)
+		}
+		transport = defaultTransport
+	}
+
+	if s3Options.writeOnce {
+		transport = &conditionalPutTransport{base: transport}
+	}
+	if s3Options.requesterPays {
+		transport = &requesterPaysTransport{
+			base:        transport,
+			credentials: s3Options.credentials,
+		}
+	}
+	if len(s3Options.requestHeaders) > 0 {
+		transport = &headerTransport{
+			base:    transport,
+			headers: s3Options.requestHeaders,
+		}
+	}
+	if s3Options.requestTimeout > 0 {
+		transport = &timeoutTransport{
+			base:    transport,
+			timeout: s3Options.requestTimeout,
+		}
+	}
+	if len(s3Options.requestObservers) > 0 {
+		// Observe every attempt of retried requests
+		transport = &observingTransport{
+			base:      transport,
+			observers: s3Options.requestObservers,
+		}
+	}
+	if s3Options.maxRetries > 0 {
+		transport = &retryTransport{
+			base:       transport,
+			maxRetries: s3Options.maxRetries,
+			backoff:    s3Options.retryBackoff,
+			maxBackoff: s3Options.retryMaxBackoff,
+		}
+	}
+
+	return transport, nil
+}
+
+// newHTTPTransport creates the default transport of the MinIO client configured with the HTTP client options.
+func newHTTPTransport(secure bool, o httpClientOptions) (*http.Transport, error) {
+	transport, err := minio.DefaultTransport(secure)
+	if err != nil {
+		return nil, fmt.Errorf("creating default transport: %w", err)
+	}
+	if o.maxIdleConnsPerHost > 0 {
+		transport.MaxIdleConnsPerHost = o.maxIdleConnsPerHost
+		if transport.MaxIdleConns < o.maxIdleConnsPerHost {
+			transport.MaxIdleConns = o.maxIdleConnsPerHost
+		}
+	}
+	if o.idleConnTimeout > 0 {
+		transport.IdleConnTimeout = o.idleConnTimeout
+	}
+	if o.proxy != nil {
+		transport.Proxy = o.proxy
+	}
+	switch {
+	case o.dialContext != nil:
+		transport.DialContext = o.dialContext
+	case o.resolver != nil:
+		// Same settings as the default transport
+		transport.DialContext = (&net.Dialer{
+			Timeout:   30 * time.Second,
+			KeepAlive: 30 * time.Second,
+			Resolver:  o.resolver,
+		}).DialContext
+	}
+
+	tlsConfig := transport.TLSClientConfig
+	if o.tlsConfig != nil {
+		tlsConfig = o.tlsConfig.Clone()
+	}
+	if tlsConfig == nil {
+		tlsConfig = &tls.Config{MinVersion: tls.VersionTLS12}
+	}
+	if len(o.caCertificates) > 0 {
+		rootCAs := tlsConfig.RootCAs
+		if rootCAs == nil {
+			rootCAs, err = x509.SystemCertPool()
+			if err != nil {
+				rootCAs = x509.NewCertPool()
+			}
+		} else {
+			rootCAs = rootCAs.Clone()
+		}
+		for _, pemCerts := range o.caCertificates {
+			if !rootCAs.AppendCertsFromPEM(pemCerts) {
+				return nil, errors.New("no valid CA certificates found in PEM data")
+			}
+		}
+		tlsConfig.RootCAs = rootCAs
+	}
+	if len(o.clientCertificates) > 0 {
+		// Do not modify the certificates of the given config
+		certs := tlsConfig.Certificates
+		tlsConfig.Certificates = append(certs[:len(certs):len(certs)], o.clientCertificates...)
+	}
+	if o.insecureSkipVerify {
+		tlsConfig.InsecureSkipVerify = true
+	}
+	transport.TLSClientConfig = tlsConfig
+
+	return transport, nil
+}
+
+// headerTransport adds custom headers to every request.
+type headerTransport struct {
+	base    http.RoundTripper
+	headers http.Header
+}
+
+var _ http.RoundTripper = &headerTransport{}
+
+// RoundTrip implements http.RoundTripper.
+func (t *headerTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	// A RoundTripper must not modify the given request, so we clone it
+	req = req.Clone(req.Context())
+	for key, values := range t.headers {
+		for _, value := range values {
+			req.Header.Add(key, value)
+		}
+	}
+	return t.base.RoundTrip(req)
+}
+
+// requesterPaysHeader is the header to accept the charges for requests to a bucket with requester pays enabled.
+const requesterPaysHeader = "X-Amz-Request-Payer"
+
+// requesterPaysTransport adds the x-amz-request-payer header to requests without it (the client only supports it
+// for getting objects) and signs them again, since S3 only accepts signed x-amz-* headers.
+// Requests with a streaming signature (uploads over an insecure connection) cannot be signed again, so the header
+// is not signed for them.
+type requesterPaysTransport struct {
+	base        http.RoundTripper
+	credentials *credentials.Credentials
+}
+
+var _ http.RoundTripper = &requesterPaysTransport{}
+
+// RoundTrip implements http.RoundTripper.
+func (t *requesterPaysTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Header.Get(requesterPaysHeader) != "" {
+		return t.base.RoundTrip(req)
+	}
+
+	req = req.Clone(req.Context())
+	req.Header.Set(requesterPaysHeader, "requester")
+
+	region, ok := signatureV4Region(req.Header.Get("Authorization"))
+	if !ok || t.credentials == nil || strings.HasPrefix(req.Header.Get("X-Amz-Content-Sha256"), "STREAMING-AWS4-HMAC-SHA256-PAYLOAD") {
+		return t.base.RoundTrip(req)
+	}
+	creds, err := t.credentials.Get()
+	if err != nil {
+		return nil, fmt.Errorf("getting credentials: %w", err)
+	}
+	req = signer.SignV4Trailer(*req, creds.AccessKeyID, creds.SecretAccessKey, creds.SessionToken, region, req.Trailer)
+
+	return t.base.RoundTrip(req)
+}
+
+// signatureV4Region returns the region of the credential scope of a V4 authorization header
+// (e.g. "AWS4-HMAC-SHA256 Credential=AKID/20230102/eu-central-1/s3/aws4_request, SignedHeaders=...").
+func signatureV4Region(authorization string) (string, bool) {
+	_, params, ok := strings.Cut(authorization, "AWS4-HMAC-SHA256 Credential=")
+	if !ok {
+		return "", false
+	}
+	scope, _, _ := strings.Cut(params, ",")
+	parts := strings.Split(scope, "/")
+	if len(parts) != 5 {
+		return "", false
+	}
+	return parts[2], true
+}
+
+// conditionalPutKey is the context key for requests that must not overwrite an existing object.
+type conditionalPutKey struct{}
+
+// withConditionalPut returns a context for requests that must not overwrite an existing object.
+func withConditionalPut(ctx context.Context) context.Context {
+	return context.WithValue(ctx, conditionalPutKey{}, true)
+}
+
+// conditionalPutTransport adds an "If-None-Match: *" header to requests creating an object (PutObject and
+// CompleteMultipartUpload) with a context from withConditionalPut, so the server refuses to overwrite an existing
+// object with 412 Precondition Failed. Servers without support for conditional writes ignore the header.
+type conditionalPutTransport struct {
+	base http.RoundTripper
+}
+
+var _ http.RoundTripper = &conditionalPutTransport{}
+
+// RoundTrip implements http.RoundTripper.
+func (t *conditionalPutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	if req.Context().Value(conditionalPutKey{}) == nil || !createsObject(req) {
+		return t.base.RoundTrip(req)
+	}
+
+	// A RoundTripper must not modify the given request, so we clone it
+	req = req.Clone(req.Context())
+	req.Header.Set("If-None-Match", "*")
+	return t.base.RoundTrip(req)
+}
+
+// createsObject checks if the request is a PutObject (not a part upload or copy) or CompleteMultipartUpload request.
+func createsObject(req *http.Request) bool {
+	query := req.URL.Query()
+	switch req.Method {
+	case http.MethodPut:
+		return !query.Has("partNumber") && req.Header.Get("X-Amz-Copy-Source") == ""
+	case http.MethodPost:
+		return query.Has("uploadId")
+	}
+	return false
+}
+
+// timeoutTransport cancels a request if no response headers were received within the timeout.
+type timeoutTransport struct {
+	base    http.RoundTripper
+	timeout time.Duration
+}
+
+var _ http.RoundTripper = &timeoutTransport{}
+
+// RoundTrip implements http.RoundTripper.
+func (t *timeoutTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	ctx, cancel := context.WithCancel(req.Context())
+	timer := time.AfterFunc(t.timeout, cancel)
+
+	resp, err := t.base.RoundTrip(req.WithContext(ctx))
+	if !timer.Stop() && err != nil {
+		cancel()
+		return nil, fmt.Errorf("request timed out after %s: %w", t.timeout, err)
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+
+	// The body must be readable after the headers were received, so we cancel the context when it is closed
+	resp.Body = &cancelOnCloseReader{ReadCloser: resp.Body, cancel: cancel}
+	return resp, nil
+}
+
+// retryTransport retries requests with a replayable body on network errors and retryable status codes.
+type retryTransport struct {
+	base       http.RoundTripper
+	maxRetries int
+	backoff    time.Duration
+	maxBackoff time.Duration
+}
+
+var _ http.RoundTripper = &retryTransport{}
+
+// RoundTrip implements http.RoundTripper.
+func (t *retryTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	backoff := t.backoff
+	for attempt := 0; ; attempt++ {
+		attemptReq := req
+		if attempt > 0 {
+			var err error
+			attemptReq, err = rewindRequest(req.WithContext(context.WithValue(req.Context(), attemptKey{}, attempt)))
+			if err != nil {
+				return nil, err
+			}
+		}
+
+		resp, err := t.base.RoundTrip(attemptReq)
+		if attempt >= t.maxRetries || !isRetryable(req, resp, err) {
+			return resp, err
+		}
+		if resp != nil {
+			// Drain and close the body, so the connection can be reused
+			_, _ = io.Copy(io.Discard, resp.Body)
+			_ = resp.Body.Close()
+		}
+
+		select {
+		case <-req.Context().Done():
+			return nil, req.Context().Err()
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+		if t.maxBackoff > 0 && backoff > t.maxBackoff {
+			backoff = t.maxBackoff
+		}
+	}
+}
+
+// attemptKey is the context key for the attempt number of retried requests.
+type attemptKey struct{}
+
+func isRetryable(req *http.Request, resp *http.Response, err error) bool {
+	// Only requests without body or with a replayable body can be retried
+	if req.Body != nil && req.Body != http.NoBody && req.GetBody == nil {
+		return false
+	}
+	if req.Context().Err() != nil {
+		return false
+	}
+	if err != nil {
+		return true
+	}
+	switch resp.StatusCode {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+func rewindRequest(req *http.Request) (*http.Request, error) {
+	newReq := req.Clone(req.Context())
+	if req.Body == nil || req.Body == http.NoBody {
+		return newReq, nil
+	}
+	body, err := req.GetBody()
+	if err != nil {
+		return nil, fmt.Errorf("getting request body for retry: %w", err)
+	}
+	newReq.Body = body
+	return newReq, nil
+}
+
+// RequestInfo describes a request to S3 for a RequestObserver.
+type RequestInfo struct {
+	Method string
+	// URL is the URL of the request (without credentials, which are sent in headers).
+	URL *url.URL
+	// StatusCode is the status code of the response (zero if the request failed without a response).
+	StatusCode int
+	// Err is the error of a request that failed without a response (e.g. a network error or a timeout).
+	Err error
+	// Duration is the time until the response headers were received or the request failed.
+	Duration time.Duration
+	// Attempt is the number of the attempt of a retried request (see WithRetry), zero for the first attempt.
+	Attempt int
+	// Throttled is true if the server asked to reduce the request rate (503 Slow Down or 429 Too Many Requests).
+	Throttled bool
+}
+
+// A RequestObserver is called after every request to S3 (e.g. to record latency metrics).
+// It is called concurrently and must not block.
+type RequestObserver func(info RequestInfo)
+
+// SlowRequestLogger returns a RequestObserver that logs requests slower than threshold with logf (e.g. log.Printf),
+// so slowness of the server can be distinguished from slowness of the application.
+func SlowRequestLogger(threshold time.Duration, logf func(format string, args ...any)) RequestObserver {
+	return func(info RequestInfo) {
+		if info.Duration < threshold {
+			return
+		}
+		status := strconv.Itoa(info.StatusCode)
+		if info.Err != nil {
+			status = info.Err.Error()
+		}
+		logf("slow S3 request: %s %s took %s (status: %s, attempt: %d)", info.Method, info.URL.Path, info.Duration, status, info.Attempt)
+	}
+}
+
+// observingTransport calls observers after every request.
+type observingTransport struct {
+	base      http.RoundTripper
+	observers []RequestObserver
+}
+
+var _ http.RoundTripper = &observingTransport{}
+
+// RoundTrip implements http.RoundTripper.
+func (t *observingTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	start := time.Now()
+	resp, err := t.base.RoundTrip(req)
+
+	info := RequestInfo{
+		Method:   req.Method,
+		URL:      req.URL,
+		Err:      err,
+		Duration: time.Since(start),
+	}
+	info.Attempt, _ = req.Context().Value(attemptKey{}).(int)
+	if resp != nil {
+		info.StatusCode = resp.StatusCode
+		info.Throttled = resp.StatusCode == http.StatusServiceUnavailable || resp.StatusCode == http.StatusTooManyRequests
+	}
+	for _, observer := range t.observers {
+		observer(info)
+	}
+
+	return resp, err
+}
+
+// cancelOnCloseReader cancels a context after the reader was closed.
+type cancelOnCloseReader struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+// Close implements io.Closer.
+func (r *cancelOnCloseReader) Close() error {
+	defer r.cancel()
+	return r.ReadCloser.Close()
+}
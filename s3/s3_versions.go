@@ -0,0 +1,165 @@
+package s3
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/minio/minio-go/v7"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/hashing"
+)
+
+// ObjectVersion describes a version of an object in a bucket with versioning enabled.
+type ObjectVersion struct {
+	// VersionID is the ID of the version.
+	VersionID string
+	// LastModified is the time the version was created.
+	LastModified time.Time
+	// Size is the size of the version in bytes (zero for delete markers).
+	Size int64
+	// IsLatest is true for the current version of the object.
+	IsLatest bool
+	// IsDeleteMarker is true if the version marks the object as removed.
+	IsDeleteMarker bool
+}
+
+// VersioningEnabled checks if versioning is enabled for the bucket.
+// If versioning is enabled, Remove only adds a delete marker, which can be undone with Undelete.
+func (f *Filestore) VersioningEnabled(ctx context.Context) (bool, error) {
+	ctx, cancel := f.withOperationTimeout(ctx)
+	defer cancel()
+
+	config, err := f.Client.GetBucketVersioning(ctx, f.BucketName)
+	if err != nil {
+		return false, fmt.Errorf("getting bucket versioning: %w", err)
+	}
+	return config.Enabled(), nil
+}
+
+// Versions returns all versions of an object by hash, including delete markers, with the latest version first.
+// A filestore.NotExistError is returned if there are no versions of the object.
+func (f *Filestore) Versions(ctx context.Context, hash string) ([]ObjectVersion, error) {
+	ctx, cancel := f.withOperationTimeout(ctx)
+	defer cancel()
+
+	_, versions, err := f.objectVersions(ctx, "versions", hash)
+	return versions, err
+}
+
+// Undelete restores a removed object by hash in a bucket with versioning enabled.
+// The delete markers on top of the latest version are removed, so the version before the removal is current again.
+// Undelete does nothing if the object is not removed. A filestore.NotExistError is returned if there are no
+// versions of the object or all versions are delete markers.
+func (f *Filestore) Undelete(ctx context.Context, hash string) error {
+	ctx, cancel := f.withOperationTimeout(ctx)
+	defer cancel()
+
+	objectKey, versions, err := f.objectVersions(ctx, "undelete", hash)
+	if err != nil {
+		return err
+	}
+
+	var deleteMarkers []string
+	for _, version := range versions {
+		if !version.IsDeleteMarker {
+			break
+		}
+		deleteMarkers = append(deleteMarkers, version.VersionID)
+	}
+	if len(deleteMarkers) == len(versions) {
+		return &filestore.NotExistError{Op: "undelete", Hash: hash}
+	}
+
+	for _, versionID := range deleteMarkers {
+		err := f.Client.RemoveObject(ctx, f.BucketName, objectKey, minio.RemoveObjectOptions{VersionID: versionID})
+		if err != nil {
+			return fmt.Errorf("removing delete marker %s of object %q: %w", versionID, objectKey, err)
+		}
+	}
+	return nil
+}
+
+// PurgeVersions permanently removes all versions of an object by hash except the latest and returns the number
+// of removed versions. If the object is removed (the latest version is a delete marker), all versions are removed.
+// A filestore.NotExistError is returned if there are no versions of the object.
+func (f *Filestore) PurgeVersions(ctx context.Context, hash string) (int, error) {
+	ctx, cancel := f.withOperationTimeout(ctx)
+	defer cancel()
+
+	objectKey, versions, err := f.objectVersions(ctx, "purge versions", hash)
+	if err != nil {
+		return 0, err
+	}
+
+	var removed int
+	for _, version := range versions {
+		if version.IsLatest && !version.IsDeleteMarker {
+			continue
+		}
+		err := f.Client.RemoveObject(ctx, f.BucketName, objectKey, minio.RemoveObjectOptions{VersionID: version.VersionID})
+		if err != nil {
+			return removed, fmt.Errorf("removing version %s of object %q: %w", version.VersionID, objectKey, err)
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// objectVersions lists the versions of an object by key and falls back to the legacy key (see hashing.LegacyKey).
+func (f *Filestore) objectVersions(ctx context.Context, op, key string) (string, []ObjectVersion, error) {
+	versions, err := f.listVersions(ctx, key)
+	if err != nil {
+		return "", nil, err
+	}
+	if len(versions) > 0 {
+		return key, versions, nil
+	}
+
+	if legacyKey, ok := hashing.LegacyKey(f.keyEncoding, key); ok {
+		versions, err = f.listVersions(ctx, legacyKey)
+		if err != nil {
+			return "", nil, err
+		}
+		if len(versions) > 0 {
+			return legacyKey, versions, nil
+		}
+	}
+
+	return "", nil, &filestore.NotExistError{Op: op, Hash: key}
+}
+
+func (f *Filestore) listVersions(ctx context.Context, objectKey string) ([]ObjectVersion, error) {
+	var versions []ObjectVersion
+	for obj := range f.Client.ListObjects(ctx, f.BucketName, minio.ListObjectsOptions{
+		Prefix:       objectKey,
+		WithVersions: true,
+	}) {
+		if obj.Err != nil {
+			return nil, fmt.Errorf("listing versions of object %q: %w", objectKey, obj.Err)
+		}
+		// Other objects can start with the key as prefix
+		if obj.Key != objectKey {
+			continue
+		}
+		versions = append(versions, ObjectVersion{
+			VersionID:      obj.VersionID,
+			LastModified:   obj.LastModified,
+			Size:           obj.Size,
+			IsLatest:       obj.IsLatest,
+			IsDeleteMarker: obj.IsDeleteMarker,
+		})
+	}
+
+	// Not all S3 implementations return the latest version first
+	sort.SliceStable(versions, func(i, j int) bool {
+		if versions[i].IsLatest != versions[j].IsLatest {
+			return versions[i].IsLatest
+		}
+		return versions[i].LastModified.After(versions[j].LastModified)
+	})
+
+	return versions, nil
+}
@@ -1,69 +1,55 @@
 package s3
 
-import "io"
+import (
+	"io"
+
+	"github.com/networkteam/filestore"
+)
 
 // Sized is a reader that can return the size of the data.
-type Sized interface {
-	// Size of the data that can be read.
-	Size() int64
-}
+//
+// Deprecated: Use filestore.Sized.
+type Sized = filestore.Sized
 
 // ContentTyped is a reader that also returns the content type of the data.
-type ContentTyped interface {
-	// ContentType (media type) of the data.
-	ContentType() string
-}
+//
+// Deprecated: Use filestore.ContentTyped.
+type ContentTyped = filestore.ContentTyped
 
 // ContentDispositioned is a reader that also returns the content disposition of the data.
-type ContentDispositioned interface {
-	// ContentDisposition of the data (e.g. "inline; filename=\"test.png\"").
-	ContentDisposition() string
-}
+//
+// Deprecated: Use filestore.ContentDispositioned.
+type ContentDispositioned = filestore.ContentDispositioned
+
+// Hashed is a reader that also returns the expected (hex encoded SHA256) hash of the data.
+//
+// Deprecated: Use filestore.Hashed.
+type Hashed = filestore.Hashed
 
 // SizedReader wraps a reader and its size of the data to implement Sized.
+//
+// Deprecated: Use filestore.SizedReader or filestore.NewReader.
 func SizedReader(r io.Reader, size int64) io.Reader {
-	return &sizedReader{r, size}
-}
-
-type sizedReader struct {
-	io.Reader
-	size int64
-}
-
-func (s *sizedReader) Size() int64 {
-	return s.size
+	return filestore.SizedReader(r, size)
 }
 
-var _ Sized = &sizedReader{}
-
 // ContentTypedReader wraps a reader and its content type to implement ContentTyped.
+//
+// Deprecated: Use filestore.ContentTypedReader or filestore.NewReader.
 func ContentTypedReader(r io.Reader, contentType string) io.Reader {
-	return &contentTypedReader{r, contentType}
-}
-
-type contentTypedReader struct {
-	io.Reader
-	contentType string
-}
-
-func (s *contentTypedReader) ContentType() string {
-	return s.contentType
+	return filestore.ContentTypedReader(r, contentType)
 }
 
-var _ ContentTyped = &contentTypedReader{}
-
 // ContentDispositionedReader wraps a reader and its content disposition to implement ContentDispositioned.
+//
+// Deprecated: Use filestore.ContentDispositionedReader or filestore.NewReader.
 func ContentDispositionedReader(r io.Reader, contentDisposition string) io.Reader {
-	return &contentDispositionedReader{r, contentDisposition}
-}
-
-type contentDispositionedReader struct {
-	io.Reader
-	contentDisposition string
+	return filestore.ContentDispositionedReader(r, contentDisposition)
 }
 
-func (s *contentDispositionedReader) ContentDisposition() string {
-	return s.contentDisposition
+// HashedReader wraps a reader and the expected hash of the data to implement Hashed.
+//
+// Deprecated: Use filestore.HashedReader.
+func HashedReader(r io.Reader, hash string) io.Reader {
+	return filestore.HashedReader(r, hash)
 }
-
-var _ ContentDispositioned = &contentDispositionedReader{}
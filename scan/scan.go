@@ -0,0 +1,146 @@
+// Package scan provides a file store wrapper that scans content (e.g. for viruses) before it is stored.
+package scan
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+
+	"github.com/hashicorp/go-multierror"
+
+	"github.com/networkteam/filestore"
+)
+
+// A Scanner scans content and returns an error wrapping filestore.ErrContentRejected if the content must not be stored.
+type Scanner interface {
+	Scan(ctx context.Context, r io.Reader) error
+}
+
+// ScannerFunc adapts a function to a Scanner.
+type ScannerFunc func(ctx context.Context, r io.Reader) error
+
+// Scan implements Scanner.
+func (f ScannerFunc) Scan(ctx context.Context, r io.Reader) error {
+	return f(ctx, r)
+}
+
+// Filestore wraps a file store and scans content with a Scanner before it is stored.
+// Content is spooled to a temporary file for scanning, so rejected content is never passed to the wrapped store.
+// Only the methods of filestore.FileStore are available on the wrapper.
+type Filestore struct {
+	filestore.FileStore
+
+	scanner Scanner
+	tmpDir  string
+}
+
+type options struct {
+	tmpDir string
+}
+
+// Option is a functional option for creating a scanning file store.
+type Option func(*options)
+
+// WithTmpDir sets the directory for temporary files (defaults to os.TempDir()).
+func WithTmpDir(tmpDir string) Option {
+	return func(opts *options) {
+		opts.tmpDir = tmpDir
+	}
+}
+
+var _ filestore.FileStore = &Filestore{}
+
+// NewFilestore creates a file store that scans content with scanner before storing it in store.
+func NewFilestore(store filestore.FileStore, scanner Scanner, opts ...Option) *Filestore {
+	var o options
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return &Filestore{
+		FileStore: store,
+		scanner:   scanner,
+		tmpDir:    o.tmpDir,
+	}
+}
+
+// Store scans the content and stores it in the wrapped store if it was not rejected.
+func (f *Filestore) Store(ctx context.Context, r io.Reader) (hash string, err error) {
+	err = f.scanned(ctx, r, func(scannedReader io.Reader) error {
+		hash, err = f.FileStore.Store(ctx, scannedReader)
+		return err
+	})
+	return hash, err
+}
+
+// StoreHashed scans the content and stores it in the wrapped store if it was not rejected.
+func (f *Filestore) StoreHashed(ctx context.Context, r io.Reader, hash string) error {
+	return f.scanned(ctx, r, func(scannedReader io.Reader) error {
+		return f.FileStore.StoreHashed(ctx, scannedReader, hash)
+	})
+}
+
+// scanned spools the content of r to a temporary file, scans it and calls store with a reader of the scanned content.
+func (f *Filestore) scanned(ctx context.Context, r io.Reader, store func(scannedReader io.Reader) error) (err error) {
+	tmpFile, err := os.CreateTemp(f.tmpDir, "scan-*")
+	if err != nil {
+		return fmt.Errorf("creating temp file: %w", err)
+	}
+	defer func() {
+		if closeErr := tmpFile.Close(); closeErr != nil {
+			err = multierror.Append(err, fmt.Errorf("closing temp file: %w", closeErr))
+		}
+		if removeErr := os.Remove(tmpFile.Name()); removeErr != nil {
+			err = multierror.Append(err, fmt.Errorf("removing temp file: %w", removeErr))
+		}
+	}()
+
+	size, err := filestore.Copy(tmpFile, r)
+	if err != nil {
+		return fmt.Errorf("spooling content: %w", err)
+	}
+
+	if _, err = tmpFile.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("seeking temp file: %w", err)
+	}
+	if err = f.scanner.Scan(ctx, tmpFile); err != nil {
+		return fmt.Errorf("scanning content: %w", err)
+	}
+
+	if _, err = tmpFile.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("seeking temp file: %w", err)
+	}
+	return store(newScannedReader(tmpFile, size, r))
+}
+
+// scannedReader reads the scanned content and keeps the size, content type and disposition of the original reader.
+type scannedReader struct {
+	io.Reader
+	size               int64
+	contentType        string
+	contentDisposition string
+}
+
+func newScannedReader(r io.Reader, size int64, original io.Reader) *scannedReader {
+	sr := &scannedReader{Reader: r, size: size}
+	if typedReader, ok := original.(filestore.ContentTyped); ok {
+		sr.contentType = typedReader.ContentType()
+	}
+	if dispoReader, ok := original.(filestore.ContentDispositioned); ok {
+		sr.contentDisposition = dispoReader.ContentDisposition()
+	}
+	return sr
+}
+
+func (r *scannedReader) Size() int64 {
+	return r.size
+}
+
+func (r *scannedReader) ContentType() string {
+	return r.contentType
+}
+
+func (r *scannedReader) ContentDisposition() string {
+	return r.contentDisposition
+}
@@ -0,0 +1,112 @@
+package scan
+
+import (
+	"bufio"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+
+	"github.com/networkteam/filestore"
+)
+
+// ErrUnexpectedResponse is returned if clamd returns a response that cannot be parsed.
+var ErrUnexpectedResponse = errors.New("unexpected clamd response")
+
+// clamAVChunkSize is the size of chunks sent to clamd (must be smaller than StreamMaxLength of clamd).
+const clamAVChunkSize = 64 * 1024
+
+// ClamAV is a Scanner that scans content with a clamd daemon using the INSTREAM command.
+type ClamAV struct {
+	network string
+	address string
+	dialer  net.Dialer
+}
+
+var _ Scanner = &ClamAV{}
+
+// NewClamAV creates a scanner for the clamd daemon at the given network ("tcp" or "unix") and address
+// (e.g. "localhost:3310" or "/run/clamav/clamd.ctl").
+func NewClamAV(network, address string) *ClamAV {
+	return &ClamAV{
+		network: network,
+		address: address,
+	}
+}
+
+// Scan implements Scanner. Content with a found signature is rejected with an error wrapping
+// filestore.ErrContentRejected that contains the signature name.
+func (c *ClamAV) Scan(ctx context.Context, r io.Reader) error {
+	conn, err := c.dialer.DialContext(ctx, c.network, c.address)
+	if err != nil {
+		return fmt.Errorf("connecting to clamd: %w", err)
+	}
+	defer conn.Close()
+
+	if deadline, ok := ctx.Deadline(); ok {
+		if err := conn.SetDeadline(deadline); err != nil {
+			return fmt.Errorf("setting deadline: %w", err)
+		}
+	}
+
+	if err := c.sendStream(conn, r); err != nil {
+		return err
+	}
+
+	response, err := bufio.NewReader(conn).ReadString(0)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return fmt.Errorf("reading clamd response: %w", err)
+	}
+
+	return parseClamAVResponse(strings.TrimRight(response, "\x00\n"))
+}
+
+func (c *ClamAV) sendStream(w io.Writer, r io.Reader) error {
+	if _, err := w.Write([]byte("zINSTREAM\x00")); err != nil {
+		return fmt.Errorf("sending command: %w", err)
+	}
+
+	buf := make([]byte, clamAVChunkSize)
+	sizeBuf := make([]byte, 4)
+	for {
+		n, readErr := r.Read(buf)
+		if n > 0 {
+			binary.BigEndian.PutUint32(sizeBuf, uint32(n))
+			if _, err := w.Write(sizeBuf); err != nil {
+				return fmt.Errorf("sending chunk size: %w", err)
+			}
+			if _, err := w.Write(buf[:n]); err != nil {
+				return fmt.Errorf("sending chunk: %w", err)
+			}
+		}
+		if errors.Is(readErr, io.EOF) {
+			break
+		}
+		if readErr != nil {
+			return fmt.Errorf("reading content: %w", readErr)
+		}
+	}
+
+	// A chunk with size 0 ends the stream
+	binary.BigEndian.PutUint32(sizeBuf, 0)
+	if _, err := w.Write(sizeBuf); err != nil {
+		return fmt.Errorf("ending stream: %w", err)
+	}
+	return nil
+}
+
+// parseClamAVResponse parses responses like "stream: OK" or "stream: Eicar-Signature FOUND".
+func parseClamAVResponse(response string) error {
+	result := strings.TrimPrefix(response, "stream: ")
+	switch {
+	case result == "OK":
+		return nil
+	case strings.HasSuffix(result, " FOUND"):
+		return fmt.Errorf("%w: %s", filestore.ErrContentRejected, strings.TrimSuffix(result, " FOUND"))
+	default:
+		return fmt.Errorf("%w: %q", ErrUnexpectedResponse, response)
+	}
+}
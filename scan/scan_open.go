@@ -0,0 +1,40 @@
+package scan
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/networkteam/filestore"
+)
+
+func init() {
+	filestore.RegisterWrapper("clamav", wrapClamAV)
+}
+
+// ErrMissingClamAVAddress is returned by filestore.Open if the clamav wrapper is used without a clamav parameter.
+var ErrMissingClamAVAddress = errors.New("missing clamav address")
+
+// wrapClamAV wraps a store opened by filestore.Open with "wrap=clamav" with a ClamAV scanner.
+// The address of clamd is set with the clamav parameter (e.g. "clamav=tcp://localhost:3310" or
+// "clamav=unix:///run/clamav/clamd.ctl"), the directory for temporary files with scanTmp.
+func wrapClamAV(ctx context.Context, store filestore.FileStore, params url.Values) (filestore.FileStore, error) {
+	address := params.Get("clamav")
+	if address == "" {
+		return nil, ErrMissingClamAVAddress
+	}
+	u, err := url.Parse(address)
+	if err != nil {
+		return nil, fmt.Errorf("parsing clamav address: %w", err)
+	}
+
+	var scanner *ClamAV
+	if u.Scheme == "unix" {
+		scanner = NewClamAV("unix", u.Path)
+	} else {
+		scanner = NewClamAV(u.Scheme, u.Host)
+	}
+
+	return NewFilestore(store, scanner, WithTmpDir(params.Get("scanTmp"))), nil
+}
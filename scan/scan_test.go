@@ -0,0 +1,111 @@
+package scan_test
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"io"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/memory"
+	"github.com/networkteam/filestore/scan"
+)
+
+func TestFilestore_Store(t *testing.T) {
+	ctx := context.Background()
+
+	store := memory.NewFilestore()
+	scanner := scan.ScannerFunc(func(ctx context.Context, r io.Reader) error {
+		content, err := io.ReadAll(r)
+		if err != nil {
+			return err
+		}
+		if bytes.Contains(content, []byte("VIRUS")) {
+			return filestore.ErrContentRejected
+		}
+		return nil
+	})
+	scanningStore := scan.NewFilestore(store, scanner, scan.WithTmpDir(t.TempDir()))
+
+	hash, err := scanningStore.Store(ctx, filestore.ContentTypedReader(strings.NewReader("Clean content"), "text/plain"))
+	require.NoError(t, err)
+
+	info, err := store.Stat(ctx, hash)
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain", info.ContentType)
+
+	_, err = scanningStore.Store(ctx, strings.NewReader("Content with VIRUS"))
+	assert.ErrorIs(t, err, filestore.ErrContentRejected)
+
+	err = scanningStore.StoreHashed(ctx, strings.NewReader("Content with VIRUS"), "a0b1c2d3e4f5")
+	assert.ErrorIs(t, err, filestore.ErrContentRejected)
+
+	exists, err := store.Exists(ctx, "a0b1c2d3e4f5")
+	require.NoError(t, err)
+	assert.False(t, exists)
+}
+
+func TestClamAV_Scan(t *testing.T) {
+	ctx := context.Background()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	defer listener.Close()
+
+	// Fake clamd that finds a signature in content containing "EICAR"
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			go serveFakeClamd(conn)
+		}
+	}()
+
+	scanner := scan.NewClamAV("tcp", listener.Addr().String())
+
+	err = scanner.Scan(ctx, strings.NewReader("Clean content"))
+	require.NoError(t, err)
+
+	err = scanner.Scan(ctx, strings.NewReader("Content with EICAR"))
+	assert.ErrorIs(t, err, filestore.ErrContentRejected)
+	assert.ErrorContains(t, err, "Eicar-Signature")
+}
+
+func serveFakeClamd(conn net.Conn) {
+	defer conn.Close()
+
+	cmd := make([]byte, len("zINSTREAM\x00"))
+	if _, err := io.ReadFull(conn, cmd); err != nil || string(cmd) != "zINSTREAM\x00" {
+		return
+	}
+
+	var content []byte
+	for {
+		var size uint32
+		if err := binary.Read(conn, binary.BigEndian, &size); err != nil {
+			return
+		}
+		if size == 0 {
+			break
+		}
+		chunk := make([]byte, size)
+		if _, err := io.ReadFull(conn, chunk); err != nil {
+			return
+		}
+		content = append(content, chunk...)
+	}
+
+	if bytes.Contains(content, []byte("EICAR")) {
+		_, _ = conn.Write([]byte("stream: Eicar-Signature FOUND\x00"))
+		return
+	}
+	_, _ = conn.Write([]byte("stream: OK\x00"))
+}
@@ -0,0 +1,23 @@
+package filestore
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+)
+
+// sniffLen is the number of bytes used by http.DetectContentType.
+const sniffLen = 512
+
+// DetectContentType detects the content type of the content of r (see http.DetectContentType) and returns it with
+// a reader that returns the complete content (including the bytes read for detection).
+func DetectContentType(r io.Reader) (string, io.Reader, error) {
+	br := bufio.NewReaderSize(r, sniffLen)
+	head, err := br.Peek(sniffLen)
+	if err != nil && !errors.Is(err, io.EOF) {
+		return "", nil, fmt.Errorf("reading content: %w", err)
+	}
+	return http.DetectContentType(head), br, nil
+}
@@ -0,0 +1,158 @@
+package filestore
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+)
+
+// DefaultSpoolMemoryThreshold is the default size up to which Spool keeps the content in memory.
+const DefaultSpoolMemoryThreshold = 8 << 20
+
+type spoolOptions struct {
+	memoryThreshold int64
+	tmpDir          string
+}
+
+// SpoolOption is a functional option for Spool.
+type SpoolOption func(*spoolOptions)
+
+// WithSpoolMemoryThreshold sets the size up to which Spool keeps the content in memory
+// (defaults to DefaultSpoolMemoryThreshold). Larger content is written to a temporary file.
+func WithSpoolMemoryThreshold(threshold int64) SpoolOption {
+	return func(opts *spoolOptions) {
+		opts.memoryThreshold = threshold
+	}
+}
+
+// WithSpoolTmpDir sets the directory for temporary files of Spool (defaults to os.TempDir()).
+func WithSpoolTmpDir(tmpDir string) SpoolOption {
+	return func(opts *spoolOptions) {
+		opts.tmpDir = tmpDir
+	}
+}
+
+// SpooledReader reads content spooled by Spool. It implements Sized, io.Seeker and io.ReaderAt and keeps the
+// content type and disposition of the original reader. Close must be called to remove the temporary file.
+type SpooledReader struct {
+	r                  readSeekerAt
+	file               *os.File
+	size               int64
+	contentType        string
+	contentDisposition string
+}
+
+type readSeekerAt interface {
+	io.ReadSeeker
+	io.ReaderAt
+}
+
+var (
+	_ Sized                = &SpooledReader{}
+	_ ContentTyped         = &SpooledReader{}
+	_ ContentDispositioned = &SpooledReader{}
+	_ io.ReadSeekCloser    = &SpooledReader{}
+	_ io.ReaderAt          = &SpooledReader{}
+)
+
+// Spool reads r completely and returns a reader of the content with a known size, so stores can upload it without
+// buffering content of unknown size (e.g. the S3 client uses a lot of memory for uploads of unknown length).
+// Content up to the memory threshold (see WithSpoolMemoryThreshold) is kept in memory, larger content is written
+// to a temporary file. Readers implementing Sized do not need to be spooled.
+func Spool(r io.Reader, opts ...SpoolOption) (*SpooledReader, error) {
+	o := spoolOptions{memoryThreshold: DefaultSpoolMemoryThreshold}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	s := &SpooledReader{}
+	if typedReader, ok := r.(ContentTyped); ok {
+		s.contentType = typedReader.ContentType()
+	}
+	if dispoReader, ok := r.(ContentDispositioned); ok {
+		s.contentDisposition = dispoReader.ContentDisposition()
+	}
+
+	// Read one byte more than the threshold to detect larger content
+	var buf bytes.Buffer
+	n, err := Copy(&buf, io.LimitReader(r, o.memoryThreshold+1))
+	if err != nil {
+		return nil, fmt.Errorf("spooling content: %w", err)
+	}
+	if n <= o.memoryThreshold {
+		s.r = bytes.NewReader(buf.Bytes())
+		s.size = n
+		return s, nil
+	}
+
+	file, err := os.CreateTemp(o.tmpDir, "spool-*")
+	if err != nil {
+		return nil, fmt.Errorf("creating temp file: %w", err)
+	}
+	s.file = file
+
+	size, err := Copy(file, io.MultiReader(&buf, r))
+	if err == nil {
+		_, err = file.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		_ = s.Close()
+		return nil, fmt.Errorf("spooling content to temp file: %w", err)
+	}
+	s.r = file
+	s.size = size
+
+	return s, nil
+}
+
+// Read implements io.Reader.
+func (s *SpooledReader) Read(p []byte) (int, error) {
+	return s.r.Read(p)
+}
+
+// ReadAt implements io.ReaderAt.
+func (s *SpooledReader) ReadAt(p []byte, off int64) (int, error) {
+	return s.r.ReadAt(p, off)
+}
+
+// Seek implements io.Seeker.
+func (s *SpooledReader) Seek(offset int64, whence int) (int64, error) {
+	return s.r.Seek(offset, whence)
+}
+
+// Size implements Sized.
+func (s *SpooledReader) Size() int64 {
+	return s.size
+}
+
+// ContentType implements ContentTyped with the content type of the original reader.
+func (s *SpooledReader) ContentType() string {
+	return s.contentType
+}
+
+// ContentDisposition implements ContentDispositioned with the content disposition of the original reader.
+func (s *SpooledReader) ContentDisposition() string {
+	return s.contentDisposition
+}
+
+// Spilled returns true if the content was written to a temporary file.
+func (s *SpooledReader) Spilled() bool {
+	return s.file != nil
+}
+
+// Close removes the temporary file (if any).
+func (s *SpooledReader) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	closeErr := s.file.Close()
+	if err := os.Remove(s.file.Name()); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("removing temp file: %w", err)
+	}
+	if closeErr != nil && !errors.Is(closeErr, os.ErrClosed) {
+		return fmt.Errorf("closing temp file: %w", closeErr)
+	}
+	return nil
+}
@@ -0,0 +1,53 @@
+package filestore_test
+
+import (
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/networkteam/filestore"
+)
+
+func TestSpool(t *testing.T) {
+	for _, test := range []struct {
+		name    string
+		content string
+		spilled bool
+	}{
+		{name: "memory", content: "Hello", spilled: false},
+		{name: "at threshold", content: "Hello Worl", spilled: false},
+		{name: "temp file", content: "Hello World", spilled: true},
+	} {
+		t.Run(test.name, func(t *testing.T) {
+			tmpDir := t.TempDir()
+
+			// Hide the size of the strings.Reader
+			r := filestore.NewReader(io.MultiReader(strings.NewReader(test.content)), filestore.WithContentType("text/plain"))
+			spooled, err := filestore.Spool(r, filestore.WithSpoolMemoryThreshold(10), filestore.WithSpoolTmpDir(tmpDir))
+			require.NoError(t, err)
+
+			assert.Equal(t, test.spilled, spooled.Spilled())
+			assert.Equal(t, int64(len(test.content)), spooled.Size())
+			assert.Equal(t, "text/plain", spooled.ContentType())
+
+			content, err := io.ReadAll(spooled)
+			require.NoError(t, err)
+			assert.Equal(t, test.content, string(content))
+
+			p := make([]byte, 4)
+			_, err = spooled.ReadAt(p, 1)
+			require.NoError(t, err)
+			assert.Equal(t, test.content[1:5], string(p))
+
+			require.NoError(t, spooled.Close())
+
+			entries, err := os.ReadDir(tmpDir)
+			require.NoError(t, err)
+			assert.Empty(t, entries, "temp file should be removed")
+		})
+	}
+}
@@ -0,0 +1,55 @@
+package filestore
+
+import (
+	"context"
+	"io"
+)
+
+// StoreInfo stores the content of r in store and returns information about the stored file without an additional
+// request to the store: the hash, the number of bytes read and the content type (declared by r, see ContentTyped,
+// or detected from the content, see DetectContentType) and content disposition (declared by r).
+// A detected content type is also passed to the store.
+func StoreInfo(ctx context.Context, store Storer, r io.Reader) (ObjectInfo, error) {
+	var info ObjectInfo
+	if typedReader, ok := r.(ContentTyped); ok {
+		info.ContentType = typedReader.ContentType()
+	}
+	if dispoReader, ok := r.(ContentDispositioned); ok {
+		info.ContentDisposition = dispoReader.ContentDisposition()
+	}
+
+	content := r
+	if info.ContentType == "" {
+		var err error
+		if info.ContentType, content, err = DetectContentType(r); err != nil {
+			return ObjectInfo{}, err
+		}
+	}
+
+	cr := &countingReader{r: content}
+	opts := []ReaderOption{WithContentType(info.ContentType), WithContentDisposition(info.ContentDisposition)}
+	if sizedReader, ok := r.(Sized); ok {
+		opts = append(opts, WithSize(sizedReader.Size()))
+	}
+
+	hash, err := store.Store(ctx, NewReader(cr, opts...))
+	if err != nil {
+		return ObjectInfo{}, err
+	}
+	info.Hash = hash
+	info.Size = cr.n
+
+	return info, nil
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,47 @@
+package filestore_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/memory"
+)
+
+func TestStoreInfo(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewFilestore()
+
+	t.Run("detected content type", func(t *testing.T) {
+		info, err := filestore.StoreInfo(ctx, store, strings.NewReader("Hello World"))
+		require.NoError(t, err)
+		assert.Equal(t, filestore.ObjectInfo{
+			Hash:        "a591a6d40bf420404a011733cfb7b190d62c65bf0bcda32b57b277d9ad9f146e",
+			Size:        11,
+			ContentType: "text/plain; charset=utf-8",
+		}, info)
+
+		stored, err := store.Stat(ctx, info.Hash)
+		require.NoError(t, err)
+		assert.Equal(t, info, stored)
+	})
+
+	t.Run("declared content type and disposition", func(t *testing.T) {
+		info, err := filestore.StoreInfo(ctx, store, filestore.NewReader(
+			strings.NewReader("Other content"),
+			filestore.WithContentType("application/octet-stream"),
+			filestore.WithFilename("data.bin"),
+		))
+		require.NoError(t, err)
+		assert.Equal(t, filestore.ObjectInfo{
+			Hash:               "0f8d9a2c864001b5c6492122310ba2a1346db67609fe815c070cab8a548ce27f",
+			Size:               13,
+			ContentType:        "application/octet-stream",
+			ContentDisposition: `attachment; filename="data.bin"`,
+		}, info)
+	})
+}
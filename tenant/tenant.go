@@ -0,0 +1,266 @@
+// Package tenant manages the file stores of multiple tenants (e.g. a directory or bucket per tenant) behind one API.
+package tenant
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"sync"
+
+	"github.com/networkteam/filestore"
+)
+
+// ErrInvalidTenantID is returned for tenant IDs that are not valid (see Manager).
+var ErrInvalidTenantID = errors.New("invalid tenant ID")
+
+// tenantIDRegex allows lowercase DNS labels, so tenant IDs can be used for directory and bucket names.
+var tenantIDRegex = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]{0,61}[a-z0-9])?$`)
+
+// Manager opens and caches the file stores of tenants from a provider.
+//
+// Tenant IDs must consist of lowercase letters, digits and hyphens (not at the start or end) with a maximum length
+// of 63 characters, so they can be used for directory and bucket names.
+type Manager struct {
+	provider Provider
+
+	mx     sync.Mutex
+	stores map[string]filestore.FileStore
+}
+
+// NewManager creates a manager for the tenant file stores of provider.
+func NewManager(provider Provider) *Manager {
+	return &Manager{
+		provider: provider,
+		stores:   make(map[string]filestore.FileStore),
+	}
+}
+
+// For returns the file store of a tenant. The store is opened on first use, so errors for opening the store
+// (e.g. ErrInvalidTenantID) are returned by the operations of the store.
+// Only the methods of filestore.FileStore are available on the returned store.
+func (m *Manager) For(tenantID string) filestore.FileStore {
+	return &tenantStore{
+		manager:  m,
+		tenantID: tenantID,
+	}
+}
+
+// Create opens the file store of a new tenant, which creates its storage (depending on the provider).
+func (m *Manager) Create(ctx context.Context, tenantID string) error {
+	_, err := m.store(ctx, tenantID)
+	return err
+}
+
+// Delete removes all files of a tenant and the storage of the tenant if the provider implements Deleter.
+func (m *Manager) Delete(ctx context.Context, tenantID string) error {
+	store, err := m.store(ctx, tenantID)
+	if err != nil {
+		return err
+	}
+
+	// Files are collected first, so they are not removed while iterating
+	var hashes []string
+	err = store.Iterate(ctx, 1000, func(batch []string) error {
+		hashes = append(hashes, batch...)
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("iterating files of tenant %s: %w", tenantID, err)
+	}
+	for _, hash := range hashes {
+		if err := store.Remove(ctx, hash); err != nil && !errors.Is(err, filestore.ErrNotExist) {
+			return fmt.Errorf("removing file %s of tenant %s: %w", hash, tenantID, err)
+		}
+	}
+
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	delete(m.stores, tenantID)
+
+	if deleter, ok := m.provider.(Deleter); ok {
+		if err := deleter.Delete(ctx, tenantID); err != nil {
+			return fmt.Errorf("deleting tenant %s: %w", tenantID, err)
+		}
+	}
+
+	return nil
+}
+
+// Tenants returns the sorted IDs of all tenants. If the provider does not implement Lister, only the tenants
+// opened by the manager are returned.
+func (m *Manager) Tenants(ctx context.Context) ([]string, error) {
+	if lister, ok := m.provider.(Lister); ok {
+		tenantIDs, err := lister.Tenants(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("listing tenants: %w", err)
+		}
+		sort.Strings(tenantIDs)
+		return tenantIDs, nil
+	}
+
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	tenantIDs := make([]string, 0, len(m.stores))
+	for tenantID := range m.stores {
+		tenantIDs = append(tenantIDs, tenantID)
+	}
+	sort.Strings(tenantIDs)
+	return tenantIDs, nil
+}
+
+// Iterate calls callback with the ID and file store of every tenant (see Tenants).
+// If callback returns an error, iteration stops and the error is returned.
+func (m *Manager) Iterate(ctx context.Context, callback func(tenantID string, store filestore.FileStore) error) error {
+	tenantIDs, err := m.Tenants(ctx)
+	if err != nil {
+		return err
+	}
+	for _, tenantID := range tenantIDs {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		if err := callback(tenantID, m.For(tenantID)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// usager is implemented by file stores that can return their usage (e.g. local.Filestore).
+type usager interface {
+	Usage(ctx context.Context) (filestore.Usage, error)
+}
+
+// Usage returns the number of stored files of a tenant and their total size in bytes.
+// If the file store of the tenant cannot return its usage, the sizes of all files are summed up.
+func (m *Manager) Usage(ctx context.Context, tenantID string) (filestore.Usage, error) {
+	store, err := m.store(ctx, tenantID)
+	if err != nil {
+		return filestore.Usage{}, err
+	}
+
+	if u, ok := store.(usager); ok {
+		return u.Usage(ctx)
+	}
+
+	var usage filestore.Usage
+	err = store.Iterate(ctx, 1000, func(hashes []string) error {
+		for _, hash := range hashes {
+			size, err := store.Size(ctx, hash)
+			if errors.Is(err, filestore.ErrNotExist) {
+				// Removed while iterating
+				continue
+			}
+			if err != nil {
+				return err
+			}
+			usage.Objects++
+			usage.Bytes += size
+		}
+		return nil
+	})
+	if err != nil {
+		return filestore.Usage{}, fmt.Errorf("calculating usage of tenant %s: %w", tenantID, err)
+	}
+
+	return usage, nil
+}
+
+// store returns the cached file store of a tenant or opens it.
+func (m *Manager) store(ctx context.Context, tenantID string) (filestore.FileStore, error) {
+	if !tenantIDRegex.MatchString(tenantID) {
+		return nil, fmt.Errorf("%w: %q", ErrInvalidTenantID, tenantID)
+	}
+
+	m.mx.Lock()
+	defer m.mx.Unlock()
+
+	if store, ok := m.stores[tenantID]; ok {
+		return store, nil
+	}
+
+	store, err := m.provider.Open(ctx, tenantID)
+	if err != nil {
+		return nil, fmt.Errorf("opening file store of tenant %s: %w", tenantID, err)
+	}
+	m.stores[tenantID] = store
+
+	return store, nil
+}
+
+// tenantStore opens the file store of a tenant on first use and delegates all operations to it.
+type tenantStore struct {
+	manager  *Manager
+	tenantID string
+}
+
+var _ filestore.FileStore = &tenantStore{}
+
+func (s *tenantStore) Store(ctx context.Context, r io.Reader) (string, error) {
+	store, err := s.manager.store(ctx, s.tenantID)
+	if err != nil {
+		return "", err
+	}
+	return store.Store(ctx, r)
+}
+
+func (s *tenantStore) StoreHashed(ctx context.Context, r io.Reader, hash string) error {
+	store, err := s.manager.store(ctx, s.tenantID)
+	if err != nil {
+		return err
+	}
+	return store.StoreHashed(ctx, r, hash)
+}
+
+func (s *tenantStore) Exists(ctx context.Context, hash string) (bool, error) {
+	store, err := s.manager.store(ctx, s.tenantID)
+	if err != nil {
+		return false, err
+	}
+	return store.Exists(ctx, hash)
+}
+
+func (s *tenantStore) Fetch(ctx context.Context, hash string) (io.ReadCloser, error) {
+	store, err := s.manager.store(ctx, s.tenantID)
+	if err != nil {
+		return nil, err
+	}
+	return store.Fetch(ctx, hash)
+}
+
+func (s *tenantStore) Iterate(ctx context.Context, maxBatch int, callback func(hashes []string) error) error {
+	store, err := s.manager.store(ctx, s.tenantID)
+	if err != nil {
+		return err
+	}
+	return store.Iterate(ctx, maxBatch, callback)
+}
+
+func (s *tenantStore) Remove(ctx context.Context, hash string) error {
+	store, err := s.manager.store(ctx, s.tenantID)
+	if err != nil {
+		return err
+	}
+	return store.Remove(ctx, hash)
+}
+
+func (s *tenantStore) Size(ctx context.Context, hash string) (int64, error) {
+	store, err := s.manager.store(ctx, s.tenantID)
+	if err != nil {
+		return 0, err
+	}
+	return store.Size(ctx, hash)
+}
+
+func (s *tenantStore) ImgproxyURLSource(hash string) (string, error) {
+	store, err := s.manager.store(context.Background(), s.tenantID)
+	if err != nil {
+		return "", err
+	}
+	return store.ImgproxyURLSource(hash)
+}
@@ -0,0 +1,102 @@
+package tenant
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/local"
+)
+
+// A Provider opens the file stores of tenants.
+type Provider interface {
+	// Open opens the file store of a tenant. The storage of the tenant (e.g. a directory or bucket) should be
+	// created if it does not exist.
+	Open(ctx context.Context, tenantID string) (filestore.FileStore, error)
+}
+
+// A Deleter is a provider that can delete the storage of a tenant (e.g. a directory or bucket).
+// Delete is called by Manager.Delete after all files of the tenant were removed.
+type Deleter interface {
+	Delete(ctx context.Context, tenantID string) error
+}
+
+// A Lister is a provider that can list the IDs of all tenants with storage.
+type Lister interface {
+	Tenants(ctx context.Context) ([]string, error)
+}
+
+// ProviderFunc is a function that implements Provider.
+type ProviderFunc func(ctx context.Context, tenantID string) (filestore.FileStore, error)
+
+// Open calls f.
+func (f ProviderFunc) Open(ctx context.Context, tenantID string) (filestore.FileStore, error) {
+	return f(ctx, tenantID)
+}
+
+// DSN returns a provider that opens the file store of a tenant with filestore.Open from a DSN template.
+// The placeholder "{tenant}" in the template is replaced by the tenant ID, e.g.
+// "s3://key:secret@endpoint/assets-{tenant}?autoCreate=true" for a bucket per tenant.
+// The backend of the DSN must be registered (see filestore.Register).
+func DSN(template string) Provider {
+	return ProviderFunc(func(ctx context.Context, tenantID string) (filestore.FileStore, error) {
+		return filestore.Open(ctx, strings.ReplaceAll(template, "{tenant}", tenantID))
+	})
+}
+
+// tmpDirName is the directory for temporary files of all tenants in the base path of a DirProvider.
+// It starts with a dot, so it is not listed as a tenant.
+const tmpDirName = ".tmp"
+
+// DirProvider provides local file stores in a directory per tenant.
+type DirProvider struct {
+	basePath string
+	opts     []local.Option
+}
+
+var (
+	_ Provider = &DirProvider{}
+	_ Deleter  = &DirProvider{}
+	_ Lister   = &DirProvider{}
+)
+
+// Dir returns a provider for local file stores in a directory per tenant below basePath.
+// Temporary files of all tenants are written to a ".tmp" directory in basePath.
+func Dir(basePath string, opts ...local.Option) *DirProvider {
+	return &DirProvider{
+		basePath: basePath,
+		opts:     opts,
+	}
+}
+
+// Open opens the local file store of a tenant and creates its directory if it does not exist.
+func (p *DirProvider) Open(ctx context.Context, tenantID string) (filestore.FileStore, error) {
+	return local.NewFilestore(filepath.Join(p.basePath, tmpDirName), filepath.Join(p.basePath, tenantID), p.opts...)
+}
+
+// Delete removes the directory of a tenant.
+func (p *DirProvider) Delete(ctx context.Context, tenantID string) error {
+	return os.RemoveAll(filepath.Join(p.basePath, tenantID))
+}
+
+// Tenants returns the IDs of all tenants with a directory.
+func (p *DirProvider) Tenants(ctx context.Context) ([]string, error) {
+	entries, err := os.ReadDir(p.basePath)
+	if os.IsNotExist(err) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("reading base path: %w", err)
+	}
+
+	var tenantIDs []string
+	for _, entry := range entries {
+		if entry.IsDir() && tenantIDRegex.MatchString(entry.Name()) {
+			tenantIDs = append(tenantIDs, entry.Name())
+		}
+	}
+	return tenantIDs, nil
+}
@@ -0,0 +1,113 @@
+package tenant_test
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/memory"
+	"github.com/networkteam/filestore/tenant"
+)
+
+func TestManager_Dir(t *testing.T) {
+	ctx := context.Background()
+	basePath := t.TempDir()
+
+	manager := tenant.NewManager(tenant.Dir(basePath))
+
+	hash, err := manager.For("acme").Store(ctx, strings.NewReader("Acme content"))
+	require.NoError(t, err)
+	_, err = manager.For("globex").Store(ctx, strings.NewReader("Globex content and more"))
+	require.NoError(t, err)
+
+	t.Run("isolates tenants", func(t *testing.T) {
+		exists, err := manager.For("globex").Exists(ctx, hash)
+		require.NoError(t, err)
+		assert.False(t, exists)
+
+		r, err := manager.For("acme").Fetch(ctx, hash)
+		require.NoError(t, err)
+		defer r.Close()
+		content, err := io.ReadAll(r)
+		require.NoError(t, err)
+		assert.Equal(t, "Acme content", string(content))
+	})
+
+	t.Run("Tenants", func(t *testing.T) {
+		tenantIDs, err := manager.Tenants(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"acme", "globex"}, tenantIDs)
+
+		// A new manager lists the tenants from the directories
+		tenantIDs, err = tenant.NewManager(tenant.Dir(basePath)).Tenants(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"acme", "globex"}, tenantIDs)
+	})
+
+	t.Run("Usage", func(t *testing.T) {
+		usage, err := manager.Usage(ctx, "globex")
+		require.NoError(t, err)
+		assert.Equal(t, filestore.Usage{Objects: 1, Bytes: 23}, usage)
+	})
+
+	t.Run("Iterate", func(t *testing.T) {
+		var tenantIDs []string
+		err := manager.Iterate(ctx, func(tenantID string, store filestore.FileStore) error {
+			tenantIDs = append(tenantIDs, tenantID)
+			return nil
+		})
+		require.NoError(t, err)
+		assert.Equal(t, []string{"acme", "globex"}, tenantIDs)
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		require.NoError(t, manager.Delete(ctx, "acme"))
+
+		_, err := os.Stat(filepath.Join(basePath, "acme"))
+		assert.True(t, os.IsNotExist(err))
+
+		tenantIDs, err := manager.Tenants(ctx)
+		require.NoError(t, err)
+		assert.Equal(t, []string{"globex"}, tenantIDs)
+	})
+}
+
+func TestManager_ProviderFunc(t *testing.T) {
+	ctx := context.Background()
+
+	var opened []string
+	manager := tenant.NewManager(tenant.ProviderFunc(func(ctx context.Context, tenantID string) (filestore.FileStore, error) {
+		opened = append(opened, tenantID)
+		return memory.NewFilestore(), nil
+	}))
+
+	require.NoError(t, manager.Create(ctx, "acme"))
+	_, err := manager.For("acme").Store(ctx, strings.NewReader("Acme content"))
+	require.NoError(t, err)
+
+	usage, err := manager.Usage(ctx, "acme")
+	require.NoError(t, err)
+	assert.Equal(t, filestore.Usage{Objects: 1, Bytes: 12}, usage)
+
+	tenantIDs, err := manager.Tenants(ctx)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"acme"}, tenantIDs)
+	assert.Equal(t, []string{"acme"}, opened, "store should be opened once")
+}
+
+func TestManager_InvalidTenantID(t *testing.T) {
+	ctx := context.Background()
+	manager := tenant.NewManager(tenant.Dir(t.TempDir()))
+
+	for _, tenantID := range []string{"", "Acme", "../acme", "acme-", ".tmp", strings.Repeat("a", 64)} {
+		_, err := manager.For(tenantID).Store(ctx, strings.NewReader("content"))
+		assert.ErrorIs(t, err, tenant.ErrInvalidTenantID, tenantID)
+	}
+}
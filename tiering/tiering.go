@@ -0,0 +1,234 @@
+// Package tiering provides a file store wrapper that moves files to a secondary store (e.g. a cheaper, slower
+// backend) on Archive and back on Restore, for backends without storage classes like S3 Glacier.
+package tiering
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/hashicorp/go-multierror"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/internal/parallel"
+)
+
+// DefaultPrefetchConcurrency is the default number of files restored concurrently by Prefetch.
+const DefaultPrefetchConcurrency = 4
+
+// Filestore wraps a file store and archives files to a secondary store. Archived files still exist, but Fetch fails
+// with filestore.ErrArchived until they are restored. Restores are done immediately and are permanent.
+// Only the methods of filestore.FileStore and filestore.Archiver are available on the wrapper.
+type Filestore struct {
+	filestore.FileStore
+
+	archive             filestore.FileStore
+	prefetchConcurrency int
+}
+
+type options struct {
+	prefetchConcurrency int
+}
+
+// Option is a functional option for creating a tiering file store.
+type Option func(*options)
+
+// WithPrefetchConcurrency sets the number of files restored concurrently by Prefetch
+// (defaults to DefaultPrefetchConcurrency).
+func WithPrefetchConcurrency(concurrency int) Option {
+	return func(opts *options) {
+		opts.prefetchConcurrency = concurrency
+	}
+}
+
+var (
+	_ filestore.FileStore  = &Filestore{}
+	_ filestore.Archiver   = &Filestore{}
+	_ filestore.Prefetcher = &Filestore{}
+)
+
+// NewFilestore creates a file store that archives files from store to archive.
+func NewFilestore(store, archive filestore.FileStore, opts ...Option) *Filestore {
+	o := options{
+		prefetchConcurrency: DefaultPrefetchConcurrency,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return &Filestore{
+		FileStore:           store,
+		archive:             archive,
+		prefetchConcurrency: o.prefetchConcurrency,
+	}
+}
+
+// Archive moves the file with the hash to the archive store.
+func (f *Filestore) Archive(ctx context.Context, hash string) error {
+	archived, err := f.move(ctx, f.FileStore, f.archive, hash)
+	if err != nil {
+		return fmt.Errorf("archiving %q: %w", hash, err)
+	}
+	if !archived {
+		return f.checkArchived(ctx, "archive", hash)
+	}
+	return nil
+}
+
+// Restore moves an archived file with the hash back from the archive store.
+func (f *Filestore) Restore(ctx context.Context, hash string) error {
+	restored, err := f.move(ctx, f.archive, f.FileStore, hash)
+	if err != nil {
+		return fmt.Errorf("restoring %q: %w", hash, err)
+	}
+	if !restored {
+		exists, err := f.FileStore.Exists(ctx, hash)
+		if err != nil {
+			return err
+		}
+		if !exists {
+			return &filestore.NotExistError{Op: "restore", Hash: hash}
+		}
+	}
+	return nil
+}
+
+// Prefetch implements filestore.Prefetcher and restores the archived files with the given hashes. All hashes are
+// restored even if some fail, the errors are returned combined.
+func (f *Filestore) Prefetch(ctx context.Context, hashes []string) error {
+	var (
+		mx     sync.Mutex
+		result error
+	)
+	err := parallel.ForEach(ctx, hashes, f.prefetchConcurrency, func(ctx context.Context, hash string) error {
+		if err := f.Restore(ctx, hash); err != nil {
+			mx.Lock()
+			result = multierror.Append(result, err)
+			mx.Unlock()
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	return result
+}
+
+// RestoreStatus returns whether the file with the hash is archived. Since restores are done immediately, an archived
+// file is never being restored.
+func (f *Filestore) RestoreStatus(ctx context.Context, hash string) (filestore.RestoreStatus, error) {
+	exists, err := f.FileStore.Exists(ctx, hash)
+	if err != nil {
+		return filestore.RestoreStatus{}, err
+	}
+	if exists {
+		return filestore.RestoreStatus{}, nil
+	}
+	if err = f.checkArchived(ctx, "restore status", hash); err != nil {
+		return filestore.RestoreStatus{}, err
+	}
+	return filestore.RestoreStatus{Archived: true}, nil
+}
+
+// Exists checks if the file with the hash exists in the store or in the archive store.
+func (f *Filestore) Exists(ctx context.Context, hash string) (bool, error) {
+	exists, err := f.FileStore.Exists(ctx, hash)
+	if err != nil || exists {
+		return exists, err
+	}
+	return f.archive.Exists(ctx, hash)
+}
+
+// Fetch fetches the file with the hash from the store or returns filestore.ErrArchived if it is archived.
+func (f *Filestore) Fetch(ctx context.Context, hash string) (io.ReadCloser, error) {
+	r, err := f.FileStore.Fetch(ctx, hash)
+	if !errors.Is(err, filestore.ErrNotExist) {
+		return r, err
+	}
+	archived, archiveErr := f.archive.Exists(ctx, hash)
+	if archiveErr != nil {
+		return nil, fmt.Errorf("checking archive: %w", archiveErr)
+	}
+	if archived {
+		return nil, fmt.Errorf("fetch %q: %w", hash, filestore.ErrArchived)
+	}
+	return nil, err
+}
+
+// Size returns the size of the file with the hash from the store or the archive store.
+func (f *Filestore) Size(ctx context.Context, hash string) (int64, error) {
+	size, err := f.FileStore.Size(ctx, hash)
+	if errors.Is(err, filestore.ErrNotExist) {
+		return f.archive.Size(ctx, hash)
+	}
+	return size, err
+}
+
+// Iterate iterates over the files of the store and then over the archived files.
+// A file that is archived or restored during the iteration can be returned twice or not at all.
+func (f *Filestore) Iterate(ctx context.Context, maxBatch int, callback func(hashes []string) error) error {
+	if err := f.FileStore.Iterate(ctx, maxBatch, callback); err != nil {
+		return err
+	}
+	return f.archive.Iterate(ctx, maxBatch, callback)
+}
+
+// Remove removes the file with the hash from the store and the archive store.
+func (f *Filestore) Remove(ctx context.Context, hash string) error {
+	err := f.FileStore.Remove(ctx, hash)
+	if errors.Is(err, filestore.ErrNotExist) {
+		return f.archive.Remove(ctx, hash)
+	}
+	if err != nil {
+		return err
+	}
+
+	// A file can exist in both stores if archiving or restoring was interrupted
+	if err = f.archive.Remove(ctx, hash); err != nil && !errors.Is(err, filestore.ErrNotExist) {
+		return fmt.Errorf("removing from archive: %w", err)
+	}
+	return nil
+}
+
+// move copies the file with the hash from src to dst with its metadata and removes it from src.
+// It returns false if the file does not exist in src.
+func (f *Filestore) move(ctx context.Context, src, dst filestore.FileStore, hash string) (moved bool, err error) {
+	rc, info, err := filestore.FetchInfo(ctx, src, hash)
+	if errors.Is(err, filestore.ErrNotExist) {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	err = dst.StoreHashed(ctx, filestore.NewReader(
+		rc,
+		filestore.WithSize(info.Size),
+		filestore.WithContentType(info.ContentType),
+		filestore.WithContentDisposition(info.ContentDisposition),
+	), hash)
+	// Close before removing, so the file is not open anymore
+	_ = rc.Close()
+	if err != nil {
+		return false, fmt.Errorf("copying: %w", err)
+	}
+
+	if err = src.Remove(ctx, hash); err != nil {
+		return false, fmt.Errorf("removing: %w", err)
+	}
+	return true, nil
+}
+
+// checkArchived returns a filestore.NotExistError if the file with the hash is not in the archive store.
+func (f *Filestore) checkArchived(ctx context.Context, op, hash string) error {
+	archived, err := f.archive.Exists(ctx, hash)
+	if err != nil {
+		return fmt.Errorf("checking archive: %w", err)
+	}
+	if !archived {
+		return &filestore.NotExistError{Op: op, Hash: hash}
+	}
+	return nil
+}
@@ -0,0 +1,33 @@
+package tiering
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/url"
+
+	"github.com/networkteam/filestore"
+)
+
+func init() {
+	filestore.RegisterWrapper("tiering", wrapTiering)
+}
+
+// ErrMissingArchive is returned by filestore.Open if the tiering wrapper is used without an archive store.
+var ErrMissingArchive = errors.New("missing archive store")
+
+// wrapTiering wraps a store opened by filestore.Open with "wrap=tiering" to archive files to the store opened from
+// the (URL encoded) DSN in the archive parameter, e.g. "archive=file%3A%2F%2F%2Fmnt%2Fcold%2Fassets".
+func wrapTiering(ctx context.Context, store filestore.FileStore, params url.Values) (filestore.FileStore, error) {
+	archiveDSN := params.Get("archive")
+	if archiveDSN == "" {
+		return nil, ErrMissingArchive
+	}
+
+	archive, err := filestore.Open(ctx, archiveDSN)
+	if err != nil {
+		return nil, fmt.Errorf("opening archive store: %w", err)
+	}
+
+	return NewFilestore(store, archive), nil
+}
@@ -0,0 +1,119 @@
+package tiering_test
+
+import (
+	"context"
+	"io"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/memory"
+	"github.com/networkteam/filestore/tiering"
+)
+
+func TestFilestore(t *testing.T) {
+	ctx := context.Background()
+	primary := memory.NewFilestore()
+	archive := memory.NewFilestore()
+	store := tiering.NewFilestore(primary, archive)
+
+	hash, err := store.Store(ctx, filestore.ContentTypedReader(strings.NewReader("Old content"), "text/plain"))
+	require.NoError(t, err)
+
+	status, err := store.RestoreStatus(ctx, hash)
+	require.NoError(t, err)
+	assert.Equal(t, filestore.RestoreStatus{}, status)
+
+	require.NoError(t, store.Archive(ctx, hash))
+	require.NoError(t, store.Archive(ctx, hash), "archiving an archived file does nothing")
+
+	status, err = store.RestoreStatus(ctx, hash)
+	require.NoError(t, err)
+	assert.Equal(t, filestore.RestoreStatus{Archived: true}, status)
+
+	exists, err := primary.Exists(ctx, hash)
+	require.NoError(t, err)
+	assert.False(t, exists)
+	info, err := archive.Stat(ctx, hash)
+	require.NoError(t, err)
+	assert.Equal(t, "text/plain", info.ContentType)
+
+	_, err = store.Fetch(ctx, hash)
+	assert.ErrorIs(t, err, filestore.ErrArchived)
+
+	exists, err = store.Exists(ctx, hash)
+	require.NoError(t, err)
+	assert.True(t, exists, "archived files exist")
+	size, err := store.Size(ctx, hash)
+	require.NoError(t, err)
+	assert.Equal(t, int64(11), size)
+
+	var iterated []string
+	err = store.Iterate(ctx, 10, func(hashes []string) error {
+		iterated = append(iterated, hashes...)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{hash}, iterated)
+
+	require.NoError(t, store.Restore(ctx, hash))
+	require.NoError(t, store.Restore(ctx, hash), "restoring a restored file does nothing")
+
+	status, err = store.RestoreStatus(ctx, hash)
+	require.NoError(t, err)
+	assert.Equal(t, filestore.RestoreStatus{}, status)
+
+	r, err := store.Fetch(ctx, hash)
+	require.NoError(t, err)
+	content, err := io.ReadAll(r)
+	require.NoError(t, err)
+	require.NoError(t, r.Close())
+	assert.Equal(t, "Old content", string(content))
+
+	require.NoError(t, store.Archive(ctx, hash))
+	require.NoError(t, store.Remove(ctx, hash))
+	exists, err = store.Exists(ctx, hash)
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	_, err = store.Fetch(ctx, hash)
+	assert.ErrorIs(t, err, filestore.ErrNotExist)
+	assert.ErrorIs(t, store.Archive(ctx, hash), filestore.ErrNotExist)
+	assert.ErrorIs(t, store.Restore(ctx, hash), filestore.ErrNotExist)
+	_, err = store.RestoreStatus(ctx, hash)
+	assert.ErrorIs(t, err, filestore.ErrNotExist)
+}
+
+func TestFilestore_Prefetch(t *testing.T) {
+	ctx := context.Background()
+	primary := memory.NewFilestore()
+	store := tiering.NewFilestore(primary, memory.NewFilestore(), tiering.WithPrefetchConcurrency(2))
+
+	var hashes []string
+	for _, content := range []string{"First", "Second", "Third"} {
+		hash, err := store.Store(ctx, strings.NewReader(content))
+		require.NoError(t, err)
+		require.NoError(t, store.Archive(ctx, hash))
+		hashes = append(hashes, hash)
+	}
+
+	require.NoError(t, store.Prefetch(ctx, hashes))
+	for _, hash := range hashes {
+		exists, err := primary.Exists(ctx, hash)
+		require.NoError(t, err)
+		assert.True(t, exists)
+	}
+}
+
+func TestOpen(t *testing.T) {
+	store, err := filestore.Open(context.Background(), "memory://?wrap=tiering&archive="+url.QueryEscape("memory://"))
+	require.NoError(t, err)
+	assert.IsType(t, &tiering.Filestore{}, store)
+
+	_, err = filestore.Open(context.Background(), "memory://?wrap=tiering")
+	assert.ErrorIs(t, err, tiering.ErrMissingArchive)
+}
@@ -0,0 +1,175 @@
+// Package upload stores uploaded files of HTTP requests in a file store.
+package upload
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+
+	"github.com/networkteam/filestore"
+)
+
+// ErrTooLarge is returned if an upload exceeds the max size. It wraps filestore.ErrTooLarge.
+var ErrTooLarge = fmt.Errorf("upload exceeds max size: %w", filestore.ErrTooLarge)
+
+// ErrMissingFile is returned by StoreRequest if the request has no file with the given field name.
+var ErrMissingFile = errors.New("missing file in request")
+
+// Result describes a stored upload.
+type Result struct {
+	Hash        string `json:"hash"`
+	Size        int64  `json:"size"`
+	ContentType string `json:"contentType,omitempty"`
+	Filename    string `json:"filename,omitempty"`
+}
+
+// StoreRequest stores the file with the given form field name of a multipart request.
+// The request body is streamed to the store, so the file is not buffered in memory or on disk.
+// If maxSize is greater than 0, uploads exceeding it fail with ErrTooLarge.
+func StoreRequest(store filestore.Storer, r *http.Request, fieldName string, maxSize int64) (Result, error) {
+	part, err := filePart(r, fieldName)
+	if err != nil {
+		return Result{}, err
+	}
+	defer part.Close()
+
+	return StorePart(r.Context(), store, part, maxSize)
+}
+
+// filePart returns the first file part with the given form field name of a multipart request.
+func filePart(r *http.Request, fieldName string) (*multipart.Part, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, fmt.Errorf("reading multipart request: %w", err)
+	}
+
+	for {
+		part, err := mr.NextPart()
+		if errors.Is(err, io.EOF) {
+			return nil, ErrMissingFile
+		}
+		if err != nil {
+			return nil, fmt.Errorf("reading part: %w", err)
+		}
+
+		if part.FormName() == fieldName && part.FileName() != "" {
+			return part, nil
+		}
+		_ = part.Close()
+	}
+}
+
+// StorePart stores a file part of a multipart form.
+// The content type and filename of the part are passed to the store (e.g. as S3 object metadata).
+// If maxSize is greater than 0, uploads exceeding it fail with ErrTooLarge.
+func StorePart(ctx context.Context, store filestore.Storer, part *multipart.Part, maxSize int64) (Result, error) {
+	return Store(ctx, store, part, Metadata{
+		ContentType: part.Header.Get("Content-Type"),
+		Filename:    part.FileName(),
+		Size:        -1,
+	}, maxSize)
+}
+
+// Metadata of an upload.
+type Metadata struct {
+	ContentType string
+	// Filename of the upload, directories are removed.
+	Filename string
+	// Size is the expected size of the upload or -1 if unknown.
+	Size int64
+}
+
+// Store stores the content of r with the given metadata. The size, content type and content disposition
+// (an attachment with the filename) are passed to the store by wrapping the reader.
+// If maxSize is greater than 0, uploads exceeding it fail with ErrTooLarge.
+func Store(ctx context.Context, store filestore.Storer, r io.Reader, meta Metadata, maxSize int64) (Result, error) {
+	if maxSize > 0 && meta.Size > maxSize {
+		return Result{}, ErrTooLarge
+	}
+
+	ur := &uploadReader{
+		r:           r,
+		maxSize:     maxSize,
+		size:        meta.Size,
+		contentType: meta.ContentType,
+	}
+	filename := baseFilename(meta.Filename)
+	if filename != "" {
+		ur.contentDisposition = filestore.ContentDisposition("attachment", filename)
+	}
+
+	var (
+		hash string
+		err  error
+	)
+	if meta.Size >= 0 {
+		hash, err = store.Store(ctx, &sizedUploadReader{ur})
+	} else {
+		hash, err = store.Store(ctx, ur)
+	}
+	if ur.exceeded {
+		return Result{}, ErrTooLarge
+	}
+	if err != nil {
+		return Result{}, fmt.Errorf("storing upload: %w", err)
+	}
+
+	return Result{
+		Hash:        hash,
+		Size:        ur.read,
+		ContentType: meta.ContentType,
+		Filename:    filename,
+	}, nil
+}
+
+// baseFilename returns the last element of a (client supplied) filename or an empty string.
+func baseFilename(filename string) string {
+	filename = filepath.Base(filepath.FromSlash(filename))
+	if filename == "." || filename == string(filepath.Separator) {
+		return ""
+	}
+	return filename
+}
+
+// uploadReader limits the size of the content and implements the typed reader interfaces for
+// the content type and disposition of an upload.
+type uploadReader struct {
+	r                  io.Reader
+	maxSize            int64
+	read               int64
+	exceeded           bool
+	size               int64
+	contentType        string
+	contentDisposition string
+}
+
+func (r *uploadReader) Read(p []byte) (int, error) {
+	n, err := r.r.Read(p)
+	r.read += int64(n)
+	if r.maxSize > 0 && r.read > r.maxSize {
+		r.exceeded = true
+		return n, ErrTooLarge
+	}
+	return n, err
+}
+
+func (r *uploadReader) ContentType() string {
+	return r.contentType
+}
+
+func (r *uploadReader) ContentDisposition() string {
+	return r.contentDisposition
+}
+
+// sizedUploadReader is an uploadReader with a known size.
+type sizedUploadReader struct {
+	*uploadReader
+}
+
+func (r *sizedUploadReader) Size() int64 {
+	return r.size
+}
@@ -0,0 +1,121 @@
+package upload
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/contenttype"
+)
+
+type handlerOptions struct {
+	maxSize             int64
+	allowedContentTypes []string
+	fieldName           string
+}
+
+// HandlerOption is a functional option for creating an upload handler.
+type HandlerOption func(*handlerOptions)
+
+// WithMaxSize limits the size of uploads. Larger uploads are rejected with 413 Request Entity Too Large.
+func WithMaxSize(maxSize int64) HandlerOption {
+	return func(opts *handlerOptions) {
+		opts.maxSize = maxSize
+	}
+}
+
+// WithAllowedContentTypes only allows uploads with a detected content type matching one of the given types
+// (e.g. "image/png" or "image/*"). Other uploads are rejected with 415 Unsupported Media Type.
+func WithAllowedContentTypes(contentTypes ...string) HandlerOption {
+	return func(opts *handlerOptions) {
+		opts.allowedContentTypes = contentTypes
+	}
+}
+
+// WithFieldName sets the form field name of the file in multipart requests (defaults to "file").
+func WithFieldName(fieldName string) HandlerOption {
+	return func(opts *handlerOptions) {
+		opts.fieldName = fieldName
+	}
+}
+
+// Handler returns an http.Handler that streams uploads into the store and responds with the Result as JSON
+// (status 201 Created). Multipart requests store the file of the configured field, other requests store the
+// request body with the filename of a Content-Disposition request header.
+// The content type is detected from the content (see http.DetectContentType) and stored as metadata.
+//
+// The handler can be mounted with chi (r.Post("/upload", handler.ServeHTTP)) or echo (echo.WrapHandler(handler)).
+func Handler(store filestore.Storer, opts ...HandlerOption) http.Handler {
+	o := handlerOptions{
+		fieldName: "file",
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		result, err := o.store(store, r)
+		if err != nil {
+			status := errorStatus(err)
+			http.Error(w, http.StatusText(status), status)
+			return
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		_ = json.NewEncoder(w).Encode(result)
+	})
+}
+
+func (o handlerOptions) store(store filestore.Storer, r *http.Request) (Result, error) {
+	var (
+		body io.Reader
+		meta = Metadata{Size: -1}
+	)
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+		part, err := filePart(r, o.fieldName)
+		if err != nil {
+			return Result{}, err
+		}
+		defer part.Close()
+
+		body = part
+		meta.Filename = part.FileName()
+	} else {
+		body = r.Body
+		meta.Size = r.ContentLength
+		if _, params, err := mime.ParseMediaType(r.Header.Get("Content-Disposition")); err == nil {
+			meta.Filename = params["filename"]
+		}
+	}
+
+	var err error
+	if meta.ContentType, body, err = filestore.DetectContentType(body); err != nil {
+		return Result{}, fmt.Errorf("reading upload: %w", err)
+	}
+	if !contenttype.Matches(meta.ContentType, o.allowedContentTypes) {
+		return Result{}, fmt.Errorf("%w: %s", contenttype.ErrNotAllowed, meta.ContentType)
+	}
+
+	return Store(r.Context(), store, body, meta, o.maxSize)
+}
+
+func errorStatus(err error) int {
+	switch {
+	case errors.Is(err, filestore.ErrTooLarge):
+		return http.StatusRequestEntityTooLarge
+	case errors.Is(err, contenttype.ErrNotAllowed):
+		return http.StatusUnsupportedMediaType
+	case errors.Is(err, filestore.ErrContentRejected):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, ErrMissingFile), errors.Is(err, http.ErrNotMultipart):
+		return http.StatusBadRequest
+	default:
+		return http.StatusInternalServerError
+	}
+}
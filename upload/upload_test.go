@@ -0,0 +1,141 @@
+package upload_test
+
+import (
+	"bytes"
+	"context"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/local"
+	"github.com/networkteam/filestore/memory"
+	"github.com/networkteam/filestore/upload"
+)
+
+func TestStoreRequest(t *testing.T) {
+	store := memory.NewFilestore()
+
+	req := multipartRequest(t, "file", "../docs/report.pdf", "application/pdf", "PDF content")
+	result, err := upload.StoreRequest(store, req, "file", 1024)
+	require.NoError(t, err)
+
+	assert.Equal(t, upload.Result{
+		Hash:        "7e7f04c8b5646f7ad29b1cb0c8085d4ff9c6b08f2a632f496641b31f524c7b98",
+		Size:        11,
+		ContentType: "application/pdf",
+		Filename:    "report.pdf",
+	}, result)
+
+	info, err := store.Stat(context.Background(), result.Hash)
+	require.NoError(t, err)
+	assert.Equal(t, filestore.ObjectInfo{
+		Hash:               result.Hash,
+		Size:               11,
+		ContentType:        "application/pdf",
+		ContentDisposition: `attachment; filename="report.pdf"`,
+	}, info)
+
+	t.Run("missing file", func(t *testing.T) {
+		req := multipartRequest(t, "other", "report.pdf", "application/pdf", "PDF content")
+		_, err := upload.StoreRequest(store, req, "file", 1024)
+		assert.ErrorIs(t, err, upload.ErrMissingFile)
+	})
+}
+
+func TestStore_MaxSize(t *testing.T) {
+	ctx := context.Background()
+	testDir := t.TempDir()
+
+	localStore, err := local.NewFilestore(path.Join(testDir, "tmp"), path.Join(testDir, "assets"))
+	require.NoError(t, err)
+
+	for name, store := range map[string]filestore.Storer{
+		"memory": memory.NewFilestore(),
+		"local":  localStore,
+	} {
+		t.Run(name, func(t *testing.T) {
+			_, err := upload.Store(ctx, store, strings.NewReader("Too much content"), upload.Metadata{Size: -1}, 8)
+			assert.ErrorIs(t, err, upload.ErrTooLarge)
+
+			_, err = upload.Store(ctx, store, strings.NewReader("Too much content"), upload.Metadata{Size: 16}, 8)
+			assert.ErrorIs(t, err, upload.ErrTooLarge)
+
+			result, err := upload.Store(ctx, store, strings.NewReader("Content"), upload.Metadata{Size: -1}, 8)
+			require.NoError(t, err)
+			assert.Equal(t, int64(7), result.Size)
+		})
+	}
+
+	var hashes []string
+	err = localStore.Iterate(ctx, 10, func(batch []string) error {
+		hashes = append(hashes, batch...)
+		return nil
+	})
+	require.NoError(t, err)
+	assert.Len(t, hashes, 1, "too large uploads are not stored")
+}
+
+func multipartRequest(t *testing.T, fieldName, filename, contentType, content string) *http.Request {
+	t.Helper()
+
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	partHeader := make(map[string][]string)
+	partHeader["Content-Disposition"] = []string{`form-data; name="` + fieldName + `"; filename="` + filename + `"`}
+	partHeader["Content-Type"] = []string{contentType}
+	part, err := mw.CreatePart(partHeader)
+	require.NoError(t, err)
+	_, err = part.Write([]byte(content))
+	require.NoError(t, err)
+	require.NoError(t, mw.Close())
+
+	req := httptest.NewRequest(http.MethodPost, "/upload", &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return req
+}
+
+func TestHandler(t *testing.T) {
+	store := memory.NewFilestore()
+	handler := upload.Handler(store, upload.WithMaxSize(1024), upload.WithAllowedContentTypes("image/*", "text/plain"))
+
+	t.Run("multipart", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, multipartRequest(t, "file", "hello.txt", "application/octet-stream", "Hello World"))
+
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.JSONEq(t, `{"hash":"a591a6d40bf420404a011733cfb7b190d62c65bf0bcda32b57b277d9ad9f146e","size":11,"contentType":"text/plain; charset=utf-8","filename":"hello.txt"}`, rec.Body.String())
+	})
+
+	t.Run("body", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPut, "/upload", strings.NewReader("\x89PNG\r\n\x1a\nPNG content"))
+		req.Header.Set("Content-Disposition", `attachment; filename="image.png"`)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusCreated, rec.Code)
+		assert.Contains(t, rec.Body.String(), `"contentType":"image/png","filename":"image.png"`)
+	})
+
+	t.Run("content type not allowed", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPut, "/upload", strings.NewReader("%PDF-1.4 content"))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusUnsupportedMediaType, rec.Code)
+	})
+
+	t.Run("too large", func(t *testing.T) {
+		req := httptest.NewRequest(http.MethodPut, "/upload", strings.NewReader(strings.Repeat("a", 2048)))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	})
+}
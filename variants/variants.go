@@ -0,0 +1,223 @@
+// Package variants pre-generates image variants (e.g. thumbnails) when images are stored and keeps them in a cache
+// store, so the first view of an image does not include resizing on the fly.
+//
+// Variants are generated by a Generator, either by imgproxy (see ImgproxyGenerator) or with a local resizer
+// (see ResizeGenerator). A Pipeline generates the variants of enqueued images in the background, e.g. for every
+// image stored with an imaging.Filestore:
+//
+//	pipeline := variants.NewPipeline(cacheStore, variants.ResizeGenerator(store), []variants.Variant{
+//		{Name: "thumb", Params: imgproxy.Parameters{Resize: imgproxy.ResizingTypeFill, Width: 200, Height: 200}},
+//	})
+//	go pipeline.Run(ctx)
+//	store := imaging.NewFilestore(store, pipeline.OnAnalyzed)
+package variants
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"sync"
+
+	"github.com/hashicorp/go-multierror"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/hashing"
+	"github.com/networkteam/filestore/imaging"
+	"github.com/networkteam/filestore/imgproxy"
+)
+
+const (
+	// DefaultWorkers is the default number of images processed concurrently by Run.
+	DefaultWorkers = 2
+	// DefaultQueueSize is the default number of images that can be enqueued before they are processed.
+	DefaultQueueSize = 1000
+)
+
+// ErrUnknownVariant is returned by Pipeline.Fetch for a variant name that is not configured.
+var ErrUnknownVariant = errors.New("unknown variant")
+
+// A Variant is a named set of processing parameters. The name identifies the variant in the cache, so it must be
+// changed if the parameters change (e.g. "thumb-v2"), otherwise previously generated variants are returned.
+type Variant struct {
+	Name   string
+	Params imgproxy.Parameters
+}
+
+// Key returns the key of the variant with the given name of an image in the cache store. It is a hash of the image
+// hash and the name, so it is valid for all stores.
+func Key(hash, name string) string {
+	return hashing.HashBytes([]byte(hash + "/" + name))
+}
+
+// Pipeline generates the variants of images in the background and stores them in a cache store.
+type Pipeline struct {
+	cache     filestore.FileStore
+	generator Generator
+	variants  []Variant
+	queue     chan string
+	workers   int
+	onError   func(hash string, variant Variant, err error)
+}
+
+type options struct {
+	workers   int
+	queueSize int
+	onError   func(hash string, variant Variant, err error)
+}
+
+// Option is a functional option for creating a pipeline.
+type Option func(*options)
+
+// WithWorkers sets the number of images processed concurrently by Run (defaults to DefaultWorkers).
+func WithWorkers(workers int) Option {
+	return func(opts *options) {
+		opts.workers = workers
+	}
+}
+
+// WithQueueSize sets the number of images that can be enqueued before they are processed
+// (defaults to DefaultQueueSize).
+func WithQueueSize(queueSize int) Option {
+	return func(opts *options) {
+		opts.queueSize = queueSize
+	}
+}
+
+// WithErrorHandler sets a function that is called if a variant could not be generated in the background
+// (e.g. to log the error). Failed variants are generated again on demand by Fetch.
+func WithErrorHandler(onError func(hash string, variant Variant, err error)) Option {
+	return func(opts *options) {
+		opts.onError = onError
+	}
+}
+
+// NewPipeline creates a pipeline that generates the variants with generator and stores them in cache.
+func NewPipeline(cache filestore.FileStore, generator Generator, variants []Variant, opts ...Option) *Pipeline {
+	o := options{
+		workers:   DefaultWorkers,
+		queueSize: DefaultQueueSize,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return &Pipeline{
+		cache:     cache,
+		generator: generator,
+		variants:  variants,
+		queue:     make(chan string, o.queueSize),
+		workers:   o.workers,
+		onError:   o.onError,
+	}
+}
+
+// Enqueue adds an image to the queue for generating its variants and returns false if the queue is full.
+// The queue is not durable, variants of images that were not processed are generated on demand by Fetch.
+func (p *Pipeline) Enqueue(hash string) bool {
+	select {
+	case p.queue <- hash:
+		return true
+	default:
+		return false
+	}
+}
+
+// OnAnalyzed enqueues a stored image, it can be passed to imaging.NewFilestore.
+func (p *Pipeline) OnAnalyzed(ctx context.Context, result imaging.Result) {
+	p.Enqueue(result.Hash)
+}
+
+// Run generates the variants of enqueued images until ctx is cancelled and returns the error of the context.
+func (p *Pipeline) Run(ctx context.Context) error {
+	var wg sync.WaitGroup
+	for i := 0; i < p.workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case hash := <-p.queue:
+					p.generateAll(ctx, hash)
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	return ctx.Err()
+}
+
+// Generate generates all variants of an image that are not cached yet (e.g. to backfill existing images).
+func (p *Pipeline) Generate(ctx context.Context, hash string) error {
+	var result error
+	for _, variant := range p.variants {
+		if err := p.generateIfMissing(ctx, hash, variant); err != nil {
+			result = multierror.Append(result, err)
+		}
+	}
+	return result
+}
+
+// Fetch fetches a variant of an image by name from the cache. A variant that was not generated yet is generated
+// on demand.
+func (p *Pipeline) Fetch(ctx context.Context, hash, name string) (io.ReadCloser, error) {
+	variant, ok := p.variant(name)
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownVariant, name)
+	}
+
+	r, err := p.cache.Fetch(ctx, Key(hash, name))
+	if !errors.Is(err, filestore.ErrNotExist) {
+		return r, err
+	}
+
+	if err = p.generate(ctx, hash, variant); err != nil {
+		return nil, err
+	}
+	return p.cache.Fetch(ctx, Key(hash, name))
+}
+
+func (p *Pipeline) generateAll(ctx context.Context, hash string) {
+	for _, variant := range p.variants {
+		if err := p.generateIfMissing(ctx, hash, variant); err != nil && p.onError != nil {
+			p.onError(hash, variant, err)
+		}
+	}
+}
+
+func (p *Pipeline) generateIfMissing(ctx context.Context, hash string, variant Variant) error {
+	exists, err := p.cache.Exists(ctx, Key(hash, variant.Name))
+	if err != nil {
+		return fmt.Errorf("checking variant %s of %s: %w", variant.Name, hash, err)
+	}
+	if exists {
+		return nil
+	}
+	return p.generate(ctx, hash, variant)
+}
+
+// generate generates a variant and stores it in the cache.
+func (p *Pipeline) generate(ctx context.Context, hash string, variant Variant) error {
+	rc, err := p.generator.Generate(ctx, hash, variant)
+	if err != nil {
+		return fmt.Errorf("generating variant %s of %s: %w", variant.Name, hash, err)
+	}
+	defer rc.Close()
+
+	if err = p.cache.StoreHashed(ctx, rc, Key(hash, variant.Name)); err != nil {
+		return fmt.Errorf("storing variant %s of %s: %w", variant.Name, hash, err)
+	}
+	return nil
+}
+
+func (p *Pipeline) variant(name string) (Variant, bool) {
+	for _, variant := range p.variants {
+		if variant.Name == name {
+			return variant, true
+		}
+	}
+	return Variant{}, false
+}
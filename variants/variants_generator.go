@@ -0,0 +1,233 @@
+package variants
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"math"
+	"net/http"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/imaging"
+	"github.com/networkteam/filestore/imgproxy"
+)
+
+// ErrUnexpectedStatus is returned by the imgproxy generator if the response status is not 200 OK.
+var ErrUnexpectedStatus = errors.New("unexpected response status")
+
+// ErrTooManyPixels is returned by the resize generator if an image has more pixels than allowed (see WithMaxPixels).
+var ErrTooManyPixels = errors.New("image has too many pixels")
+
+// A Generator generates the content of a variant of an image. The returned reader can implement
+// filestore.ContentTyped to set the content type of the cached variant.
+type Generator interface {
+	Generate(ctx context.Context, hash string, variant Variant) (io.ReadCloser, error)
+}
+
+// GeneratorFunc adapts a function to a Generator.
+type GeneratorFunc func(ctx context.Context, hash string, variant Variant) (io.ReadCloser, error)
+
+// Generate calls f(ctx, hash, variant).
+func (f GeneratorFunc) Generate(ctx context.Context, hash string, variant Variant) (io.ReadCloser, error) {
+	return f(ctx, hash, variant)
+}
+
+// ImgproxyGenerator returns a generator that requests variants from imgproxy with the parameters of the variant.
+// The source URL of the image is returned by sourcer (usually the store of the image). If client is nil,
+// http.DefaultClient is used.
+func ImgproxyGenerator(service *imgproxy.Service, sourcer filestore.ImgproxyURLSourcer, client *http.Client) Generator {
+	if client == nil {
+		client = http.DefaultClient
+	}
+
+	return GeneratorFunc(func(ctx context.Context, hash string, variant Variant) (io.ReadCloser, error) {
+		source, err := sourcer.ImgproxyURLSource(hash)
+		if err != nil {
+			return nil, fmt.Errorf("getting imgproxy source: %w", err)
+		}
+		imageURL, err := service.ImageURL(source, variant.Params)
+		if err != nil {
+			return nil, fmt.Errorf("building image URL: %w", err)
+		}
+
+		req, err := http.NewRequestWithContext(ctx, http.MethodGet, imageURL, nil)
+		if err != nil {
+			return nil, fmt.Errorf("creating request: %w", err)
+		}
+		resp, err := client.Do(req)
+		if err != nil {
+			return nil, fmt.Errorf("requesting image: %w", err)
+		}
+		if resp.StatusCode != http.StatusOK {
+			_ = resp.Body.Close()
+			return nil, fmt.Errorf("%w: %s", ErrUnexpectedStatus, resp.Status)
+		}
+
+		return &typedReadCloser{ReadCloser: resp.Body, contentType: resp.Header.Get("Content-Type")}, nil
+	})
+}
+
+type resizeOptions struct {
+	maxPixels int64
+}
+
+// ResizeOption is a functional option for the resize generator.
+type ResizeOption func(*resizeOptions)
+
+// WithMaxPixels sets the maximum number of pixels (width * height) of images that are decoded for resizing
+// (defaults to imaging.DefaultMaxPixels). Decoding needs memory for every pixel, so larger images (or images declaring
+// huge dimensions in their header) are rejected with ErrTooManyPixels before decoding.
+func WithMaxPixels(maxPixels int64) ResizeOption {
+	return func(opts *resizeOptions) {
+		opts.maxPixels = maxPixels
+	}
+}
+
+// ResizeGenerator returns a generator that resizes images fetched from store without an external service.
+// Only the resizing parameters (Resize, Width, Height, Enlarge and DPR) and Format ("png", otherwise JPEG) and
+// Quality are applied: ResizingTypeFill crops the image to fill the dimensions, all other types fit the image into
+// the dimensions.
+// The EXIF orientation is not applied.
+func ResizeGenerator(store filestore.Fetcher, opts ...ResizeOption) Generator {
+	o := resizeOptions{
+		maxPixels: imaging.DefaultMaxPixels,
+	}
+	for _, opt := range opts {
+		opt(&o)
+	}
+
+	return GeneratorFunc(func(ctx context.Context, hash string, variant Variant) (io.ReadCloser, error) {
+		rc, err := store.Fetch(ctx, hash)
+		if err != nil {
+			return nil, err
+		}
+		img, err := decode(rc, o.maxPixels)
+		_ = rc.Close()
+		if err != nil {
+			return nil, err
+		}
+
+		resized := resize(img, variant.Params)
+
+		var (
+			buf         bytes.Buffer
+			contentType string
+		)
+		if variant.Params.Format == "png" {
+			contentType = "image/png"
+			err = png.Encode(&buf, resized)
+		} else {
+			contentType = "image/jpeg"
+			quality := variant.Params.Quality
+			if quality <= 0 {
+				quality = jpeg.DefaultQuality
+			}
+			err = jpeg.Encode(&buf, resized, &jpeg.Options{Quality: quality})
+		}
+		if err != nil {
+			return nil, fmt.Errorf("encoding image: %w", err)
+		}
+
+		return &sizedTypedReadCloser{
+			typedReadCloser: &typedReadCloser{ReadCloser: io.NopCloser(&buf), contentType: contentType},
+			size:            int64(buf.Len()),
+		}, nil
+	})
+}
+
+// decode decodes an image after checking the number of pixels declared in its header against maxPixels.
+func decode(r io.Reader, maxPixels int64) (image.Image, error) {
+	// The header read for the config is decoded again
+	var head bytes.Buffer
+	config, _, err := image.DecodeConfig(io.TeeReader(r, &head))
+	if err != nil {
+		return nil, fmt.Errorf("decoding image config: %w", err)
+	}
+	if int64(config.Width)*int64(config.Height) > maxPixels {
+		return nil, fmt.Errorf("%w: %dx%d", ErrTooManyPixels, config.Width, config.Height)
+	}
+
+	img, _, err := image.Decode(io.MultiReader(&head, r))
+	if err != nil {
+		return nil, fmt.Errorf("decoding image: %w", err)
+	}
+	return img, nil
+}
+
+// resize resizes img according to the resizing parameters.
+func resize(img image.Image, params imgproxy.Parameters) image.Image {
+	bounds := img.Bounds()
+	srcWidth, srcHeight := float64(bounds.Dx()), float64(bounds.Dy())
+
+	dpr := params.DPR
+	if dpr <= 0 {
+		dpr = 1
+	}
+	width, height := float64(params.Width)*dpr, float64(params.Height)*dpr
+	if width == 0 && height == 0 {
+		return img
+	}
+
+	scaleX, scaleY := width/srcWidth, height/srcHeight
+	switch {
+	case width == 0:
+		scaleX = scaleY
+	case height == 0:
+		scaleY = scaleX
+	}
+
+	if params.Resize == imgproxy.ResizingTypeFill && width > 0 && height > 0 {
+		// Crop the center of the image to the aspect ratio of the dimensions
+		scale := math.Max(scaleX, scaleY)
+		cropWidth, cropHeight := math.Min(srcWidth, width/scale), math.Min(srcHeight, height/scale)
+		x0 := bounds.Min.X + int((srcWidth-cropWidth)/2)
+		y0 := bounds.Min.Y + int((srcHeight-cropHeight)/2)
+		cropRect := image.Rect(x0, y0, x0+round(cropWidth), y0+round(cropHeight))
+		return imaging.Resize(subImage(img, cropRect), round(width), round(height))
+	}
+
+	scale := math.Min(scaleX, scaleY)
+	if scale > 1 && !params.Enlarge {
+		return img
+	}
+	return imaging.Resize(img, round(srcWidth*scale), round(srcHeight*scale))
+}
+
+// subImage returns the part of img within rect.
+func subImage(img image.Image, rect image.Rectangle) image.Image {
+	if s, ok := img.(interface {
+		SubImage(r image.Rectangle) image.Image
+	}); ok {
+		return s.SubImage(rect)
+	}
+	return img
+}
+
+func round(f float64) int {
+	return int(math.Round(f))
+}
+
+// typedReadCloser is a generated variant with a content type.
+type typedReadCloser struct {
+	io.ReadCloser
+	contentType string
+}
+
+func (r *typedReadCloser) ContentType() string {
+	return r.contentType
+}
+
+// sizedTypedReadCloser is a generated variant with a content type and a known size.
+type sizedTypedReadCloser struct {
+	*typedReadCloser
+	size int64
+}
+
+func (r *sizedTypedReadCloser) Size() int64 {
+	return r.size
+}
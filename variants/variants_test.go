@@ -0,0 +1,157 @@
+package variants_test
+
+import (
+	"bytes"
+	"context"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/imaging"
+	"github.com/networkteam/filestore/imgproxy"
+	"github.com/networkteam/filestore/memory"
+	"github.com/networkteam/filestore/variants"
+)
+
+var testVariants = []variants.Variant{
+	{Name: "square", Params: imgproxy.Parameters{Resize: imgproxy.ResizingTypeFill, Width: 50, Height: 50, Format: "png"}},
+	{Name: "small", Params: imgproxy.Parameters{Resize: imgproxy.ResizingTypeFit, Width: 100, Height: 100}},
+}
+
+func TestPipeline(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewFilestore()
+	cache := memory.NewFilestore()
+
+	pipeline := variants.NewPipeline(cache, variants.ResizeGenerator(store), testVariants)
+	runPipeline(t, pipeline)
+
+	hash, err := imaging.NewFilestore(store, pipeline.OnAnalyzed).Store(ctx, bytes.NewReader(pngImage(t, 200, 100)))
+	require.NoError(t, err)
+
+	require.Eventually(t, func() bool {
+		exists, err := cache.Exists(ctx, variants.Key(hash, "small"))
+		require.NoError(t, err)
+		return exists
+	}, 5*time.Second, time.Millisecond)
+
+	info, err := cache.Stat(ctx, variants.Key(hash, "square"))
+	require.NoError(t, err)
+	assert.Equal(t, "image/png", info.ContentType)
+
+	assertDimensions(t, pipeline, hash, "square", 50, 50)
+	assertDimensions(t, pipeline, hash, "small", 100, 50)
+
+	_, err = pipeline.Fetch(ctx, hash, "huge")
+	assert.ErrorIs(t, err, variants.ErrUnknownVariant)
+}
+
+func TestPipeline_FetchOnDemand(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewFilestore()
+	cache := memory.NewFilestore()
+
+	hash, err := store.Store(ctx, bytes.NewReader(pngImage(t, 80, 160)))
+	require.NoError(t, err)
+
+	pipeline := variants.NewPipeline(cache, variants.ResizeGenerator(store), testVariants)
+	assertDimensions(t, pipeline, hash, "small", 50, 100)
+
+	_, err = pipeline.Fetch(ctx, "a0b1c2d3e4f5", "small")
+	assert.ErrorIs(t, err, filestore.ErrNotExist)
+}
+
+func TestResizeGenerator_MaxPixels(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewFilestore()
+
+	hash, err := store.Store(ctx, bytes.NewReader(pngImage(t, 200, 100)))
+	require.NoError(t, err)
+
+	_, err = variants.ResizeGenerator(store, variants.WithMaxPixels(199*100)).Generate(ctx, hash, testVariants[1])
+	assert.ErrorIs(t, err, variants.ErrTooManyPixels)
+
+	rc, err := variants.ResizeGenerator(store, variants.WithMaxPixels(200*100)).Generate(ctx, hash, testVariants[1])
+	require.NoError(t, err)
+	_ = rc.Close()
+}
+
+func TestImgproxyGenerator(t *testing.T) {
+	ctx := context.Background()
+
+	var requestedPath string
+	ts := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requestedPath = r.URL.Path
+		w.Header().Set("Content-Type", "image/webp")
+		_, _ = w.Write([]byte("variant"))
+	}))
+	defer ts.Close()
+
+	service, err := imgproxy.NewService(ts.URL)
+	require.NoError(t, err)
+	store := memory.NewFilestore()
+	cache := memory.NewFilestore()
+
+	pipeline := variants.NewPipeline(cache, variants.ImgproxyGenerator(service, store, nil), []variants.Variant{
+		{Name: "webp", Params: imgproxy.Parameters{Width: 300, Format: "webp"}},
+	})
+	require.NoError(t, pipeline.Generate(ctx, "a0b1c2d3e4f5"))
+	assert.Contains(t, requestedPath, "resize:auto:300:0")
+
+	info, err := cache.Stat(ctx, variants.Key("a0b1c2d3e4f5", "webp"))
+	require.NoError(t, err)
+	assert.Equal(t, "image/webp", info.ContentType)
+	assert.Equal(t, int64(len("variant")), info.Size)
+}
+
+func runPipeline(t *testing.T, pipeline *variants.Pipeline) {
+	t.Helper()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error)
+	go func() {
+		done <- pipeline.Run(ctx)
+	}()
+	t.Cleanup(func() {
+		cancel()
+		assert.ErrorIs(t, <-done, context.Canceled)
+	})
+}
+
+func assertDimensions(t *testing.T, pipeline *variants.Pipeline, hash, name string, width, height int) {
+	t.Helper()
+
+	rc, err := pipeline.Fetch(context.Background(), hash, name)
+	require.NoError(t, err)
+	defer rc.Close()
+	content, err := io.ReadAll(rc)
+	require.NoError(t, err)
+
+	config, _, err := image.DecodeConfig(bytes.NewReader(content))
+	require.NoError(t, err)
+	assert.Equal(t, width, config.Width)
+	assert.Equal(t, height, config.Height)
+}
+
+func pngImage(t *testing.T, width, height int) []byte {
+	t.Helper()
+
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	for y := 0; y < height; y++ {
+		for x := 0; x < width; x++ {
+			img.Set(x, y, color.RGBA{G: 255, A: 255})
+		}
+	}
+	var buf bytes.Buffer
+	require.NoError(t, png.Encode(&buf, img))
+	return buf.Bytes()
+}
@@ -0,0 +1,124 @@
+package filestore
+
+import (
+	"archive/zip"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// ZipEntry is a file of a zip archive written by WriteZip.
+type ZipEntry struct {
+	// Hash of the stored file.
+	Hash string
+	// Name is the path of the file in the archive (e.g. "attachments/report.pdf").
+	Name string
+	// Modified is the modification time of the file in the archive (optional).
+	Modified time.Time
+}
+
+// WriteZip writes a zip archive with the given entries to w. The content of each entry is fetched from store and
+// streamed to w one after another, so memory usage does not depend on the size of the files.
+// Names are cleaned to relative paths and made unique by adding a counter (e.g. "report (1).pdf").
+func WriteZip(ctx context.Context, w io.Writer, store Fetcher, entries []ZipEntry) error {
+	zw := zip.NewWriter(w)
+
+	names := make(map[string]struct{}, len(entries))
+	for _, entry := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+
+		name := uniqueName(zipName(entry.Name, entry.Hash), names)
+		if err := writeZipEntry(ctx, zw, store, entry, name); err != nil {
+			return err
+		}
+	}
+
+	if err := zw.Close(); err != nil {
+		return fmt.Errorf("closing zip archive: %w", err)
+	}
+	return nil
+}
+
+func writeZipEntry(ctx context.Context, zw *zip.Writer, store Fetcher, entry ZipEntry, name string) error {
+	r, err := store.Fetch(ctx, entry.Hash)
+	if err != nil {
+		return fmt.Errorf("fetching %s: %w", entry.Hash, err)
+	}
+	defer r.Close()
+
+	fw, err := zw.CreateHeader(&zip.FileHeader{
+		Name:     name,
+		Method:   zip.Deflate,
+		Modified: entry.Modified,
+	})
+	if err != nil {
+		return fmt.Errorf("creating zip entry %q: %w", name, err)
+	}
+	if _, err = Copy(fw, r); err != nil {
+		return fmt.Errorf("writing zip entry %q: %w", name, err)
+	}
+	return nil
+}
+
+// zipName returns a clean relative path for name or the hash if name is empty.
+func zipName(name, hash string) string {
+	name = strings.TrimPrefix(path.Clean("/"+strings.ReplaceAll(name, `\`, "/")), "/")
+	if name == "" {
+		return hash
+	}
+	return name
+}
+
+// uniqueName returns name or name with a counter before the extension if it was already used.
+func uniqueName(name string, names map[string]struct{}) string {
+	unique := name
+	ext := path.Ext(name)
+	for i := 1; ; i++ {
+		if _, exists := names[unique]; !exists {
+			break
+		}
+		unique = fmt.Sprintf("%s (%d)%s", strings.TrimSuffix(name, ext), i, ext)
+	}
+	names[unique] = struct{}{}
+	return unique
+}
+
+// ServeZip responds with a zip archive of the given entries as an attachment with the given filename (see WriteZip).
+// If the first file cannot be fetched, an error status is sent (404 Not Found for filestore.ErrNotExist).
+// Errors after the response was started cannot be reported to the client (the archive is truncated),
+// so they are returned, e.g. for logging.
+func ServeZip(w http.ResponseWriter, r *http.Request, store Fetcher, filename string, entries []ZipEntry) error {
+	zw := &zipResponseWriter{ResponseWriter: w, filename: filename}
+	err := WriteZip(r.Context(), zw, store, entries)
+	if err != nil && !zw.started {
+		status := http.StatusInternalServerError
+		if errors.Is(err, ErrNotExist) {
+			status = http.StatusNotFound
+		}
+		http.Error(w, http.StatusText(status), status)
+	}
+	return err
+}
+
+// zipResponseWriter sets the response headers of a zip archive when the first bytes are written.
+type zipResponseWriter struct {
+	http.ResponseWriter
+	filename string
+	started  bool
+}
+
+func (w *zipResponseWriter) Write(p []byte) (int, error) {
+	if !w.started {
+		w.started = true
+		w.Header().Set("Content-Type", "application/zip")
+		w.Header().Set("Content-Disposition", ContentDisposition("attachment", w.filename))
+	}
+	return w.ResponseWriter.Write(p)
+}
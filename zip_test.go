@@ -0,0 +1,92 @@
+package filestore_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/networkteam/filestore"
+	"github.com/networkteam/filestore/memory"
+)
+
+func TestWriteZip(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewFilestore()
+
+	hash1, err := store.Store(ctx, strings.NewReader("First content"))
+	require.NoError(t, err)
+	hash2, err := store.Store(ctx, strings.NewReader("Second content"))
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	err = filestore.WriteZip(ctx, &buf, store, []filestore.ZipEntry{
+		{Hash: hash1, Name: "docs/report.pdf"},
+		{Hash: hash2, Name: "docs/report.pdf"},
+		{Hash: hash1, Name: "../../etc/passwd"},
+		{Hash: hash2},
+	})
+	require.NoError(t, err)
+
+	assert.Equal(t, map[string]string{
+		"docs/report.pdf":     "First content",
+		"docs/report (1).pdf": "Second content",
+		"etc/passwd":          "First content",
+		hash2:                 "Second content",
+	}, readZip(t, buf.Bytes()))
+}
+
+func TestServeZip(t *testing.T) {
+	ctx := context.Background()
+	store := memory.NewFilestore()
+
+	hash, err := store.Store(ctx, strings.NewReader("Content"))
+	require.NoError(t, err)
+
+	t.Run("existing files", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/attachments.zip", nil)
+		err := filestore.ServeZip(rec, req, store, "attachments.zip", []filestore.ZipEntry{{Hash: hash, Name: "file.txt"}})
+		require.NoError(t, err)
+
+		assert.Equal(t, http.StatusOK, rec.Code)
+		assert.Equal(t, "application/zip", rec.Header().Get("Content-Type"))
+		assert.Equal(t, `attachment; filename="attachments.zip"`, rec.Header().Get("Content-Disposition"))
+		assert.Equal(t, map[string]string{"file.txt": "Content"}, readZip(t, rec.Body.Bytes()))
+	})
+
+	t.Run("missing file", func(t *testing.T) {
+		rec := httptest.NewRecorder()
+		req := httptest.NewRequest(http.MethodGet, "/attachments.zip", nil)
+		err := filestore.ServeZip(rec, req, store, "attachments.zip", []filestore.ZipEntry{{Hash: "a0b1c2d3e4f5", Name: "file.txt"}})
+		require.ErrorIs(t, err, filestore.ErrNotExist)
+
+		assert.Equal(t, http.StatusNotFound, rec.Code)
+		assert.Empty(t, rec.Header().Get("Content-Disposition"))
+	})
+}
+
+func readZip(t *testing.T, data []byte) map[string]string {
+	t.Helper()
+
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	require.NoError(t, err)
+
+	files := make(map[string]string)
+	for _, f := range zr.File {
+		r, err := f.Open()
+		require.NoError(t, err)
+		content, err := io.ReadAll(r)
+		require.NoError(t, err)
+		_ = r.Close()
+		files[f.Name] = string(content)
+	}
+	return files
+}